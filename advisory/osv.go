@@ -0,0 +1,172 @@
+// Package advisory reads vulnerability advisories in the OSV format and rescans the images of the package inventory
+// they affect.
+package advisory
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+)
+
+// Advisory is a vulnerability in the OSV format, see https://ossf.github.io/osv-schema/.
+// Only the fields needed to find the affected packages are decoded.
+type Advisory struct {
+	ID       string    `json:"id"`
+	Modified time.Time `json:"modified"`
+	// Withdrawn is set if the advisory was retracted.
+	Withdrawn *time.Time `json:"withdrawn,omitempty"`
+	Aliases   []string   `json:"aliases,omitempty"`
+	Summary   string     `json:"summary,omitempty"`
+	Affected  []Affected `json:"affected,omitempty"`
+}
+
+// Affected lists the affected versions of a package.
+type Affected struct {
+	Package Package `json:"package"`
+	Ranges  []Range `json:"ranges,omitempty"`
+	// Versions are affected in addition to the ranges.
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Package is identified by ecosystem and name, or by its package URL.
+type Package struct {
+	// Ecosystem may include a release, like Debian:12.
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	PURL      string `json:"purl,omitempty"`
+}
+
+// Range is a sequence of events introducing and fixing a vulnerability.
+type Range struct {
+	// Type is SEMVER, ECOSYSTEM or GIT. GIT ranges list commits and never match a package version.
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event sets exactly one of its fields.
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+func (e Event) version() string {
+	return e.Introduced + e.Fixed + e.LastAffected + e.Limit
+}
+
+// Parse decodes a single advisory or a list of them.
+func Parse(data []byte) ([]Advisory, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var advisories []Advisory
+		if err := json.Unmarshal(data, &advisories); err != nil {
+			return nil, err
+		}
+		return advisories, nil
+	}
+	var a Advisory
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	return []Advisory{a}, nil
+}
+
+// Contains reports whether version is affected.
+func (a Affected) Contains(version string) bool {
+	for _, v := range a.Versions {
+		if inventory.CompareVersions(v, version) == 0 {
+			return true
+		}
+	}
+	for _, r := range a.Ranges {
+		if r.contains(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains evaluates the events in version order, as described by the OSV schema.
+func (r Range) contains(version string) bool {
+	if r.Type == "GIT" {
+		return false
+	}
+	events := slices.Clone(r.Events)
+	slices.SortStableFunc(events, func(a, b Event) int {
+		// introduced 0 is before all versions
+		switch {
+		case a.Introduced == "0" && b.Introduced == "0":
+			return 0
+		case a.Introduced == "0":
+			return -1
+		case b.Introduced == "0":
+			return 1
+		}
+		return inventory.CompareVersions(a.version(), b.version())
+	})
+	affected := false
+	for _, e := range events {
+		switch {
+		case e.Introduced != "":
+			if e.Introduced == "0" || inventory.CompareVersions(version, e.Introduced) >= 0 {
+				affected = true
+			}
+		case e.Fixed != "":
+			if inventory.CompareVersions(version, e.Fixed) >= 0 {
+				affected = false
+			}
+		case e.LastAffected != "":
+			if inventory.CompareVersions(version, e.LastAffected) > 0 {
+				affected = false
+			}
+		case e.Limit != "" && e.Limit != "*":
+			if inventory.CompareVersions(version, e.Limit) >= 0 {
+				affected = false
+			}
+		}
+	}
+	return affected
+}
+
+// query returns the inventory query of the package, ignoring the release of its ecosystem.
+func (p Package) query() (inventory.Query, bool) {
+	q := inventory.Query{Name: p.Name, Ecosystem: p.Ecosystem}
+	if q.Name == "" && p.PURL != "" {
+		pkg, err := inventory.ParsePURL(p.PURL)
+		if err != nil {
+			return inventory.Query{}, false
+		}
+		q.Name, q.Ecosystem = pkg.Name, pkg.Ecosystem
+	}
+	q.Ecosystem, _, _ = strings.Cut(q.Ecosystem, ":")
+	if q.Ecosystem == "PyPI" {
+		// package URLs use the normalized names of python packages
+		q.Name = strings.ReplaceAll(strings.ToLower(q.Name), "_", "-")
+	}
+	return q, q.Name != ""
+}
+
+// Match returns the digests in the inventory containing an affected version. Withdrawn advisories match nothing.
+func (a Advisory) Match(i *inventory.Index) []inventory.Match {
+	if a.Withdrawn != nil {
+		return nil
+	}
+	var matches []inventory.Match
+	for _, affected := range a.Affected {
+		q, ok := affected.Package.query()
+		if !ok {
+			continue
+		}
+		for _, m := range i.Find(q) {
+			if affected.Contains(m.Package.Version) {
+				matches = append(matches, m)
+			}
+		}
+	}
+	return matches
+}
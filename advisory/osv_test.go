@@ -0,0 +1,100 @@
+package advisory
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+var _ = DescribeTable("Affected.Contains", func(ranges []Range, versions []string, version string, expected bool) {
+	Expect(Affected{Ranges: ranges, Versions: versions}.Contains(version)).To(Equal(expected))
+},
+	Entry("introduced 0", []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "0"}, {Fixed: "3.0.12"}}}}, nil, "3.0.11-1~deb12u2", true),
+	Entry("fixed", []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "0"}, {Fixed: "3.0.12"}}}}, nil, "3.0.12", false),
+	Entry("before introduced", []Range{{Type: "SEMVER", Events: []Event{{Introduced: "2.0.0"}, {Fixed: "2.15.0"}}}}, nil, "1.2.17", false),
+	Entry("go module with v prefix", []Range{{Type: "SEMVER", Events: []Event{{Introduced: "0"}, {Fixed: "0.17.0"}}}}, nil, "v0.15.0", true),
+	Entry("second range", []Range{{Type: "ECOSYSTEM", Events: []Event{{Fixed: "1.5"}, {Introduced: "2.0"}, {Introduced: "1.0"}}}}, nil, "2.1", true),
+	Entry("between ranges", []Range{{Type: "ECOSYSTEM", Events: []Event{{Fixed: "1.5"}, {Introduced: "2.0"}, {Introduced: "1.0"}}}}, nil, "1.7", false),
+	Entry("last affected", []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "1.0"}, {LastAffected: "1.4"}}}}, nil, "1.4", true),
+	Entry("after last affected", []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "1.0"}, {LastAffected: "1.4"}}}}, nil, "1.4.1", false),
+	Entry("git ranges", []Range{{Type: "GIT", Events: []Event{{Introduced: "0"}}}}, nil, "1.0", false),
+	Entry("listed version", nil, []string{"2.14.0", "2.14.1"}, "2.14.1", true),
+)
+
+var _ = Describe("Parse", func() {
+	It("should decode single advisories and lists", func() {
+		advisories, err := Parse([]byte(`{"id": "DSA-5532-1", "modified": "2023-10-24T00:00:00Z"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(advisories).To(ConsistOf(Advisory{ID: "DSA-5532-1", Modified: time.Date(2023, 10, 24, 0, 0, 0, 0, time.UTC)}))
+
+		advisories, err = Parse([]byte(` [{"id": "a"}, {"id": "b"}]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(advisories).To(HaveLen(2))
+
+		_, err = Parse([]byte(`{"id": 1}`))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Match", func() {
+	var index *inventory.Index
+	app := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/app", Tag: "v1", Digest: digest.FromString("app")}
+	api := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/api", Tag: "v1", Digest: digest.FromString("api")}
+
+	BeforeEach(func() {
+		index = inventory.NewIndex(0)
+		index.Add(app, []inventory.Package{
+			{Name: "openssl", Version: "3.0.11-1~deb12u1", Ecosystem: "Debian"},
+			{Name: "requests", Version: "2.30.0", Ecosystem: "PyPI"},
+		})
+		index.Add(api, []inventory.Package{{Name: "openssl", Version: "3.0.13-1~deb12u1", Ecosystem: "Debian"}})
+	})
+
+	It("should find the digests with affected versions of the ecosystem", func() {
+		a := Advisory{ID: "DSA-5532-1", Affected: []Affected{{
+			Package: Package{Ecosystem: "Debian:12", Name: "openssl"},
+			Ranges:  []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "0"}, {Fixed: "3.0.11-1~deb12u2"}}}},
+		}, {
+			Package: Package{Ecosystem: "Alpine:v3.18", Name: "openssl"},
+			Ranges:  []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "0"}}}},
+		}}}
+		Expect(a.Match(index)).To(ConsistOf(HaveField("Digest", app.Digest)))
+	})
+
+	It("should match normalized python package names and package URLs", func() {
+		affected := []Affected{{
+			Package: Package{Ecosystem: "PyPI", Name: "Requests"},
+			Ranges:  []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "2.3.0"}, {Fixed: "2.31.0"}}}},
+		}, {
+			Package:  Package{PURL: "pkg:deb/debian/openssl"},
+			Versions: []string{"3.0.13-1~deb12u1"},
+		}}
+		Expect(Advisory{ID: "GHSA-j8r2-6x86-q33q", Affected: affected}.Match(index)).To(ConsistOf(
+			HaveField("Digest", app.Digest),
+			HaveField("Digest", api.Digest),
+		))
+	})
+
+	It("should match the binary packages of a source package", func() {
+		slim := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/slim", Tag: "v1", Digest: digest.FromString("slim")}
+		index.Add(slim, []inventory.Package{{Name: "libssl3", Version: "3.0.11-1~deb12u1", Ecosystem: "Debian", Source: "openssl"}})
+		a := Advisory{ID: "DSA-5532-1", Affected: []Affected{{
+			Package: Package{Ecosystem: "Debian:12", Name: "openssl"},
+			Ranges:  []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "0"}, {Fixed: "3.0.11-1~deb12u2"}}}},
+		}}}
+		Expect(a.Match(index)).To(ConsistOf(HaveField("Digest", app.Digest), HaveField("Digest", slim.Digest)))
+	})
+
+	It("should not match withdrawn advisories", func() {
+		withdrawn := time.Now()
+		a := Advisory{ID: "DSA-5532-1", Withdrawn: &withdrawn, Affected: []Affected{{
+			Package: Package{Ecosystem: "Debian", Name: "openssl"},
+			Ranges:  []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "0"}}}},
+		}}}
+		Expect(a.Match(index)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,87 @@
+package advisory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Source is a feed of advisories. Advisories returns all advisories it could read,
+// and an error for those it couldn't.
+type Source interface {
+	Advisories(ctx context.Context) ([]Advisory, error)
+}
+
+// DirSource reads the .json files in Dir and its subdirectories, like an extracted OSV export.
+// Each file holds one advisory or a list of them.
+type DirSource struct {
+	Dir string
+}
+
+func (s *DirSource) Advisories(_ context.Context) ([]Advisory, error) {
+	var advisories []Advisory
+	var errs []error
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		list, err := Parse(data)
+		if err != nil {
+			// a broken file doesn't hide the other advisories
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			return nil
+		}
+		advisories = append(advisories, list...)
+		return nil
+	})
+	return advisories, errors.Join(append(errs, err)...)
+}
+
+// maxFeedSize limits the response of a URLSource.
+const maxFeedSize = 256 << 20
+
+// URLSource downloads advisories from URL, which serves one advisory or a list of them.
+type URLSource struct {
+	URL string
+	// Client defaults to a client with a timeout of a minute.
+	Client *http.Client
+}
+
+func (s *URLSource) Advisories(ctx context.Context) ([]Advisory, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", s.URL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", s.URL, err)
+	}
+	advisories, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", s.URL, err)
+	}
+	return advisories, nil
+}
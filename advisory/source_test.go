@@ -0,0 +1,44 @@
+package advisory
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sources", func() {
+	It("should read the JSON files of a directory tree", func(ctx SpecContext) {
+		dir := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(dir, "Debian"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "Debian", "DSA-5532-1.json"), []byte(`{"id": "DSA-5532-1"}`), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "npm.json"), []byte(`[{"id": "GHSA-1"}, {"id": "GHSA-2"}]`), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "README.md"), []byte(`# OSV`), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{`), 0o644)).To(Succeed())
+
+		advisories, err := (&DirSource{Dir: dir}).Advisories(ctx)
+		Expect(err).To(MatchError(ContainSubstring("broken.json")))
+		Expect(advisories).To(ConsistOf(HaveField("ID", "DSA-5532-1"), HaveField("ID", "GHSA-1"), HaveField("ID", "GHSA-2")))
+	})
+
+	It("should download advisories", func(ctx SpecContext) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/osv.json" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(`[{"id": "GHSA-1"}]`))
+		}))
+		DeferCleanup(server.Close)
+
+		advisories, err := (&URLSource{URL: server.URL + "/osv.json"}).Advisories(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(advisories).To(ConsistOf(HaveField("ID", "GHSA-1")))
+
+		_, err = (&URLSource{URL: server.URL + "/missing.json"}).Advisories(ctx)
+		Expect(err).To(MatchError(ContainSubstring("404")))
+	})
+})
@@ -0,0 +1,150 @@
+package advisory
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// DefaultInterval is the interval in which a Watcher reads its sources by default.
+const DefaultInterval = time.Hour
+
+// Watcher reads its sources periodically and rescans the digests in the inventory that contain a package version
+// affected by an advisory that was modified after the digest was scanned last, including when the controller was
+// down. Advisories that didn't change since the previous read are skipped.
+//
+// The events of the rescans carry the ID of the advisory, which the Reconciler includes in the job name,
+// so each digest is rescanned once per advisory.
+type Watcher struct {
+	Sources   []Source
+	Inventory *inventory.Index
+	// Results are the results of the scans the advisories are compared with. Without them, every affected digest is
+	// rescanned whenever an advisory is read for the first time or modified.
+	Results results.Store
+	// Events receives the events to rescan, usually the source channel of the Reconciler.
+	Events chan<- event.TypedGenericEvent[types.RegistryEvent]
+	// Interval defaults to DefaultInterval.
+	Interval time.Duration
+	Logger   logr.Logger
+
+	// modified holds the modification time of every advisory read.
+	modified map[string]time.Time
+}
+
+// Start reads the sources until ctx is done.
+func (w *Watcher) Start(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.poll(ctx); err != nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads all sources once. It only fails if ctx is done.
+func (w *Watcher) poll(ctx context.Context) error {
+	if w.modified == nil {
+		w.modified = map[string]time.Time{}
+	}
+	for i, s := range w.Sources {
+		advisories, err := s.Advisories(ctx)
+		metrics.AdvisoryFetch(err)
+		if err != nil {
+			w.Logger.Error(err, "reading advisories", "source", i)
+		}
+		for _, a := range advisories {
+			previous, seen := w.modified[a.ID]
+			if seen && !a.Modified.After(previous) {
+				continue
+			}
+			if err := w.rescan(ctx, a); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				// the advisory is read again next time
+				w.Logger.Error(err, "rescanning images affected by advisory", "advisory", a.ID)
+				continue
+			}
+			w.modified[a.ID] = a.Modified
+		}
+	}
+	return nil
+}
+
+// rescan sends an event for every digest affected by a that wasn't scanned since a was modified.
+// The event names the first image of the digest.
+func (w *Watcher) rescan(ctx context.Context, a Advisory) error {
+	var events []types.RegistryEvent
+	done := map[digest.Digest]bool{}
+	for _, m := range a.Match(w.Inventory) {
+		if done[m.Digest] || len(m.Images) == 0 {
+			continue
+		}
+		done[m.Digest] = true
+		scanned, err := w.scanned(ctx, m.Digest)
+		if err != nil {
+			return err
+		}
+		if scanned.After(a.Modified) {
+			continue
+		}
+		img := m.Images[0]
+		events = append(events, types.RegistryEvent{
+			Registry:   img.Registry,
+			Repository: img.Repository,
+			Tag:        img.Tag,
+			Digest:     m.Digest,
+			Tenant:     img.Tenant,
+			Advisory:   a.ID,
+		})
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	w.Logger.Info("Rescanning images affected by advisory", "advisory", a.ID, "digests", len(events))
+	for _, e := range events {
+		select {
+		case w.Events <- event.TypedGenericEvent[types.RegistryEvent]{Object: e}:
+			metrics.AdvisoryRescan(e.Registry, e.Repository)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// scanned returns when the latest scan of d was scheduled or finished, the zero time if there is none.
+func (w *Watcher) scanned(ctx context.Context, d digest.Digest) (time.Time, error) {
+	if w.Results == nil {
+		return time.Time{}, nil
+	}
+	list, err := w.Results.List(ctx, results.Filter{Digest: d.String()})
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, res := range list {
+		switch res.Status {
+		case results.StatusScheduled, results.StatusScanned, results.StatusScanFailed:
+			// the results are listed newest first
+			return res.Time, nil
+		}
+	}
+	return time.Time{}, nil
+}
@@ -0,0 +1,102 @@
+package advisory
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// staticSource serves the advisories it holds.
+type staticSource struct {
+	advisories []Advisory
+}
+
+func (s *staticSource) Advisories(context.Context) ([]Advisory, error) {
+	return s.advisories, nil
+}
+
+var _ = Describe("Watcher", func() {
+	var (
+		source *staticSource
+		events chan event.TypedGenericEvent[types.RegistryEvent]
+		index  *inventory.Index
+		store  *results.MemoryStore
+		w      *Watcher
+	)
+	app := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/app", Tag: "v1", Digest: digest.FromString("app"), Tenant: "team-b"}
+	api := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/api", Tag: "v1", Digest: digest.FromString("api")}
+	modified := time.Date(2023, 10, 24, 0, 0, 0, 0, time.UTC)
+
+	openssl := func(id string, modified time.Time, fixed string) Advisory {
+		return Advisory{ID: id, Modified: modified, Affected: []Affected{{
+			Package: Package{Ecosystem: "Debian:12", Name: "openssl"},
+			Ranges:  []Range{{Type: "ECOSYSTEM", Events: []Event{{Introduced: "0"}, {Fixed: fixed}}}},
+		}}}
+	}
+
+	received := func() []types.RegistryEvent {
+		var list []types.RegistryEvent
+		for len(events) > 0 {
+			list = append(list, (<-events).Object)
+		}
+		return list
+	}
+
+	BeforeEach(func(ctx SpecContext) {
+		index = inventory.NewIndex(0)
+		index.Add(app, []inventory.Package{{Name: "openssl", Version: "3.0.11-1~deb12u1", Ecosystem: "Debian"}})
+		index.Add(api, []inventory.Package{{Name: "openssl", Version: "3.0.13-1~deb12u1", Ecosystem: "Debian"}})
+		store = results.NewMemoryStore()
+		Expect(store.Record(ctx, results.Result{Event: app, Status: results.StatusScanned, Time: modified.Add(-time.Hour)})).To(Succeed())
+		Expect(store.Record(ctx, results.Result{Event: api, Status: results.StatusScanned, Time: modified.Add(-time.Hour)})).To(Succeed())
+		source = &staticSource{advisories: []Advisory{openssl("DSA-5000-1", modified, "1.0")}}
+		events = make(chan event.TypedGenericEvent[types.RegistryEvent], 10)
+		w = &Watcher{Sources: []Source{source}, Inventory: index, Results: store, Events: events, Logger: logr.Discard()}
+	})
+
+	It("should rescan the digests scanned before the advisory was modified, also on the first read", func(ctx SpecContext) {
+		source.advisories = append(source.advisories, openssl("DSA-5532-1", modified, "3.0.11-1~deb12u2"))
+		Expect(w.poll(ctx)).To(Succeed())
+		e := app
+		e.Advisory = "DSA-5532-1"
+		Expect(received()).To(ConsistOf(e))
+
+		// unchanged advisories are not processed again
+		Expect(w.poll(ctx)).To(Succeed())
+		Expect(received()).To(BeEmpty())
+
+		// a restarted watcher skips the digests scanned since
+		Expect(store.Record(ctx, results.Result{Event: e, Status: results.StatusScheduled, Time: modified.Add(time.Hour)})).To(Succeed())
+		w = &Watcher{Sources: []Source{source}, Inventory: index, Results: store, Events: events, Logger: logr.Discard()}
+		Expect(w.poll(ctx)).To(Succeed())
+		Expect(received()).To(BeEmpty())
+	})
+
+	It("should rescan the digests scanned before a modified advisory", func(ctx SpecContext) {
+		source.advisories = append(source.advisories, openssl("DSA-5532-1", modified, "3.0.11-1~deb12u2"))
+		Expect(w.poll(ctx)).To(Succeed())
+		Expect(received()).To(HaveLen(1))
+		Expect(store.Record(ctx, results.Result{Event: app, Status: results.StatusScanned, Time: modified.Add(2 * time.Hour)})).To(Succeed())
+
+		source.advisories[1] = openssl("DSA-5532-1", modified.Add(time.Hour), "3.0.14")
+		Expect(w.poll(ctx)).To(Succeed())
+		Expect(received()).To(ConsistOf(HaveField("Digest", api.Digest)))
+	})
+
+	It("should rescan every digest once", func(ctx SpecContext) {
+		latest := app
+		latest.Tag = "latest"
+		index.Add(latest, []inventory.Package{{Name: "openssl", Version: "3.0.11-1~deb12u1", Ecosystem: "Debian"}})
+		source.advisories = append(source.advisories, openssl("DSA-5532-1", modified, "3.0.11-1~deb12u2"))
+		Expect(w.poll(ctx)).To(Succeed())
+		Expect(received()).To(ConsistOf(HaveField("Digest", app.Digest)))
+	})
+})
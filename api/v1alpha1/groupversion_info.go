@@ -0,0 +1,20 @@
+// Package v1alpha1 contains the API of registry-snyk-scan.
+// +kubebuilder:object:generate=true
+// +groupName=registry-snyk-scan.stackit.cloud
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the group version of the registry-snyk-scan API.
+	GroupVersion = schema.GroupVersion{Group: "registry-snyk-scan.stackit.cloud", Version: "v1alpha1"}
+
+	// SchemeBuilder adds the types of this group version to a scheme.
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the types of this group version to a scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
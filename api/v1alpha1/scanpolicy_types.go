@@ -0,0 +1,164 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ScanPolicySpec selects repositories and configures how their images are scanned.
+type ScanPolicySpec struct {
+	// Repositories are glob patterns matched against "<registry>/<repository>", see path.Match.
+	// +kubebuilder:validation:MinItems=1
+	Repositories []string `json:"repositories"`
+	// ExcludeRepositories are glob patterns of repositories the policy doesn't apply to.
+	// +optional
+	ExcludeRepositories []string `json:"excludeRepositories,omitempty"`
+	// Priority decides between several matching policies, the highest wins.
+	// On equal priority, ScanPolicies win over ClusterScanPolicies, then the first name in alphabetical order.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+	// Scanner overrides the scanner settings of the configuration.
+	// +optional
+	Scanner *ScannerOverrides `json:"scanner,omitempty"`
+	// JobTemplate overrides the fields of the job template of the configuration that are set here.
+	// Labels and annotations are merged.
+	// +optional
+	JobTemplate *JobTemplate `json:"jobTemplate,omitempty"`
+	// Rescan scans images again periodically after their push.
+	// +optional
+	Rescan *RescanSchedule `json:"rescan,omitempty"`
+	// Platforms replaces the allow list of image platforms in the format os/arch[/variant].
+	// +optional
+	Platforms []PlatformRule `json:"platforms,omitempty"`
+}
+
+// PlatformRule is a platform in the format os/arch[/variant]. Rules without variant match all variants.
+// +kubebuilder:validation:Pattern=`^[^/]+/[^/]+(/[^/]+)?$`
+type PlatformRule string
+
+// ScannerOverrides replace the scanner settings of the configuration.
+type ScannerOverrides struct {
+	// Backend selects the scanner. Switching to another backend than the configuration resets image and args.
+	// +kubebuilder:validation:Enum=snyk;trivy;grype
+	// +optional
+	Backend string `json:"backend,omitempty"`
+	// Image of the scanner.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Args are passed to the scanner in addition to the arguments of the configuration.
+	// +optional
+	Args []string `json:"args,omitempty"`
+	// Org is the Snyk organization the results are reported to, instead of SNYK_ORG of the token secret.
+	// +optional
+	Org string `json:"org,omitempty"`
+	// TokenSecret is the name of the secret with the keys SNYK_TOKEN and SNYK_ORG.
+	// +optional
+	TokenSecret string `json:"tokenSecret,omitempty"`
+	// Snyk selects the snyk commands and their gating options. The fields set here replace those of the configuration.
+	// +optional
+	Snyk *SnykOptions `json:"snyk,omitempty"`
+}
+
+// SnykOptions select the snyk commands run by a scan. The gating options only apply to snyk container test.
+type SnykOptions struct {
+	// Mode runs snyk container monitor, test or both. Defaults to monitor.
+	// +kubebuilder:validation:Enum=monitor;test;both
+	// +optional
+	Mode string `json:"mode,omitempty"`
+	// SeverityThreshold only reports vulnerabilities of this severity or higher.
+	// +kubebuilder:validation:Enum=low;medium;high;critical
+	// +optional
+	SeverityThreshold string `json:"severityThreshold,omitempty"`
+	// FailOn only fails the test for vulnerabilities that can be fixed with upgradable.
+	// +kubebuilder:validation:Enum=all;upgradable
+	// +optional
+	FailOn string `json:"failOn,omitempty"`
+	// ExcludeBaseImageVulns only reports vulnerabilities introduced by the layers of the image itself.
+	// +optional
+	ExcludeBaseImageVulns *bool `json:"excludeBaseImageVulns,omitempty"`
+	// ExcludeAppVulns skips the vulnerabilities of application dependencies.
+	// +optional
+	ExcludeAppVulns *bool `json:"excludeAppVulns,omitempty"`
+	// Policy references a ConfigMap key in the namespace of the scan job holding a .snyk policy file,
+	// which is passed to snyk with --policy-path to ignore accepted vulnerabilities. The key defaults to .snyk.
+	// +optional
+	Policy *corev1.ConfigMapKeySelector `json:"policy,omitempty"`
+}
+
+// RescanSchedule scans images again in a fixed interval.
+type RescanSchedule struct {
+	// Interval between scans, like 24h.
+	Interval metav1.Duration `json:"interval"`
+}
+
+// JobTemplate customizes the scan jobs.
+type JobTemplate struct {
+	// Labels and Annotations are added to the job and its pod. They don't override the ones set by the controller.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Priority",type=integer,JSONPath=`.spec.priority`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ScanPolicy configures the scans of the repositories it selects. It applies to the scan jobs in its namespace.
+type ScanPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ScanPolicySpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// ScanPolicyList contains a list of ScanPolicy.
+type ScanPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScanPolicy `json:"items"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Priority",type=integer,JSONPath=`.spec.priority`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterScanPolicy configures the scans of the repositories it selects in all namespaces.
+type ClusterScanPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ScanPolicySpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterScanPolicyList contains a list of ClusterScanPolicy.
+type ClusterScanPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterScanPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ScanPolicy{}, &ScanPolicyList{}, &ClusterScanPolicy{}, &ClusterScanPolicyList{})
+}
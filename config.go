@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/stackitcloud/registry-snyk-scan/config"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/webhook"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configFileFlags are the flags superseded by the configuration file.
+var configFileFlags = []string{
+	"port",
+	"event-queue-size",
+	"tls-cert-file",
+	"tls-key-file",
+	"tls-client-ca-file",
+	"insecure-registry",
+	"registry-profiles",
+	"registry-rewrites",
+	"registry-cache-size",
+	"supported-platforms",
+	"retry-base-delay",
+	"retry-max-delay",
+	"retry-max-attempts",
+}
+
+// loadConfig returns the configuration from the -config file, watched for changes,
+// or from the flags if there is no configuration file. The watcher is nil without a file.
+func loadConfig(logger logr.Logger) (*config.Config, *config.Watcher, error) {
+	if *configFile == "" {
+		c, err := configFromFlags()
+		return c, nil, err
+	}
+
+	var conflicting []string
+	flag.Visit(func(f *flag.Flag) {
+		for _, name := range configFileFlags {
+			if f.Name == name {
+				conflicting = append(conflicting, "-"+name)
+			}
+		}
+	})
+	if len(conflicting) > 0 {
+		return nil, nil, fmt.Errorf("%s can't be used with -config, set them in the configuration file", strings.Join(conflicting, ", "))
+	}
+
+	w, err := config.NewWatcher(*configFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.Current(), w, nil
+}
+
+// configFromFlags returns the configuration of the command line flags.
+func configFromFlags() (*config.Config, error) {
+	c := config.Defaults()
+	c.Webhook.Port = *port
+	c.Webhook.EventQueueSize = *eventQueueSize
+	if *tlsCertFile != "" || *tlsKeyFile != "" || *tlsClientCAFile != "" {
+		c.Webhook.TLS = &webhook.TLSOptions{
+			CertFile:     *tlsCertFile,
+			KeyFile:      *tlsKeyFile,
+			ClientCAFile: *tlsClientCAFile,
+		}
+	}
+
+	if *registryProfiles != "" {
+		profiles, err := registry.LoadProfiles(*registryProfiles)
+		if err != nil {
+			return nil, err
+		}
+		c.Registries.Default = profiles.Default
+		c.Registries.Profiles = profiles.Registries
+	}
+	if *insecureRegistry && c.Registries.Default.TLSMode == "" {
+		c.Registries.Default.TLSMode = registry.TLSModeSkipVerify
+	}
+	if *registryRewrites != "" {
+		rules, err := registry.LoadRewriteRules(*registryRewrites)
+		if err != nil {
+			return nil, err
+		}
+		c.Registries.Rewrites = rules
+	}
+	c.Registries.CacheSize = *registryCache
+
+	for _, p := range strings.Split(*platforms, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			c.Filters.Platforms = append(c.Filters.Platforms, p)
+		}
+	}
+
+	c.Scanner.Retry = config.Retry{
+		BaseDelay:   metav1.Duration{Duration: *retryBaseDelay},
+		MaxDelay:    metav1.Duration{Duration: *retryMaxDelay},
+		MaxAttempts: *retryMaxAttempts,
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// validateConfig implements the validate-config subcommand and returns the exit code.
+func validateConfig(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: registry-snyk-scan validate-config <file>")
+		return 2
+	}
+	if _, err := config.Load(args[0]); err != nil {
+		// print one problem per line
+		var joined interface{ Unwrap() []error }
+		if errors.As(err, &joined) {
+			fmt.Fprintf(os.Stderr, "%s is invalid:\n", args[0])
+			for _, e := range joined.Unwrap() {
+				fmt.Fprintf(os.Stderr, "  %s\n", e)
+			}
+			return 1
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s is valid\n", args[0])
+	return 0
+}
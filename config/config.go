@@ -0,0 +1,282 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/advisory"
+	"github.com/stackitcloud/registry-snyk-scan/controller"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/webhook"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the version of the configuration file format.
+	APIVersion = "registry-snyk-scan.stackit.cloud/v1alpha1"
+	// Kind of the configuration file.
+	Kind = "Config"
+)
+
+// Config is the configuration file of registry-snyk-scan.
+type Config struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	Webhook     Webhook                `json:"webhook,omitempty"`
+	Filters     Filters                `json:"filters,omitempty"`
+	Registries  Registries             `json:"registries,omitempty"`
+	Scanner     Scanner                `json:"scanner,omitempty"`
+	JobTemplate controller.JobTemplate `json:"jobTemplate,omitempty"`
+	// Namespaces route the scan jobs of repositories into other namespaces than -namespace.
+	// The first matching route wins. Changes require a restart.
+	Namespaces []controller.NamespaceRoute `json:"namespaces,omitempty"`
+	// Tenants get their own endpoints POST /event/{name}. Changes require a restart.
+	Tenants   []Tenant  `json:"tenants,omitempty"`
+	Retention Retention `json:"retention,omitempty"`
+	// Referrers attaches the reports and SBOMs of scans to the scanned images. Changes require a restart.
+	Referrers Referrers `json:"referrers,omitempty"`
+	// Lineage tracks the base images of the pushed images. Changes require a restart.
+	Lineage Lineage `json:"lineage,omitempty"`
+	// Advisories rescans the images affected by new vulnerability advisories. Changes require a restart.
+	Advisories Advisories `json:"advisories,omitempty"`
+}
+
+// Lineage configures the tracking of base images, which reads the manifest of every pushed image.
+type Lineage struct {
+	// Enabled reports the images built on a base image that was pushed again as outdated.
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// Advisories configures the feeds of vulnerability advisories in the OSV format, which are matched against the
+// package inventory built from the SBOMs of the scans.
+type Advisories struct {
+	// Dirs are searched for .json files holding one advisory or a list of them, including their subdirectories.
+	Dirs []string `json:"dirs,omitempty"`
+	// URLs serve one advisory or a list of them.
+	URLs []string `json:"urls,omitempty"`
+	// Interval between reads of the feeds. Defaults to advisory.DefaultInterval.
+	Interval metav1.Duration `json:"interval,omitempty"`
+}
+
+// Referrers configures the artifacts pushed back to the registries, which needs credentials with push access.
+type Referrers struct {
+	// Enabled pushes the report of each successful scan and its SBOMs as OCI referrers of the scanned image.
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// Tenant is a sender of notifications with its own endpoint, token, filters, Snyk org and namespace.
+type Tenant struct {
+	Name string `json:"name"`
+	// TokenFile contains the bearer token the registries of the tenant authenticate with.
+	TokenFile string `json:"tokenFile"`
+	// Filters replace the filters for the events of the tenant, if set.
+	Filters *webhook.Filters `json:"filters,omitempty"`
+	// Org is the Snyk organization of the tenant.
+	Org string `json:"org,omitempty"`
+	// Namespace of the scan jobs of the tenant, instead of the namespace routes.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Webhook configures the server receiving notifications. Changes require a restart.
+type Webhook struct {
+	Port int `json:"port,omitempty"`
+	// EventQueueSize is the number of events buffered between webhook and controller.
+	EventQueueSize int                 `json:"eventQueueSize,omitempty"`
+	TLS            *webhook.TLSOptions `json:"tls,omitempty"`
+	// TokenFile contains the bearer token the registries authenticate with at POST /event.
+	// It is required with tenants, so that they can't bypass their own endpoints.
+	TokenFile string `json:"tokenFile,omitempty"`
+}
+
+// Filters select the events that are scanned.
+type Filters struct {
+	webhook.Filters `json:",inline"`
+	// Platforms is the allow list of image platforms in the format os/arch[/variant].
+	// Defaults to all linux platforms supported by snyk.
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// Registries configures how registries are accessed.
+type Registries struct {
+	// Default is used for registries without an explicit profile.
+	Default registry.Profile `json:"default,omitempty"`
+	// Profiles maps a registry host, including the port if any, to its profile.
+	Profiles map[string]registry.Profile `json:"profiles,omitempty"`
+	// Rewrites turn the host a registry reports in its notifications into the host used to pull images.
+	Rewrites []registry.RewriteRule `json:"rewrites,omitempty"`
+	// CacheSize is the number of manifests and image configs cached by digest. Changes require a restart.
+	CacheSize int `json:"cacheSize,omitempty"`
+}
+
+// Scanner configures the scan jobs and retries of registry lookups.
+type Scanner struct {
+	controller.Scanner `json:",inline"`
+	Retry              Retry `json:"retry,omitempty"`
+}
+
+// Retry controls how events failing with transient registry errors are retried.
+type Retry struct {
+	BaseDelay   metav1.Duration `json:"baseDelay,omitempty"`
+	MaxDelay    metav1.Duration `json:"maxDelay,omitempty"`
+	MaxAttempts int             `json:"maxAttempts,omitempty"`
+}
+
+// Retention limits the results and dead letters kept in memory.
+type Retention struct {
+	Results     RetentionPolicy `json:"results,omitempty"`
+	DeadLetters RetentionPolicy `json:"deadLetters,omitempty"`
+}
+
+// RetentionPolicy removes entries older than MaxAge and the oldest entries beyond MaxEntries.
+// A zero MaxAge means no limit, MaxEntries defaults to results.DefaultMaxEntries.
+type RetentionPolicy struct {
+	MaxAge     metav1.Duration `json:"maxAge,omitempty"`
+	MaxEntries int             `json:"maxEntries,omitempty"`
+}
+
+// Defaults returns the configuration used for everything not set in a configuration file.
+func Defaults() *Config {
+	return &Config{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Webhook: Webhook{
+			Port:           8081,
+			EventQueueSize: 100,
+		},
+		Registries: Registries{
+			CacheSize: registry.DefaultCacheSize,
+		},
+		Scanner: Scanner{
+			Retry: Retry{
+				BaseDelay:   metav1.Duration{Duration: controller.DefaultRetryPolicy.BaseDelay},
+				MaxDelay:    metav1.Duration{Duration: controller.DefaultRetryPolicy.MaxDelay},
+				MaxAttempts: controller.DefaultRetryPolicy.MaxAttempts,
+			},
+		},
+	}
+}
+
+// Load reads and validates a configuration file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse decodes and validates a configuration. Unset fields keep their defaults,
+// only apiVersion and kind must always be set.
+func Parse(data []byte) (*Config, error) {
+	c := Defaults()
+	c.APIVersion, c.Kind = "", ""
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Profiles returns the registry profiles.
+func (c *Config) Profiles() *registry.Profiles {
+	return &registry.Profiles{
+		Default:    c.Registries.Default,
+		Registries: c.Registries.Profiles,
+	}
+}
+
+// Rewriter returns the registry host rewriter.
+func (c *Config) Rewriter() (*registry.Rewriter, error) {
+	return registry.NewRewriter(c.Registries.Rewrites)
+}
+
+// SupportedPlatforms returns the platform allow list, nil means the default.
+func (c *Config) SupportedPlatforms() ([]imagev1.Platform, error) {
+	var platforms []imagev1.Platform
+	for _, s := range c.Filters.Platforms {
+		p, err := controller.ParsePlatforms(s)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, p...)
+	}
+	return platforms, nil
+}
+
+// RetryPolicy returns the retry policy of registry lookups.
+func (c *Config) RetryPolicy() controller.RetryPolicy {
+	return controller.RetryPolicy{
+		BaseDelay:   c.Scanner.Retry.BaseDelay.Duration,
+		MaxDelay:    c.Scanner.Retry.MaxDelay.Duration,
+		MaxAttempts: c.Scanner.Retry.MaxAttempts,
+	}
+}
+
+// ReconcilerSettings returns the settings of the controller.
+func (c *Config) ReconcilerSettings() (controller.Settings, error) {
+	platforms, err := c.SupportedPlatforms()
+	if err != nil {
+		return controller.Settings{}, err
+	}
+	return controller.Settings{
+		Registries:         c.Profiles(),
+		SupportedPlatforms: platforms,
+		RetryPolicy:        c.RetryPolicy(),
+		Scanner:            c.Scanner.Scanner,
+		JobTemplate:        c.JobTemplate,
+	}, nil
+}
+
+// WebhookTenants returns the endpoints of the tenants by name.
+func (c *Config) WebhookTenants() map[string]webhook.Tenant {
+	tenants := map[string]webhook.Tenant{}
+	for _, t := range c.Tenants {
+		tenants[t.Name] = webhook.Tenant{TokenFile: t.TokenFile, Filters: t.Filters}
+	}
+	return tenants
+}
+
+// ControllerTenants returns the scan settings of the tenants by name.
+func (c *Config) ControllerTenants() map[string]controller.Tenant {
+	tenants := map[string]controller.Tenant{}
+	for _, t := range c.Tenants {
+		tenants[t.Name] = controller.Tenant{Namespace: t.Namespace, Org: t.Org}
+	}
+	return tenants
+}
+
+// AdvisorySources returns the configured advisory feeds.
+func (c *Config) AdvisorySources() []advisory.Source {
+	var sources []advisory.Source
+	for _, dir := range c.Advisories.Dirs {
+		sources = append(sources, &advisory.DirSource{Dir: dir})
+	}
+	for _, u := range c.Advisories.URLs {
+		sources = append(sources, &advisory.URLSource{URL: u})
+	}
+	return sources
+}
+
+// ResultsRetention returns the retention of results.
+func (c *Config) ResultsRetention() results.Retention {
+	return c.Retention.Results.retention()
+}
+
+// DeadLettersRetention returns the retention of dead letters.
+func (c *Config) DeadLettersRetention() results.Retention {
+	return c.Retention.DeadLetters.retention()
+}
+
+func (p RetentionPolicy) retention() results.Retention {
+	return results.Retention{MaxAge: p.MaxAge.Duration, MaxEntries: p.MaxEntries}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/advisory"
+	"github.com/stackitcloud/registry-snyk-scan/controller"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+)
+
+var _ = Describe("Load", func() {
+	It("should load a complete configuration", func() {
+		c, err := Load("testdata/config.yaml")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Webhook.Port).To(Equal(8443))
+		Expect(c.Webhook.TLS.CertFile).To(Equal("/etc/webhook/tls.crt"))
+		Expect(c.Webhook.TokenFile).To(Equal("/etc/webhook/token"))
+		Expect(c.Filters.ExcludeRepositories).To(ConsistOf("*/cache/*"))
+		Expect(c.Profiles().Get("legacy:5000").TLSMode).To(Equal(registry.TLSModePlainHTTP))
+
+		rewriter, err := c.Rewriter()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rewriter.Rewrite("registry.svc.cluster.local:5000")).To(Equal("registry.example.com"))
+
+		settings, err := c.ReconcilerSettings()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(settings.SupportedPlatforms).To(ConsistOf(
+			imagev1.Platform{OS: "linux", Architecture: "amd64"},
+			imagev1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+		))
+		Expect(settings.Scanner.TokenSecret).To(Equal("team-token"))
+		Expect(settings.Scanner.SnykRules).To(HaveLen(1))
+		Expect(settings.Scanner.SnykRules[0].Mode).To(Equal("both"))
+		Expect(settings.Scanner.SnykRules[0].Policy.Name).To(Equal("prod-snyk-policy"))
+		Expect(settings.Scanner.Prefetch).To(Equal(&scanner.Prefetch{Image: "registry.example.com/registry-snyk-scan:v1", Format: registry.FetchArchive}))
+		Expect(settings.Scanner.SBOM.Formats).To(ConsistOf(scanner.SBOMCycloneDX, scanner.SBOMSPDX))
+		Expect(c.Referrers.Enabled).To(BeTrue())
+		Expect(c.Lineage.Enabled).To(BeTrue())
+		Expect(c.AdvisorySources()).To(ConsistOf(
+			&advisory.DirSource{Dir: "/var/lib/osv"},
+			&advisory.URLSource{URL: "https://advisories.example.com/osv.json"},
+		))
+		Expect(c.Advisories.Interval.Duration).To(Equal(30 * time.Minute))
+		Expect(settings.JobTemplate.Labels).To(HaveKeyWithValue("team", "platform"))
+
+		Expect(c.Namespaces).To(ConsistOf(controller.NamespaceRoute{
+			Repositories: []string{"registry.example.com/team-a/*"},
+			Namespace:    "team-a",
+		}))
+
+		Expect(c.ControllerTenants()).To(HaveKeyWithValue("team-b", controller.Tenant{Namespace: "team-b", Org: "team-b"}))
+		Expect(c.WebhookTenants()).To(HaveKeyWithValue("team-b", HaveField("TokenFile", "/etc/tenants/team-b/token")))
+
+		Expect(c.ResultsRetention().MaxAge).To(Equal(168 * time.Hour))
+	})
+
+	It("should keep defaults for unset fields", func() {
+		c, err := Load("testdata/config.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.RetryPolicy()).To(Equal(controller.RetryPolicy{
+			BaseDelay:   controller.DefaultRetryPolicy.BaseDelay,
+			MaxDelay:    controller.DefaultRetryPolicy.MaxDelay,
+			MaxAttempts: 3,
+		}))
+		Expect(c.Registries.CacheSize).To(Equal(registry.DefaultCacheSize))
+	})
+
+	It("should accept a minimal configuration", func() {
+		c, err := Parse([]byte("apiVersion: registry-snyk-scan.stackit.cloud/v1alpha1\nkind: Config\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(Equal(Defaults()))
+	})
+
+	It("should reject unknown fields", func() {
+		_, err := Parse([]byte("apiVersion: registry-snyk-scan.stackit.cloud/v1alpha1\nkind: Config\nscanner:\n  imag: snyk\n"))
+		Expect(err).To(MatchError(ContainSubstring(`unknown field "imag"`)))
+	})
+})
+
+var _ = Describe("Validate", func() {
+	It("should report every invalid field with its path", func() {
+		_, err := Parse([]byte(`
+apiVersion: v1
+kind: Config
+webhook:
+  port: 0
+filters:
+  includeRepositories: ["[a"]
+  platforms: [linux]
+registries:
+  profiles:
+    legacy:5000:
+      tlsMode: none
+  rewrites:
+  - host: a
+scanner:
+  backend: clair
+  snyk:
+    mode: gate
+  snykRules:
+  - repositories: []
+    tags: ["[v"]
+    severityThreshold: severe
+    policy:
+      name: ""
+  prefetch:
+    format: zip
+    sizeLimit: "0"
+  sbom:
+    formats: [xml]
+  retry:
+    maxAttempts: 0
+jobTemplate:
+  labels:
+    team: "not a label value"
+  resources:
+    requests:
+      memory: 2Gi
+    limits:
+      memory: 1Gi
+namespaces:
+- namespace: Team_A
+  repositories: []
+tenants:
+- name: a
+  tokenFile: /token
+- name: a
+retention:
+  deadLetters:
+    maxEntries: -1
+advisories:
+  urls: [osv.json]
+  interval: -1h
+`))
+		Expect(err).To(HaveOccurred())
+		var paths []string
+		for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var fieldErr *FieldError
+			Expect(errors.As(e, &fieldErr)).To(BeTrue())
+			paths = append(paths, fieldErr.Path)
+		}
+		Expect(paths).To(ConsistOf(
+			"apiVersion",
+			"webhook.port",
+			"filters",
+			"filters.platforms[0]",
+			"registries.profiles[legacy:5000]",
+			"registries.rewrites",
+			"scanner.backend",
+			"scanner.snyk.mode",
+			"scanner.snykRules[0].repositories",
+			"scanner.snykRules[0].tags[0]",
+			"scanner.snykRules[0].severityThreshold",
+			"scanner.snykRules[0].policy.name",
+			"scanner.prefetch.image",
+			"scanner.prefetch.format",
+			"scanner.prefetch.sizeLimit",
+			"scanner.prefetch",
+			"scanner.sbom.formats[0]",
+			"scanner.sbom",
+			"scanner.retry.maxAttempts",
+			"jobTemplate.labels[team]",
+			"jobTemplate.resources.requests[memory]",
+			"namespaces[0].namespace",
+			"namespaces[0].repositories",
+			"webhook.tokenFile",
+			"tenants[1].name",
+			"tenants[1].tokenFile",
+			"retention.deadLetters.maxEntries",
+			"advisories.urls[0]",
+			"advisories.interval",
+		))
+		Expect(err).To(MatchError(ContainSubstring(`registries.profiles[legacy:5000]: unknown tlsMode "none"`)))
+	})
+})
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/controller"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// FieldError is a validation error of a single field of the configuration.
+type FieldError struct {
+	// Path of the field, like "scanner.retry.maxAttempts".
+	Path   string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Reason
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the whole configuration and returns all problems found, joined into one error.
+// Each of them is a *FieldError.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	if c.APIVersion != APIVersion {
+		v.add("apiVersion", "must be %q", APIVersion)
+	}
+	if c.Kind != Kind {
+		v.add("kind", "must be %q", Kind)
+	}
+
+	if c.Webhook.Port < 1 || c.Webhook.Port > 65535 {
+		v.add("webhook.port", "must be between 1 and 65535")
+	}
+	if c.Webhook.EventQueueSize < 0 {
+		v.add("webhook.eventQueueSize", "must not be negative")
+	}
+	if tls := c.Webhook.TLS; tls != nil && (tls.CertFile == "" || tls.KeyFile == "") {
+		v.add("webhook.tls", "certFile and keyFile must be set")
+	}
+
+	if err := c.Filters.Filters.Validate(); err != nil {
+		v.add("filters", "%s", err)
+	}
+	for i, p := range c.Filters.Platforms {
+		if _, err := controller.ParsePlatforms(p); err != nil || strings.Contains(p, ",") {
+			v.add(fmt.Sprintf("filters.platforms[%d]", i), "must be os/arch[/variant]")
+		}
+	}
+
+	if err := (&registry.Profiles{Default: c.Registries.Default}).Validate(); err != nil {
+		v.add("registries.default", "%s", strings.TrimPrefix(err.Error(), "default: "))
+	}
+	for _, host := range sortedKeys(c.Registries.Profiles) {
+		if err := (&registry.Profiles{Default: c.Registries.Profiles[host]}).Validate(); err != nil {
+			v.add(fmt.Sprintf("registries.profiles[%s]", host), "%s", strings.TrimPrefix(err.Error(), "default: "))
+		}
+	}
+	if _, err := c.Rewriter(); err != nil {
+		v.add("registries.rewrites", "%s", err)
+	}
+	if c.Registries.CacheSize < 0 {
+		v.add("registries.cacheSize", "must not be negative")
+	}
+
+	if b := c.Scanner.Backend; b != "" && !slices.Contains(scanner.Backends, b) {
+		v.add("scanner.backend", "must be one of %s", strings.Join(scanner.Backends, ", "))
+	}
+	if s := c.Scanner.TokenSecret; s != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(s) {
+			v.add("scanner.tokenSecret", "%s", msg)
+		}
+	}
+	if p := c.Scanner.Prefetch; p != nil {
+		if p.Image == "" {
+			v.add("scanner.prefetch.image", "must be set")
+		}
+		if p.Format != "" && !slices.Contains(registry.FetchFormats, p.Format) {
+			v.add("scanner.prefetch.format", "must be one of layout, archive")
+		}
+		if p.SizeLimit != nil && p.SizeLimit.Sign() <= 0 {
+			v.add("scanner.prefetch.sizeLimit", "must be positive")
+		}
+		if b := c.Scanner.Backend; b != "" && b != scanner.BackendSnyk {
+			v.add("scanner.prefetch", "is only supported by the snyk backend")
+		}
+	}
+	if sbom := c.Scanner.SBOM; sbom != nil {
+		for i, format := range sbom.Formats {
+			if !slices.Contains(scanner.SBOMFormats, format) {
+				v.add(fmt.Sprintf("scanner.sbom.formats[%d]", i), "must be one of cyclonedx, spdx")
+			}
+		}
+		if b := c.Scanner.Backend; b != "" && b != scanner.BackendSnyk {
+			v.add("scanner.sbom", "is only supported by the snyk backend")
+		}
+	}
+	retry := c.Scanner.Retry
+	if retry.BaseDelay.Duration <= 0 {
+		v.add("scanner.retry.baseDelay", "must be positive")
+	}
+	if retry.MaxDelay.Duration < retry.BaseDelay.Duration {
+		v.add("scanner.retry.maxDelay", "must not be less than baseDelay")
+	}
+	if retry.MaxAttempts < 1 {
+		v.add("scanner.retry.maxAttempts", "must be at least 1")
+	}
+
+	validateSnykOptions(v, "scanner.snyk", c.Scanner.Snyk)
+	for i, rule := range c.Scanner.SnykRules {
+		p := fmt.Sprintf("scanner.snykRules[%d]", i)
+		if len(rule.Repositories) == 0 {
+			v.add(p+".repositories", "must not be empty")
+		}
+		validatePatterns(v, p+".repositories", rule.Repositories)
+		validatePatterns(v, p+".tags", rule.Tags)
+		validateSnykOptions(v, p, rule.SnykOptions)
+	}
+
+	c.validateJobTemplate(v)
+
+	for i, route := range c.Namespaces {
+		p := fmt.Sprintf("namespaces[%d]", i)
+		for _, msg := range validation.IsDNS1123Label(route.Namespace) {
+			v.add(p+".namespace", "%s", msg)
+		}
+		if len(route.Repositories) == 0 {
+			v.add(p+".repositories", "must not be empty")
+		}
+		validatePatterns(v, p+".repositories", route.Repositories)
+	}
+
+	if len(c.Tenants) > 0 && c.Webhook.TokenFile == "" {
+		v.add("webhook.tokenFile", "must be set with tenants")
+	}
+	names := map[string]bool{}
+	for i, t := range c.Tenants {
+		p := fmt.Sprintf("tenants[%d]", i)
+		for _, msg := range validation.IsDNS1123Label(t.Name) {
+			v.add(p+".name", "%s", msg)
+		}
+		if names[t.Name] {
+			v.add(p+".name", "duplicate tenant %q", t.Name)
+		}
+		names[t.Name] = true
+		if t.TokenFile == "" {
+			v.add(p+".tokenFile", "must be set")
+		}
+		if t.Filters != nil {
+			if err := t.Filters.Validate(); err != nil {
+				v.add(p+".filters", "%s", err)
+			}
+		}
+		if t.Namespace != "" {
+			for _, msg := range validation.IsDNS1123Label(t.Namespace) {
+				v.add(p+".namespace", "%s", msg)
+			}
+		}
+	}
+
+	for i, dir := range c.Advisories.Dirs {
+		if dir == "" {
+			v.add(fmt.Sprintf("advisories.dirs[%d]", i), "must not be empty")
+		}
+	}
+	for i, u := range c.Advisories.URLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			v.add(fmt.Sprintf("advisories.urls[%d]", i), "must be an http or https URL")
+		}
+	}
+	if c.Advisories.Interval.Duration < 0 {
+		v.add("advisories.interval", "must not be negative")
+	}
+
+	c.Retention.Results.validate(v, "retention.results")
+	c.Retention.DeadLetters.validate(v, "retention.deadLetters")
+
+	return errors.Join(v.errs...)
+}
+
+func validatePatterns(v *validator, field string, patterns []string) {
+	for i, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add(fmt.Sprintf("%s[%d]", field, i), "invalid pattern %q", pattern)
+		}
+	}
+}
+
+func validateSnykOptions(v *validator, field string, o v1alpha1.SnykOptions) {
+	if o.Mode != "" && !slices.Contains(scanner.SnykModes, scanner.SnykMode(o.Mode)) {
+		v.add(field+".mode", "must be one of monitor, test, both")
+	}
+	if o.SeverityThreshold != "" && (!slices.Contains(scanner.Severities, scanner.Severity(o.SeverityThreshold)) || o.SeverityThreshold == string(scanner.SeverityUnknown)) {
+		v.add(field+".severityThreshold", "must be one of low, medium, high, critical")
+	}
+	if o.FailOn != "" && !slices.Contains(scanner.SnykFailOnValues, o.FailOn) {
+		v.add(field+".failOn", "must be one of %s", strings.Join(scanner.SnykFailOnValues, ", "))
+	}
+	if o.Policy != nil {
+		for _, msg := range validation.IsDNS1123Subdomain(o.Policy.Name) {
+			v.add(field+".policy.name", "%s", msg)
+		}
+		if o.Policy.Key != "" {
+			for _, msg := range validation.IsConfigMapKey(o.Policy.Key) {
+				v.add(field+".policy.key", "%s", msg)
+			}
+		}
+	}
+}
+
+func (p RetentionPolicy) validate(v *validator, path string) {
+	if p.MaxAge.Duration < 0 {
+		v.add(path+".maxAge", "must not be negative")
+	}
+	if p.MaxEntries < 0 {
+		v.add(path+".maxEntries", "must not be negative")
+	}
+}
+
+func (c *Config) validateJobTemplate(v *validator) {
+	t := c.JobTemplate
+	for _, k := range sortedKeys(t.Labels) {
+		val := t.Labels[k]
+		for _, msg := range validation.IsQualifiedName(k) {
+			v.add("jobTemplate.labels["+k+"]", "%s", msg)
+		}
+		for _, msg := range validation.IsValidLabelValue(val) {
+			v.add("jobTemplate.labels["+k+"]", "%s", msg)
+		}
+	}
+	for _, k := range sortedKeys(t.Annotations) {
+		for _, msg := range validation.IsQualifiedName(k) {
+			v.add("jobTemplate.annotations["+k+"]", "%s", msg)
+		}
+	}
+	if t.ServiceAccountName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(t.ServiceAccountName) {
+			v.add("jobTemplate.serviceAccountName", "%s", msg)
+		}
+	}
+	for name, q := range t.Resources.Requests {
+		if limit, ok := t.Resources.Limits[name]; ok && q.Cmp(limit) > 0 {
+			v.add("jobTemplate.resources.requests["+string(name)+"]", "must not exceed the limit %s", limit.String())
+		}
+		if q.Sign() < 0 {
+			v.add("jobTemplate.resources.requests["+string(name)+"]", "must not be negative")
+		}
+	}
+	for name, q := range t.Resources.Limits {
+		if q.Sign() < 0 {
+			v.add("jobTemplate.resources.limits["+string(name)+"]", "must not be negative")
+		}
+	}
+	if t.BackoffLimit != nil && *t.BackoffLimit < 0 {
+		v.add("jobTemplate.backoffLimit", "must not be negative")
+	}
+	if t.ActiveDeadlineSeconds != nil && *t.ActiveDeadlineSeconds <= 0 {
+		v.add("jobTemplate.activeDeadlineSeconds", "must be positive")
+	}
+	if t.TTLSecondsAfterFinished != nil && *t.TTLSecondsAfterFinished < 0 {
+		v.add("jobTemplate.ttlSecondsAfterFinished", "must not be negative")
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
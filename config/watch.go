@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+)
+
+// DefaultWatchInterval is the interval in which a Watcher checks the configuration file for changes.
+const DefaultWatchInterval = 10 * time.Second
+
+// Watcher reloads a configuration file when it changes. Invalid changes are logged and ignored,
+// the last valid configuration stays in effect.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	logger   logr.Logger
+
+	mu        sync.Mutex
+	data      []byte
+	callbacks []func(*Config)
+
+	current atomic.Pointer[Config]
+}
+
+// NewWatcher loads the configuration file at path.
+func NewWatcher(path string, logger logr.Logger) (*Watcher, error) {
+	w := &Watcher{
+		path:     path,
+		interval: DefaultWatchInterval,
+		logger:   logger,
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	w.data = data
+	w.current.Store(c)
+	return w, nil
+}
+
+// WithWatchInterval sets the interval in which the file is checked for changes.
+func (w *Watcher) WithWatchInterval(interval time.Duration) *Watcher {
+	w.interval = interval
+	return w
+}
+
+// Current returns the configuration in effect.
+func (w *Watcher) Current() *Config {
+	return w.current.Load()
+}
+
+// OnChange registers a callback that is called with every new valid configuration.
+func (w *Watcher) OnChange(f func(*Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callbacks = append(w.callbacks, f)
+}
+
+// Start checks the file for changes until ctx is cancelled.
+func (w *Watcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.Reload(); err != nil {
+				w.logger.Error(err, "ignoring invalid configuration, keeping the previous one", "path", w.path)
+			}
+		}
+	}
+}
+
+// NeedLeaderElection is false, every replica reloads its configuration.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// restartRequired returns the settings that differ between old and c and are only applied at startup.
+func restartRequired(old, c *Config) []string {
+	var changed []string
+	for _, s := range []struct {
+		name    string
+		changed bool
+	}{
+		{"webhook", !reflect.DeepEqual(old.Webhook, c.Webhook)},
+		{"registries.cacheSize", old.Registries.CacheSize != c.Registries.CacheSize},
+		{"namespaces", !reflect.DeepEqual(old.Namespaces, c.Namespaces)},
+		{"tenants", !reflect.DeepEqual(old.Tenants, c.Tenants)},
+		{"referrers", old.Referrers != c.Referrers},
+		{"lineage", old.Lineage != c.Lineage},
+		{"advisories", !reflect.DeepEqual(old.Advisories, c.Advisories)},
+	} {
+		if s.changed {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+// Reload reads the file and applies it if it changed and is valid.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		metrics.ConfigReload(err)
+		return err
+	}
+	if bytes.Equal(data, w.data) {
+		return nil
+	}
+	c, err := Parse(data)
+	// don't parse the same invalid file again
+	w.data = data
+	metrics.ConfigReload(err)
+	if err != nil {
+		return err
+	}
+
+	old := w.current.Swap(c)
+	if changed := restartRequired(old, c); len(changed) > 0 {
+		w.logger.Info("changed settings only take effect after a restart", "path", w.path, "settings", changed)
+	}
+	w.logger.Info("reloaded configuration", "path", w.path)
+	for _, f := range w.callbacks {
+		f(c)
+	}
+	return nil
+}
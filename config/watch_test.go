@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Watcher", func() {
+	const header = "apiVersion: registry-snyk-scan.stackit.cloud/v1alpha1\nkind: Config\n"
+
+	var (
+		path    string
+		watcher *Watcher
+		applied []*Config
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(header+"scanner:\n  image: snyk/snyk:1\n"), 0o600)).To(Succeed())
+		var err error
+		watcher, err = NewWatcher(path, zap.New())
+		Expect(err).NotTo(HaveOccurred())
+		applied = nil
+		watcher.OnChange(func(c *Config) {
+			applied = append(applied, c)
+		})
+	})
+
+	It("should apply valid changes", func() {
+		Expect(watcher.Current().Scanner.Image).To(Equal("snyk/snyk:1"))
+
+		Expect(os.WriteFile(path, []byte(header+"scanner:\n  image: snyk/snyk:2\n"), 0o600)).To(Succeed())
+		Expect(watcher.Reload()).To(Succeed())
+		Expect(watcher.Current().Scanner.Image).To(Equal("snyk/snyk:2"))
+		Expect(applied).To(HaveLen(1))
+	})
+
+	It("should not apply an unchanged file again", func() {
+		Expect(watcher.Reload()).To(Succeed())
+		Expect(applied).To(BeEmpty())
+	})
+
+	It("should keep the previous configuration if the change is invalid", func() {
+		Expect(os.WriteFile(path, []byte(header+"scanner:\n  retry:\n    maxAttempts: 0\n"), 0o600)).To(Succeed())
+		Expect(watcher.Reload()).To(MatchError(ContainSubstring("scanner.retry.maxAttempts")))
+		Expect(watcher.Current().Scanner.Image).To(Equal("snyk/snyk:1"))
+		Expect(applied).To(BeEmpty())
+	})
+
+	It("should warn about changes that need a restart", func() {
+		var logged []string
+		watcher.logger = funcr.New(func(prefix, args string) {
+			logged = append(logged, args)
+		}, funcr.Options{})
+
+		Expect(os.WriteFile(path, []byte(header+"scanner:\n  image: snyk/snyk:1\nlineage:\n  enabled: true\n"), 0o600)).To(Succeed())
+		Expect(watcher.Reload()).To(Succeed())
+		Expect(logged).To(ContainElement(And(ContainSubstring("only take effect after a restart"), ContainSubstring(`"settings"=["lineage"]`))))
+
+		logged = nil
+		Expect(os.WriteFile(path, []byte(header+"scanner:\n  image: snyk/snyk:2\nlineage:\n  enabled: true\n"), 0o600)).To(Succeed())
+		Expect(watcher.Reload()).To(Succeed())
+		Expect(logged).NotTo(ContainElement(ContainSubstring("only take effect after a restart")))
+	})
+
+	It("should fail to start with an invalid file", func() {
+		Expect(os.WriteFile(path, []byte("kind: Config\n"), 0o600)).To(Succeed())
+		_, err := NewWatcher(path, zap.New())
+		Expect(err).To(MatchError(ContainSubstring("apiVersion")))
+	})
+})
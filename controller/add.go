@@ -2,7 +2,10 @@ package controller
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
 	"github.com/stackitcloud/registry-snyk-scan/types"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -20,13 +23,53 @@ func (r *Reconciler) AddToManager(mgr manager.Manager, sourceChannel <-chan even
 	if r.client == nil {
 		r.client = mgr.GetClient()
 	}
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
+	if r.Reader == nil {
+		r.Reader = mgr.GetAPIReader()
+	}
+	if r.Registry == nil {
+		// credentials are read without cache, like all secrets
+		r.Registry = registry.NewClient(r.Registries, mgr.GetAPIReader(), r.Namespace, registry.DefaultCacheSize)
+	}
 
 	return builder.TypedControllerManagedBy[types.RegistryEvent](mgr).
 		Named(ControllerName).
 		WatchesRawSource(source.TypedChannel[types.RegistryEvent, types.RegistryEvent](sourceChannel, &handler.TypedFuncs[types.RegistryEvent, types.RegistryEvent]{
 			GenericFunc: func(ctx context.Context, e event.TypedGenericEvent[types.RegistryEvent], w workqueue.TypedRateLimitingInterface[types.RegistryEvent]) {
-				w.Add(e.Object)
+				w.Add(r.QueueKey(e.Object))
 			},
 		})).
+		WatchesRawSource(source.TypedFunc[types.RegistryEvent](r.enqueueRescans)).
 		Complete(r)
 }
+
+// enqueueRescans queues the events of the images that are rescanned periodically according to Results,
+// so their rescans continue after a restart or on a new leader.
+func (r *Reconciler) enqueueRescans(ctx context.Context, w workqueue.TypedRateLimitingInterface[types.RegistryEvent]) error {
+	if r.Results == nil {
+		return nil
+	}
+	list, err := r.Results.List(ctx, results.Filter{})
+	if err != nil {
+		return fmt.Errorf("listing results to reschedule rescans: %w", err)
+	}
+	for _, res := range list {
+		if res.Period != nil {
+			w.Add(res.Event)
+		}
+	}
+	return nil
+}
+
+// QueueKey returns the event that is queued for e. The media type and config digest of the notification are passed
+// to the Registry if it is a DescriptorHinter, and dropped from the event, so that all events of an image are
+// deduplicated by the queue and recorded as the same result.
+func (r *Reconciler) QueueKey(e types.RegistryEvent) types.RegistryEvent {
+	if h, ok := r.Registry.(DescriptorHinter); ok {
+		h.Hint(e)
+	}
+	e.MediaType, e.ConfigDigest = "", ""
+	return e
+}
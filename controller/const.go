@@ -3,10 +3,34 @@ package controller
 import imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
 
 const (
-	snykTokenSecretName = "snyk-token"
+	annotationPrefix = "registry-snyk-scan.stackit.cloud/"
+	// policyAnnotation names the ScanPolicy applied to a scan job.
+	policyAnnotation = annotationPrefix + "policy"
+	// rescanPeriodAnnotation is the start of the rescan period of a scan job.
+	rescanPeriodAnnotation = annotationPrefix + "rescan-period"
+	// scannerAnnotation is the backend of a scan job.
+	scannerAnnotation = annotationPrefix + "scanner"
+	// eventAnnotation holds the JSON encoded event of a scan job.
+	eventAnnotation = annotationPrefix + "event"
+	// advisoryAnnotation is the ID of the vulnerability advisory that triggered a rescan job.
+	advisoryAnnotation = annotationPrefix + "advisory"
+	// baseUpdateAnnotation is the new digest of the base image that triggered a rescan job.
+	baseUpdateAnnotation = annotationPrefix + "base-update"
+	// recordedAnnotation marks a finished scan job whose result was recorded, so it isn't recorded again after a
+	// restart or by a new leader or shard.
+	recordedAnnotation = annotationPrefix + "recorded"
+	// snykPolicyAnnotation is the ConfigMap and digest of the snyk policy of a scan job.
+	snykPolicyAnnotation = annotationPrefix + "snyk-policy"
+
+	// SnykPolicyLabel opts ConfigMaps with snyk policies into rescanning the images using them when they change.
+	SnykPolicyLabel = annotationPrefix + "snyk-policy"
+
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "registry-snyk-scan"
 )
 
-var supportedPlatforms = []imagev1.Platform{
+// defaultSupportedPlatforms is used if the Reconciler has no SupportedPlatforms.
+var defaultSupportedPlatforms = []imagev1.Platform{
 	{
 		OS:           "linux",
 		Architecture: "amd64",
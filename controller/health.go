@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	v1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// CacheSyncCheck fails until the informers of c are synced.
+func CacheSyncCheck(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+		defer cancel()
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("informer cache is not synced")
+		}
+		return nil
+	}
+}
+
+// snykSecretCheckInterval is how long SnykSecretCheck trusts a successful check, so that frequent probes
+// don't read the secret from the API server every time.
+const snykSecretCheckInterval = time.Minute
+
+// SnykSecretCheck fails if the secret with the snyk token of r's Scanner doesn't exist in its namespace.
+// It always passes if the Scanner uses another backend. After a successful check, the secret is only read
+// again after snykSecretCheckInterval or if the name of the secret changed.
+func SnykSecretCheck(reader client.Reader, r *Reconciler) healthz.Checker {
+	var (
+		mu        sync.Mutex
+		checked   string
+		succeeded time.Time
+	)
+	return func(req *http.Request) error {
+		s, err := r.settings().Scanner.New()
+		if err != nil {
+			return err
+		}
+		snyk, ok := s.(*scanner.Snyk)
+		if !ok {
+			return nil
+		}
+		name := snyk.TokenSecretName()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if name == checked && time.Since(succeeded) < snykSecretCheckInterval {
+			return nil
+		}
+		var secret v1.Secret
+		if err := reader.Get(req.Context(), k8stypes.NamespacedName{Namespace: r.Namespace, Name: name}, &secret); err != nil {
+			return fmt.Errorf("getting snyk secret %s/%s: %w", r.Namespace, name, err)
+		}
+		checked, succeeded = name, time.Now()
+		return nil
+	}
+}
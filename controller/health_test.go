@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("SnykSecretCheck", func() {
+	req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+
+	It("should fail without the snyk secret", func() {
+		check := SnykSecretCheck(fake.NewClientBuilder().Build(), &Reconciler{Namespace: "default"})
+		Expect(check(req)).To(MatchError(ContainSubstring("snyk-token")))
+	})
+
+	It("should succeed with the snyk secret", func() {
+		c := fake.NewClientBuilder().WithObjects(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: scanner.DefaultSnykTokenSecret, Namespace: "default"},
+		}).Build()
+		Expect(SnykSecretCheck(c, &Reconciler{Namespace: "default"})(req)).To(Succeed())
+	})
+
+	It("should not read the secret again after a successful check", func(ctx SpecContext) {
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: scanner.DefaultSnykTokenSecret, Namespace: "default"},
+		}
+		c := fake.NewClientBuilder().WithObjects(secret).Build()
+		check := SnykSecretCheck(c, &Reconciler{Namespace: "default"})
+		Expect(check(req)).To(Succeed())
+		Expect(c.Delete(ctx, secret)).To(Succeed())
+		Expect(check(req)).To(Succeed())
+	})
+
+	It("should check the configured secret", func() {
+		c := fake.NewClientBuilder().WithObjects(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: scanner.DefaultSnykTokenSecret, Namespace: "default"},
+		}).Build()
+		r := &Reconciler{Namespace: "default"}
+		r.Reconfigure(Settings{Scanner: Scanner{TokenSecret: "team-token"}})
+		Expect(SnykSecretCheck(c, r)(req)).To(MatchError(ContainSubstring("team-token")))
+	})
+})
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// Scanner configures the scan container.
+type Scanner struct {
+	// Backend is one of scanner.Backends. Defaults to snyk.
+	Backend string `json:"backend,omitempty"`
+	// Image of the scanner. Defaults to the image of the backend, like snyk/snyk:linux.
+	Image string `json:"image,omitempty"`
+	// Args are passed to the scanner in addition to the arguments set by the backend.
+	Args []string `json:"args,omitempty"`
+	// Org overrides SNYK_ORG of the token secret.
+	Org string `json:"org,omitempty"`
+	// TokenSecret is the name of the secret with the keys SNYK_TOKEN and SNYK_ORG. Defaults to snyk-token.
+	TokenSecret string `json:"tokenSecret,omitempty"`
+	// Snyk selects the snyk commands and their gating options.
+	Snyk v1alpha1.SnykOptions `json:"snyk,omitempty"`
+	// SnykRules override Snyk for the images of matching repositories and tags. The first matching rule wins.
+	SnykRules []SnykRule `json:"snykRules,omitempty"`
+	// Prefetch copies the image into the scan pod before the snyk scan, if set.
+	Prefetch *scanner.Prefetch `json:"prefetch,omitempty"`
+	// SBOM prints bills of materials of the images in init containers of the snyk scan, if set.
+	SBOM *scanner.SBOM `json:"sbom,omitempty"`
+}
+
+func (s Scanner) backend() string {
+	if s.Backend == "" {
+		return scanner.BackendSnyk
+	}
+	return s.Backend
+}
+
+// New returns the scanner backend configured by s.
+func (s Scanner) New() (scanner.Scanner, error) {
+	return scanner.New(s.Backend, scanner.Options{
+		Image:       s.Image,
+		Args:        s.Args,
+		Org:         s.Org,
+		TokenSecret: s.TokenSecret,
+		Snyk:        snykOptions(s.Snyk),
+		Prefetch:    s.Prefetch,
+		SBOM:        s.SBOM,
+	})
+}
+
+// withOverrides returns s with the fields set in o replaced. Args are appended.
+// Switching to another backend resets the image and args, as they only apply to the previous backend.
+func (s Scanner) withOverrides(o v1alpha1.ScannerOverrides) Scanner {
+	if o.Backend != "" && o.Backend != s.backend() {
+		s.Backend, s.Image, s.Args = o.Backend, "", nil
+	}
+	if o.Image != "" {
+		s.Image = o.Image
+	}
+	if o.Org != "" {
+		s.Org = o.Org
+	}
+	if o.TokenSecret != "" {
+		s.TokenSecret = o.TokenSecret
+	}
+	if o.Snyk != nil {
+		s.Snyk = overlaySnykOptions(s.Snyk, *o.Snyk)
+	}
+	s.Args = slices.Concat(s.Args, o.Args)
+	return s
+}
+
+// JobTemplate customizes the scan jobs.
+type JobTemplate = v1alpha1.JobTemplate
+
+func applyJobTemplate(t JobTemplate, job *batchv1.Job) {
+	job.Labels = merge(job.Labels, t.Labels)
+	job.Annotations = merge(job.Annotations, t.Annotations)
+	job.Spec.Template.Labels = merge(job.Spec.Template.Labels, t.Labels)
+	job.Spec.Template.Annotations = merge(job.Spec.Template.Annotations, t.Annotations)
+
+	job.Spec.BackoffLimit = t.BackoffLimit
+	job.Spec.ActiveDeadlineSeconds = t.ActiveDeadlineSeconds
+	job.Spec.TTLSecondsAfterFinished = t.TTLSecondsAfterFinished
+
+	pod := &job.Spec.Template.Spec
+	pod.ServiceAccountName = t.ServiceAccountName
+	pod.NodeSelector = t.NodeSelector
+	pod.Tolerations = t.Tolerations
+	for i := range pod.InitContainers {
+		pod.InitContainers[i].Resources = t.Resources
+	}
+	for i := range pod.Containers {
+		pod.Containers[i].Resources = t.Resources
+	}
+}
+
+// overlayJobTemplate returns base with the fields set in o replaced. Labels and annotations of o are added to base.
+func overlayJobTemplate(base, o JobTemplate) JobTemplate {
+	t := base
+	t.Labels = merge(o.Labels, base.Labels)
+	t.Annotations = merge(o.Annotations, base.Annotations)
+	if o.ServiceAccountName != "" {
+		t.ServiceAccountName = o.ServiceAccountName
+	}
+	if o.Resources.Limits != nil || o.Resources.Requests != nil || o.Resources.Claims != nil {
+		t.Resources = o.Resources
+	}
+	if o.NodeSelector != nil {
+		t.NodeSelector = o.NodeSelector
+	}
+	if o.Tolerations != nil {
+		t.Tolerations = o.Tolerations
+	}
+	if o.BackoffLimit != nil {
+		t.BackoffLimit = o.BackoffLimit
+	}
+	if o.ActiveDeadlineSeconds != nil {
+		t.ActiveDeadlineSeconds = o.ActiveDeadlineSeconds
+	}
+	if o.TTLSecondsAfterFinished != nil {
+		t.TTLSecondsAfterFinished = o.TTLSecondsAfterFinished
+	}
+	return t
+}
+
+// merge adds the entries of extra that are not in m yet.
+func merge(m, extra map[string]string) map[string]string {
+	if len(extra) == 0 {
+		return m
+	}
+	merged := maps.Clone(extra)
+	maps.Copy(merged, m)
+	return merged
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/stackitcloud/registry-snyk-scan/lineage"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// AncestryReader reads the annotations and layers of images.
+type AncestryReader interface {
+	Ancestry(ctx context.Context, e types.RegistryEvent) (registry.Ancestry, error)
+}
+
+// Lineage records the base image of every pushed image in Graph.
+type Lineage struct {
+	Registry AncestryReader
+	Graph    *lineage.Graph
+	// Events receives a rescan of every image that became outdated, usually the source channel of the Reconciler.
+	// Outdated images are only reported if it is nil.
+	Events chan<- event.TypedGenericEvent[types.RegistryEvent]
+}
+
+// record adds the push of e to the graph. Failures are only logged, as the scan doesn't depend on the lineage.
+func (l *Lineage) record(ctx context.Context, log logr.Logger, e types.RegistryEvent) {
+	a, err := l.Registry.Ancestry(ctx, e)
+	if err != nil {
+		log.Error(err, "reading the layers of the image to find its base")
+		return
+	}
+	for _, n := range l.Graph.Record(e, a.Annotations, a.Layers) {
+		log.Info("Image is outdated, its base image was pushed again", "outdated", n.Digest, "images", len(n.Images))
+		if l.Events == nil {
+			continue
+		}
+		// one rescan per digest, like for advisories
+		img := n.Images[0]
+		rescan := types.RegistryEvent{
+			Registry:   img.Registry,
+			Repository: img.Repository,
+			Tag:        img.Tag,
+			Digest:     n.Digest,
+			Tenant:     img.Tenant,
+			BaseUpdate: n.Outdated.Current,
+		}
+		select {
+		case l.Events <- event.TypedGenericEvent[types.RegistryEvent]{Object: rescan}:
+			metrics.BaseImageRescan(rescan.Registry, rescan.Repository)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/lineage"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// fakeAncestry returns the layers of every digest.
+type fakeAncestry map[digest.Digest][]digest.Digest
+
+func (f fakeAncestry) Ancestry(_ context.Context, e types.RegistryEvent) (registry.Ancestry, error) {
+	return registry.Ancestry{Layers: f[e.Digest]}, nil
+}
+
+var _ = Describe("Lineage", func() {
+	It("should record the base of pushed images", func(ctx SpecContext) {
+		base := types.RegistryEvent{Registry: "registry.example.com", Repository: "base/debian", Tag: "12", Digest: digest.FromString("debian 12")}
+		app := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/app", Tag: "v1", Digest: digest.FromString("app")}
+		rebuilt := types.RegistryEvent{Registry: "registry.example.com", Repository: "base/debian", Tag: "12", Digest: digest.FromString("debian 12.1")}
+		graph := lineage.NewGraph(0)
+		events := make(chan event.TypedGenericEvent[types.RegistryEvent], 1)
+		c := fake.NewClientBuilder().Build()
+		r := Reconciler{
+			client:   c,
+			Registry: linuxAMD64,
+			Lineage: &Lineage{
+				Registry: fakeAncestry{
+					base.Digest:    {digest.FromString("debian")},
+					app.Digest:     {digest.FromString("debian"), digest.FromString("app")},
+					rebuilt.Digest: {digest.FromString("debian 12.1")},
+				},
+				Graph:  graph,
+				Events: events,
+			},
+		}
+
+		for _, e := range []types.RegistryEvent{base, app, rebuilt} {
+			_, err := r.Reconcile(ctx, e)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(graph.Outdated(app.Digest)).To(HaveField("Current", rebuilt.Digest))
+
+		// the outdated image is rescanned once for the new base
+		rescan := app
+		rescan.BaseUpdate = rebuilt.Digest
+		Expect(events).To(Receive(HaveField("Object", rescan)))
+		_, err := r.Reconcile(ctx, rescan)
+		Expect(err).NotTo(HaveOccurred())
+		var job batchv1.Job
+		Expect(c.Get(ctx, client.ObjectKey{Name: scanJobName(app, "base="+rebuilt.Digest.String())}, &job)).To(Succeed())
+		Expect(job.Annotations).To(HaveKeyWithValue(baseUpdateAnnotation, rebuilt.Digest.String()))
+
+		// rescans are no pushes
+		rescan = base
+		rescan.Advisory = "DSA-5532-1"
+		_, err = r.Reconcile(ctx, rescan)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(graph.Outdated(app.Digest)).NotTo(BeNil())
+		Expect(events).NotTo(Receive())
+	})
+})
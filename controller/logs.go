@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+// DefaultLogLimit is the number of bytes of scan output read by default.
+const DefaultLogLimit = 8 << 20
+
+// LogReader reads the output of a container of a finished scan job, usually scanner.ContainerName.
+type LogReader interface {
+	ScanLogs(ctx context.Context, job *batchv1.Job, container string) ([]byte, error)
+}
+
+// PodLogs reads the logs of a container of the most recent pod of a job. Logs longer than LimitBytes are
+// rejected instead of parsing a truncated report.
+type PodLogs struct {
+	Clientset kubernetes.Interface
+	// LimitBytes defaults to DefaultLogLimit.
+	LimitBytes int64
+}
+
+func (p *PodLogs) ScanLogs(ctx context.Context, job *batchv1.Job, container string) ([]byte, error) {
+	if job.Spec.Selector == nil {
+		return nil, fmt.Errorf("job %s has no selector", job.Name)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := p.Clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("listing pods of job %s: %w", job.Name, err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("job %s has no pods", job.Name)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.After(pods.Items[j].CreationTimestamp.Time)
+	})
+
+	limit := p.LimitBytes
+	if limit <= 0 {
+		limit = DefaultLogLimit
+	}
+	pod := pods.Items[0]
+	// one byte more than the limit tells truncated logs apart
+	stream, err := p.Clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container:  container,
+		LimitBytes: ptr.To(limit + 1),
+	}).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading logs of pod %s: %w", pod.Name, err)
+	}
+	defer stream.Close()
+	logs, err := io.ReadAll(io.LimitReader(stream, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading logs of pod %s: %w", pod.Name, err)
+	}
+	if int64(len(logs)) > limit {
+		return nil, fmt.Errorf("logs of pod %s exceed %d bytes", pod.Name, limit)
+	}
+	return logs, nil
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+var _ = Describe("PodLogs", func() {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "scan", Namespace: "default"},
+		Spec: batchv1.JobSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"batch.kubernetes.io/job-name": "scan"}},
+		},
+	}
+	pod := func(name string, created time.Time) v1.Pod {
+		return v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Labels:            map[string]string{"batch.kubernetes.io/job-name": "scan"},
+			CreationTimestamp: metav1.NewTime(created),
+		}}
+	}
+	// apiServer serves the pods and logs of the pods, which the fake clientset doesn't tell apart
+	apiServer := func(logs map[string]string, pods ...v1.Pod) kubernetes.Interface {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, isLog := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/default/pods/"), "/log")
+			if isLog {
+				_, _ = w.Write([]byte(logs[name]))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(&v1.PodList{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"},
+				Items:    pods,
+			})
+		}))
+		DeferCleanup(srv.Close)
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+		Expect(err).NotTo(HaveOccurred())
+		return clientset
+	}
+
+	It("should read the logs of the newest pod", func(ctx SpecContext) {
+		p := &PodLogs{Clientset: apiServer(
+			map[string]string{"scan-1": "first attempt", "scan-2": "second attempt"},
+			pod("scan-1", time.Now().Add(-time.Hour)), pod("scan-2", time.Now()),
+		)}
+		logs, err := p.ScanLogs(ctx, job, scanner.ContainerName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(logs)).To(Equal("second attempt"))
+	})
+
+	It("should reject logs over the limit", func(ctx SpecContext) {
+		p := &PodLogs{
+			Clientset:  apiServer(map[string]string{"scan-1": "0123456789"}, pod("scan-1", time.Now())),
+			LimitBytes: 9,
+		}
+		_, err := p.ScanLogs(ctx, job, scanner.ContainerName)
+		Expect(err).To(MatchError(ContainSubstring("exceed 9 bytes")))
+
+		p.LimitBytes = 10
+		Expect(p.ScanLogs(ctx, job, scanner.ContainerName)).To(Equal([]byte("0123456789")))
+	})
+
+	It("should fail without pods", func(ctx SpecContext) {
+		p := &PodLogs{Clientset: kubefake.NewSimpleClientset()}
+		_, err := p.ScanLogs(ctx, job, scanner.ContainerName)
+		Expect(err).To(MatchError(ContainSubstring("has no pods")))
+	})
+})
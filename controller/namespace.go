@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+// NamespaceRoute sends the scan jobs of the repositories it matches to another namespace.
+type NamespaceRoute struct {
+	// Repositories are glob patterns matched against "<registry>/<repository>", see path.Match.
+	Repositories []string `json:"repositories"`
+	// Namespace the scan jobs are created in. It needs the secrets of the scanner and the credentials secrets
+	// and CA bundles of the registry profiles.
+	Namespace string `json:"namespace"`
+}
+
+func (n NamespaceRoute) matches(key string) bool {
+	for _, pattern := range n.Repositories {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetNamespaces returns the namespaces scan jobs can be created in, which the manager cache has to cover.
+func TargetNamespaces(defaultNamespace string, routes []NamespaceRoute, tenants map[string]Tenant) []string {
+	set := map[string]struct{}{defaultNamespace: {}}
+	for _, route := range routes {
+		set[route.Namespace] = struct{}{}
+	}
+	for _, t := range tenants {
+		if t.Namespace != "" {
+			set[t.Namespace] = struct{}{}
+		}
+	}
+	namespaces := make([]string, 0, len(set))
+	for ns := range set {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// namespaceFor returns the namespace of the scan job of e. The namespace of the tenant takes precedence,
+// then the first matching route wins.
+func (r *Reconciler) namespaceFor(e types.RegistryEvent) string {
+	if t, ok := r.tenant(e); ok && t.Namespace != "" {
+		return t.Namespace
+	}
+	key := e.RepositoryPath()
+	for _, route := range r.NamespaceRoutes {
+		if route.matches(key) {
+			return route.Namespace
+		}
+	}
+	return r.Namespace
+}
+
+// checkNamespace returns an error if the namespace of job or a Secret or ConfigMap it references doesn't exist,
+// in which case the pod of the job would never start. The namespace is read without cache and only its metadata,
+// so that no informer watches all namespaces.
+func (r *Reconciler) checkNamespace(ctx context.Context, job *batchv1.Job) error {
+	namespace := job.Namespace
+	var ns metav1.PartialObjectMetadata
+	ns.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("Namespace"))
+	if err := r.apiReader().Get(ctx, k8stypes.NamespacedName{Name: namespace}, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("target namespace %s does not exist", namespace)
+		}
+		return fmt.Errorf("getting target namespace %s: %w", namespace, err)
+	}
+
+	for _, name := range referencedSecrets(&job.Spec.Template.Spec) {
+		var secret v1.Secret
+		if err := r.apiReader().Get(ctx, k8stypes.NamespacedName{Namespace: namespace, Name: name}, &secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return fmt.Errorf("secret %s does not exist in target namespace %s", name, namespace)
+			}
+			return fmt.Errorf("getting secret %s/%s: %w", namespace, name, err)
+		}
+	}
+	for _, name := range referencedConfigMaps(&job.Spec.Template.Spec) {
+		var configMap v1.ConfigMap
+		if err := r.apiReader().Get(ctx, k8stypes.NamespacedName{Namespace: namespace, Name: name}, &configMap); err != nil {
+			if apierrors.IsNotFound(err) {
+				return fmt.Errorf("ConfigMap %s does not exist in target namespace %s", name, namespace)
+			}
+			return fmt.Errorf("getting ConfigMap %s/%s: %w", namespace, name, err)
+		}
+	}
+	return nil
+}
+
+// referencedSecrets returns the names of the secrets used by the environment variables and volumes of pod.
+func referencedSecrets(pod *v1.PodSpec) []string {
+	var names []string
+	add := func(name string) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, c := range slices.Concat(pod.InitContainers, pod.Containers) {
+		for _, env := range c.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				add(env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+	for _, vol := range pod.Volumes {
+		if vol.Secret != nil {
+			add(vol.Secret.SecretName)
+		}
+	}
+	return names
+}
+
+// referencedConfigMaps returns the names of the ConfigMaps used by the environment variables and volumes of pod,
+// like the CA bundles of registry profiles and snyk policies.
+func referencedConfigMaps(pod *v1.PodSpec) []string {
+	var names []string
+	add := func(name string) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, c := range slices.Concat(pod.InitContainers, pod.Containers) {
+		for _, env := range c.Env {
+			if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil {
+				add(env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+		}
+	}
+	for _, vol := range pod.Volumes {
+		if vol.ConfigMap != nil {
+			add(vol.ConfigMap.Name)
+		}
+	}
+	return names
+}
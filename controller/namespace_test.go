@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("NamespaceRoutes", func() {
+	routes := []NamespaceRoute{
+		{Repositories: []string{"registry.example.com/team-a/*"}, Namespace: "team-a"},
+		{Repositories: []string{"registry.example.com/*/*"}, Namespace: "shared"},
+	}
+	event := types.RegistryEvent{
+		Registry:   "registry.example.com",
+		Repository: "team-a/app",
+		Tag:        "latest",
+		Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+	}
+	namespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	secret := func(namespace, name string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	newReconciler := func(objs ...client.Object) (*Reconciler, client.Client, results.Store) {
+		c := fake.NewClientBuilder().WithObjects(objs...).Build()
+		store := results.NewMemoryStore()
+		return &Reconciler{
+			Namespace:       "scans",
+			NamespaceRoutes: routes,
+			client:          c,
+			Registry:        linuxAMD64,
+			Results:         store,
+		}, c, store
+	}
+
+	It("should list all target namespaces once", func() {
+		Expect(TargetNamespaces("scans", append(routes, NamespaceRoute{Namespace: "team-a"}), map[string]Tenant{"b": {Namespace: "team-b"}, "c": {}})).To(Equal([]string{"scans", "shared", "team-a", "team-b"}))
+	})
+
+	It("should create the job in the first matching namespace", func(ctx SpecContext) {
+		r, c, _ := newReconciler(namespace("team-a"), secret("team-a", scanner.DefaultSnykTokenSecret))
+
+		_, err := r.Reconcile(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		Expect(jobs.Items[0].Namespace).To(Equal("team-a"))
+	})
+
+	It("should keep unrouted repositories in the default namespace", func(ctx SpecContext) {
+		r, c, _ := newReconciler()
+		e := event
+		e.Registry = "docker.io"
+
+		_, err := r.Reconcile(ctx, e)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		Expect(jobs.Items[0].Namespace).To(Equal("scans"))
+	})
+
+	It("should retry and finally give up if the target namespace is missing", func(ctx SpecContext) {
+		r, _, store := newReconciler()
+		r.DeadLetters = results.NewDeadLetters()
+		r.Reconfigure(Settings{RetryPolicy: RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute, MaxAttempts: 2}})
+
+		result, err := r.Reconcile(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Second))
+		stored, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(BeEmpty())
+
+		result, err = r.Reconcile(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		stored, err = store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(ConsistOf(And(
+			HaveField("Status", results.StatusFailed),
+			HaveField("Reason", ContainSubstring("target namespace team-a does not exist")),
+		)))
+		Expect(r.DeadLetters.List(results.Filter{})).To(HaveLen(1))
+	})
+
+	It("should retry if a secret is missing in the target namespace", func(ctx SpecContext) {
+		r, c, _ := newReconciler(namespace("team-a"), secret("team-a", scanner.DefaultSnykTokenSecret))
+		r.Reconfigure(Settings{Registries: &registry.Profiles{
+			Default: registry.Profile{CredentialsSecret: "registry-credentials"},
+		}})
+
+		result, err := r.Reconcile(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+	})
+
+	It("should retry if the CA bundle is missing in the target namespace", func(ctx SpecContext) {
+		r, c, _ := newReconciler(namespace("team-a"), secret("team-a", scanner.DefaultSnykTokenSecret))
+		r.Reconfigure(Settings{Registries: &registry.Profiles{
+			Default: registry.Profile{CABundle: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "registry-ca"},
+				Key:                  "ca.crt",
+			}},
+		}})
+
+		result, err := r.Reconcile(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+
+		Expect(c.Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "registry-ca"}})).To(Succeed())
+		_, err = r.Reconcile(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ParsePlatforms parses a comma separated list of platforms in the format os/arch[/variant].
+func ParsePlatforms(s string) ([]imagev1.Platform, error) {
+	var platforms []imagev1.Platform
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		parts := strings.Split(p, "/")
+		if len(parts) < 2 || len(parts) > 3 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", p)
+		}
+		platform := imagev1.Platform{
+			OS:           parts[0],
+			Architecture: parts[1],
+		}
+		if len(parts) == 3 {
+			platform.Variant = parts[2]
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
+// platformString formats p as os/arch[/variant], which is the format expected by snyk.
+func platformString(p imagev1.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// isPlatformSupported checks platform against the allow list.
+// Entries with a variant only match images of that variant, entries without a variant match any variant.
+func isPlatformSupported(supported []imagev1.Platform, platform imagev1.Platform) bool {
+	return slices.ContainsFunc(supported, func(p imagev1.Platform) bool {
+		return p.Architecture == platform.Architecture &&
+			p.OS == platform.OS &&
+			(p.Variant == "" || p.Variant == platform.Variant)
+	})
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var _ = Describe("ParsePlatforms", func() {
+	It("parses platforms with and without variant", func() {
+		platforms, err := ParsePlatforms("linux/amd64, linux/arm/v7")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platforms).To(Equal([]imagev1.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm", Variant: "v7"},
+		}))
+	})
+
+	DescribeTable("rejects invalid platforms", func(s string) {
+		_, err := ParsePlatforms(s)
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("missing architecture", "linux"),
+		Entry("too many parts", "linux/arm/v7/extra"),
+		Entry("empty part", "linux//v7"),
+	)
+})
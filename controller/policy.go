@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Policy is the ScanPolicy or ClusterScanPolicy that applies to an event.
+type Policy struct {
+	// Name is "ScanPolicy/<namespace>/<name>" or "ClusterScanPolicy/<name>".
+	Name string
+	Spec v1alpha1.ScanPolicySpec
+	// Namespaced is set for ScanPolicies, whose scanner args are restricted to NamespacedScannerArgs.
+	Namespaced bool
+}
+
+// NamespacedScannerArgs are the flags of each backend that ScanPolicies may add to the scanner args, as --flag or
+// --flag=value. The other flags, like those choosing where results are reported or how the registry is accessed,
+// are reserved to the configuration and ClusterScanPolicies.
+var NamespacedScannerArgs = map[string][]string{
+	scanner.BackendSnyk: {
+		"--exclude-app-vulns", "--exclude-base-image-vulns", "--exclude-node-modules", "--nested-jars-depth",
+		"--severity-threshold", "--fail-on", "--project-tags", "--project-environment", "--project-lifecycle",
+		"--project-business-criticality",
+	},
+	scanner.BackendTrivy: {"--severity", "--ignore-unfixed", "--pkg-types", "--scanners", "--skip-dirs", "--skip-files"},
+	scanner.BackendGrype: {"--only-fixed", "--only-notfixed", "--fail-on", "--exclude", "--scope"},
+}
+
+// validateNamespacedArgs fails if args contain anything but the NamespacedScannerArgs of backend.
+func validateNamespacedArgs(backend string, args []string) error {
+	for _, arg := range args {
+		flag, _, _ := strings.Cut(arg, "=")
+		if !strings.HasPrefix(flag, "--") || !slices.Contains(NamespacedScannerArgs[backend], flag) {
+			return fmt.Errorf("scanner arg %q is not allowed in ScanPolicies", arg)
+		}
+	}
+	return nil
+}
+
+// PolicyResolver finds the policy that applies to an event.
+type PolicyResolver interface {
+	// Resolve returns the policy for the scan job of e in namespace, nil if no policy applies.
+	Resolve(ctx context.Context, namespace string, e types.RegistryEvent) (*Policy, error)
+}
+
+// ScanPolicies resolves the ScanPolicies in the namespace of the scan job and all ClusterScanPolicies.
+type ScanPolicies struct {
+	Reader client.Reader
+}
+
+type candidate struct {
+	policy     Policy
+	namespaced bool
+	name       string
+}
+
+// Resolve returns the matching policy with the highest priority. On equal priority
+// ScanPolicies win over ClusterScanPolicies, then the first name in alphabetical order.
+func (p *ScanPolicies) Resolve(ctx context.Context, namespace string, e types.RegistryEvent) (*Policy, error) {
+	key := e.RepositoryPath()
+	var candidates []candidate
+
+	var namespaced v1alpha1.ScanPolicyList
+	if err := p.Reader.List(ctx, &namespaced, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("listing scan policies: %w", err)
+	}
+	for _, sp := range namespaced.Items {
+		if policyMatches(sp.Spec, key) {
+			candidates = append(candidates, candidate{
+				policy:     Policy{Name: "ScanPolicy/" + sp.Namespace + "/" + sp.Name, Spec: sp.Spec, Namespaced: true},
+				namespaced: true,
+				name:       sp.Name,
+			})
+		}
+	}
+
+	var cluster v1alpha1.ClusterScanPolicyList
+	if err := p.Reader.List(ctx, &cluster); err != nil {
+		return nil, fmt.Errorf("listing cluster scan policies: %w", err)
+	}
+	for _, csp := range cluster.Items {
+		if policyMatches(csp.Spec, key) {
+			candidates = append(candidates, candidate{
+				policy: Policy{Name: "ClusterScanPolicy/" + csp.Name, Spec: csp.Spec},
+				name:   csp.Name,
+			})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.policy.Spec.Priority != b.policy.Spec.Priority {
+			return a.policy.Spec.Priority > b.policy.Spec.Priority
+		}
+		if a.namespaced != b.namespaced {
+			return a.namespaced
+		}
+		return a.name < b.name
+	})
+	return &candidates[0].policy, nil
+}
+
+// policyMatches reports whether spec selects the repository key "<registry>/<repository>".
+// Exclusions win over inclusions, invalid patterns never match.
+func policyMatches(spec v1alpha1.ScanPolicySpec, key string) bool {
+	return !matchesAny(spec.ExcludeRepositories, key) && matchesAny(spec.Repositories, key)
+}
+
+// eventSettings are the settings used for a single event.
+type eventSettings struct {
+	Settings
+	// policy is the name of the applied policy, if any.
+	policy string
+	// rescanInterval is zero if images are not rescanned.
+	rescanInterval time.Duration
+	// scanner is the backend configured by Scanner.
+	scanner scanner.Scanner
+}
+
+// withPolicy returns the settings with the overrides of p applied.
+func (s Settings) withPolicy(p *Policy) (eventSettings, error) {
+	es, err := s.withOverrides(p)
+	if err != nil {
+		return es, err
+	}
+	es.scanner, err = es.Scanner.New()
+	return es, err
+}
+
+func (s Settings) withOverrides(p *Policy) (eventSettings, error) {
+	es := eventSettings{Settings: s}
+	if p == nil {
+		return es, nil
+	}
+	es.policy = p.Name
+	if p.Spec.Scanner != nil {
+		es.Scanner = s.Scanner.withOverrides(*p.Spec.Scanner)
+		if p.Namespaced {
+			if err := validateNamespacedArgs(es.Scanner.backend(), p.Spec.Scanner.Args); err != nil {
+				return es, fmt.Errorf("%s: %w", p.Name, err)
+			}
+		}
+	}
+	if p.Spec.JobTemplate != nil {
+		es.JobTemplate = overlayJobTemplate(s.JobTemplate, *p.Spec.JobTemplate)
+	}
+	if p.Spec.Rescan != nil {
+		es.rescanInterval = p.Spec.Rescan.Interval.Duration
+	}
+	if p.Spec.Platforms != nil {
+		es.SupportedPlatforms = nil
+		for _, rule := range p.Spec.Platforms {
+			platforms, err := ParsePlatforms(string(rule))
+			if err != nil {
+				return es, fmt.Errorf("%s: %w", p.Name, err)
+			}
+			es.SupportedPlatforms = append(es.SupportedPlatforms, platforms...)
+		}
+	}
+	return es, nil
+}
@@ -0,0 +1,326 @@
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func policyScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+	return scheme
+}
+
+var policyEvent = types.RegistryEvent{
+	Registry:   "registry.example.com",
+	Repository: "team-a/app",
+	Tag:        "latest",
+	Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+}
+
+var _ = Describe("ScanPolicies", func() {
+	scanPolicy := func(namespace, name string, priority int32, repositories ...string) *v1alpha1.ScanPolicy {
+		return &v1alpha1.ScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       v1alpha1.ScanPolicySpec{Repositories: repositories, Priority: priority},
+		}
+	}
+	clusterScanPolicy := func(name string, priority int32, repositories ...string) *v1alpha1.ClusterScanPolicy {
+		return &v1alpha1.ClusterScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       v1alpha1.ScanPolicySpec{Repositories: repositories, Priority: priority},
+		}
+	}
+	resolve := func(ctx SpecContext, objs ...client.Object) *Policy {
+		p := &ScanPolicies{
+			Reader: fake.NewClientBuilder().WithScheme(policyScheme()).WithObjects(objs...).Build(),
+		}
+		policy, err := p.Resolve(ctx, "scans", policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		return policy
+	}
+
+	It("should return nil without matching policy", func(ctx SpecContext) {
+		Expect(resolve(ctx, clusterScanPolicy("other", 0, "registry.example.com/team-b/*"))).To(BeNil())
+	})
+
+	It("should ignore ScanPolicies of other namespaces", func(ctx SpecContext) {
+		Expect(resolve(ctx, scanPolicy("other", "team-a", 0, "registry.example.com/team-a/*"))).To(BeNil())
+	})
+
+	It("should prefer the highest priority", func(ctx SpecContext) {
+		policy := resolve(ctx,
+			scanPolicy("scans", "team-a", 0, "registry.example.com/team-a/*"),
+			clusterScanPolicy("all", 10, "*/*/*", "*/*"),
+		)
+		Expect(policy.Name).To(Equal("ClusterScanPolicy/all"))
+	})
+
+	It("should prefer ScanPolicies, then names on equal priority", func(ctx SpecContext) {
+		policy := resolve(ctx,
+			clusterScanPolicy("a", 0, "registry.example.com/team-a/*"),
+			scanPolicy("scans", "c", 0, "registry.example.com/team-a/*"),
+			scanPolicy("scans", "b", 0, "registry.example.com/team-a/app"),
+		)
+		Expect(policy.Name).To(Equal("ScanPolicy/scans/b"))
+	})
+
+	It("should honor exclusions", func(ctx SpecContext) {
+		p := clusterScanPolicy("all", 0, "registry.example.com/*/*")
+		p.Spec.ExcludeRepositories = []string{"registry.example.com/team-a/*"}
+		Expect(resolve(ctx, p)).To(BeNil())
+	})
+})
+
+var _ = Describe("Reconcile with ScanPolicy", func() {
+	newReconciler := func(objs ...client.Object) (*Reconciler, client.Client, results.Store) {
+		c := fake.NewClientBuilder().WithScheme(policyScheme()).WithObjects(objs...).Build()
+		store := results.NewMemoryStore()
+		r := &Reconciler{
+			Namespace: "scans",
+			client:    c,
+			Registry:  linuxAMD64,
+			Results:   store,
+			Policies:  &ScanPolicies{Reader: c},
+		}
+		r.Reconfigure(Settings{
+			Scanner:     Scanner{Args: []string{"--exclude-app-vulns"}},
+			JobTemplate: JobTemplate{Labels: map[string]string{"team": "platform"}, ServiceAccountName: "scanner"},
+		})
+		return r, c, store
+	}
+
+	It("should apply the overrides of the policy and record it", func(ctx SpecContext) {
+		r, c, store := newReconciler(&v1alpha1.ScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "scans", Name: "team-a"},
+			Spec: v1alpha1.ScanPolicySpec{
+				Repositories: []string{"registry.example.com/team-a/*"},
+				Scanner: &v1alpha1.ScannerOverrides{
+					Args: []string{"--severity-threshold=high"},
+					Org:  "team-a",
+				},
+				JobTemplate: &v1alpha1.JobTemplate{
+					Labels:       map[string]string{"team": "a"},
+					BackoffLimit: ptr.To[int32](1),
+				},
+			},
+		})
+
+		result, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		job := jobs.Items[0]
+		Expect(job.Name).To(Equal(scanJobName(policyEvent)))
+		Expect(job.Annotations).To(HaveKeyWithValue(policyAnnotation, "ScanPolicy/scans/team-a"))
+		Expect(job.Labels).To(HaveKeyWithValue("team", "a"))
+		Expect(job.Spec.BackoffLimit).To(HaveValue(BeEquivalentTo(1)))
+		Expect(job.Spec.Template.Spec.ServiceAccountName).To(Equal("scanner"))
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Args).To(ContainElements("--exclude-app-vulns", "--severity-threshold=high"))
+		Expect(container.Args[len(container.Args)-1]).To(Equal(policyEvent.Reference()))
+		Expect(container.Env).To(ContainElement(HaveField("Value", "team-a")))
+
+		stored, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(ConsistOf(HaveField("Policy", "ScanPolicy/scans/team-a")))
+	})
+
+	It("should skip platforms not allowed by the policy", func(ctx SpecContext) {
+		r, c, store := newReconciler(&v1alpha1.ClusterScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "arm-only"},
+			Spec: v1alpha1.ScanPolicySpec{
+				Repositories: []string{"registry.example.com/*/*"},
+				Platforms:    []v1alpha1.PlatformRule{"linux/arm64"},
+			},
+		})
+
+		_, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+		stored, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(ConsistOf(And(
+			HaveField("Status", results.StatusSkipped),
+			HaveField("Policy", "ClusterScanPolicy/arm-only"),
+		)))
+	})
+
+	It("should schedule rescans", func(ctx SpecContext) {
+		r, c, _ := newReconciler(&v1alpha1.ClusterScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "daily"},
+			Spec: v1alpha1.ScanPolicySpec{
+				Repositories: []string{"registry.example.com/*/*"},
+				Rescan:       &v1alpha1.RescanSchedule{Interval: metav1.Duration{Duration: 24 * time.Hour}},
+			},
+		})
+
+		result, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", 24*time.Hour))
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		Expect(jobs.Items[0].Name).NotTo(Equal(scanJobName(policyEvent)))
+		Expect(jobs.Items[0].Annotations).To(HaveKey(rescanPeriodAnnotation))
+
+		// the job of the current period exists already
+		result, err = r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+	})
+
+	It("should continue the rescan schedule of the last result", func(ctx SpecContext) {
+		r, c, store := newReconciler(&v1alpha1.ClusterScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "daily"},
+			Spec: v1alpha1.ScanPolicySpec{
+				Repositories: []string{"registry.example.com/*/*"},
+				Rescan:       &v1alpha1.RescanSchedule{Interval: metav1.Duration{Duration: 24 * time.Hour}},
+			},
+		})
+		last := time.Now().Add(-25 * time.Hour).Truncate(time.Second)
+		Expect(store.Record(ctx, results.Result{Event: policyEvent, Status: results.StatusScanned, Period: &last})).To(Succeed())
+
+		result, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", 23*time.Hour, time.Minute))
+
+		next := last.Add(24 * time.Hour)
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		Expect(jobs.Items[0].Name).To(Equal(rescanJobName(policyEvent, next)))
+		stored, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(ConsistOf(HaveField("Period", HaveValue(BeTemporally("==", next)))))
+	})
+
+	It("should not rescan before the interval passed since the first scan", func(ctx SpecContext) {
+		r, c, _ := newReconciler(&v1alpha1.ClusterScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "hourly"},
+			Spec: v1alpha1.ScanPolicySpec{
+				Repositories: []string{"registry.example.com/*/*"},
+				Rescan:       &v1alpha1.RescanSchedule{Interval: metav1.Duration{Duration: time.Hour}},
+			},
+		})
+		_, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		result, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+	})
+
+	It("should queue the images with rescans on start", func(ctx SpecContext) {
+		r, _, store := newReconciler()
+		period := time.Now()
+		rescanned := policyEvent
+		rescanned.Repository = "team-a/rescanned"
+		Expect(store.Record(ctx, results.Result{Event: rescanned, Status: results.StatusScanned, Period: &period})).To(Succeed())
+		Expect(store.Record(ctx, results.Result{Event: policyEvent, Status: results.StatusScanned})).To(Succeed())
+
+		w := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[types.RegistryEvent]())
+		defer w.ShutDown()
+		Expect(r.enqueueRescans(ctx, w)).To(Succeed())
+		Expect(w.Len()).To(Equal(1))
+		queued, _ := w.Get()
+		Expect(queued).To(Equal(rescanned))
+	})
+
+	It("should drop events of ScanPolicies with scanner args they may not set", func(ctx SpecContext) {
+		r, c, store := newReconciler(&v1alpha1.ScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "scans", Name: "team-a"},
+			Spec: v1alpha1.ScanPolicySpec{
+				Repositories: []string{"registry.example.com/team-a/*"},
+				Scanner:      &v1alpha1.ScannerOverrides{Args: []string{"--org=other"}},
+			},
+		})
+
+		_, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+		stored, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(ConsistOf(And(
+			HaveField("Status", results.StatusDropped),
+			HaveField("Reason", ContainSubstring("--org=other")),
+		)))
+	})
+
+	It("should allow all scanner args in ClusterScanPolicies", func(ctx SpecContext) {
+		r, c, _ := newReconciler(&v1alpha1.ClusterScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "all"},
+			Spec: v1alpha1.ScanPolicySpec{
+				Repositories: []string{"registry.example.com/*/*"},
+				Scanner:      &v1alpha1.ScannerOverrides{Args: []string{"--org=other"}},
+			},
+		})
+
+		_, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		Expect(jobs.Items[0].Spec.Template.Spec.Containers[0].Args).To(ContainElement("--org=other"))
+	})
+
+	It("should rescan once per advisory without scheduling further rescans", func(ctx SpecContext) {
+		r, c, store := newReconciler(&v1alpha1.ClusterScanPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "daily"},
+			Spec: v1alpha1.ScanPolicySpec{
+				Repositories: []string{"registry.example.com/*/*"},
+				Rescan:       &v1alpha1.RescanSchedule{Interval: metav1.Duration{Duration: 24 * time.Hour}},
+			},
+		})
+		e := policyEvent
+		e.Advisory = "GHSA-jfh8-c2jp-5v3q"
+
+		for range 2 {
+			result, err := r.Reconcile(ctx, e)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+		}
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		Expect(jobs.Items[0].Name).To(Equal(scanJobName(policyEvent, "advisory=GHSA-jfh8-c2jp-5v3q")))
+		Expect(jobs.Items[0].Annotations).To(HaveKeyWithValue(advisoryAnnotation, "GHSA-jfh8-c2jp-5v3q"))
+		Expect(jobs.Items[0].Annotations).NotTo(HaveKey(rescanPeriodAnnotation))
+
+		stored, err := store.List(ctx, results.Filter{Advisory: "GHSA-jfh8-c2jp-5v3q"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(ConsistOf(HaveField("Event", e)))
+	})
+})
@@ -4,141 +4,444 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
 	"github.com/stackitcloud/registry-snyk-scan/types"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+// RegistryClient looks up image metadata in registries.
+type RegistryClient interface {
+	Platform(ctx context.Context, e types.RegistryEvent) (imagev1.Platform, error)
+}
+
+// DescriptorHinter is implemented by registry clients that use the descriptor of a notification for later lookups
+// of its digest, see registry.Client.Hint.
+type DescriptorHinter interface {
+	Hint(e types.RegistryEvent)
+}
+
+// JobCreator creates scan jobs. Creating a job that exists already fails with an AlreadyExists error.
+type JobCreator interface {
+	Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error
+}
+
+// Reconciler creates a scan job for every pushed image.
+// Registries, SupportedPlatforms, RetryPolicy, Scanner and JobTemplate are its initial Settings. Once it was added
+// to a manager, they must only be changed with Reconfigure, which guards them against concurrent reconciles.
 type Reconciler struct {
-	Namespace        string
-	InsecureRegistry bool
+	Namespace string
+	// Registry is used to look up the platform of images.
+	// Defaults to a caching registry.Client using Registries.
+	Registry RegistryClient
+	// Registries holds the connection profiles of the registries sending events.
+	Registries *registry.Profiles
+	// SupportedPlatforms is the allow list of platforms to scan. Defaults to all linux platforms supported by snyk.
+	SupportedPlatforms []imagev1.Platform
+	// Results records the outcome of each event, if set.
+	Results results.Store
+	// RetryPolicy applies to transient registry errors and to objects missing for the scan job, like its namespace
+	// or snyk policy. Defaults to DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+	// DeadLetters keeps events that exhausted their retries, if set.
+	DeadLetters *results.DeadLetters
+	// Scanner configures the scan container.
+	Scanner Scanner
+	// JobTemplate customizes the scan jobs.
+	JobTemplate JobTemplate
+	// NamespaceRoutes send the scan jobs of matching repositories to other namespaces than Namespace.
+	// The first matching route wins. The manager cache must cover all TargetNamespaces.
+	NamespaceRoutes []NamespaceRoute
+	// Tenants holds the settings of the tenants sending events to their own webhook endpoints.
+	// The manager cache must cover their namespaces.
+	Tenants map[string]Tenant
+	// Policies resolves the ScanPolicy of each event, if set. Its overrides apply on top of the other settings.
+	Policies PolicyResolver
+	// Jobs creates the scan jobs. Defaults to the client of the manager.
+	Jobs JobCreator
+	// Reader reads the snyk policy ConfigMaps. Defaults to the API reader of the manager, which only caches the
+	// ConfigMaps with the SnykPolicyLabel.
+	Reader client.Reader
+	// APIReader reads the secrets referenced by scan jobs, and the namespaces and ConfigMaps checked before jobs
+	// are created in other namespaces than Namespace. Defaults to the API reader of the manager, so that they
+	// aren't cached.
+	APIReader client.Reader
+	// Attachments recognizes the pushes of artifacts attached to scanned images, which are not scanned, if set.
+	Attachments AttachmentChecker
+	// Lineage records the base image of every pushed image, if set.
+	Lineage *Lineage
 
 	client client.Client
+
+	// settingsMu guards the fields that can be changed with Reconfigure
+	settingsMu sync.RWMutex
+
+	attemptsMu sync.Mutex
+	attempts   map[types.RegistryEvent]int
+}
+
+// Settings are the parts of the Reconciler that can be changed while it is running.
+type Settings struct {
+	Registries         *registry.Profiles
+	SupportedPlatforms []imagev1.Platform
+	RetryPolicy        RetryPolicy
+	Scanner            Scanner
+	JobTemplate        JobTemplate
+}
+
+// Reconfigure replaces the settings of a running Reconciler.
+// Events that are already queued are processed with the new settings.
+func (r *Reconciler) Reconfigure(s Settings) {
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+	r.Registries = s.Registries
+	r.SupportedPlatforms = s.SupportedPlatforms
+	r.RetryPolicy = s.RetryPolicy
+	r.Scanner = s.Scanner
+	r.JobTemplate = s.JobTemplate
+}
+
+func (r *Reconciler) settings() Settings {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+	return Settings{
+		Registries:         r.Registries,
+		SupportedPlatforms: r.SupportedPlatforms,
+		RetryPolicy:        r.RetryPolicy,
+		Scanner:            r.Scanner,
+		JobTemplate:        r.JobTemplate,
+	}
+}
+
+// settingsFor returns the settings of e before its ScanPolicy is applied.
+func (r *Reconciler) settingsFor(e types.RegistryEvent) Settings {
+	settings := r.settings()
+	settings.Scanner = settings.Scanner.forEvent(e)
+	if t, ok := r.tenant(e); ok && t.Org != "" {
+		settings.Scanner.Org = t.Org
+	}
+	return settings
 }
 
 func (r *Reconciler) Reconcile(ctx context.Context, req types.RegistryEvent) (reconcile.Result, error) {
 	log := logf.FromContext(ctx).WithValues("registry", req.Registry, "repository", req.Repository, "digest", req.Digest, "tag", req.Tag)
 
-	platform, err := req.Platform(r.InsecureRegistry)
+	if err := req.Validate(); err != nil {
+		// retrying won't fix a malformed event
+		log.Error(err, "dropping invalid registry event")
+		metrics.ReconcileOutcome(req.Registry, req.Repository, metrics.OutcomeInvalid)
+		return reconcile.Result{}, nil
+	}
+	namespace := r.namespaceFor(req)
+	if namespace != r.Namespace {
+		log = log.WithValues("namespace", namespace)
+	}
+
+	settings := r.settingsFor(req)
+	var policy *Policy
+	if r.Policies != nil {
+		var err error
+		if policy, err = r.Policies.Resolve(ctx, namespace, req); err != nil {
+			metrics.ReconcileOutcome(req.Registry, req.Repository, metrics.OutcomeError)
+			return reconcile.Result{}, fmt.Errorf("failed to resolve scan policy: %w", err)
+		}
+	}
+	es, err := settings.withPolicy(policy)
 	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to get platform for registry event: %w", err)
+		log.Error(err, "dropping event with invalid scan policy")
+		metrics.ReconcileOutcome(req.Registry, req.Repository, metrics.OutcomeDropped)
+		return reconcile.Result{}, r.record(ctx, req, es.policy, results.StatusDropped, err.Error())
+	}
+	if es.policy != "" {
+		log = log.WithValues("policy", es.policy)
 	}
+	profile := es.Registries.Get(req.Registry)
 
-	if !isPlatformSupported(platform) {
-		log.Info("skipping unsupported platform", "platform", platform)
-		return reconcile.Result{}, nil
+	if r.Attachments != nil {
+		attached, err := r.Attachments.Attached(ctx, req)
+		if err != nil {
+			return r.handleLookupError(ctx, log, es, req, fmt.Errorf("failed to check for attached artifact: %w", err))
+		}
+		if attached {
+			r.forget(req)
+			log.V(1).Info("ignoring attached artifact")
+			metrics.ReconcileOutcome(req.Registry, req.Repository, metrics.OutcomeAttachment)
+			return reconcile.Result{}, nil
+		}
+	}
+
+	start := time.Now()
+	platform, err := r.Registry.Platform(ctx, req)
+	metrics.RegistryLookup(req.Registry, time.Since(start))
+	if err != nil {
+		return r.handleLookupError(ctx, log, es, req, fmt.Errorf("failed to get platform for registry event: %w", err))
+	}
+	if r.Lineage != nil && req.Advisory == "" && req.BaseUpdate == "" {
+		r.Lineage.record(ctx, log, req)
+	}
+
+	supportedPlatforms := es.SupportedPlatforms
+	if supportedPlatforms == nil {
+		supportedPlatforms = defaultSupportedPlatforms
+	}
+	if !isPlatformSupported(supportedPlatforms, platform) {
+		r.forget(req)
+		log.Info("skipping unsupported platform", "platform", platformString(platform))
+		metrics.ReconcileOutcome(req.Registry, req.Repository, metrics.OutcomeUnsupportedPlatform)
+		return reconcile.Result{}, r.record(ctx, req, es.policy, results.StatusSkipped, "unsupported platform "+platformString(platform))
+	}
+
+	// with a rescan interval there is one job per image and period,
+	// with a snyk policy there is one job per image and policy content,
+	// advisories get one job per image and advisory, and base updates one per image and new base
+	var result reconcile.Result
+	var period *time.Time
+	var nameSuffixes []string
+	annotations := annotationsForScanJob(req)
+	if es.policy != "" {
+		annotations[policyAnnotation] = es.policy
+	}
+	if ref := es.snykPolicy(); ref != nil {
+		policyDigest, err := r.snykPolicyDigest(ctx, namespace, *ref)
+		if err != nil {
+			// the ConfigMap might be created later
+			return r.retry(ctx, log, es, req, err)
+		}
+		nameSuffixes = append(nameSuffixes, policyDigest.String())
+		annotations[snykPolicyAnnotation] = ref.Name + "@" + policyDigest.String()
+	}
+	name := scanJobName(req, nameSuffixes...)
+	switch {
+	case req.Advisory != "":
+		// one rescan per image and advisory, the periodic rescans continue with the event of the push
+		name = scanJobName(req, append(nameSuffixes, "advisory="+req.Advisory)...)
+		annotations[advisoryAnnotation] = req.Advisory
+	case req.BaseUpdate != "":
+		name = scanJobName(req, append(nameSuffixes, "base="+req.BaseUpdate.String())...)
+		annotations[baseUpdateAnnotation] = req.BaseUpdate.String()
+	case es.rescanInterval > 0:
+		now := time.Now()
+		start, err := r.rescanPeriod(ctx, req, es.rescanInterval, now)
+		if err != nil {
+			metrics.ReconcileOutcome(req.Registry, req.Repository, metrics.OutcomeError)
+			return reconcile.Result{}, err
+		}
+		period = &start
+		name = rescanJobName(req, start, nameSuffixes...)
+		annotations[rescanPeriodAnnotation] = start.UTC().Format(time.RFC3339)
+		result.RequeueAfter = start.Add(es.rescanInterval).Sub(now)
 	}
 
 	log.Info("Creating job for webhook event")
+	workload := es.scanner.Workload(scanner.Target{Event: req, Platform: platform, Profile: profile})
+	annotations[scannerAnnotation] = es.scanner.Name()
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      scanJobName(req),
-			Namespace: r.Namespace,
-			Labels:    labelsForScanJob(req),
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labelsForScanJob(req),
+			Annotations: annotations,
 		},
 		Spec: batchv1.JobSpec{
 			Template: v1.PodTemplateSpec{
 				Spec: v1.PodSpec{
-					RestartPolicy: v1.RestartPolicyOnFailure,
-					Containers: []v1.Container{
-						{
-							Name:    "scan",
-							Image:   "snyk/snyk:linux",
-							Command: []string{"snyk"},
-							Args:    scanJobArguments(req, platform, r.InsecureRegistry),
-							Env: []v1.EnvVar{
-								{
-									Name: "SNYK_TOKEN",
-									ValueFrom: &v1.EnvVarSource{
-										SecretKeyRef: &v1.SecretKeySelector{
-											Key: "SNYK_TOKEN",
-											LocalObjectReference: v1.LocalObjectReference{
-												Name: snykTokenSecretName,
-											},
-										},
-									},
-								},
-								{
-									Name: "SNYK_ORG",
-									ValueFrom: &v1.EnvVarSource{
-										SecretKeyRef: &v1.SecretKeySelector{
-											Key: "SNYK_ORG",
-											LocalObjectReference: v1.LocalObjectReference{
-												Name: snykTokenSecretName,
-											},
-										},
-									},
-								},
-								{
-									Name:  "SNYK_DISABLE_ANALYTICS",
-									Value: "1",
-								},
-							},
-						},
-					},
+					RestartPolicy:  v1.RestartPolicyOnFailure,
+					InitContainers: workload.InitContainers,
+					Containers:     []v1.Container{workload.Container},
+					Volumes:        workload.Volumes,
 				},
 			},
 		},
 	}
 
-	if err := r.client.Create(ctx, job); err != nil {
+	applyJobTemplate(es.JobTemplate, job)
+
+	if namespace != r.Namespace {
+		if err := r.checkNamespace(ctx, job); err != nil {
+			// the namespace or its secrets might be created later
+			return r.retry(ctx, log, es, req, err)
+		}
+	}
+
+	if err := r.jobs().Create(ctx, job); err != nil {
 		// skip already existing jobs
 		if apierrors.IsAlreadyExists(err) {
-			return reconcile.Result{}, nil
+			r.forget(req)
+			metrics.ReconcileOutcome(req.Registry, req.Repository, metrics.OutcomeJobExists)
+			return result, nil
 		}
-		return reconcile.Result{}, fmt.Errorf("failed to create job: %w", err)
+		return r.retry(ctx, log, es, req, fmt.Errorf("failed to create job: %w", err))
 	}
+	r.forget(req)
+	metrics.ReconcileOutcome(req.Registry, req.Repository, metrics.OutcomeJobCreated)
 
-	return reconcile.Result{}, nil
+	return result, r.recordResult(ctx, results.Result{
+		Event:      req,
+		Status:     results.StatusScheduled,
+		Policy:     es.policy,
+		Period:     period,
+		SnykPolicy: annotations[snykPolicyAnnotation],
+	})
 }
 
-func isPlatformSupported(platform imagev1.Platform) bool {
-	return slices.ContainsFunc(supportedPlatforms, func(p imagev1.Platform) bool {
-		return p.Architecture == platform.Architecture &&
-			p.OS == platform.OS
-	})
+// rescanPeriod returns the start of the rescan period of e at now. The first period starts with the first scan
+// and is stored in its result, the following periods start every interval after it, so the schedule of an image
+// continues after a restart. Without Results, the periods are aligned to the zero time.
+func (r *Reconciler) rescanPeriod(ctx context.Context, e types.RegistryEvent, interval time.Duration, now time.Time) (time.Time, error) {
+	if r.Results == nil {
+		return now.Truncate(interval), nil
+	}
+	list, err := r.Results.List(ctx, results.Filter{Registry: e.Registry, Repository: e.Repository, Digest: string(e.Digest), Tenant: e.Tenant})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to list results: %w", err)
+	}
+	var start time.Time
+	for _, res := range list {
+		if res.Event == e && res.Period != nil {
+			start = *res.Period
+		}
+	}
+	if start.IsZero() {
+		// the period is stored in the annotations of the job with a precision of seconds
+		return now.Truncate(time.Second), nil
+	}
+	if elapsed := now.Sub(start); elapsed >= interval {
+		start = start.Add(elapsed / interval * interval)
+	}
+	return start, nil
+}
+
+func (r *Reconciler) jobs() JobCreator {
+	if r.Jobs != nil {
+		return r.Jobs
+	}
+	return r.client
+}
+
+func (r *Reconciler) reader() client.Reader {
+	if r.Reader != nil {
+		return r.Reader
+	}
+	return r.client
+}
+
+func (r *Reconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.client
+}
+
+func (r *Reconciler) record(ctx context.Context, e types.RegistryEvent, policy string, status results.Status, reason string) error {
+	return r.recordResult(ctx, results.Result{Event: e, Status: status, Reason: reason, Policy: policy})
 }
 
-func scanJobArguments(e types.RegistryEvent, p imagev1.Platform, insecureRegistry bool) []string {
-	cmd := []string{
-		"container",
-		"monitor",
-		"-d",
-		"--org=$(SNYK_ORG)",
+func (r *Reconciler) recordResult(ctx context.Context, res results.Result) error {
+	if r.Results == nil {
+		return nil
 	}
-	if insecureRegistry {
-		cmd = append(cmd, "--insecure")
+	if err := r.Results.Record(ctx, res); err != nil {
+		return fmt.Errorf("failed to record result: %w", err)
 	}
-	cmd = append(cmd, fmt.Sprintf("--target-reference=%s@%s", e.Tag, e.Digest))
-	cmd = append(cmd, fmt.Sprintf("--platform=%s/%s", p.OS, p.Architecture))
-	cmd = append(cmd, e.Reference())
-	return cmd
+	return nil
 }
 
-func scanJobName(e types.RegistryEvent) string {
+// scanJobName is derived from the image reference, prefixed with the tenant if any,
+// so that tenants pushing the same image get their own scans.
+// The suffixes distinguish further scans of the same image.
+func scanJobName(e types.RegistryEvent, suffixes ...string) string {
 	hash := sha256.New()
+	if e.Tenant != "" {
+		hash.Write([]byte(e.Tenant + "/"))
+	}
 	hash.Write([]byte(e.Reference()))
+	for _, s := range suffixes {
+		hash.Write([]byte("@" + s))
+	}
 	return hex.EncodeToString(hash.Sum(nil))[:63]
 }
 
+// rescanJobName is the name of the scan job of e in the rescan period starting at period.
+func rescanJobName(e types.RegistryEvent, period time.Time, suffixes ...string) string {
+	return scanJobName(e, append([]string{period.UTC().Format(time.RFC3339)}, suffixes...)...)
+}
+
 func labelsForScanJob(e types.RegistryEvent) map[string]string {
-	return map[string]string{
-		// colon is not allowed in labels, digest uses algo:hash as format
-		"digest": strings.ReplaceAll(string(e.Digest), ":", "_")[:63],
-		"tag":    e.Tag,
-		// colon is not allowed in labels, registry string could contain port
-		"registry":   strings.ReplaceAll(e.Registry, ":", "_"),
-		"repository": e.Repository,
+	labels := map[string]string{
+		"digest":       labelValue(string(e.Digest)),
+		"tag":          labelValue(e.Tag),
+		"registry":     labelValue(e.Registry),
+		"repository":   labelValue(e.Repository),
+		managedByLabel: managedByValue,
+	}
+	if e.Tenant != "" {
+		labels["tenant"] = labelValue(e.Tenant)
+	}
+	return labels
+}
+
+// annotationsForScanJob keeps the unencoded values of the event, as labels may be truncated.
+func annotationsForScanJob(e types.RegistryEvent) map[string]string {
+	annotations := map[string]string{
+		annotationPrefix + "registry":   e.Registry,
+		annotationPrefix + "repository": e.Repository,
+		annotationPrefix + "tag":        e.Tag,
+		annotationPrefix + "digest":     string(e.Digest),
+		annotationPrefix + "reference":  e.Reference(),
+		eventAnnotation:                 eventJSON(e),
+	}
+	if e.Tenant != "" {
+		annotations[annotationPrefix+"tenant"] = e.Tenant
+	}
+	return annotations
+}
+
+// eventJSON encodes e for the event annotation, so that the event can be restored from its scan job.
+func eventJSON(e types.RegistryEvent) string {
+	data, _ := json.Marshal(e)
+	return string(data)
+}
+
+// labelValue encodes s into a valid label value.
+// Disallowed characters like ':' in digests and ports or '/' in repositories are replaced with '_'
+// and the value is truncated to 63 characters.
+func labelValue(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !isLabelChar(c) {
+			b[i] = '_'
+		}
+	}
+	if len(b) > validation.LabelValueMaxLength {
+		b = b[:validation.LabelValueMaxLength]
 	}
+	// values must begin and end with an alphanumeric character
+	return strings.TrimFunc(string(b), func(r rune) bool {
+		return !isAlphanumeric(byte(r))
+	})
+}
+
+func isLabelChar(c byte) bool {
+	return isAlphanumeric(c) || c == '-' || c == '_' || c == '.'
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
 }
@@ -1,15 +1,20 @@
 package controller
 
 import (
-	"github.com/google/go-containerregistry/pkg/name"
-	v1 "github.com/google/go-containerregistry/pkg/v1"
-	registryfake "github.com/google/go-containerregistry/pkg/v1/fake"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"context"
+	"strings"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
 	"github.com/stackitcloud/registry-snyk-scan/types"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8stypes "k8s.io/apimachinery/pkg/types"
@@ -17,30 +22,25 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
-var _ = Describe("Reconcile", func() {
-	// override RemoteImage function in types package to ensure that we don't actually call the registry
-	originalRemoteImage := types.RemoteImage
-	BeforeEach(func() {
-		types.RemoteImage = func(ref name.Reference, options ...remote.Option) (v1.Image, error) {
-			return &registryfake.FakeImage{
-				ConfigFileStub: func() (*v1.ConfigFile, error) {
-					return &v1.ConfigFile{
-						Architecture: "amd64",
-						OS:           "linux",
-					}, nil
-				},
-			}, nil
-		}
-		DeferCleanup(func() {
-			types.RemoteImage = originalRemoteImage
-		})
-	})
+// fakeRegistry ensures that we don't actually call the registry
+type fakeRegistry struct {
+	platform imagev1.Platform
+	err      error
+}
 
+func (f fakeRegistry) Platform(context.Context, types.RegistryEvent) (imagev1.Platform, error) {
+	return f.platform, f.err
+}
+
+var linuxAMD64 = fakeRegistry{platform: imagev1.Platform{OS: "linux", Architecture: "amd64"}}
+
+var _ = Describe("Reconcile", func() {
 	It("should create a job if it does not exist already", func(ctx SpecContext) {
 		client := fake.NewClientBuilder().Build()
 
 		r := Reconciler{
-			client: client,
+			client:   client,
+			Registry: linuxAMD64,
 		}
 
 		req := types.RegistryEvent{
@@ -59,6 +59,92 @@ var _ = Describe("Reconcile", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(jobs.Items).To(HaveLen(1))
 		Expect(jobs.Items[0].Name).To(Equal(jobName))
+		Expect(jobs.Items[0].Annotations).To(HaveKeyWithValue(annotationPrefix+"repository", "library/ubuntu"))
+	})
+
+	It("should record unsupported platforms as skipped", func(ctx SpecContext) {
+		client := fake.NewClientBuilder().Build()
+		store := results.NewMemoryStore()
+
+		r := Reconciler{
+			client:             client,
+			Registry:           linuxAMD64,
+			Results:            store,
+			SupportedPlatforms: []imagev1.Platform{{OS: "linux", Architecture: "arm64"}},
+		}
+
+		req := types.RegistryEvent{
+			Registry:   "docker.io",
+			Repository: "library/ubuntu",
+			Tag:        "latest",
+			Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+		}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(client.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+
+		list, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Status).To(Equal(results.StatusSkipped))
+		Expect(list[0].Reason).To(Equal("unsupported platform linux/amd64"))
+	})
+
+	It("should drop invalid events without creating a job", func(ctx SpecContext) {
+		client := fake.NewClientBuilder().Build()
+
+		r := Reconciler{
+			client:   client,
+			Registry: linuxAMD64,
+		}
+
+		_, err := r.Reconcile(ctx, types.RegistryEvent{
+			Registry:   "docker.io",
+			Repository: "library/ubuntu",
+			Tag:        "latest",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(client.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+	})
+
+	It("should apply the registry profile to the job", func(ctx SpecContext) {
+		client := fake.NewClientBuilder().Build()
+
+		r := Reconciler{
+			client:   client,
+			Registry: linuxAMD64,
+			Registries: &registry.Profiles{
+				Registries: map[string]registry.Profile{
+					"legacy:5000": {
+						TLSMode: registry.TLSModePlainHTTP,
+						Proxy:   "http://proxy:3128",
+					},
+				},
+			},
+		}
+
+		req := types.RegistryEvent{
+			Registry:   "legacy:5000",
+			Repository: "library/ubuntu",
+			Tag:        "latest",
+			Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+		}
+
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(client.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		container := jobs.Items[0].Spec.Template.Spec.Containers[0]
+		Expect(container.Args).To(ContainElement("--insecure"))
+		Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "HTTPS_PROXY", Value: "http://proxy:3128"}))
 	})
 
 	It("should skip creating job if already exists", func(ctx SpecContext) {
@@ -79,7 +165,8 @@ var _ = Describe("Reconcile", func() {
 			Build()
 
 		r := Reconciler{
-			client: client,
+			client:   client,
+			Registry: linuxAMD64,
 		}
 
 		_, err := r.Reconcile(ctx, req)
@@ -93,11 +180,110 @@ var _ = Describe("Reconcile", func() {
 		// check that job did not change during reconcilation
 		Expect(job).To(Equal(newjob))
 	})
+
+	It("should apply the scanner settings and job template", func(ctx SpecContext) {
+		client := fake.NewClientBuilder().Build()
+		r := Reconciler{
+			client:   client,
+			Registry: linuxAMD64,
+		}
+		r.Reconfigure(Settings{
+			Scanner: Scanner{Image: "registry.example.com/snyk/snyk:linux", TokenSecret: "team-token"},
+			JobTemplate: JobTemplate{
+				Labels:                  map[string]string{"team": "platform", managedByLabel: "someone-else"},
+				ServiceAccountName:      "scanner",
+				TTLSecondsAfterFinished: ptr.To[int32](3600),
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+			},
+		})
+
+		_, err := r.Reconcile(ctx, types.RegistryEvent{
+			Registry:   "docker.io",
+			Repository: "library/ubuntu",
+			Tag:        "latest",
+			Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(client.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		job := jobs.Items[0]
+		Expect(job.Labels).To(HaveKeyWithValue("team", "platform"))
+		Expect(job.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(job.Spec.Template.Labels).To(HaveKeyWithValue("team", "platform"))
+		Expect(job.Spec.TTLSecondsAfterFinished).To(HaveValue(BeEquivalentTo(3600)))
+		Expect(job.Spec.Template.Spec.ServiceAccountName).To(Equal("scanner"))
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal("registry.example.com/snyk/snyk:linux"))
+		Expect(container.Resources.Limits).To(HaveKey(corev1.ResourceMemory))
+		Expect(container.Env[0].ValueFrom.SecretKeyRef.Name).To(Equal("team-token"))
+	})
+
+	It("should queue the events of an image with the same key", func() {
+		hints := &hintingRegistry{fakeRegistry: linuxAMD64}
+		r := Reconciler{Registry: hints}
+		withDescriptor := types.RegistryEvent{
+			Registry:     "docker.io",
+			Repository:   "library/ubuntu",
+			Tag:          "latest",
+			Digest:       "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+			MediaType:    imagev1.MediaTypeImageManifest,
+			ConfigDigest: "sha256:2a2a3c1a1e1b6e3e1a2b0b4e7a4a7e9d0c5f1b0e2d6a9c8b7f4e3d2c1b0a9f8e",
+		}
+		without := withDescriptor
+		without.MediaType, without.ConfigDigest = "", ""
+
+		Expect(r.QueueKey(withDescriptor)).To(Equal(without))
+		Expect(r.QueueKey(without)).To(Equal(without))
+		Expect(hints.events).To(ConsistOf(withDescriptor, without))
+	})
 })
 
+// hintingRegistry records the events passed to Hint.
+type hintingRegistry struct {
+	fakeRegistry
+	events []types.RegistryEvent
+}
+
+func (h *hintingRegistry) Hint(e types.RegistryEvent) {
+	h.events = append(h.events, e)
+}
+
 var _ = DescribeTable("isPlatformSupported", func(platform imagev1.Platform, expected bool) {
-	Expect(isPlatformSupported(platform)).To((Equal(expected)))
+	Expect(isPlatformSupported(defaultSupportedPlatforms, platform)).To((Equal(expected)))
 },
 	Entry("supported should return true", imagev1.Platform{OS: "linux", Architecture: "amd64"}, true),
 	Entry("windows platform should return false", imagev1.Platform{OS: "windows"}, false),
+	Entry("supported variant should return true", imagev1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, true),
+	Entry("unsupported variant should return false", imagev1.Platform{OS: "linux", Architecture: "arm", Variant: "v5"}, false),
+	Entry("entry without variant should match any variant", imagev1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, true),
+)
+
+var _ = Describe("labelsForScanJob", func() {
+	It("should only produce valid label values", func() {
+		labels := labelsForScanJob(types.RegistryEvent{
+			Registry:   "registry.example.com:5000",
+			Repository: "team/" + strings.Repeat("very-long-name/", 10) + "app",
+			Tag:        "_v1.0",
+			Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+		})
+		for _, v := range labels {
+			Expect(validation.IsValidLabelValue(v)).To(BeEmpty(), v)
+		}
+		Expect(labels["digest"]).To(Equal("sha256_e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815a"))
+		Expect(labels["registry"]).To(Equal("registry.example.com_5000"))
+		Expect(labels["tag"]).To(Equal("v1.0"))
+	})
+})
+
+var _ = DescribeTable("labelValue", func(in, expected string) {
+	Expect(labelValue(in)).To(Equal(expected))
+},
+	Entry("keeps valid values", "v1.0.0", "v1.0.0"),
+	Entry("replaces slashes", "team/app", "team_app"),
+	Entry("empty values stay empty", "", ""),
+	Entry("trims non alphanumeric ends", "-app-", "app"),
 )
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// ReferrerPusher attaches artifacts to scanned images as OCI referrers, see registry.Client.
+type ReferrerPusher interface {
+	Attach(ctx context.Context, e types.RegistryEvent, a registry.Artifact) (v1.Hash, error)
+}
+
+// AttachmentChecker recognizes the events of artifacts attached to images, see registry.Client.
+type AttachmentChecker interface {
+	Attached(ctx context.Context, e types.RegistryEvent) (bool, error)
+}
+
+// SBOMFormats returns the formats of the SBOM init containers of a scan job.
+func SBOMFormats(job *batchv1.Job) []scanner.SBOMFormat {
+	var formats []scanner.SBOMFormat
+	for _, c := range job.Spec.Template.Spec.InitContainers {
+		if format, ok := scanner.ParseSBOMContainerName(c.Name); ok {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// AttachArtifacts pushes the report in the output of a successful scan and its SBOMs as referrers of the
+// scanned image. sboms holds the output of the SBOM containers by format. Outputs without JSON document,
+// like the output of snyk container monitor, are skipped.
+func AttachArtifacts(ctx context.Context, referrers ReferrerPusher, res results.Result, output []byte, sboms map[scanner.SBOMFormat][]byte) error {
+	if res.Status != results.StatusScanned {
+		return nil
+	}
+	annotations := map[string]string{scannerAnnotation: res.Scanner}
+	var errs []error
+	attach := func(kind string, a registry.Artifact) {
+		_, err := referrers.Attach(ctx, res.Event, a)
+		metrics.ReferrerPushed(res.Event.Registry, res.Event.Repository, kind, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("attaching %s: %w", kind, err))
+		}
+	}
+
+	if report, ok := scanner.ExtractJSON(output); ok {
+		attach("report", registry.Artifact{
+			ArtifactType: registry.ReportArtifactType,
+			MediaType:    "application/json",
+			Data:         report,
+			Annotations:  annotations,
+		})
+	}
+	for _, format := range scanner.SBOMFormats {
+		sbom, ok := scanner.ExtractJSON(sboms[format])
+		if !ok {
+			continue
+		}
+		attach("sbom-"+string(format), registry.Artifact{
+			ArtifactType: format.MediaType(),
+			MediaType:    format.MediaType(),
+			Data:         sbom,
+			Annotations:  annotations,
+		})
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeReferrers records the attached artifacts and treats their digests as attached.
+type fakeReferrers struct {
+	mu        sync.Mutex
+	artifacts []registry.Artifact
+	digests   map[string]bool
+}
+
+func (f *fakeReferrers) Attach(_ context.Context, _ types.RegistryEvent, a registry.Artifact) (v1.Hash, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.artifacts = append(f.artifacts, a)
+	return v1.Hash{}, nil
+}
+
+func (f *fakeReferrers) Attached(_ context.Context, e types.RegistryEvent) (bool, error) {
+	return f.digests[e.Digest.String()], nil
+}
+
+var _ = Describe("Referrers", func() {
+	It("should attach the report and the SBOM of a finished scan", func(ctx SpecContext) {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "scan",
+				Namespace: "default",
+				UID:       "uid-1",
+				Labels:    map[string]string{managedByLabel: managedByValue},
+				Annotations: map[string]string{
+					eventAnnotation:   `{"registry":"registry.example.com","repository":"app","digest":"sha256:abc"}`,
+					scannerAnnotation: scanner.BackendSnyk,
+				},
+			},
+			Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: scanner.SBOMContainerName(scanner.SBOMCycloneDX)}},
+			}}},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()}},
+			},
+		}
+		referrers := &fakeReferrers{}
+		r := &ScanJobReconciler{
+			client: fake.NewClientBuilder().WithObjects(job).Build(),
+			Logs: containerLogs{
+				scanner.ContainerName:                            `{"ok":true,"vulnerabilities":[]}`,
+				scanner.SBOMContainerName(scanner.SBOMCycloneDX): `{"bomFormat":"CycloneDX"}`,
+			},
+			Referrers: referrers,
+		}
+
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: k8stypes.NamespacedName{Name: "scan", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(referrers.artifacts).To(ConsistOf(
+			And(HaveField("ArtifactType", registry.ReportArtifactType), HaveField("Data", MatchJSON(`{"ok":true,"vulnerabilities":[]}`))),
+			And(HaveField("ArtifactType", "application/vnd.cyclonedx+json"), HaveField("Data", MatchJSON(`{"bomFormat":"CycloneDX"}`))),
+		))
+		Expect(referrers.artifacts[0].Annotations).To(HaveKeyWithValue(scannerAnnotation, scanner.BackendSnyk))
+	})
+
+	It("should not attach anything for failed scans or outputs without report", func(ctx SpecContext) {
+		referrers := &fakeReferrers{}
+		res := results.Result{Status: results.StatusScanFailed, Time: time.Now()}
+		Expect(AttachArtifacts(ctx, referrers, res, []byte(`{"ok":false}`), nil)).To(Succeed())
+		res.Status = results.StatusScanned
+		Expect(AttachArtifacts(ctx, referrers, res, []byte("Monitoring image\n"), nil)).To(Succeed())
+		Expect(referrers.artifacts).To(BeEmpty())
+	})
+
+	It("should ignore the events of attached artifacts", func(ctx SpecContext) {
+		client := fake.NewClientBuilder().Build()
+		e := types.RegistryEvent{
+			Registry:   "docker.io",
+			Repository: "library/ubuntu",
+			Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+		}
+		r := Reconciler{
+			client:      client,
+			Registry:    linuxAMD64,
+			Attachments: &fakeReferrers{digests: map[string]bool{e.Digest.String(): true}},
+		}
+
+		_, err := r.Reconcile(ctx, e)
+		Expect(err).NotTo(HaveOccurred())
+		var jobs batchv1.JobList
+		Expect(client.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+	})
+})
+
+type containerLogs map[string]string
+
+func (c containerLogs) ScanLogs(_ context.Context, _ *batchv1.Job, container string) ([]byte, error) {
+	return []byte(c[container]), nil
+}
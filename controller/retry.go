@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// RetryPolicy controls how events failing with transient errors are retried.
+type RetryPolicy struct {
+	// BaseDelay is the delay before the first retry. It doubles with every further attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries.
+	MaxDelay time.Duration
+	// MaxAttempts is the number of attempts before an event is moved to the dead letters.
+	MaxAttempts int
+}
+
+// DefaultRetryPolicy is used if the Reconciler has no RetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	BaseDelay:   5 * time.Second,
+	MaxDelay:    5 * time.Minute,
+	MaxAttempts: 10,
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+func (p RetryPolicy) orDefault() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		return DefaultRetryPolicy
+	}
+	return p
+}
+
+// handleLookupError drops events with permanent errors and retries the others
+// until they exhaust their attempts and are moved to the dead letters.
+// Canceled lookups are returned as they are, the controller is stopping.
+func (r *Reconciler) handleLookupError(ctx context.Context, log logr.Logger, s eventSettings, e types.RegistryEvent, err error) (reconcile.Result, error) {
+	if errors.Is(err, context.Canceled) {
+		return reconcile.Result{}, err
+	}
+	if !registry.IsTransient(err) {
+		r.forget(e)
+		log.Error(err, "dropping event after permanent error")
+		metrics.ReconcileOutcome(e.Registry, e.Repository, metrics.OutcomeDropped)
+		return reconcile.Result{}, r.record(ctx, e, s.policy, results.StatusDropped, err.Error())
+	}
+
+	return r.retry(ctx, log, s, e, err)
+}
+
+// retry requeues e after err until it exhausted its attempts and is moved to the dead letters.
+func (r *Reconciler) retry(ctx context.Context, log logr.Logger, s eventSettings, e types.RegistryEvent, err error) (reconcile.Result, error) {
+	if errors.Is(err, context.Canceled) {
+		return reconcile.Result{}, err
+	}
+	policy := s.RetryPolicy.orDefault()
+	attempt := r.attempt(e)
+	if attempt >= policy.MaxAttempts {
+		r.forget(e)
+		log.Error(err, "giving up on event", "attempts", attempt)
+		metrics.ReconcileOutcome(e.Registry, e.Repository, metrics.OutcomeFailed)
+		if r.DeadLetters != nil {
+			r.DeadLetters.Add(results.DeadLetter{Event: e, Reason: err.Error(), Attempts: attempt})
+		}
+		return reconcile.Result{}, r.record(ctx, e, s.policy, results.StatusFailed, err.Error())
+	}
+
+	delay := policy.delay(attempt)
+	log.Error(err, "retrying event", "attempt", attempt, "delay", delay)
+	metrics.ReconcileOutcome(e.Registry, e.Repository, metrics.OutcomeRetried)
+	return reconcile.Result{RequeueAfter: delay}, nil
+}
+
+// attempt increments and returns the number of failed attempts of e.
+func (r *Reconciler) attempt(e types.RegistryEvent) int {
+	r.attemptsMu.Lock()
+	defer r.attemptsMu.Unlock()
+	if r.attempts == nil {
+		r.attempts = map[types.RegistryEvent]int{}
+	}
+	r.attempts[e]++
+	return r.attempts[e]
+}
+
+func (r *Reconciler) forget(e types.RegistryEvent) {
+	r.attemptsMu.Lock()
+	defer r.attemptsMu.Unlock()
+	delete(r.attempts, e)
+}
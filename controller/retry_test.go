@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Retry", func() {
+	req := types.RegistryEvent{
+		Registry:   "docker.io",
+		Repository: "library/ubuntu",
+		Tag:        "latest",
+		Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+	}
+
+	var (
+		store       *results.MemoryStore
+		deadLetters *results.DeadLetters
+	)
+	BeforeEach(func() {
+		store = results.NewMemoryStore()
+		deadLetters = results.NewDeadLetters()
+	})
+
+	It("should drop events with permanent errors", func(ctx SpecContext) {
+		r := Reconciler{
+			client:      fake.NewClientBuilder().Build(),
+			Registry:    fakeRegistry{err: &transport.Error{StatusCode: http.StatusNotFound}},
+			Results:     store,
+			DeadLetters: deadLetters,
+		}
+
+		result, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(reconcile.Result{}))
+
+		list, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(ConsistOf(HaveField("Status", results.StatusDropped)))
+		Expect(deadLetters.List(results.Filter{})).To(BeEmpty())
+	})
+
+	It("should neither drop nor count canceled lookups", func(ctx SpecContext) {
+		r := Reconciler{
+			client:      fake.NewClientBuilder().Build(),
+			Registry:    fakeRegistry{err: fmt.Errorf("getting manifest: %w", context.Canceled)},
+			Results:     store,
+			DeadLetters: deadLetters,
+		}
+
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(store.List(ctx, results.Filter{})).To(BeEmpty())
+		Expect(r.attempts).To(BeEmpty())
+	})
+
+	It("should retry transient errors and move the event to the dead letters", func(ctx SpecContext) {
+		r := Reconciler{
+			client:      fake.NewClientBuilder().Build(),
+			Registry:    fakeRegistry{err: errors.New("connection reset")},
+			Results:     store,
+			DeadLetters: deadLetters,
+			RetryPolicy: RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute, MaxAttempts: 2},
+		}
+
+		result, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Second))
+		Expect(deadLetters.List(results.Filter{})).To(BeEmpty())
+
+		result, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(reconcile.Result{}))
+		Expect(deadLetters.List(results.Filter{})).To(ConsistOf(And(
+			HaveField("Event", req),
+			HaveField("Attempts", 2),
+		)))
+
+		list, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(ConsistOf(HaveField("Status", results.StatusFailed)))
+	})
+
+	It("should retry failed job creations and move the event to the dead letters", func(ctx SpecContext) {
+		jobs := &failingJobs{err: errors.New("etcdserver: request timed out")}
+		r := Reconciler{
+			client:      fake.NewClientBuilder().Build(),
+			Registry:    linuxAMD64,
+			Jobs:        jobs,
+			Results:     store,
+			DeadLetters: deadLetters,
+			RetryPolicy: RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute, MaxAttempts: 2},
+		}
+
+		result, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Second))
+
+		result, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(reconcile.Result{}))
+		Expect(jobs.calls).To(Equal(2))
+		Expect(deadLetters.List(results.Filter{})).To(ConsistOf(And(
+			HaveField("Event", req),
+			HaveField("Attempts", 2),
+			HaveField("Reason", ContainSubstring("request timed out")),
+		)))
+	})
+
+	It("should reset the attempts after a successful lookup", func(ctx SpecContext) {
+		r := Reconciler{
+			client:      fake.NewClientBuilder().Build(),
+			Registry:    fakeRegistry{err: errors.New("connection reset")},
+			RetryPolicy: RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute, MaxAttempts: 2},
+		}
+
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		r.Registry = linuxAMD64
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.attempts).NotTo(HaveKey(req))
+	})
+})
+
+// failingJobs fails to create every job with err.
+type failingJobs struct {
+	err   error
+	calls int
+}
+
+func (f *failingJobs) Create(_ context.Context, _ client.Object, _ ...client.CreateOption) error {
+	f.calls++
+	return f.err
+}
+
+var _ = DescribeTable("RetryPolicy.delay", func(attempt int, expected time.Duration) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, MaxAttempts: 10}
+	Expect(p.delay(attempt)).To(Equal(expected))
+},
+	Entry("first attempt", 1, time.Second),
+	Entry("third attempt", 3, 4*time.Second),
+	Entry("capped", 8, 10*time.Second),
+)
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+// StoreSBOMs keeps the SBOMs printed by the SBOM containers of the scan of e under its digest.
+// sboms holds the output of the containers by format, outputs without JSON document are skipped.
+func StoreSBOMs(ctx context.Context, store sbom.Store, e types.RegistryEvent, sboms map[scanner.SBOMFormat][]byte) error {
+	var errs []error
+	for _, format := range scanner.SBOMFormats {
+		doc, ok := scanner.ExtractJSON(sboms[format])
+		if !ok {
+			continue
+		}
+		err := store.Put(ctx, e.Digest, format, doc)
+		metrics.SBOMStored(e.Registry, e.Repository, string(format), err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("storing %s SBOM: %w", format, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("StoreSBOMs", func() {
+	It("should store the SBOMs of a finished scan job by digest", func(ctx SpecContext) {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "scan",
+				Namespace: "default",
+				UID:       "uid-1",
+				Labels:    map[string]string{managedByLabel: managedByValue},
+				Annotations: map[string]string{
+					eventAnnotation:   `{"registry":"registry.example.com","repository":"app","digest":"` + policyEvent.Digest.String() + `"}`,
+					scannerAnnotation: scanner.BackendSnyk,
+				},
+			},
+			Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					{Name: scanner.SBOMContainerName(scanner.SBOMCycloneDX)},
+					{Name: scanner.SBOMContainerName(scanner.SBOMSPDX)},
+				},
+			}}},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()}},
+			},
+		}
+		store := sbom.NewMemoryStore(0)
+		r := &ScanJobReconciler{
+			client: fake.NewClientBuilder().WithObjects(job).Build(),
+			Logs: containerLogs{
+				scanner.SBOMContainerName(scanner.SBOMCycloneDX): "Analyzing image\n{\"bomFormat\":\"CycloneDX\"}\n",
+				scanner.SBOMContainerName(scanner.SBOMSPDX):      "error: unsupported image",
+			},
+			SBOMs: store,
+		}
+
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: k8stypes.NamespacedName{Name: "scan", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+		// the SBOM is kept even if the scan after it failed
+		Expect(store.Formats(ctx, policyEvent.Digest)).To(Equal([]scanner.SBOMFormat{scanner.SBOMCycloneDX}))
+		Expect(store.Get(ctx, policyEvent.Digest, scanner.SBOMCycloneDX)).To(MatchJSON(`{"bomFormat":"CycloneDX"}`))
+	})
+
+	It("should skip outputs without SBOM", func(ctx SpecContext) {
+		store := sbom.NewMemoryStore(0)
+		Expect(StoreSBOMs(ctx, store, types.RegistryEvent{Digest: policyEvent.Digest}, nil)).To(Succeed())
+		Expect(store.Formats(ctx, policyEvent.Digest)).To(BeEmpty())
+	})
+})
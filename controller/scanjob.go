@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ScanJobControllerName is the name of the controller observing scan jobs.
+const ScanJobControllerName = "scan-job-observer"
+
+// ShardOwner decides whether this replica is responsible for an event.
+type ShardOwner interface {
+	Owns(e types.RegistryEvent) bool
+}
+
+// ScanJobReconciler observes finished scan jobs.
+type ScanJobReconciler struct {
+	// Shards restricts the observed jobs to the repositories owned by this replica, if set.
+	Shards ShardOwner
+	// Results records the outcome of each scan, if set.
+	Results results.Store
+	// Logs reads the output of the scans to record their findings, if set.
+	Logs LogReader
+	// Referrers attaches the reports and SBOMs of successful scans to the scanned images, if set.
+	// It needs Logs.
+	Referrers ReferrerPusher
+	// SBOMs keeps the SBOMs printed by the scan jobs, if set. It needs Logs.
+	SBOMs sbom.Store
+	// Inventory indexes the packages of the SBOMs printed by the scan jobs, if set. It needs Logs.
+	Inventory *inventory.Index
+
+	client client.Client
+
+	mu sync.Mutex
+	// observed holds the UID of each finished job that was already recorded
+	observed map[k8stypes.NamespacedName]k8stypes.UID
+}
+
+// AddToManager adds ScanJobReconciler to the given manager.
+func (r *ScanJobReconciler) AddToManager(mgr manager.Manager) error {
+	if r.client == nil {
+		r.client = mgr.GetClient()
+	}
+
+	return builder.ControllerManagedBy(mgr).
+		Named(ScanJobControllerName).
+		For(&batchv1.Job{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.isOwnedScanJob))).
+		Complete(r)
+}
+
+func isScanJob(obj client.Object) bool {
+	return obj.GetLabels()[managedByLabel] == managedByValue
+}
+
+func (r *ScanJobReconciler) isOwnedScanJob(obj client.Object) bool {
+	if !isScanJob(obj) {
+		return false
+	}
+	if r.Shards == nil {
+		return true
+	}
+	return r.Shards.Owns(types.RegistryEvent{
+		Registry:   obj.GetAnnotations()[annotationPrefix+"registry"],
+		Repository: obj.GetAnnotations()[annotationPrefix+"repository"],
+	})
+}
+
+func (r *ScanJobReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	var job batchv1.Job
+	if err := r.client.Get(ctx, req.NamespacedName, &job); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(req.NamespacedName)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	outcome, finishedAt, ok := jobOutcome(&job)
+	if !ok || job.Annotations[recordedAnnotation] != "" || !r.observe(req.NamespacedName, job.UID) {
+		return reconcile.Result{}, nil
+	}
+
+	var duration time.Duration
+	if job.Status.StartTime != nil {
+		duration = finishedAt.Sub(job.Status.StartTime.Time)
+	}
+	metrics.ScanFinished(job.Annotations[annotationPrefix+"registry"], job.Annotations[annotationPrefix+"repository"], outcome, duration)
+
+	if r.Results != nil || r.Referrers != nil || r.SBOMs != nil || r.Inventory != nil {
+		if err := r.recordScan(ctx, &job, outcome, finishedAt); err != nil {
+			// observe the job again on retry
+			r.forget(req.NamespacedName)
+			return reconcile.Result{}, err
+		}
+	}
+	if err := r.markRecorded(ctx, &job); err != nil {
+		// recording again would count the scan twice, the job is only recorded again after a restart
+		logf.FromContext(ctx).Error(err, "marking scan job as recorded")
+	}
+	return reconcile.Result{}, nil
+}
+
+// markRecorded annotates job with recordedAnnotation.
+func (r *ScanJobReconciler) markRecorded(ctx context.Context, job *batchv1.Job) error {
+	patch := client.MergeFrom(job.DeepCopy())
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[recordedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	return r.client.Patch(ctx, job, patch)
+}
+
+// recordScan records the outcome and findings of a finished scan job, stores and indexes its SBOMs and attaches
+// its artifacts.
+// Failing to read the findings is recorded as the reason of the result.
+func (r *ScanJobReconciler) recordScan(ctx context.Context, job *batchv1.Job, outcome string, finishedAt time.Time) error {
+	res, ok := ScanJobResult(job, outcome, finishedAt)
+	if !ok {
+		return nil
+	}
+	var logs []byte
+	if r.Logs != nil {
+		var err error
+		logs, err = r.Logs.ScanLogs(ctx, job, scanner.ContainerName)
+		if err == nil {
+			err = AddFindings(&res, logs)
+		}
+		if err != nil {
+			logf.FromContext(ctx).Error(err, "reading scan findings")
+			res.Reason = err.Error()
+		} else if res.Verdict != "" {
+			metrics.ScanVerdict(res.Event.Registry, res.Event.Repository, string(res.Verdict))
+		}
+	}
+	if r.Results != nil {
+		if err := r.Results.Record(ctx, res); err != nil {
+			return fmt.Errorf("failed to record result: %w", err)
+		}
+	}
+	var sboms map[scanner.SBOMFormat][]byte
+	if r.Logs != nil && (r.Referrers != nil || r.SBOMs != nil || r.Inventory != nil) {
+		sboms = r.sbomLogs(ctx, job)
+	}
+	if r.SBOMs != nil {
+		if err := StoreSBOMs(ctx, r.SBOMs, res.Event, sboms); err != nil {
+			logf.FromContext(ctx).Error(err, "storing SBOMs")
+		}
+	}
+	if r.Inventory != nil {
+		if err := r.Inventory.AddSBOMs(res.Event, sboms); err != nil {
+			logf.FromContext(ctx).Error(err, "indexing SBOM packages")
+		}
+	}
+	if r.Referrers != nil && r.Logs != nil && res.Reason == "" {
+		// pushing again on retry would attach duplicates, failures are only logged
+		if err := AttachArtifacts(ctx, r.Referrers, res, logs, sboms); err != nil {
+			logf.FromContext(ctx).Error(err, "attaching artifacts to image")
+		}
+	}
+	return nil
+}
+
+// sbomLogs reads the output of the SBOM containers of a scan job by format.
+func (r *ScanJobReconciler) sbomLogs(ctx context.Context, job *batchv1.Job) map[scanner.SBOMFormat][]byte {
+	sboms := map[scanner.SBOMFormat][]byte{}
+	for _, format := range SBOMFormats(job) {
+		logs, err := r.Logs.ScanLogs(ctx, job, scanner.SBOMContainerName(format))
+		if err != nil {
+			logf.FromContext(ctx).Error(err, "reading SBOM", "format", format)
+			continue
+		}
+		sboms[format] = logs
+	}
+	return sboms
+}
+
+// ScanJobResult restores the result of a scan job that finished with outcome from the annotations of the job.
+// It returns false for jobs created by older versions, which don't know their event.
+func ScanJobResult(job *batchv1.Job, outcome string, finishedAt time.Time) (results.Result, bool) {
+	var e types.RegistryEvent
+	if err := json.Unmarshal([]byte(job.Annotations[eventAnnotation]), &e); err != nil {
+		return results.Result{}, false
+	}
+	res := results.Result{
+		Event:      e,
+		Status:     results.StatusScanned,
+		Policy:     job.Annotations[policyAnnotation],
+		Scanner:    job.Annotations[scannerAnnotation],
+		SnykPolicy: job.Annotations[snykPolicyAnnotation],
+		Time:       finishedAt,
+	}
+	if outcome == metrics.ScanFailed {
+		res.Status = results.StatusScanFailed
+	}
+	if period, err := time.Parse(time.RFC3339, job.Annotations[rescanPeriodAnnotation]); err == nil {
+		res.Period = &period
+	}
+	return res, true
+}
+
+// AddFindings parses the output of the scan container with the backend of res and counts the findings
+// and the verdict in res.
+func AddFindings(res *results.Result, output []byte) error {
+	s, err := scanner.New(res.Scanner, scanner.Options{})
+	if err != nil {
+		return err
+	}
+	findings, err := s.ParseFindings(output)
+	if err != nil {
+		return err
+	}
+	if findings == nil {
+		return nil
+	}
+	res.Vulnerabilities = findings.Summary()
+	if findings.Passed != nil {
+		res.Verdict = results.VerdictFail
+		if *findings.Passed {
+			res.Verdict = results.VerdictPass
+		}
+	}
+	return nil
+}
+
+// observe returns true the first time it is called for a job.
+func (r *ScanJobReconciler) observe(name k8stypes.NamespacedName, uid k8stypes.UID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.observed == nil {
+		r.observed = map[k8stypes.NamespacedName]k8stypes.UID{}
+	}
+	if r.observed[name] == uid {
+		return false
+	}
+	r.observed[name] = uid
+	return true
+}
+
+func (r *ScanJobReconciler) forget(name k8stypes.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.observed, name)
+}
+
+// jobOutcome returns the outcome and finish time of a job, ok is false if the job is still running.
+func jobOutcome(job *batchv1.Job) (outcome string, finishedAt time.Time, ok bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return metrics.ScanSucceeded, c.LastTransitionTime.Time, true
+		case batchv1.JobFailed:
+			return metrics.ScanFailed, c.LastTransitionTime.Time, true
+		}
+	}
+	return "", time.Time{}, false
+}
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("ScanJobReconciler", func() {
+	It("should observe a finished job once", func(ctx SpecContext) {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "scan",
+				Namespace: "default",
+				UID:       "uid-1",
+				Labels:    map[string]string{managedByLabel: managedByValue},
+			},
+			Status: batchv1.JobStatus{
+				StartTime: &metav1.Time{Time: time.Now().Add(-time.Minute)},
+				Conditions: []batchv1.JobCondition{
+					{Type: batchv1.JobComplete, Status: v1.ConditionTrue, LastTransitionTime: metav1.Now()},
+				},
+			},
+		}
+		r := &ScanJobReconciler{client: fake.NewClientBuilder().WithObjects(job).Build()}
+		req := reconcile.Request{NamespacedName: k8stypes.NamespacedName{Name: "scan", Namespace: "default"}}
+
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.observe(req.NamespacedName, job.UID)).To(BeFalse())
+	})
+
+	It("should record the findings of a finished job", func(ctx SpecContext) {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "scan",
+				Namespace: "default",
+				UID:       "uid-1",
+				Labels:    map[string]string{managedByLabel: managedByValue},
+				Annotations: map[string]string{
+					eventAnnotation:        `{"registry":"registry.example.com","repository":"app","digest":"sha256:abc"}`,
+					scannerAnnotation:      scanner.BackendTrivy,
+					policyAnnotation:       "default/strict",
+					rescanPeriodAnnotation: "2024-05-01T10:00:00Z",
+				},
+			},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue, LastTransitionTime: metav1.Now()}},
+			},
+		}
+		store := results.NewMemoryStore()
+		r := &ScanJobReconciler{
+			client:  fake.NewClientBuilder().WithObjects(job).Build(),
+			Results: store,
+			Logs:    staticLogs(`{"Results":[{"Vulnerabilities":[{"VulnerabilityID":"CVE-2024-1","PkgName":"openssl","Severity":"HIGH"}]}]}`),
+		}
+
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: k8stypes.NamespacedName{Name: "scan", Namespace: "default"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		res, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(HaveLen(1))
+		Expect(res[0].Event.Digest).To(BeEquivalentTo("sha256:abc"))
+		Expect(res[0].Status).To(Equal(results.StatusScanFailed))
+		Expect(res[0].Policy).To(Equal("default/strict"))
+		Expect(res[0].Scanner).To(Equal(scanner.BackendTrivy))
+		Expect(res[0].Vulnerabilities).To(Equal(scanner.Summary{scanner.SeverityHigh: 1}))
+		Expect(res[0].Period).To(HaveValue(BeTemporally("==", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))))
+	})
+
+	It("should record a finished job once across restarts", func(ctx SpecContext) {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "scan",
+				Namespace: "default",
+				UID:       "uid-1",
+				Labels:    map[string]string{managedByLabel: managedByValue},
+				Annotations: map[string]string{
+					eventAnnotation:   `{"registry":"registry.example.com","repository":"app","digest":"sha256:abc"}`,
+					scannerAnnotation: scanner.BackendTrivy,
+				},
+			},
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue, LastTransitionTime: metav1.Now()}},
+			},
+		}
+		c := fake.NewClientBuilder().WithObjects(job).Build()
+		req := reconcile.Request{NamespacedName: k8stypes.NamespacedName{Name: "scan", Namespace: "default"}}
+		store := results.NewMemoryStore()
+		_, err := (&ScanJobReconciler{client: c, Results: store}).Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		var recorded batchv1.Job
+		Expect(c.Get(ctx, req.NamespacedName, &recorded)).To(Succeed())
+		Expect(recorded.Annotations).To(HaveKey(recordedAnnotation))
+
+		// a new replica with an empty store, like after a restart, skips the job
+		restarted := results.NewMemoryStore()
+		_, err = (&ScanJobReconciler{client: c, Results: restarted}).Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restarted.List(ctx, results.Filter{})).To(BeEmpty())
+	})
+
+	It("should forget deleted jobs", func(ctx SpecContext) {
+		r := &ScanJobReconciler{client: fake.NewClientBuilder().Build()}
+		name := k8stypes.NamespacedName{Name: "scan", Namespace: "default"}
+		r.observe(name, "uid-1")
+
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.observed).NotTo(HaveKey(name))
+	})
+
+	It("should only observe jobs of owned repositories", func() {
+		job := func(repository string) *batchv1.Job {
+			return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+				Labels:      map[string]string{managedByLabel: managedByValue},
+				Annotations: map[string]string{annotationPrefix + "registry": "registry.example.com", annotationPrefix + "repository": repository},
+			}}
+		}
+		r := &ScanJobReconciler{Shards: ownedRepositories{"registry.example.com/mine": true}}
+		Expect(r.isOwnedScanJob(job("mine"))).To(BeTrue())
+		Expect(r.isOwnedScanJob(job("other"))).To(BeFalse())
+		Expect(r.isOwnedScanJob(&batchv1.Job{})).To(BeFalse())
+	})
+})
+
+type staticLogs string
+
+func (s staticLogs) ScanLogs(context.Context, *batchv1.Job, string) ([]byte, error) {
+	return []byte(s), nil
+}
+
+type ownedRepositories map[string]bool
+
+func (o ownedRepositories) Owns(e types.RegistryEvent) bool {
+	return o[e.ShardKey()]
+}
+
+var _ = DescribeTable("jobOutcome", func(conditions []batchv1.JobCondition, expected string, finished bool) {
+	outcome, _, ok := jobOutcome(&batchv1.Job{Status: batchv1.JobStatus{Conditions: conditions}})
+	Expect(ok).To(Equal(finished))
+	Expect(outcome).To(Equal(expected))
+},
+	Entry("running", nil, "", false),
+	Entry("complete", []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}, metrics.ScanSucceeded, true),
+	Entry("failed", []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue}}, metrics.ScanFailed, true),
+	Entry("suspended", []batchv1.JobCondition{{Type: batchv1.JobSuspended, Status: v1.ConditionTrue}}, "", false),
+)
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SnykRule selects the snyk commands and gating options for the images of matching repositories and tags.
+type SnykRule struct {
+	// Repositories are globs on "<registry>/<repository>".
+	Repositories []string `json:"repositories"`
+	// Tags are globs on the tag of the image. Empty matches all images, including those pushed by digest.
+	Tags []string `json:"tags,omitempty"`
+	// The options set here replace those of the scanner.
+	v1alpha1.SnykOptions `json:",inline"`
+}
+
+func (r SnykRule) matches(e types.RegistryEvent) bool {
+	return matchesAny(r.Repositories, e.RepositoryPath()) && (len(r.Tags) == 0 || matchesAny(r.Tags, e.Tag))
+}
+
+func matchesAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// forEvent returns s with the options of the first snyk rule matching e applied.
+func (s Scanner) forEvent(e types.RegistryEvent) Scanner {
+	for _, rule := range s.SnykRules {
+		if rule.matches(e) {
+			s.Snyk = overlaySnykOptions(s.Snyk, rule.SnykOptions)
+			break
+		}
+	}
+	return s
+}
+
+// overlaySnykOptions returns base with the fields set in o replaced.
+func overlaySnykOptions(base, o v1alpha1.SnykOptions) v1alpha1.SnykOptions {
+	if o.Mode != "" {
+		base.Mode = o.Mode
+	}
+	if o.SeverityThreshold != "" {
+		base.SeverityThreshold = o.SeverityThreshold
+	}
+	if o.FailOn != "" {
+		base.FailOn = o.FailOn
+	}
+	if o.ExcludeBaseImageVulns != nil {
+		base.ExcludeBaseImageVulns = o.ExcludeBaseImageVulns
+	}
+	if o.ExcludeAppVulns != nil {
+		base.ExcludeAppVulns = o.ExcludeAppVulns
+	}
+	if o.Policy != nil {
+		base.Policy = o.Policy
+	}
+	return base
+}
+
+func snykOptions(o v1alpha1.SnykOptions) scanner.SnykOptions {
+	return scanner.SnykOptions{
+		Mode:                  scanner.SnykMode(o.Mode),
+		SeverityThreshold:     scanner.Severity(o.SeverityThreshold),
+		FailOn:                o.FailOn,
+		ExcludeBaseImageVulns: o.ExcludeBaseImageVulns != nil && *o.ExcludeBaseImageVulns,
+		ExcludeAppVulns:       o.ExcludeAppVulns != nil && *o.ExcludeAppVulns,
+		Policy:                o.Policy,
+	}
+}
+
+// snykPolicy returns the reference to the snyk policy of the scan, if snyk scans with one.
+func (es eventSettings) snykPolicy() *v1.ConfigMapKeySelector {
+	if es.scanner.Name() != scanner.BackendSnyk {
+		return nil
+	}
+	return es.Scanner.Snyk.Policy
+}
+
+// snykPolicyDigest returns the digest of the snyk policy ref in namespace.
+func (r *Reconciler) snykPolicyDigest(ctx context.Context, namespace string, ref v1.ConfigMapKeySelector) (digest.Digest, error) {
+	var cm v1.ConfigMap
+	if err := r.reader().Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &cm); err != nil {
+		return "", fmt.Errorf("failed to get snyk policy: %w", err)
+	}
+	key := cmp.Or(ref.Key, scanner.DefaultSnykPolicyKey)
+	policy, ok := cm.Data[key]
+	if !ok {
+		return "", fmt.Errorf("snyk policy ConfigMap %s has no key %s", ref.Name, key)
+	}
+	return digest.FromString(policy), nil
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("SnykRules", func() {
+	s := Scanner{
+		Snyk: v1alpha1.SnykOptions{Mode: "monitor", ExcludeAppVulns: ptr.To(true)},
+		SnykRules: []SnykRule{
+			{Repositories: []string{"registry.example.com/team-a/*"}, Tags: []string{"v*"}, SnykOptions: v1alpha1.SnykOptions{Mode: "both", SeverityThreshold: "high"}},
+			{Repositories: []string{"registry.example.com/team-a/*"}, SnykOptions: v1alpha1.SnykOptions{Mode: "test", ExcludeAppVulns: ptr.To(false)}},
+		},
+	}
+
+	It("should apply the first matching rule", func() {
+		e := policyEvent
+		e.Tag = "v1.2.0"
+		Expect(s.forEvent(e).Snyk).To(Equal(v1alpha1.SnykOptions{Mode: "both", SeverityThreshold: "high", ExcludeAppVulns: ptr.To(true)}))
+
+		Expect(s.forEvent(policyEvent).Snyk).To(Equal(v1alpha1.SnykOptions{Mode: "test", ExcludeAppVulns: ptr.To(false)}))
+	})
+
+	It("should keep the options without matching rule", func() {
+		e := policyEvent
+		e.Repository = "team-b/app"
+		Expect(s.forEvent(e).Snyk).To(Equal(s.Snyk))
+	})
+
+	It("should monitor in an init container and test in the scan container", func(ctx SpecContext) {
+		c := fake.NewClientBuilder().Build()
+		r := &Reconciler{client: c, Registry: linuxAMD64, Scanner: s}
+		e := policyEvent
+		e.Tag = "v1.2.0"
+		_, err := r.Reconcile(ctx, e)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		pod := jobs.Items[0].Spec.Template.Spec
+		Expect(pod.InitContainers).To(HaveLen(1))
+		Expect(pod.InitContainers[0].Args).To(ContainElement("monitor"))
+		Expect(pod.Containers[0].Args).To(ContainElements("test", "--severity-threshold=high", "--exclude-app-vulns"))
+	})
+})
+
+var _ = DescribeTable("AddFindings verdict", func(output string, expected results.Verdict) {
+	res := results.Result{Event: policyEvent, Scanner: scanner.BackendSnyk}
+	Expect(AddFindings(&res, []byte(output))).To(Succeed())
+	Expect(res.Verdict).To(Equal(expected))
+},
+	Entry("passed", `{"ok":true,"vulnerabilities":[]}`, results.VerdictPass),
+	Entry("failed", `{"ok":false,"vulnerabilities":[{"id":"SNYK-1","severity":"high"}]}`, results.VerdictFail),
+	Entry("monitor only", "Monitoring registry.example.com/team-a/app\n", results.Verdict("")),
+)
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SnykPolicyControllerName is the name of the controller rescanning images when their snyk policy changes.
+const SnykPolicyControllerName = "snyk-policy-watcher"
+
+// SnykPolicyReconciler rescans the current digests of the repositories using a snyk policy when it changes.
+// Only ConfigMaps with the SnykPolicyLabel set to "true" are watched. The current digests are the latest
+// scanned digest of every tag in Results, the rescans create new jobs because the job names include the policy digest.
+// A digest is rescanned if its latest result used another version of the policy, so changes made while the
+// controller wasn't running are found on start.
+type SnykPolicyReconciler struct {
+	// Reconciler decides which policy applies to an image.
+	Reconciler *Reconciler
+	Results    results.Store
+	// Events receives the events to rescan, usually the source channel of the Reconciler.
+	Events chan<- event.TypedGenericEvent[types.RegistryEvent]
+
+	client client.Client
+}
+
+// AddToManager adds SnykPolicyReconciler to the given manager.
+func (r *SnykPolicyReconciler) AddToManager(mgr manager.Manager) error {
+	if r.client == nil {
+		r.client = mgr.GetClient()
+	}
+
+	return builder.ControllerManagedBy(mgr).
+		Named(SnykPolicyControllerName).
+		For(&v1.ConfigMap{}, builder.WithPredicates(predicate.NewPredicateFuncs(isSnykPolicy))).
+		Complete(r)
+}
+
+func isSnykPolicy(obj client.Object) bool {
+	return obj.GetLabels()[SnykPolicyLabel] == "true"
+}
+
+// SnykPolicyCacheSelector selects the ConfigMaps SnykPolicyReconciler watches, so the cache of the manager can be
+// restricted to them.
+func SnykPolicyCacheSelector() labels.Selector {
+	return labels.SelectorFromSet(labels.Set{SnykPolicyLabel: "true"})
+}
+
+func (r *SnykPolicyReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	var cm v1.ConfigMap
+	if err := r.client.Get(ctx, req.NamespacedName, &cm); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if !isSnykPolicy(&cm) {
+		return reconcile.Result{}, nil
+	}
+
+	events, err := r.outdatedEvents(ctx, &cm)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if len(events) == 0 {
+		return reconcile.Result{}, nil
+	}
+	log := logf.FromContext(ctx)
+	log.Info("Rescanning images after snyk policy change", "images", len(events))
+	for _, e := range events {
+		select {
+		case r.Events <- event.TypedGenericEvent[types.RegistryEvent]{Object: e}:
+		case <-ctx.Done():
+			return reconcile.Result{}, ctx.Err()
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+// outdatedEvents returns the latest scanned event of every tag whose scan uses the snyk policy in cm, but used another
+// version of it. Results without snyk policy, like those recorded before it was stored, are skipped.
+func (r *SnykPolicyReconciler) outdatedEvents(ctx context.Context, cm *v1.ConfigMap) ([]types.RegistryEvent, error) {
+	list, err := r.Results.List(ctx, results.Filter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list results: %w", err)
+	}
+	type tagKey struct {
+		tenant, registry, repository, tag string
+	}
+	seen := map[tagKey]bool{}
+	var events []types.RegistryEvent
+	// the list starts with the most recent result, which holds the current digest of its tag
+	for _, res := range list {
+		e := res.Event
+		key := tagKey{e.Tenant, e.Registry, e.Repository, e.Tag}
+		if e.Tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		switch res.Status {
+		case results.StatusScheduled, results.StatusScanned, results.StatusScanFailed:
+		default:
+			continue
+		}
+		if res.SnykPolicy == "" {
+			continue
+		}
+
+		// the latest result might be the rescan for an advisory or a base update
+		e.Advisory, e.BaseUpdate = "", ""
+		ref, err := r.usesPolicy(ctx, e, client.ObjectKeyFromObject(cm))
+		if err != nil {
+			return nil, err
+		}
+		if ref == nil {
+			continue
+		}
+		policy, ok := cm.Data[cmp.Or(ref.Key, scanner.DefaultSnykPolicyKey)]
+		if !ok {
+			// the Reconciler retries the event until the key exists
+			continue
+		}
+		if res.SnykPolicy != cm.Name+"@"+digest.FromString(policy).String() {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// usesPolicy returns the reference to the snyk policy in cm if the scan of e uses it with the settings the
+// Reconciler has now, nil if not.
+func (r *SnykPolicyReconciler) usesPolicy(ctx context.Context, e types.RegistryEvent, cm k8stypes.NamespacedName) (*v1.ConfigMapKeySelector, error) {
+	namespace := r.Reconciler.namespaceFor(e)
+	if namespace != cm.Namespace {
+		return nil, nil
+	}
+	var policy *Policy
+	if r.Reconciler.Policies != nil {
+		var err error
+		if policy, err = r.Reconciler.Policies.Resolve(ctx, namespace, e); err != nil {
+			return nil, fmt.Errorf("failed to resolve scan policy: %w", err)
+		}
+	}
+	es, err := r.Reconciler.settingsFor(e).withPolicy(policy)
+	if err != nil {
+		// the Reconciler drops the event
+		return nil, nil
+	}
+	if ref := es.snykPolicy(); ref != nil && ref.Name == cm.Name {
+		return ref, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Snyk policies", func() {
+	var (
+		c       client.Client
+		store   *results.MemoryStore
+		r       *Reconciler
+		policy  *v1.ConfigMap
+		cmKey   = k8stypes.NamespacedName{Namespace: "scans", Name: "team-a-snyk"}
+		withRef = Scanner{SnykRules: []SnykRule{{
+			Repositories: []string{"registry.example.com/team-a/*"},
+			SnykOptions: v1alpha1.SnykOptions{Policy: &v1.ConfigMapKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: cmKey.Name},
+			}},
+		}}}
+	)
+
+	BeforeEach(func() {
+		policy = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: cmKey.Namespace, Name: cmKey.Name, Labels: map[string]string{SnykPolicyLabel: "true"}},
+			Data:       map[string]string{".snyk": "ignore: {}\n"},
+		}
+		c = fake.NewClientBuilder().WithObjects(policy).Build()
+		store = results.NewMemoryStore()
+		r = &Reconciler{client: c, Namespace: "scans", Registry: linuxAMD64, Results: store, Scanner: withRef}
+	})
+
+	It("should mount the policy and scan again when it changes", func(ctx SpecContext) {
+		_, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		job := jobs.Items[0]
+		Expect(job.Name).NotTo(Equal(scanJobName(policyEvent)))
+		Expect(job.Annotations[snykPolicyAnnotation]).To(HavePrefix(cmKey.Name + "@sha256:"))
+		Expect(job.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--policy-path=/etc/snyk-policy/.snyk"))
+		Expect(store.List(ctx, results.Filter{})).To(ConsistOf(HaveField("SnykPolicy", job.Annotations[snykPolicyAnnotation])))
+
+		policy.Data[".snyk"] = "ignore:\n  SNYK-1: []\n"
+		Expect(c.Update(ctx, policy)).To(Succeed())
+		_, err = r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(2))
+	})
+
+	It("should retry while the policy is missing", func(ctx SpecContext) {
+		Expect(c.Delete(ctx, policy)).To(Succeed())
+		result, err := r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(store.List(ctx, results.Filter{})).To(BeEmpty())
+
+		policy.ResourceVersion = ""
+		Expect(c.Create(ctx, policy)).To(Succeed())
+		_, err = r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.List(ctx, results.Filter{})).To(ConsistOf(And(
+			HaveField("Status", results.StatusScheduled),
+			HaveField("SnykPolicy", HavePrefix(cmKey.Name+"@sha256:")),
+		)))
+	})
+
+	It("should rescan the current digest of every tag that used another version of the policy", func(ctx SpecContext) {
+		events := make(chan event.TypedGenericEvent[types.RegistryEvent], 10)
+		pr := &SnykPolicyReconciler{Reconciler: r, Results: store, Events: events, client: c}
+
+		old := policyEvent
+		old.Digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+		other := policyEvent
+		other.Repository = "team-b/app"
+		unknown := policyEvent
+		unknown.Tag = "v2"
+		scannedWith := cmKey.Name + "@" + digest.FromString(policy.Data[".snyk"]).String()
+		now := time.Now()
+		for i, e := range []types.RegistryEvent{old, policyEvent, other} {
+			Expect(store.Record(ctx, results.Result{Event: e, Status: results.StatusScanned, SnykPolicy: scannedWith, Time: now.Add(time.Duration(i) * time.Second)})).To(Succeed())
+		}
+		// results recorded before the policy was stored aren't rescanned
+		Expect(store.Record(ctx, results.Result{Event: unknown, Status: results.StatusScanned, Time: now})).To(Succeed())
+
+		_, err := pr.Reconcile(ctx, reconcile.Request{NamespacedName: cmKey})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+
+		policy.Data[".snyk"] = "ignore:\n  SNYK-1: []\n"
+		Expect(c.Update(ctx, policy)).To(Succeed())
+		_, err = pr.Reconcile(ctx, reconcile.Request{NamespacedName: cmKey})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect((<-events).Object).To(Equal(policyEvent))
+
+		// a restarted controller finds the change, as long as the rescan wasn't recorded
+		pr = &SnykPolicyReconciler{Reconciler: r, Results: store, Events: events, client: c}
+		_, err = pr.Reconcile(ctx, reconcile.Request{NamespacedName: cmKey})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect((<-events).Object).To(Equal(policyEvent))
+
+		_, err = r.Reconcile(ctx, policyEvent)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = pr.Reconcile(ctx, reconcile.Request{NamespacedName: cmKey})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+})
@@ -0,0 +1,20 @@
+package controller
+
+import "github.com/stackitcloud/registry-snyk-scan/types"
+
+// Tenant holds the scan settings of the events a tenant sends to its own webhook endpoint.
+type Tenant struct {
+	// Namespace the scan jobs of the tenant are created in, instead of the namespace routes.
+	Namespace string `json:"namespace,omitempty"`
+	// Org is the Snyk organization of the tenant. ScanPolicies can override it.
+	Org string `json:"org,omitempty"`
+}
+
+// tenant returns the settings of the tenant of e, if any.
+func (r *Reconciler) tenant(e types.RegistryEvent) (Tenant, bool) {
+	if e.Tenant == "" {
+		return Tenant{}, false
+	}
+	t, ok := r.Tenants[e.Tenant]
+	return t, ok
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Tenants", func() {
+	It("should create the job with the namespace, org and labels of the tenant", func(ctx SpecContext) {
+		c := fake.NewClientBuilder().WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: scanner.DefaultSnykTokenSecret}},
+		).Build()
+		store := results.NewMemoryStore()
+		r := Reconciler{
+			Namespace: "scans",
+			Tenants:   map[string]Tenant{"a": {Namespace: "team-a", Org: "org-a"}},
+			client:    c,
+			Registry:  linuxAMD64,
+			Results:   store,
+		}
+		e := types.RegistryEvent{
+			Registry:   "registry.example.com",
+			Repository: "app",
+			Tag:        "latest",
+			Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+			Tenant:     "a",
+		}
+
+		_, err := r.Reconcile(ctx, e)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jobs batchv1.JobList
+		Expect(c.List(ctx, &jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		job := jobs.Items[0]
+		Expect(job.Namespace).To(Equal("team-a"))
+		Expect(job.Labels).To(HaveKeyWithValue("tenant", "a"))
+		e.Tenant = ""
+		Expect(job.Name).NotTo(Equal(scanJobName(e)))
+		Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "SNYK_ORG", Value: "org-a"}))
+
+		stored, err := store.List(ctx, results.Filter{Tenant: "a"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored).To(HaveLen(1))
+	})
+})
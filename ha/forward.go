@@ -0,0 +1,127 @@
+package ha
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ForwardedHeader marks requests forwarded by another replica, they are never forwarded again.
+// It carries the secret shared by the replicas, so that clients can't bypass the routing.
+const ForwardedHeader = "X-Registry-Snyk-Scan-Forwarded"
+
+// Forwarded reports whether r was forwarded by another replica knowing secret.
+func Forwarded(r *http.Request, secret string) bool {
+	value := r.Header.Get(ForwardedHeader)
+	return secret != "" && subtle.ConstantTimeCompare([]byte(value), []byte(secret)) == 1
+}
+
+// ErrNoLeader is returned while no replica holds the leader lease.
+var ErrNoLeader = errors.New("no leader elected")
+
+// Forwarder passes requests received by a non-leader replica on to the leader.
+// The leader is found through the holder identity of the leader election lease,
+// which controller-runtime sets to "<hostname>_<uuid>". The hostname of a pod is its name.
+type Forwarder struct {
+	// Reader is used to read the lease and the leader pod, it should not be cached.
+	Reader client.Reader
+	// Namespace of the lease and the replica pods.
+	Namespace string
+	// LeaseName is the leader election ID.
+	LeaseName string
+	// Port and Scheme of the webhook server of the leader.
+	Port   int
+	Scheme string
+	// Client sends the forwarded requests.
+	Client *http.Client
+	// Secret is shared by all replicas and sent with forwarded requests.
+	Secret string
+	// Elected is closed once this replica is the leader, see manager.Manager.Elected.
+	Elected <-chan struct{}
+}
+
+// IsLeader reports whether this replica is the leader.
+func (f *Forwarder) IsLeader() bool {
+	select {
+	case <-f.Elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// LeaderURL returns the base URL of the leader's webhook server.
+func (f *Forwarder) LeaderURL(ctx context.Context) (string, error) {
+	var lease coordinationv1.Lease
+	if err := f.Reader.Get(ctx, k8stypes.NamespacedName{Namespace: f.Namespace, Name: f.LeaseName}, &lease); err != nil {
+		return "", fmt.Errorf("getting leader lease: %w", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return "", ErrNoLeader
+	}
+	podName, _, _ := strings.Cut(*lease.Spec.HolderIdentity, "_")
+
+	var pod corev1.Pod
+	if err := f.Reader.Get(ctx, k8stypes.NamespacedName{Namespace: f.Namespace, Name: podName}, &pod); err != nil {
+		return "", fmt.Errorf("getting leader pod: %w", err)
+	}
+	if pod.Status.PodIP == "" {
+		return "", fmt.Errorf("leader pod %s has no IP", podName)
+	}
+	return fmt.Sprintf("%s://%s", f.Scheme, net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(f.Port))), nil
+}
+
+// Forward sends a request with method and body to path on the leader and returns the status code, content type
+// and body of its response. path may include a query.
+func (f *Forwarder) Forward(ctx context.Context, method, path string, header http.Header, body []byte) (int, string, []byte, error) {
+	leader, err := f.LeaderURL(ctx)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	return send(ctx, f.Client, f.Secret, method, leader+path, header, body)
+}
+
+// maxResponseSize limits the forwarded responses, which include SBOMs and result lists.
+const maxResponseSize = 64 << 20
+
+func post(ctx context.Context, c *http.Client, secret, url string, header http.Header, body []byte) (int, []byte, error) {
+	status, _, respBody, err := send(ctx, c, secret, http.MethodPost, url, header, body)
+	return status, respBody, err
+}
+
+func send(ctx context.Context, c *http.Client, secret, method, url string, header http.Header, body []byte) (int, string, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", nil, err
+	}
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if auth := header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	req.Header.Set(ForwardedHeader, secret)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("forwarding request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("reading forwarded response: %w", err)
+	}
+	return resp.StatusCode, resp.Header.Get("Content-Type"), respBody, nil
+}
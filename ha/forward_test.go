@@ -0,0 +1,131 @@
+package ha
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func lease(holder string) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-snyk-scan", Namespace: "default"},
+		Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder},
+	}
+}
+
+func pod(name, ip string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status:     corev1.PodStatus{PodIP: ip},
+	}
+}
+
+var _ = Describe("Forwarded", func() {
+	request := func(value string) *http.Request {
+		r, err := http.NewRequest(http.MethodPost, "/event", nil)
+		Expect(err).NotTo(HaveOccurred())
+		if value != "" {
+			r.Header.Set(ForwardedHeader, value)
+		}
+		return r
+	}
+
+	It("should accept requests with the shared secret", func() {
+		Expect(Forwarded(request("s3cret"), "s3cret")).To(BeTrue())
+	})
+
+	It("should reject requests without or with another secret", func() {
+		Expect(Forwarded(request(""), "s3cret")).To(BeFalse())
+		Expect(Forwarded(request("true"), "s3cret")).To(BeFalse())
+	})
+
+	It("should reject all requests without a configured secret", func() {
+		Expect(Forwarded(request(""), "")).To(BeFalse())
+	})
+})
+
+var _ = Describe("Forwarder", func() {
+	newForwarder := func(port int, objects ...client.Object) *Forwarder {
+		return &Forwarder{
+			Reader:    fake.NewClientBuilder().WithObjects(objects...).Build(),
+			Namespace: "default",
+			LeaseName: "registry-snyk-scan",
+			Port:      port,
+			Scheme:    "http",
+			Client:    http.DefaultClient,
+			Secret:    "s3cret",
+		}
+	}
+
+	It("should report leadership once elected", func() {
+		elected := make(chan struct{})
+		f := &Forwarder{Elected: elected}
+		Expect(f.IsLeader()).To(BeFalse())
+		close(elected)
+		Expect(f.IsLeader()).To(BeTrue())
+	})
+
+	It("should resolve the leader pod from the lease holder", func() {
+		f := newForwarder(8080, lease("webhook-6d4f9_0b7c1e2a-5f7d-4c1e-9a36-0f1d2c3b4a59"), pod("webhook-6d4f9", "10.0.0.7"))
+		Expect(f.LeaderURL(context.Background())).To(Equal("http://10.0.0.7:8080"))
+	})
+
+	It("should fail without a lease holder", func() {
+		f := newForwarder(8080, lease(""))
+		_, err := f.LeaderURL(context.Background())
+		Expect(err).To(MatchError(ErrNoLeader))
+	})
+
+	It("should fail if the leader pod has no IP yet", func() {
+		f := newForwarder(8080, lease("webhook-6d4f9_0b7c1e2a"), pod("webhook-6d4f9", ""))
+		_, err := f.LeaderURL(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("has no IP")))
+	})
+
+	It("should forward the request to the leader and relay its response", func() {
+		var received *http.Request
+		var receivedBody []byte
+		leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			receivedBody, _ = io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"rejected":[]}`))
+		}))
+		defer leader.Close()
+		u, err := url.Parse(leader.URL)
+		Expect(err).NotTo(HaveOccurred())
+		host, portString, err := net.SplitHostPort(u.Host)
+		Expect(err).NotTo(HaveOccurred())
+		port, err := strconv.Atoi(portString)
+		Expect(err).NotTo(HaveOccurred())
+
+		f := newForwarder(port, lease("webhook-6d4f9_0b7c1e2a"), pod("webhook-6d4f9", host))
+		header := http.Header{}
+		header.Set("Content-Type", "application/vnd.docker.distribution.events.v1+json")
+		header.Set("Authorization", "Bearer token")
+		status, contentType, body, err := f.Forward(context.Background(), http.MethodPost, "/event", header, []byte(`{"events":[]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(contentType).To(Equal("application/json"))
+		Expect(string(body)).To(Equal(`{"rejected":[]}`))
+
+		Expect(received.URL.Path).To(Equal("/event"))
+		Expect(received.Header.Get(ForwardedHeader)).To(Equal("s3cret"))
+		Expect(received.Header.Get("Authorization")).To(Equal("Bearer token"))
+		Expect(received.Header.Get("Content-Type")).To(Equal("application/vnd.docker.distribution.events.v1+json"))
+		Expect(string(receivedBody)).To(Equal(`{"events":[]}`))
+	})
+})
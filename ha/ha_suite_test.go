@@ -0,0 +1,13 @@
+package ha
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestHA(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HA Suite")
+}
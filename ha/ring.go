@@ -0,0 +1,59 @@
+package ha
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// DefaultVirtualNodes is the number of points each member gets on the Ring.
+const DefaultVirtualNodes = 128
+
+// Ring is a consistent hash ring. When a member joins or leaves, only the keys of that member move.
+type Ring struct {
+	points  []uint64
+	members map[uint64]string
+}
+
+// NewRing returns a ring of the given members with virtualNodes points per member.
+func NewRing(members []string, virtualNodes int) *Ring {
+	if virtualNodes < 1 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	r := &Ring{members: map[uint64]string{}}
+	// sort to resolve hash collisions the same way on every replica
+	members = slices.Clone(members)
+	slices.Sort(members)
+	for _, m := range members {
+		for i := 0; i < virtualNodes; i++ {
+			p := hash(m + "#" + strconv.Itoa(i))
+			if _, ok := r.members[p]; ok {
+				continue
+			}
+			r.members[p] = m
+			r.points = append(r.points, p)
+		}
+	}
+	slices.Sort(r.points)
+	return r
+}
+
+// Owner returns the member owning key, or an empty string if the ring has no members.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.members[r.points[i]]
+}
+
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,49 @@
+package ha
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ring", func() {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("registry.example.com/team/repo-%d", i)
+	}
+
+	It("should have no owner without members", func() {
+		Expect(NewRing(nil, 0).Owner("registry.example.com/repo")).To(BeEmpty())
+	})
+
+	It("should assign keys independently of the member order", func() {
+		a := NewRing([]string{"a", "b", "c"}, 0)
+		b := NewRing([]string{"c", "a", "b"}, 0)
+		for _, k := range keys {
+			Expect(a.Owner(k)).To(Equal(b.Owner(k)))
+		}
+	})
+
+	It("should spread keys over all members", func() {
+		ring := NewRing([]string{"a", "b", "c"}, 0)
+		counts := map[string]int{}
+		for _, k := range keys {
+			counts[ring.Owner(k)]++
+		}
+		Expect(counts).To(HaveLen(3))
+		for _, c := range counts {
+			Expect(c).To(BeNumerically(">", 200))
+		}
+	})
+
+	It("should only move the keys of a leaving member", func() {
+		before := NewRing([]string{"a", "b", "c"}, 0)
+		after := NewRing([]string{"a", "b"}, 0)
+		for _, k := range keys {
+			if owner := before.Owner(k); owner != "c" {
+				Expect(after.Owner(k)).To(Equal(owner))
+			}
+		}
+	})
+})
@@ -0,0 +1,219 @@
+package ha
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ShardGroupLabel is set on the membership leases of all shards of a group.
+	ShardGroupLabel = "registry-snyk-scan.stackit.cloud/shard-group"
+	// ShardAddressAnnotation holds the host:port of the webhook server of a shard.
+	ShardAddressAnnotation = "registry-snyk-scan.stackit.cloud/shard-address"
+
+	// DefaultLeaseDuration is the time after which a shard that stopped renewing its lease is removed.
+	DefaultLeaseDuration = 15 * time.Second
+)
+
+// Shards splits the repositories of all registries between replicas.
+// Every replica holds a membership lease that it renews periodically. The live leases of a group
+// form a consistent hash Ring, so when replicas come and go only the repositories of that replica move.
+type Shards struct {
+	// Client reads and writes the membership leases, it should not be cached.
+	Client client.Client
+	// Namespace of the membership leases.
+	Namespace string
+	// Group is the name shared by all shards and the prefix of their lease names.
+	Group string
+	// Identity of this replica, usually the pod name.
+	Identity string
+	// Address is the host:port other shards forward events to.
+	Address string
+	// Scheme of the webhook servers.
+	Scheme string
+	// HTTPClient sends forwarded requests.
+	HTTPClient *http.Client
+	// Secret is shared by all shards and sent with forwarded requests.
+	Secret string
+	// LeaseDuration defaults to DefaultLeaseDuration, leases are renewed three times per duration.
+	LeaseDuration time.Duration
+	// VirtualNodes defaults to DefaultVirtualNodes.
+	VirtualNodes int
+	Logger       logr.Logger
+
+	mu        sync.RWMutex
+	ring      *Ring
+	addresses map[string]string
+}
+
+// Start registers this replica and keeps the membership up to date until ctx is cancelled.
+// On shutdown the lease is deleted, so the remaining shards take over right away.
+func (s *Shards) Start(ctx context.Context) error {
+	interval := s.leaseDuration() / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.sync(ctx); err != nil {
+			s.Logger.Error(err, "syncing shard membership")
+		}
+		select {
+		case <-ctx.Done():
+			deleteCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := s.Client.Delete(deleteCtx, s.lease()); client.IgnoreNotFound(err) != nil {
+				return fmt.Errorf("deleting shard lease: %w", err)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection is false, all shards run at the same time.
+func (s *Shards) NeedLeaderElection() bool {
+	return false
+}
+
+func (s *Shards) leaseDuration() time.Duration {
+	if s.LeaseDuration <= 0 {
+		return DefaultLeaseDuration
+	}
+	return s.LeaseDuration
+}
+
+func (s *Shards) leaseName(identity string) string {
+	return s.Group + "-" + identity
+}
+
+func (s *Shards) lease() *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.leaseName(s.Identity),
+			Namespace: s.Namespace,
+		},
+	}
+}
+
+// sync renews the lease of this replica and rebuilds the ring from all live leases.
+func (s *Shards) sync(ctx context.Context) error {
+	if err := s.renew(ctx); err != nil {
+		return err
+	}
+
+	var leases coordinationv1.LeaseList
+	if err := s.Client.List(ctx, &leases, client.InNamespace(s.Namespace), client.MatchingLabels{ShardGroupLabel: s.Group}); err != nil {
+		return fmt.Errorf("listing shard leases: %w", err)
+	}
+	now := time.Now()
+	var members []string
+	addresses := map[string]string{}
+	for i := range leases.Items {
+		l := &leases.Items[i]
+		if l.Spec.HolderIdentity == nil || expired(l, now) {
+			// clean up after replicas that did not shut down gracefully
+			if err := s.Client.Delete(ctx, l); client.IgnoreNotFound(err) != nil {
+				s.Logger.Error(err, "deleting expired shard lease", "lease", l.Name)
+			}
+			continue
+		}
+		identity := *l.Spec.HolderIdentity
+		members = append(members, identity)
+		addresses[identity] = l.Annotations[ShardAddressAnnotation]
+	}
+
+	ring := NewRing(members, s.VirtualNodes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !maps.Equal(addresses, s.addresses) {
+		s.Logger.Info("shard membership changed", "shards", members)
+	}
+	s.ring, s.addresses = ring, addresses
+	return nil
+}
+
+func expired(l *coordinationv1.Lease, now time.Time) bool {
+	if l.Spec.RenewTime == nil || l.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return l.Spec.RenewTime.Add(time.Duration(*l.Spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
+
+func (s *Shards) renew(ctx context.Context) error {
+	lease := s.lease()
+	err := s.Client.Get(ctx, client.ObjectKeyFromObject(lease), lease)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("getting shard lease: %w", err)
+	}
+	create := apierrors.IsNotFound(err)
+
+	if lease.Labels == nil {
+		lease.Labels = map[string]string{}
+	}
+	lease.Labels[ShardGroupLabel] = s.Group
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[ShardAddressAnnotation] = s.Address
+	lease.Spec.HolderIdentity = ptr.To(s.Identity)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(s.leaseDuration().Seconds()))
+	lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now()}
+
+	if create {
+		if err := s.Client.Create(ctx, lease); err != nil {
+			return fmt.Errorf("creating shard lease: %w", err)
+		}
+		return nil
+	}
+	if err := s.Client.Update(ctx, lease); err != nil {
+		return fmt.Errorf("renewing shard lease: %w", err)
+	}
+	return nil
+}
+
+// Owner returns the identity of the shard responsible for key.
+// Until the membership is known, this replica owns all keys.
+func (s *Shards) Owner(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ring == nil {
+		return s.Identity
+	}
+	if owner := s.ring.Owner(key); owner != "" {
+		return owner
+	}
+	return s.Identity
+}
+
+// Owns reports whether this replica is responsible for e.
+func (s *Shards) Owns(e types.RegistryEvent) bool {
+	return s.Owner(e.ShardKey()) == s.Identity
+}
+
+// Route returns the shard responsible for e and whether that is this replica.
+func (s *Shards) Route(e types.RegistryEvent) (string, bool) {
+	owner := s.Owner(e.ShardKey())
+	return owner, owner == s.Identity
+}
+
+// ForwardTo posts body to path on the given shard and returns the status code and body of its response.
+func (s *Shards) ForwardTo(ctx context.Context, shard, path string, header http.Header, body []byte) (int, []byte, error) {
+	s.mu.RLock()
+	address := s.addresses[shard]
+	s.mu.RUnlock()
+	if address == "" {
+		return 0, nil, fmt.Errorf("shard %s has no address", shard)
+	}
+	return post(ctx, s.HTTPClient, s.Secret, fmt.Sprintf("%s://%s%s", s.Scheme, address, path), header, body)
+}
@@ -0,0 +1,112 @@
+package ha
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func shardLease(identity, address string, renewed time.Time) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "shards-" + identity,
+			Namespace:   "default",
+			Labels:      map[string]string{ShardGroupLabel: "shards"},
+			Annotations: map[string]string{ShardAddressAnnotation: address},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To(identity),
+			LeaseDurationSeconds: ptr.To(int32(15)),
+			RenewTime:            &metav1.MicroTime{Time: renewed},
+		},
+	}
+}
+
+var _ = Describe("Shards", func() {
+	var (
+		c      client.Client
+		shards *Shards
+	)
+
+	BeforeEach(func() {
+		c = fake.NewClientBuilder().WithObjects(
+			shardLease("b", "10.0.0.2:8081", time.Now()),
+			shardLease("gone", "10.0.0.3:8081", time.Now().Add(-time.Minute)),
+		).Build()
+		shards = &Shards{
+			Client:     c,
+			Namespace:  "default",
+			Group:      "shards",
+			Identity:   "a",
+			Address:    "10.0.0.1:8081",
+			Scheme:     "http",
+			HTTPClient: http.DefaultClient,
+		}
+	})
+
+	It("should own everything before the membership is known", func() {
+		Expect(shards.Owns(types.RegistryEvent{Registry: "registry.example.com", Repository: "repo"})).To(BeTrue())
+	})
+
+	It("should register itself and split the repositories with live shards", func(ctx SpecContext) {
+		Expect(shards.sync(ctx)).To(Succeed())
+
+		var own coordinationv1.Lease
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "shards-a"}, &own)).To(Succeed())
+		Expect(own.Labels).To(HaveKeyWithValue(ShardGroupLabel, "shards"))
+		Expect(own.Annotations).To(HaveKeyWithValue(ShardAddressAnnotation, "10.0.0.1:8081"))
+
+		var expired coordinationv1.Lease
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "shards-gone"}, &expired)).NotTo(Succeed())
+
+		owners := map[string]bool{}
+		for _, repository := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+			e := types.RegistryEvent{Registry: "registry.example.com", Repository: repository}
+			shard, local := shards.Route(e)
+			Expect(local).To(Equal(shard == "a"))
+			Expect(shards.Owns(e)).To(Equal(local))
+			owners[shard] = true
+		}
+		Expect(owners).To(Equal(map[string]bool{"a": true, "b": true}))
+	})
+
+	It("should renew its lease", func(ctx SpecContext) {
+		Expect(shards.sync(ctx)).To(Succeed())
+		var first coordinationv1.Lease
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "shards-a"}, &first)).To(Succeed())
+
+		Expect(shards.sync(ctx)).To(Succeed())
+		var second coordinationv1.Lease
+		Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "shards-a"}, &second)).To(Succeed())
+		Expect(second.Spec.RenewTime.After(first.Spec.RenewTime.Time)).To(BeTrue())
+	})
+
+	It("should delete its lease on shutdown", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- shards.Start(ctx)
+		}()
+		Eventually(func() error {
+			return c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "shards-a"}, &coordinationv1.Lease{})
+		}).Should(Succeed())
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "shards-a"}, &coordinationv1.Lease{})).NotTo(Succeed())
+	})
+
+	It("should fail to forward to unknown shards", func(ctx SpecContext) {
+		Expect(shards.sync(ctx)).To(Succeed())
+		_, _, err := shards.ForwardTo(ctx, "unknown", "/event", http.Header{}, nil)
+		Expect(err).To(MatchError(ContainSubstring("has no address")))
+	})
+})
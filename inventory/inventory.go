@@ -0,0 +1,284 @@
+// Package inventory indexes the packages listed in the SBOMs of scanned images, so the images shipping a package
+// version can be found without scanning them again.
+package inventory
+
+import (
+	"cmp"
+	"container/list"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+// Package is a version of a package of an ecosystem, like Debian, npm or Maven.
+type Package struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Ecosystem string `json:"ecosystem"`
+	// Source is the source package of a distribution package, if it has another name, like openssl for libssl3.
+	// Advisories of distributions name the source package.
+	Source string `json:"source,omitempty"`
+}
+
+// names returns the names p is indexed under.
+func (p Package) names() []string {
+	if p.Source != "" {
+		return []string{p.Name, p.Source}
+	}
+	return []string{p.Name}
+}
+
+// Image is a repository and tag a digest was pushed to.
+type Image struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Tenant     string `json:"tenant,omitempty"`
+}
+
+// Match is a digest containing a package version, and the images it was pushed as.
+type Match struct {
+	Package Package       `json:"package"`
+	Digest  digest.Digest `json:"digest"`
+	Images  []Image       `json:"images"`
+}
+
+// Query selects the versions of a package, or of the packages built from a source package. An empty ecosystem matches
+// all ecosystems.
+type Query struct {
+	Name      string
+	Ecosystem string
+	Versions  Range
+}
+
+// DefaultMaxDigests is the number of digests an Index keeps by default.
+const DefaultMaxDigests = 10000
+
+type entry struct {
+	packages []Package
+	images   map[Image]struct{}
+	// moved holds the tagged images that point to another digest now
+	moved map[Image]struct{}
+	// element is the position of the digest in Index.order
+	element *list.Element
+}
+
+// Index maps packages to the digests containing them, and digests to their images.
+type Index struct {
+	mu sync.RWMutex
+	// packages maps package names, and the names of source packages, to their versions and the digests containing them
+	packages map[string]map[Package]map[digest.Digest]struct{}
+	// versions is the number of distinct package versions
+	versions int
+	digests  map[digest.Digest]*entry
+	// tags maps the tagged images to the digest they were pushed as last
+	tags map[Image]digest.Digest
+	// order holds the digests, the most recently added first and those without images last
+	order      *list.List
+	maxDigests int
+}
+
+// NewIndex returns an empty Index for up to maxDigests digests, DefaultMaxDigests if not positive.
+// The least recently added digests are dropped first.
+func NewIndex(maxDigests int) *Index {
+	if maxDigests <= 0 {
+		maxDigests = DefaultMaxDigests
+	}
+	return &Index{
+		packages:   map[string]map[Package]map[digest.Digest]struct{}{},
+		digests:    map[digest.Digest]*entry{},
+		tags:       map[Image]digest.Digest{},
+		order:      list.New(),
+		maxDigests: maxDigests,
+	}
+}
+
+// Add records the image of e and replaces the packages of its digest. If e moves a tag, the image is removed from
+// the digest the tag pointed to before. Events of the digest a tag moved away from, like of rescans, don't move the
+// tag back. Digests without images are not found, they are dropped first once the index is full.
+func (i *Index) Add(e types.RegistryEvent, packages []Package) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	en, ok := i.digests[e.Digest]
+	if !ok {
+		en = &entry{images: map[Image]struct{}{}, moved: map[Image]struct{}{}, element: i.order.PushFront(e.Digest)}
+		i.digests[e.Digest] = en
+	} else {
+		i.order.MoveToFront(en.element)
+	}
+	for _, p := range en.packages {
+		i.remove(p, e.Digest)
+	}
+	en.packages = slices.Clone(packages)
+	img := Image{Registry: e.Registry, Repository: e.Repository, Tag: e.Tag, Tenant: e.Tenant}
+	if _, moved := en.moved[img]; !moved {
+		if previous, ok := i.tags[img]; ok && previous != e.Digest {
+			old := i.digests[previous]
+			delete(old.images, img)
+			old.moved[img] = struct{}{}
+			if len(old.images) == 0 {
+				// digests still pushed as an image are dropped last
+				i.order.MoveToBack(old.element)
+			}
+		}
+		if img.Tag != "" {
+			i.tags[img] = e.Digest
+		}
+		en.images[img] = struct{}{}
+	}
+	for _, p := range packages {
+		for _, name := range p.names() {
+			versions, ok := i.packages[name]
+			if !ok {
+				versions = map[Package]map[digest.Digest]struct{}{}
+				i.packages[name] = versions
+			}
+			digests, ok := versions[p]
+			if !ok {
+				digests = map[digest.Digest]struct{}{}
+				versions[p] = digests
+				if name == p.Name {
+					i.versions++
+				}
+			}
+			digests[e.Digest] = struct{}{}
+		}
+	}
+	for i.order.Len() > i.maxDigests {
+		i.drop(i.order.Back().Value.(digest.Digest))
+	}
+	metrics.InventorySize(len(i.digests), i.versions)
+}
+
+// drop removes d with its packages and images, i.mu must be held.
+func (i *Index) drop(d digest.Digest) {
+	en := i.digests[d]
+	for _, p := range en.packages {
+		i.remove(p, d)
+	}
+	for img := range en.images {
+		if i.tags[img] == d {
+			delete(i.tags, img)
+		}
+	}
+	i.order.Remove(en.element)
+	delete(i.digests, d)
+}
+
+// remove removes d from the digests of p, i.mu must be held.
+func (i *Index) remove(p Package, d digest.Digest) {
+	for _, name := range p.names() {
+		digests, ok := i.packages[name][p]
+		if !ok {
+			continue
+		}
+		delete(digests, d)
+		if len(digests) > 0 {
+			continue
+		}
+		delete(i.packages[name], p)
+		if name == p.Name {
+			i.versions--
+		}
+		if len(i.packages[name]) == 0 {
+			delete(i.packages, name)
+		}
+	}
+}
+
+// AddSBOMs indexes the first SBOM of sboms in the order of scanner.SBOMFormats for the image of e.
+// Outputs without JSON document are skipped.
+func (i *Index) AddSBOMs(e types.RegistryEvent, sboms map[scanner.SBOMFormat][]byte) error {
+	for _, format := range scanner.SBOMFormats {
+		doc, ok := scanner.ExtractJSON(sboms[format])
+		if !ok {
+			continue
+		}
+		packages, err := Parse(format, doc)
+		if err != nil {
+			return err
+		}
+		i.Add(e, packages)
+		return nil
+	}
+	return nil
+}
+
+// Rebuild indexes the stored SBOMs of the scanned images in store, like after a restart.
+func (i *Index) Rebuild(ctx context.Context, store results.Store, sboms sbom.Store) error {
+	scans, err := store.List(ctx, results.Filter{})
+	if err != nil {
+		return err
+	}
+	// the results are listed newest first, the tags must end up at the digest they were pushed as last
+	slices.Reverse(scans)
+	for _, res := range scans {
+		if res.Status != results.StatusScanned && res.Status != results.StatusScanFailed {
+			continue
+		}
+		formats, err := sboms.Formats(ctx, res.Event.Digest)
+		if err != nil {
+			return err
+		}
+		if len(formats) == 0 {
+			continue
+		}
+		doc, err := sboms.Get(ctx, res.Event.Digest, formats[0])
+		if err != nil {
+			return err
+		}
+		packages, err := Parse(formats[0], doc)
+		if err != nil {
+			return fmt.Errorf("SBOM of %s: %w", res.Event.Digest, err)
+		}
+		i.Add(res.Event, packages)
+	}
+	return nil
+}
+
+// Find returns the digests containing a version of the package in q, ordered by ecosystem, name, version and digest.
+func (i *Index) Find(q Query) []Match {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	var matches []Match
+	for p, digests := range i.packages[q.Name] {
+		if (q.Ecosystem != "" && p.Ecosystem != q.Ecosystem) || !q.Versions.Contains(p.Version) {
+			continue
+		}
+		for d := range digests {
+			if len(i.digests[d].images) == 0 {
+				continue
+			}
+			matches = append(matches, Match{Package: p, Digest: d, Images: i.images(d)})
+		}
+	}
+	slices.SortFunc(matches, func(a, b Match) int {
+		return cmp.Or(
+			cmp.Compare(a.Package.Ecosystem, b.Package.Ecosystem),
+			cmp.Compare(a.Package.Name, b.Package.Name),
+			CompareVersions(a.Package.Version, b.Package.Version),
+			cmp.Compare(a.Digest, b.Digest),
+		)
+	})
+	return matches
+}
+
+// images returns the sorted images of d, i.mu must be held.
+func (i *Index) images(d digest.Digest) []Image {
+	var images []Image
+	for img := range i.digests[d].images {
+		images = append(images, img)
+	}
+	slices.SortFunc(images, func(a, b Image) int {
+		return cmp.Or(cmp.Compare(a.Registry, b.Registry), cmp.Compare(a.Repository, b.Repository), cmp.Compare(a.Tag, b.Tag), cmp.Compare(a.Tenant, b.Tenant))
+	})
+	return images
+}
@@ -0,0 +1,114 @@
+package inventory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+var _ = Describe("Index", func() {
+	var (
+		i          *Index
+		old, fixed types.RegistryEvent
+	)
+	openssl := func(version string) Package {
+		return Package{Name: "openssl", Version: version, Ecosystem: "Debian"}
+	}
+
+	BeforeEach(func() {
+		i = NewIndex(0)
+		old = types.RegistryEvent{Registry: "registry.example.com", Repository: "team/app", Tag: "v1", Digest: digest.FromString("old")}
+		fixed = types.RegistryEvent{Registry: "registry.example.com", Repository: "team/app", Tag: "v2", Digest: digest.FromString("fixed")}
+		i.Add(old, []Package{openssl("3.0.11-1~deb12u1"), {Name: "zlib1g", Version: "1:1.2.13", Ecosystem: "Debian"}})
+		i.Add(fixed, []Package{openssl("3.0.13-1~deb12u1")})
+	})
+
+	It("should find the digests containing a version range", func() {
+		r, err := ParseRange("<3.0.12")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(i.Find(Query{Name: "openssl", Versions: r})).To(Equal([]Match{{
+			Package: openssl("3.0.11-1~deb12u1"),
+			Digest:  old.Digest,
+			Images:  []Image{{Registry: "registry.example.com", Repository: "team/app", Tag: "v1"}},
+		}}))
+		Expect(i.Find(Query{Name: "openssl"})).To(HaveLen(2))
+		Expect(i.Find(Query{Name: "openssl", Ecosystem: "Alpine"})).To(BeEmpty())
+	})
+
+	It("should collect the images of a digest", func() {
+		latest := old
+		latest.Tag = "latest"
+		i.Add(latest, []Package{openssl("3.0.11-1~deb12u1")})
+
+		matches := i.Find(Query{Name: "openssl", Versions: Range{{Op: "=", Version: "3.0.11-1~deb12u1"}}})
+		Expect(matches).To(HaveLen(1))
+		Expect(matches[0].Images).To(ConsistOf(HaveField("Tag", "v1"), HaveField("Tag", "latest")))
+		// the packages of the digest were replaced
+		Expect(i.Find(Query{Name: "zlib1g"})).To(BeEmpty())
+	})
+
+	It("should drop the tags that moved to another digest", func() {
+		moved := fixed
+		moved.Tag = "v1"
+		i.Add(moved, []Package{openssl("3.0.13-1~deb12u1")})
+		Expect(i.Find(Query{Name: "openssl"})).To(ConsistOf(And(
+			HaveField("Digest", fixed.Digest),
+			HaveField("Images", ConsistOf(HaveField("Tag", "v1"), HaveField("Tag", "v2"))),
+		)))
+
+		// a rescan of the digest the tag pointed to before doesn't move it back
+		i.Add(old, []Package{openssl("3.0.11-1~deb12u1")})
+		Expect(i.Find(Query{Name: "openssl"})).To(ConsistOf(HaveField("Digest", fixed.Digest)))
+	})
+
+	It("should drop the least recently added digests", func() {
+		i = NewIndex(2)
+		for _, name := range []string{"a", "b", "c"} {
+			i.Add(types.RegistryEvent{Registry: "registry.example.com", Repository: "team/" + name, Digest: digest.FromString(name)}, []Package{openssl("3.0.11-1~deb12u1")})
+		}
+		Expect(i.Find(Query{Name: "openssl"})).To(ConsistOf(HaveField("Digest", digest.FromString("b")), HaveField("Digest", digest.FromString("c"))))
+	})
+
+	It("should find binary packages by their source package", func() {
+		e := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/slim", Digest: digest.FromString("slim")}
+		libssl := Package{Name: "libssl3", Version: "3.0.11-1~deb12u1", Ecosystem: "Debian", Source: "openssl"}
+		i.Add(e, []Package{libssl})
+		Expect(i.Find(Query{Name: "openssl", Versions: Range{{Op: "=", Version: "3.0.11-1~deb12u1"}}})).To(ConsistOf(
+			HaveField("Digest", old.Digest),
+			And(HaveField("Digest", e.Digest), HaveField("Package", libssl)),
+		))
+		Expect(i.Find(Query{Name: "libssl3"})).To(HaveLen(1))
+
+		i.Add(e, nil)
+		Expect(i.Find(Query{Name: "openssl"})).To(HaveLen(2))
+		Expect(i.Find(Query{Name: "libssl3"})).To(BeEmpty())
+	})
+
+	It("should index the first SBOM of a scan", func() {
+		e := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/api", Digest: digest.FromString("api")}
+		Expect(i.AddSBOMs(e, map[scanner.SBOMFormat][]byte{
+			scanner.SBOMCycloneDX: []byte("Analyzing\n" + `{"components":[{"purl":"pkg:apk/alpine/busybox@1.36.1-r15"}]}`),
+			scanner.SBOMSPDX:      []byte(`{"packages":[{"externalRefs":[{"referenceType":"purl","referenceLocator":"pkg:apk/alpine/musl@1.2.4-r2"}]}]}`),
+		})).To(Succeed())
+		Expect(i.Find(Query{Name: "busybox"})).To(HaveLen(1))
+		Expect(i.Find(Query{Name: "musl"})).To(BeEmpty())
+	})
+
+	It("should rebuild from stored results and SBOMs", func(ctx SpecContext) {
+		store := results.NewMemoryStore()
+		sboms := sbom.NewMemoryStore(0)
+		Expect(store.Record(ctx, results.Result{Event: old, Status: results.StatusScanned})).To(Succeed())
+		Expect(store.Record(ctx, results.Result{Event: fixed, Status: results.StatusSkipped})).To(Succeed())
+		doc := []byte(`{"components":[{"purl":"pkg:deb/debian/openssl@3.0.11-1~deb12u1"}]}`)
+		Expect(sboms.Put(ctx, old.Digest, scanner.SBOMCycloneDX, doc)).To(Succeed())
+		Expect(sboms.Put(ctx, fixed.Digest, scanner.SBOMCycloneDX, doc)).To(Succeed())
+
+		rebuilt := NewIndex(0)
+		Expect(rebuilt.Rebuild(ctx, store, sboms)).To(Succeed())
+		Expect(rebuilt.Find(Query{Name: "openssl"})).To(ConsistOf(HaveField("Digest", old.Digest)))
+	})
+})
@@ -0,0 +1,184 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+)
+
+// ecosystems maps package URL types to the ecosystem names of OSV.
+var ecosystems = map[string]string{
+	"apk":      "Alpine",
+	"cargo":    "crates.io",
+	"composer": "Packagist",
+	"deb":      "Debian",
+	"gem":      "RubyGems",
+	"golang":   "Go",
+	"hex":      "Hex",
+	"maven":    "Maven",
+	"npm":      "npm",
+	"nuget":    "NuGet",
+	"pub":      "Pub",
+	"pypi":     "PyPI",
+	"swift":    "SwiftURL",
+}
+
+// distroTypes are the package URL types whose namespace is the distribution instead of a part of the name.
+var distroTypes = map[string]bool{"apk": true, "deb": true, "rpm": true}
+
+// ParsePURL returns the package a package URL like pkg:deb/debian/openssl@3.0.11-1~deb12u2?arch=amd64 refers to.
+func ParsePURL(purl string) (Package, error) {
+	rest, ok := strings.CutPrefix(purl, "pkg:")
+	if !ok {
+		return Package{}, fmt.Errorf("package URL %q doesn't start with pkg:", purl)
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, qualifiers, _ := strings.Cut(rest, "?")
+	rest = strings.TrimLeft(rest, "/")
+	typ, path, ok := strings.Cut(rest, "/")
+	if !ok || typ == "" {
+		return Package{}, fmt.Errorf("package URL %q has no type", purl)
+	}
+	typ = strings.ToLower(typ)
+
+	var version string
+	if i := strings.LastIndex(path, "@"); i > 0 {
+		path, version = path[:i], path[i+1:]
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segments {
+		unescaped, err := url.PathUnescape(s)
+		if err != nil {
+			return Package{}, fmt.Errorf("package URL %q: %w", purl, err)
+		}
+		segments[i] = unescaped
+	}
+	if unescaped, err := url.PathUnescape(version); err == nil {
+		version = unescaped
+	}
+
+	name := segments[len(segments)-1]
+	namespace := segments[:len(segments)-1]
+	if name == "" {
+		return Package{}, fmt.Errorf("package URL %q has no name", purl)
+	}
+
+	ecosystem, ok := ecosystems[typ]
+	if !ok {
+		ecosystem = typ
+	}
+	switch {
+	case typ == "deb" && len(namespace) > 0 && namespace[0] == "ubuntu":
+		ecosystem = "Ubuntu"
+	case typ == "rpm" && len(namespace) > 0:
+		ecosystem = namespace[0]
+	}
+	switch {
+	case distroTypes[typ]:
+	case typ == "maven" && len(namespace) > 0:
+		name = strings.Join(namespace, ".") + ":" + name
+	case len(namespace) > 0:
+		name = strings.Join(namespace, "/") + "/" + name
+	}
+	p := Package{Name: name, Version: version, Ecosystem: ecosystem}
+	if distroTypes[typ] {
+		if source := sourceName(typ, qualifiers); source != name {
+			p.Source = source
+		}
+	}
+	return p, nil
+}
+
+// sourceName returns the source package named by the upstream qualifier of a distribution package, like openssl for
+// libssl3. Debian and Alpine name the source package, optionally followed by @ and its version, RPM the file of the
+// source RPM like openssl-3.0.7-27.el9.src.rpm.
+func sourceName(typ, qualifiers string) string {
+	var upstream string
+	for _, q := range strings.Split(qualifiers, "&") {
+		if key, value, _ := strings.Cut(q, "="); key == "upstream" {
+			if unescaped, err := url.PathUnescape(value); err == nil {
+				upstream = unescaped
+			}
+		}
+	}
+	if typ != "rpm" {
+		name, _, _ := strings.Cut(upstream, "@")
+		return name
+	}
+	name, ok := strings.CutSuffix(upstream, ".src.rpm")
+	if !ok {
+		return upstream
+	}
+	// drop the version and the release
+	for range 2 {
+		if i := strings.LastIndex(name, "-"); i > 0 {
+			name = name[:i]
+		}
+	}
+	return name
+}
+
+type cycloneDXComponent struct {
+	PURL       string               `json:"purl"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type spdxDocument struct {
+	Packages []struct {
+		ExternalRefs []struct {
+			ReferenceType    string `json:"referenceType"`
+			ReferenceLocator string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	} `json:"packages"`
+}
+
+// Parse returns the packages listed in an SBOM. Only packages with a package URL are returned, as name and version
+// alone don't tell the ecosystem. The image itself is not a package.
+func Parse(format scanner.SBOMFormat, doc []byte) ([]Package, error) {
+	var purls []string
+	switch format {
+	case scanner.SBOMCycloneDX:
+		var bom cycloneDXComponent
+		if err := json.Unmarshal(doc, &bom); err != nil {
+			return nil, fmt.Errorf("decoding CycloneDX SBOM: %w", err)
+		}
+		var walk func([]cycloneDXComponent)
+		walk = func(components []cycloneDXComponent) {
+			for _, c := range components {
+				purls = append(purls, c.PURL)
+				walk(c.Components)
+			}
+		}
+		walk(bom.Components)
+	case scanner.SBOMSPDX:
+		var spdx spdxDocument
+		if err := json.Unmarshal(doc, &spdx); err != nil {
+			return nil, fmt.Errorf("decoding SPDX SBOM: %w", err)
+		}
+		for _, p := range spdx.Packages {
+			for _, ref := range p.ExternalRefs {
+				if ref.ReferenceType == "purl" {
+					purls = append(purls, ref.ReferenceLocator)
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SBOM format %q", format)
+	}
+
+	var packages []Package
+	for _, purl := range purls {
+		if purl == "" || strings.HasPrefix(purl, "pkg:docker/") || strings.HasPrefix(purl, "pkg:oci/") {
+			continue
+		}
+		p, err := ParsePURL(purl)
+		if err != nil {
+			continue
+		}
+		packages = append(packages, p)
+	}
+	return packages, nil
+}
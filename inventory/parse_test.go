@@ -0,0 +1,67 @@
+package inventory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+)
+
+var _ = DescribeTable("ParsePURL", func(purl string, expected Package) {
+	p, err := ParsePURL(purl)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(p).To(Equal(expected))
+},
+	Entry("debian", "pkg:deb/debian/openssl@3.0.11-1~deb12u2?arch=amd64&distro=debian-12", Package{Name: "openssl", Version: "3.0.11-1~deb12u2", Ecosystem: "Debian"}),
+	Entry("ubuntu", "pkg:deb/ubuntu/zlib1g@1:1.2.13", Package{Name: "zlib1g", Version: "1:1.2.13", Ecosystem: "Ubuntu"}),
+	Entry("alpine", "pkg:apk/alpine/busybox@1.36.1-r15", Package{Name: "busybox", Version: "1.36.1-r15", Ecosystem: "Alpine"}),
+	Entry("debian binary package", "pkg:deb/debian/libssl3@3.0.11-1~deb12u2?arch=amd64&upstream=openssl&distro=debian-12",
+		Package{Name: "libssl3", Version: "3.0.11-1~deb12u2", Ecosystem: "Debian", Source: "openssl"}),
+	Entry("debian source version", "pkg:deb/debian/libc6@2.36-9?upstream=glibc%402.36-9", Package{Name: "libc6", Version: "2.36-9", Ecosystem: "Debian", Source: "glibc"}),
+	Entry("alpine subpackage", "pkg:apk/alpine/libcrypto3@3.1.4-r5?upstream=openssl", Package{Name: "libcrypto3", Version: "3.1.4-r5", Ecosystem: "Alpine", Source: "openssl"}),
+	Entry("rpm", "pkg:rpm/redhat/openssl-libs@3.0.7-27.el9?upstream=openssl-3.0.7-27.el9.src.rpm",
+		Package{Name: "openssl-libs", Version: "3.0.7-27.el9", Ecosystem: "redhat", Source: "openssl"}),
+	Entry("upstream of the same name", "pkg:deb/debian/openssl@3.0.11-1?upstream=openssl", Package{Name: "openssl", Version: "3.0.11-1", Ecosystem: "Debian"}),
+	Entry("maven", "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1", Package{Name: "org.apache.logging.log4j:log4j-core", Version: "2.14.1", Ecosystem: "Maven"}),
+	Entry("npm scope", "pkg:npm/%40angular/core@16.0.0", Package{Name: "@angular/core", Version: "16.0.0", Ecosystem: "npm"}),
+	Entry("go module", "pkg:golang/golang.org/x/net@v0.17.0", Package{Name: "golang.org/x/net", Version: "v0.17.0", Ecosystem: "Go"}),
+	Entry("unknown type", "pkg:conan/zlib@1.3", Package{Name: "zlib", Version: "1.3", Ecosystem: "conan"}),
+)
+
+var _ = Describe("Parse", func() {
+	It("should list the components of a CycloneDX SBOM", func() {
+		packages, err := Parse(scanner.SBOMCycloneDX, []byte(`{
+			"bomFormat": "CycloneDX",
+			"metadata": {"component": {"name": "app", "purl": "pkg:docker/app@sha256:abc"}},
+			"components": [
+				{"name": "openssl", "version": "3.0.11-1", "purl": "pkg:deb/debian/openssl@3.0.11-1"},
+				{"name": "app.jar", "components": [{"name": "log4j-core", "purl": "pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1"}]},
+				{"name": "without-purl", "version": "1.0"}
+			]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packages).To(ConsistOf(
+			Package{Name: "openssl", Version: "3.0.11-1", Ecosystem: "Debian"},
+			Package{Name: "org.apache.logging.log4j:log4j-core", Version: "2.14.1", Ecosystem: "Maven"},
+		))
+	})
+
+	It("should list the packages of an SPDX SBOM", func() {
+		packages, err := Parse(scanner.SBOMSPDX, []byte(`{
+			"spdxVersion": "SPDX-2.3",
+			"packages": [
+				{"name": "app", "externalRefs": [{"referenceType": "purl", "referenceLocator": "pkg:oci/app@sha256%3Aabc"}]},
+				{"name": "busybox", "externalRefs": [
+					{"referenceType": "cpe23Type", "referenceLocator": "cpe:2.3:a:busybox:busybox:1.36.1:*:*:*:*:*:*:*"},
+					{"referenceType": "purl", "referenceLocator": "pkg:apk/alpine/busybox@1.36.1-r15"}
+				]}
+			]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(packages).To(ConsistOf(Package{Name: "busybox", Version: "1.36.1-r15", Ecosystem: "Alpine"}))
+	})
+
+	It("should fail for invalid documents", func() {
+		_, err := Parse(scanner.SBOMCycloneDX, []byte(`[`))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,200 @@
+package inventory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CompareVersions compares two package versions and returns -1, 0 or 1. It works across ecosystems without knowing
+// their rules exactly: an epoch like 1: is compared first, then runs of digits numerically and runs of letters
+// lexically, ignoring separators. A version with more segments is greater, unless the next segment starts with
+// letters or ~, which marks pre-releases like 1.0.0-rc1 or 1.0~beta. Post-releases like 2.31.0.post1, 5.3.18.RELEASE,
+// the patch releases _p1 of Alpine and the letter releases of OpenSSL like 1.1.1w are greater than the release.
+func CompareVersions(a, b string) int {
+	epochA, a := splitEpoch(a)
+	epochB, b := splitEpoch(b)
+	if c := compareInts(epochA, epochB); c != 0 {
+		return c
+	}
+	ta, tb := tokenize(a), tokenize(b)
+	for i := 0; i < len(ta) || i < len(tb); i++ {
+		switch {
+		case i >= len(ta):
+			return -tailOrder(tb[i:])
+		case i >= len(tb):
+			return tailOrder(ta[i:])
+		}
+		if c := compareTokens(ta[i], tb[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func splitEpoch(v string) (int, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if e, rest, ok := strings.Cut(v, ":"); ok {
+		if n, err := strconv.Atoi(e); err == nil {
+			return n, rest
+		}
+	}
+	return 0, v
+}
+
+// tokenize splits v into runs of digits, runs of letters and ~.
+func tokenize(v string) []string {
+	var tokens []string
+	for i := 0; i < len(v); {
+		r := rune(v[i])
+		j := i + 1
+		switch {
+		case unicode.IsDigit(r):
+			for j < len(v) && unicode.IsDigit(rune(v[j])) {
+				j++
+			}
+		case unicode.IsLetter(r):
+			for j < len(v) && unicode.IsLetter(rune(v[j])) {
+				j++
+			}
+		case r == '~':
+		default:
+			i = j
+			continue
+		}
+		tokens = append(tokens, v[i:j])
+		i = j
+	}
+	return tokens
+}
+
+// postReleases are the tokens that mark a version after the release, compared case-insensitively.
+var postReleases = map[string]bool{
+	"final": true, "ga": true, "p": true, "patch": true, "pl": true, "post": true, "r": true, "release": true, "sp": true,
+}
+
+func isPostRelease(t string) bool {
+	return postReleases[strings.ToLower(t)]
+}
+
+// tailOrder is the order of a version with the extra tokens tail relative to the version without them.
+func tailOrder(tail []string) int {
+	t := tail[0]
+	switch {
+	case t == "~":
+		return -1
+	case isNumeric(t), isPostRelease(t):
+		return 1
+	case len(tail) == 1 && len(t) == 1:
+		// a single trailing letter, like the letter releases of OpenSSL
+		return 1
+	}
+	return -1
+}
+
+func compareTokens(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "~":
+		return -1
+	case b == "~":
+		return 1
+	case isNumeric(a) && isNumeric(b):
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if c := compareInts(len(a), len(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	case isNumeric(a):
+		return 1
+	case isNumeric(b):
+		return -1
+	case isPostRelease(a) != isPostRelease(b):
+		if isPostRelease(a) {
+			return 1
+		}
+		return -1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func isNumeric(t string) bool {
+	return t != "" && unicode.IsDigit(rune(t[0]))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Constraint compares versions to Version with Op, one of =, !=, <, <=, > and >=.
+type Constraint struct {
+	Op      string
+	Version string
+}
+
+// Range is a list of constraints that all must hold. The empty range contains all versions.
+type Range []Constraint
+
+// ParseRange parses comma separated constraints like ">=1.2.0,<1.2.5". A version without operator must match exactly,
+// "*" matches all versions.
+func ParseRange(s string) (Range, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "*" {
+		return nil, nil
+	}
+	var r Range
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		op := "="
+		for _, candidate := range []string{"<=", ">=", "!=", "==", "<", ">", "="} {
+			if rest, ok := strings.CutPrefix(part, candidate); ok {
+				op, part = candidate, strings.TrimSpace(rest)
+				break
+			}
+		}
+		if op == "==" {
+			op = "="
+		}
+		if part == "" {
+			return nil, fmt.Errorf("constraint without version in %q", s)
+		}
+		r = append(r, Constraint{Op: op, Version: part})
+	}
+	return r, nil
+}
+
+// Contains reports whether version satisfies all constraints of r.
+func (r Range) Contains(version string) bool {
+	for _, c := range r {
+		cmp := CompareVersions(version, c.Version)
+		var ok bool
+		switch c.Op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package inventory
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = DescribeTable("CompareVersions", func(a, b string, expected int) {
+	Expect(CompareVersions(a, b)).To(Equal(expected))
+	Expect(CompareVersions(b, a)).To(Equal(-expected))
+},
+	Entry("equal", "1.2.3", "1.2.3", 0),
+	Entry("numeric segments", "1.10.0", "1.9.9", 1),
+	Entry("leading v", "v1.2.3", "1.2.3", 0),
+	Entry("leading zeros", "1.02", "1.2", 0),
+	Entry("more segments", "1.2.3.1", "1.2.3", 1),
+	Entry("pre-release", "1.0.0-rc1", "1.0.0", -1),
+	Entry("pre-releases", "1.0.0-alpha", "1.0.0-beta", -1),
+	Entry("debian revision", "3.0.11-1~deb12u2", "3.0.11-1", -1),
+	Entry("debian epoch", "1:1.0", "2.0", 1),
+	Entry("alpine release", "3.1.4-r5", "3.1.4-r6", -1),
+	Entry("alpine revision", "3.1.4-r0", "3.1.4", 1),
+	Entry("alpine patch release", "9.4_p1", "9.4", 1),
+	Entry("openssl letter release", "1.1.1w", "1.1.1", 1),
+	Entry("openssl letter releases", "1.1.1w", "1.1.1v", 1),
+	Entry("python post-release", "2.31.0.post1", "2.31.0", 1),
+	Entry("python post-release before the next release", "2.31.0.post1", "2.31.1", -1),
+	Entry("python pre-release with number", "1.0a1", "1.0", -1),
+	Entry("spring release", "5.3.18.RELEASE", "5.3.18", 1),
+	Entry("milestone before release", "5.3.18.M1", "5.3.18.RELEASE", -1),
+)
+
+var _ = Describe("Range", func() {
+	It("should hold all constraints", func() {
+		r, err := ParseRange(">=3.0.0, <3.0.12")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(Range{{Op: ">=", Version: "3.0.0"}, {Op: "<", Version: "3.0.12"}}))
+		Expect(r.Contains("3.0.11-1~deb12u2")).To(BeTrue())
+		Expect(r.Contains("3.0.12")).To(BeFalse())
+		Expect(r.Contains("1.1.1w")).To(BeFalse())
+	})
+
+	It("should match exact versions and everything", func() {
+		r, err := ParseRange("2.14.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Contains("2.14.1")).To(BeTrue())
+		Expect(r.Contains("2.14.2")).To(BeFalse())
+		r, err = ParseRange("==2.14.1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(Equal(Range{{Op: "=", Version: "2.14.1"}}))
+
+		all, err := ParseRange("*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all.Contains("0.0.1")).To(BeTrue())
+	})
+
+	It("should reject constraints without version", func() {
+		_, err := ParseRange(">=1.0,<")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,160 @@
+package lineage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+)
+
+// DefaultSaveInterval is the interval in which a Saver writes a changed graph by default.
+const DefaultSaveInterval = time.Minute
+
+// snapshot is the JSON encoding of a Graph.
+type snapshot struct {
+	// Nodes are ordered the least recently pushed first.
+	Nodes  []snapshotNode                  `json:"nodes"`
+	Chains map[digest.Digest]digest.Digest `json:"chains"`
+	Tags   map[string]digest.Digest        `json:"tags"`
+}
+
+type snapshotNode struct {
+	Digest   digest.Digest     `json:"digest"`
+	Images   []inventory.Image `json:"images"`
+	Moved    []string          `json:"moved,omitempty"`
+	Base     *Base             `json:"base,omitempty"`
+	Outdated *Outdated         `json:"outdated,omitempty"`
+	Chain    digest.Digest     `json:"chain,omitempty"`
+}
+
+// LoadGraph returns the graph saved at path for up to maxNodes digests, an empty one if the file doesn't exist.
+func LoadGraph(path string, maxNodes int) (*Graph, error) {
+	g := NewGraph(maxNodes)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, sn := range s.Nodes {
+		n := g.touch(sn.Digest)
+		for _, img := range sn.Images {
+			n.images[img] = struct{}{}
+		}
+		for _, tag := range sn.Moved {
+			n.moved[tag] = struct{}{}
+		}
+		if sn.Base != nil {
+			g.setBase(sn.Digest, n, sn.Base)
+		}
+		g.setOutdated(n, sn.Outdated)
+		n.chain = sn.Chain
+	}
+	for chain, d := range s.Chains {
+		if _, ok := g.nodes[d]; ok {
+			g.chains[chain] = d
+		}
+	}
+	for tag, d := range s.Tags {
+		if _, ok := g.nodes[d]; ok {
+			g.tags[tag] = d
+		}
+	}
+	for g.order.Len() > g.maxNodes {
+		g.drop(g.order.Back().Value.(digest.Digest))
+	}
+	metrics.LineageSize(g.based, g.outdated)
+	return g, nil
+}
+
+// Save writes g to path if it changed since it was loaded or saved last. The file is replaced at once, so a crash
+// leaves the previous version.
+func (g *Graph) Save(path string) error {
+	g.mu.Lock()
+	if !g.changed {
+		g.mu.Unlock()
+		return nil
+	}
+	s := snapshot{Chains: maps.Clone(g.chains), Tags: maps.Clone(g.tags)}
+	for e := g.order.Back(); e != nil; e = e.Prev() {
+		d := e.Value.(digest.Digest)
+		n := g.nodes[d]
+		sn := snapshotNode{Digest: d, Images: g.node(d).Images, Base: n.base, Outdated: n.outdated, Chain: n.chain}
+		for tag := range n.moved {
+			sn.Moved = append(sn.Moved, tag)
+		}
+		slices.Sort(sn.Moved)
+		s.Nodes = append(s.Nodes, sn)
+	}
+	g.changed = false
+	g.mu.Unlock()
+
+	err := writeFile(path, s)
+	if err != nil {
+		g.mu.Lock()
+		g.changed = true
+		g.mu.Unlock()
+	}
+	return err
+}
+
+func writeFile(path string, s snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Saver saves Graph to Path periodically and when it stops, so the lineage survives restarts.
+type Saver struct {
+	Graph *Graph
+	Path  string
+	// Interval defaults to DefaultSaveInterval.
+	Interval time.Duration
+	Logger   logr.Logger
+}
+
+// Start saves the graph until ctx is done.
+func (s *Saver) Start(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSaveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.save()
+			return nil
+		case <-ticker.C:
+			s.save()
+		}
+	}
+}
+
+func (s *Saver) save() {
+	if err := s.Graph.Save(s.Path); err != nil {
+		s.Logger.Error(err, "saving the lineage", "path", s.Path)
+	}
+}
@@ -0,0 +1,374 @@
+// Package lineage tracks the base images of pushed images, so the images built on a base that was pushed again
+// can be reported as outdated.
+package lineage
+
+import (
+	"cmp"
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/opencontainers/go-digest"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+// Sources of the base of an image.
+const (
+	// SourceAnnotation means the manifest names the base with imagev1.AnnotationBaseImageDigest.
+	SourceAnnotation = "annotation"
+	// SourceLayers means the layers of the base are the longest prefix of the layers of the image.
+	SourceLayers = "layers"
+)
+
+// Base is the image another image was built on.
+type Base struct {
+	// Name is the reference of the base, if the annotations include it.
+	Name   string        `json:"name,omitempty"`
+	Digest digest.Digest `json:"digest"`
+	Source string        `json:"source"`
+}
+
+// Outdated reports that a tag of the base of an image was pushed again since the image was built.
+type Outdated struct {
+	// Base is the tag of the base image that moved, empty if another tenant pushed it.
+	Base string `json:"base,omitempty"`
+	// Digest of the base the image is built on.
+	Digest digest.Digest `json:"digest"`
+	// Current is the digest the tag points to now, empty if another tenant pushed it.
+	Current digest.Digest `json:"current,omitempty"`
+	Since   time.Time     `json:"since"`
+}
+
+// Node is the lineage of a digest.
+type Node struct {
+	Digest   digest.Digest     `json:"digest"`
+	Images   []inventory.Image `json:"images"`
+	Base     *Base             `json:"base,omitempty"`
+	Outdated *Outdated         `json:"outdated,omitempty"`
+	// Children are the digests built on this one.
+	Children []digest.Digest `json:"children,omitempty"`
+}
+
+// DefaultMaxNodes is the number of digests a Graph keeps by default.
+const DefaultMaxNodes = 10000
+
+type node struct {
+	images map[inventory.Image]struct{}
+	// moved holds the tags that point to another digest now, later events of this digest don't move them back
+	moved    map[string]struct{}
+	base     *Base
+	outdated *Outdated
+	// chain is the chain ID of all layers
+	chain digest.Digest
+	// element is the position of the digest in Graph.order
+	element *list.Element
+}
+
+// Graph links the pushed digests to their bases.
+type Graph struct {
+	mu    sync.RWMutex
+	nodes map[digest.Digest]*node
+	// chains maps the chain ID of the layers of every recorded image to the first digest recorded with them
+	chains map[digest.Digest]digest.Digest
+	// tags maps every pushed tag to the digest it points to
+	tags map[string]digest.Digest
+	// children maps the bases to the digests built on them
+	children map[digest.Digest]map[digest.Digest]struct{}
+	// order holds the digests, the most recently pushed or used as base first
+	order    *list.List
+	maxNodes int
+	// based and outdated are the numbers of nodes with a base and of the outdated ones
+	based, outdated int
+	// changed is set by every change since the graph was saved last
+	changed bool
+}
+
+// NewGraph returns an empty Graph for up to maxNodes digests, DefaultMaxNodes if not positive.
+// The least recently pushed digests are dropped first, bases count as pushed whenever an image built on them is.
+func NewGraph(maxNodes int) *Graph {
+	if maxNodes <= 0 {
+		maxNodes = DefaultMaxNodes
+	}
+	return &Graph{
+		nodes:    map[digest.Digest]*node{},
+		chains:   map[digest.Digest]digest.Digest{},
+		tags:     map[string]digest.Digest{},
+		children: map[digest.Digest]map[digest.Digest]struct{}{},
+		order:    list.New(),
+		maxNodes: maxNodes,
+	}
+}
+
+// Record adds the push of e, with the annotations of its manifest and the diff IDs of its layers.
+// If e moves a tag, the images built on the digest the tag pointed to before become outdated. Events of the digest
+// a tag moved away from, like of rescans, don't move the tag back.
+// Record returns the images that became outdated.
+func (g *Graph) Record(e types.RegistryEvent, annotations map[string]string, layers []digest.Digest) []Node {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	g.changed = true
+
+	n := g.touch(e.Digest)
+	n.images[inventory.Image{Registry: e.Registry, Repository: e.Repository, Tag: e.Tag, Tenant: e.Tenant}] = struct{}{}
+
+	chain := chainIDs(layers)
+	if n.base == nil {
+		if base := g.base(e.Digest, annotations, chain); base != nil {
+			g.setBase(e.Digest, n, base)
+			g.setOutdated(n, g.outdatedBy(base, now))
+		}
+	}
+	if n.base != nil {
+		if b, ok := g.nodes[n.base.Digest]; ok {
+			// bases in use are dropped last
+			g.order.MoveToFront(b.element)
+		}
+	}
+	if len(chain) > 0 && n.chain == "" {
+		n.chain = chain[len(chain)-1]
+		// retags and images only changing the config have the same layers, they don't replace the base
+		if _, ok := g.chains[n.chain]; !ok {
+			g.chains[n.chain] = e.Digest
+		}
+	}
+
+	var outdated []digest.Digest
+	if e.Tag != "" {
+		tag := imageTag(e.Registry, e.Repository, e.Tag)
+		_, moved := n.moved[tag]
+		if previous, ok := g.tags[tag]; !moved && ok && previous != e.Digest {
+			g.nodes[previous].moved[tag] = struct{}{}
+			for d := range g.children[previous] {
+				if child := g.nodes[d]; child.outdated == nil {
+					g.setOutdated(child, &Outdated{Base: tag, Digest: previous, Current: e.Digest, Since: now})
+					outdated = append(outdated, d)
+				}
+			}
+			for d := range g.children[e.Digest] {
+				if child := g.nodes[d]; child.outdated != nil && child.outdated.Base == tag {
+					// the child was built on the digest the tag points to now
+					g.setOutdated(child, nil)
+				}
+			}
+			if len(outdated) > 0 {
+				metrics.BaseImageUpdated(e.Registry, e.Repository)
+			}
+		}
+		if !moved {
+			g.tags[tag] = e.Digest
+		}
+	}
+	for g.order.Len() > g.maxNodes {
+		g.drop(g.order.Back().Value.(digest.Digest))
+	}
+	metrics.LineageSize(g.based, g.outdated)
+
+	nodes := make([]Node, 0, len(outdated))
+	for _, d := range outdated {
+		nodes = append(nodes, g.node(d))
+	}
+	sortNodes(nodes)
+	return nodes
+}
+
+// touch returns the node of d, which is added if it is missing, and moves it to the front. g.mu must be held.
+func (g *Graph) touch(d digest.Digest) *node {
+	n, ok := g.nodes[d]
+	if !ok {
+		n = &node{images: map[inventory.Image]struct{}{}, moved: map[string]struct{}{}, element: g.order.PushFront(d)}
+		g.nodes[d] = n
+	} else {
+		g.order.MoveToFront(n.element)
+	}
+	return n
+}
+
+// setBase sets the base of the node n of d, g.mu must be held.
+func (g *Graph) setBase(d digest.Digest, n *node, base *Base) {
+	n.base = base
+	g.based++
+	children, ok := g.children[base.Digest]
+	if !ok {
+		children = map[digest.Digest]struct{}{}
+		g.children[base.Digest] = children
+	}
+	children[d] = struct{}{}
+}
+
+// setOutdated sets whether n is outdated, g.mu must be held.
+func (g *Graph) setOutdated(n *node, o *Outdated) {
+	if n.outdated != nil {
+		g.outdated--
+	}
+	if o != nil {
+		g.outdated++
+	}
+	n.outdated = o
+}
+
+// drop removes d with its tags and the layers recorded for it, g.mu must be held.
+func (g *Graph) drop(d digest.Digest) {
+	n := g.nodes[d]
+	for img := range n.images {
+		if tag := imageTag(img.Registry, img.Repository, img.Tag); img.Tag != "" && g.tags[tag] == d {
+			delete(g.tags, tag)
+		}
+	}
+	if n.chain != "" && g.chains[n.chain] == d {
+		delete(g.chains, n.chain)
+	}
+	if n.base != nil {
+		g.based--
+		delete(g.children[n.base.Digest], d)
+		if len(g.children[n.base.Digest]) == 0 {
+			delete(g.children, n.base.Digest)
+		}
+	}
+	g.setOutdated(n, nil)
+	g.order.Remove(n.element)
+	delete(g.nodes, d)
+}
+
+// base returns the base named by the annotations, or the image whose layers are the longest prefix of chain.
+func (g *Graph) base(d digest.Digest, annotations map[string]string, chain []digest.Digest) *Base {
+	if baseDigest, err := digest.Parse(annotations[imagev1.AnnotationBaseImageDigest]); err == nil {
+		return &Base{Name: annotations[imagev1.AnnotationBaseImageName], Digest: baseDigest, Source: SourceAnnotation}
+	}
+	// the image itself has all layers, so its base has fewer
+	for i := len(chain) - 2; i >= 0; i-- {
+		if baseDigest, ok := g.chains[chain[i]]; ok && baseDigest != d {
+			return &Base{Digest: baseDigest, Source: SourceLayers}
+		}
+	}
+	return nil
+}
+
+// outdatedBy checks whether a tag of base points to another digest already, like for images built on an old base.
+func (g *Graph) outdatedBy(base *Base, now time.Time) *Outdated {
+	var tags []string
+	if base.Name != "" {
+		tags = append(tags, tagKey(base.Name))
+	}
+	if n, ok := g.nodes[base.Digest]; ok {
+		for img := range n.images {
+			if img.Tag != "" {
+				tags = append(tags, imageTag(img.Registry, img.Repository, img.Tag))
+			}
+		}
+	}
+	slices.Sort(tags)
+	for _, tag := range tags {
+		if current, ok := g.tags[tag]; ok && current != base.Digest {
+			return &Outdated{Base: tag, Digest: base.Digest, Current: current, Since: now}
+		}
+	}
+	return nil
+}
+
+// Get returns the lineage of d.
+func (g *Graph) Get(d digest.Digest) (Node, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if _, ok := g.nodes[d]; !ok {
+		return Node{}, false
+	}
+	return g.node(d), true
+}
+
+// Outdated returns whether d is built on a base that was pushed again, nil if not.
+func (g *Graph) Outdated(d digest.Digest) *Outdated {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if n, ok := g.nodes[d]; ok && n.outdated != nil {
+		o := *n.outdated
+		return &o
+	}
+	return nil
+}
+
+// ListOutdated returns the outdated images, only those built on base if it is set.
+func (g *Graph) ListOutdated(base digest.Digest) []Node {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var nodes []Node
+	if base != "" {
+		for d := range g.children[base] {
+			if g.nodes[d].outdated != nil {
+				nodes = append(nodes, g.node(d))
+			}
+		}
+	} else {
+		for d, n := range g.nodes {
+			if n.outdated != nil {
+				nodes = append(nodes, g.node(d))
+			}
+		}
+	}
+	sortNodes(nodes)
+	return nodes
+}
+
+// node returns the lineage of d, g.mu must be held.
+func (g *Graph) node(d digest.Digest) Node {
+	n := g.nodes[d]
+	out := Node{Digest: d}
+	for img := range n.images {
+		out.Images = append(out.Images, img)
+	}
+	slices.SortFunc(out.Images, func(a, b inventory.Image) int {
+		return cmp.Or(cmp.Compare(a.Registry, b.Registry), cmp.Compare(a.Repository, b.Repository),
+			cmp.Compare(a.Tag, b.Tag), cmp.Compare(a.Tenant, b.Tenant))
+	})
+	if n.base != nil {
+		base := *n.base
+		out.Base = &base
+	}
+	if n.outdated != nil {
+		outdated := *n.outdated
+		out.Outdated = &outdated
+	}
+	for child := range g.children[d] {
+		out.Children = append(out.Children, child)
+	}
+	slices.Sort(out.Children)
+	return out
+}
+
+func sortNodes(nodes []Node) {
+	slices.SortFunc(nodes, func(a, b Node) int {
+		return cmp.Compare(a.Digest, b.Digest)
+	})
+}
+
+// chainIDs returns the chain ID of every prefix of layers, which identifies the layers up to and including each one.
+func chainIDs(layers []digest.Digest) []digest.Digest {
+	ids := make([]digest.Digest, len(layers))
+	for i, l := range layers {
+		if i == 0 {
+			ids[i] = l
+			continue
+		}
+		ids[i] = digest.FromString(string(ids[i-1]) + " " + string(l))
+	}
+	return ids
+}
+
+// imageTag returns the key of a pushed tag.
+func imageTag(registry, repository, tag string) string {
+	return tagKey(registry + "/" + repository + ":" + tag)
+}
+
+// tagKey normalizes a tag reference, so the names in annotations match the tags of pushes.
+func tagKey(ref string) string {
+	tag, err := name.NewTag(ref)
+	if err != nil {
+		return ref
+	}
+	return tag.Context().Name() + ":" + tag.TagStr()
+}
@@ -0,0 +1,153 @@
+package lineage
+
+import (
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+var _ = Describe("Graph", func() {
+	var g *Graph
+
+	push := func(repository, tag, content string) types.RegistryEvent {
+		return types.RegistryEvent{Registry: "registry.example.com", Repository: repository, Tag: tag, Digest: digest.FromString(content)}
+	}
+	layer := func(content string) digest.Digest {
+		return digest.FromString("layer " + content)
+	}
+
+	BeforeEach(func() {
+		g = NewGraph(0)
+	})
+
+	It("should find the base by the longest layer prefix", func() {
+		base := push("base/debian", "12", "debian 12")
+		node := push("base/node", "20", "node 20")
+		app := push("team/app", "v1", "app")
+		Expect(g.Record(base, nil, []digest.Digest{layer("debian")})).To(BeEmpty())
+		Expect(g.Record(node, nil, []digest.Digest{layer("debian"), layer("node")})).To(BeEmpty())
+		Expect(g.Record(app, nil, []digest.Digest{layer("debian"), layer("node"), layer("app")})).To(BeEmpty())
+
+		n, ok := g.Get(app.Digest)
+		Expect(ok).To(BeTrue())
+		Expect(n.Base).To(Equal(&Base{Digest: node.Digest, Source: SourceLayers}))
+		Expect(n.Outdated).To(BeNil())
+		n, _ = g.Get(base.Digest)
+		Expect(n.Children).To(ConsistOf(node.Digest))
+	})
+
+	It("should prefer the base of the annotations", func() {
+		app := push("team/app", "v1", "app")
+		g.Record(app, map[string]string{
+			imagev1.AnnotationBaseImageName:   "docker.io/library/debian:12",
+			imagev1.AnnotationBaseImageDigest: string(digest.FromString("debian")),
+		}, []digest.Digest{layer("debian"), layer("app")})
+
+		n, _ := g.Get(app.Digest)
+		Expect(n.Base).To(Equal(&Base{Name: "docker.io/library/debian:12", Digest: digest.FromString("debian"), Source: SourceAnnotation}))
+	})
+
+	It("should report the children of a base pushed again as outdated", func() {
+		base := push("base/debian", "12", "debian 12")
+		app := push("team/app", "v1", "app")
+		g.Record(base, nil, []digest.Digest{layer("debian")})
+		g.Record(app, nil, []digest.Digest{layer("debian"), layer("app")})
+
+		rebuilt := push("base/debian", "12", "debian 12.1")
+		outdated := g.Record(rebuilt, nil, []digest.Digest{layer("debian 12.1")})
+		Expect(outdated).To(ConsistOf(And(
+			HaveField("Digest", app.Digest),
+			HaveField("Outdated.Base", "registry.example.com/base/debian:12"),
+			HaveField("Outdated.Digest", base.Digest),
+			HaveField("Outdated.Current", rebuilt.Digest),
+		)))
+		Expect(g.Outdated(app.Digest)).NotTo(BeNil())
+		Expect(g.ListOutdated("")).To(ConsistOf(HaveField("Digest", app.Digest)))
+		Expect(g.ListOutdated(rebuilt.Digest)).To(BeEmpty())
+
+		// images built on the old base afterwards are outdated right away
+		late := push("team/api", "v1", "api")
+		g.Record(late, nil, []digest.Digest{layer("debian"), layer("api")})
+		Expect(g.Outdated(late.Digest)).To(HaveField("Current", rebuilt.Digest))
+
+		// rebuilding the child on the new base gives a current image
+		app2 := push("team/app", "v2", "app 2")
+		g.Record(app2, nil, []digest.Digest{layer("debian 12.1"), layer("app")})
+		Expect(g.Outdated(app2.Digest)).To(BeNil())
+
+		// rescans of the old base don't move the tag back
+		Expect(g.Record(base, nil, []digest.Digest{layer("debian")})).To(BeEmpty())
+		Expect(g.Outdated(app.Digest)).NotTo(BeNil())
+		Expect(g.Outdated(app2.Digest)).To(BeNil())
+	})
+
+	It("should keep the first digest pushed with the layers as base", func() {
+		base := push("base/debian", "12", "debian 12")
+		g.Record(base, nil, []digest.Digest{layer("debian")})
+		// a config only change, like a label, has the same layers
+		g.Record(push("team/labeled", "v1", "labeled"), nil, []digest.Digest{layer("debian")})
+
+		app := push("team/app", "v1", "app")
+		g.Record(app, nil, []digest.Digest{layer("debian"), layer("app")})
+		n, _ := g.Get(app.Digest)
+		Expect(n.Base.Digest).To(Equal(base.Digest))
+	})
+
+	It("should drop the least recently pushed digests first", func() {
+		g = NewGraph(2)
+		base := push("base/debian", "12", "debian 12")
+		g.Record(base, nil, []digest.Digest{layer("debian")})
+		app := push("team/app", "v1", "app")
+		g.Record(app, nil, []digest.Digest{layer("debian"), layer("app")})
+		// the base was used by app, so the app is dropped first
+		g.Record(push("team/api", "v1", "api"), nil, []digest.Digest{layer("debian"), layer("api")})
+
+		_, ok := g.Get(app.Digest)
+		Expect(ok).To(BeFalse())
+		n, ok := g.Get(base.Digest)
+		Expect(ok).To(BeTrue())
+		Expect(n.Children).To(ConsistOf(digest.FromString("api")))
+	})
+
+	It("should save and load the graph", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "lineage.json")
+		base := push("base/debian", "12", "debian 12")
+		app := push("team/app", "v1", "app")
+		g.Record(base, nil, []digest.Digest{layer("debian")})
+		g.Record(app, nil, []digest.Digest{layer("debian"), layer("app")})
+		Expect(g.Save(path)).To(Succeed())
+
+		loaded, err := LoadGraph(path, 0)
+		Expect(err).NotTo(HaveOccurred())
+		n, ok := loaded.Get(app.Digest)
+		Expect(ok).To(BeTrue())
+		Expect(n).To(Equal(g.node(app.Digest)))
+
+		// the tag of the base is known after the restart
+		rebuilt := push("base/debian", "12", "debian 12.1")
+		Expect(loaded.Record(rebuilt, nil, []digest.Digest{layer("debian 12.1")})).To(ConsistOf(HaveField("Digest", app.Digest)))
+	})
+
+	It("should start empty without file", func() {
+		g, err := LoadGraph(filepath.Join(GinkgoT().TempDir(), "lineage.json"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(g.ListOutdated("")).To(BeEmpty())
+	})
+
+	It("should match annotated base names against pushed tags", func() {
+		base := push("base/debian", "12", "debian 12")
+		g.Record(base, nil, []digest.Digest{layer("debian")})
+		g.Record(push("base/debian", "12", "debian 12.1"), nil, []digest.Digest{layer("debian 12.1")})
+
+		app := push("team/app", "v1", "app")
+		g.Record(app, map[string]string{
+			imagev1.AnnotationBaseImageName:   "registry.example.com/base/debian:12",
+			imagev1.AnnotationBaseImageDigest: string(base.Digest),
+		}, nil)
+		Expect(g.Outdated(app.Digest)).To(HaveField("Base", "registry.example.com/base/debian:12"))
+	})
+})
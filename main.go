@@ -1,46 +1,191 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/stackitcloud/registry-snyk-scan/advisory"
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/config"
 	"github.com/stackitcloud/registry-snyk-scan/controller"
+	"github.com/stackitcloud/registry-snyk-scan/ha"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/lineage"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/standalone"
 	"github.com/stackitcloud/registry-snyk-scan/types"
 	"github.com/stackitcloud/registry-snyk-scan/webhook"
 	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
 var (
 	port             = flag.Int("port", 8081, "port to bind server to")
 	namespace        = flag.String("namespace", "default", "namespace to deploy scan jobs into")
-	insecureRegistry = flag.Bool("insecure-registry", false, "disables TLS verification for registry endpoint")
+	insecureRegistry = flag.Bool("insecure-registry", false, "disables TLS verification for registries without a profile")
+	registryProfiles = flag.String("registry-profiles", "", "path to a YAML file with per-registry connection profiles")
+	platforms        = flag.String("supported-platforms", "", "comma separated list of platforms (os/arch[/variant]) to scan, defaults to all linux platforms supported by snyk")
+	registryCache    = flag.Int("registry-cache-size", registry.DefaultCacheSize, "number of manifests and image configs cached by digest")
+	retryBaseDelay   = flag.Duration("retry-base-delay", controller.DefaultRetryPolicy.BaseDelay, "delay before retrying an event after a transient registry error, doubled with every attempt")
+	retryMaxDelay    = flag.Duration("retry-max-delay", controller.DefaultRetryPolicy.MaxDelay, "maximum delay between retries of an event")
+	retryMaxAttempts = flag.Int("retry-max-attempts", controller.DefaultRetryPolicy.MaxAttempts, "attempts before an event is moved to the dead letters")
+	metricsAddr      = flag.String("metrics-bind-address", metricsserver.DefaultBindAddress, "address to serve prometheus metrics at, 0 disables the metrics server")
+	maxRegistries    = flag.Int("metrics-max-registries", 50, "number of distinct registry label values in metrics, -1 for no limit")
+	maxRepositories  = flag.Int("metrics-max-repositories", 500, "number of distinct repository label values in metrics, -1 for no limit")
+	probeAddr        = flag.String("health-probe-bind-address", ":8082", "address to serve /healthz and /readyz at")
+	eventQueueSize   = flag.Int("event-queue-size", 100, "number of events buffered between webhook and controller")
+	tlsCertFile      = flag.String("tls-cert-file", "", "serve the webhook over TLS with this certificate, reloaded on change")
+	tlsKeyFile       = flag.String("tls-key-file", "", "private key of -tls-cert-file")
+	tlsClientCAFile  = flag.String("tls-client-ca-file", "", "require webhook clients to present a certificate signed by these CAs")
+	leaderElect      = flag.Bool("leader-elect", false, "run several replicas: only the leader creates jobs, the others forward notifications to it")
+	leaderElectionID = flag.String("leader-election-id", "registry-snyk-scan", "name of the leader election lease")
+	forwardCAFile    = flag.String("forward-ca-file", "", "CA bundle to verify the webhook certificate of the leader or other shards when forwarding over TLS, defaults to the system roots")
+	forwardSrvName   = flag.String("forward-server-name", "", "server name to verify the webhook certificate of the leader or other shards against when forwarding over TLS")
+	forwardSecret    = flag.String("forward-secret-file", "", "file with a secret shared by all replicas, sent with forwarded requests; required with -leader-elect or -shard")
+	shard            = flag.Bool("shard", false, "run several replicas that split the repositories between them, each replica creates the jobs of its own repositories")
+	shardGroup       = flag.String("shard-group", "registry-snyk-scan", "name shared by all shards, used as prefix of their membership leases")
+	shardAddress     = flag.String("shard-address", "", "host:port other shards forward events to, defaults to $POD_IP and -port")
+	registryRewrites = flag.String("registry-rewrites", "", "path to a YAML file with rules rewriting the registry host of notifications")
+	scanPolicies     = flag.Bool("scan-policies", false, "apply ScanPolicy resources of the scan job namespace and ClusterScanPolicy resources to events, requires their CRDs")
+	configFile       = flag.String("config", "", "path to a configuration file, reloaded on change; replaces the webhook, registry, platform and retry flags")
+	resultsFile      = flag.String("results-file", "", "keep the results in this file, so they survive restarts")
+	sbomDir          = flag.String("sbom-dir", "", "keep the SBOMs of scanned images in this directory, so they survive restarts; defaults to memory")
+	lineageFile      = flag.String("lineage-file", "", "keep the base images of pushed images in this file, so they survive restarts; defaults to memory")
+	standaloneMode   = flag.Bool("standalone", false, "run without Kubernetes: scans run as local processes and secrets are read from -secrets-dir")
+	secretsDir       = flag.String("secrets-dir", "/etc/registry-snyk-scan", "directory with a subdirectory per Secret and ConfigMap referenced by registry profiles and the scanner, one file per key, used with -standalone")
+	workers          = flag.Int("workers", standalone.DefaultWorkers, "number of scans run in parallel with -standalone")
+	scanLogLimit     = flag.Int("scan-log-limit", controller.DefaultLogLimit, "bytes of scanner output and of each SBOM read per scan")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		os.Exit(validateConfig(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == scanner.PrefetchCommand {
+		os.Exit(prefetch(os.Args[2:]))
+	}
+
 	opts := zap.Options{}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 	logger := zap.New(zap.UseFlagOptions(&opts))
 	ctrllog.SetLogger(logger)
 
+	cfg, watcher, err := loadConfig(logger.WithName("config"))
+	if err != nil {
+		logger.Error(err, "loading configuration")
+		os.Exit(1)
+	}
 	ctx := signals.SetupSignalHandler()
-	eventChan := make(chan event.TypedGenericEvent[types.RegistryEvent])
+	eventChan := make(chan event.TypedGenericEvent[types.RegistryEvent], cfg.Webhook.EventQueueSize)
+
+	metrics.SetCardinalityLimits(*maxRegistries, *maxRepositories)
+
+	if *shard && *leaderElect {
+		logger.Error(nil, "-shard and -leader-elect are mutually exclusive")
+		os.Exit(1)
+	}
+	// shards only see the images of their own repositories, which would give partial answers
+	if *shard && (cfg.Lineage.Enabled || len(cfg.AdvisorySources()) > 0) {
+		logger.Error(nil, "lineage and advisories need the images of all repositories and can't be used with -shard")
+		os.Exit(1)
+	}
+	var secret string
+	if *shard || *leaderElect {
+		secret, err = readForwardSecret()
+		if err != nil {
+			logger.Error(err, "reading the forward secret")
+			os.Exit(1)
+		}
+	}
 
-	mgr, err := manager.New(config.GetConfigOrDie(), manager.Options{
+	resultStore, err := newResultStore()
+	if err != nil {
+		logger.Error(err, "opening results")
+		os.Exit(1)
+	}
+	deadLetters := results.NewDeadLetters()
+	sboms, err := newSBOMStore()
+	if err != nil {
+		logger.Error(err, "opening SBOMs")
+		os.Exit(1)
+	}
+	packages := inventory.NewIndex(inventory.DefaultMaxDigests)
+	if *sbomDir == "" {
+		logger.Error(nil, "-sbom-dir is not set, the package inventory only holds the images scanned from now on "+
+			"and advisories miss the images scanned before a restart")
+	} else if err := packages.Rebuild(ctx, resultStore, sboms); err != nil {
+		logger.Error(err, "indexing the packages of stored SBOMs")
+		os.Exit(1)
+	}
+
+	if *standaloneMode {
+		if *shard || *leaderElect || *scanPolicies {
+			logger.Error(nil, "-shard, -leader-elect and -scan-policies need Kubernetes and can't be used with -standalone")
+			os.Exit(1)
+		}
+		if err := runStandalone(ctx, cfg, watcher, eventChan, resultStore, deadLetters, sboms, packages, logger); err != nil {
+			logger.Error(err, "running standalone")
+			os.Exit(1)
+		}
+		return
+	}
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+
+	// jobs, policies and the secrets they reference are read from all namespaces scan jobs are routed to
+	cacheNamespaces := map[string]cache.Config{}
+	for _, ns := range controller.TargetNamespaces(*namespace, cfg.Namespaces, cfg.ControllerTenants()) {
+		cacheNamespaces[ns] = cache.Config{}
+	}
+
+	mgr, err := manager.New(ctrlconfig.GetConfigOrDie(), manager.Options{
+		Scheme: scheme,
+		Metrics: metricsserver.Options{
+			BindAddress: *metricsAddr,
+		},
+		HealthProbeBindAddress:        *probeAddr,
+		LeaderElection:                *leaderElect,
+		LeaderElectionID:              *leaderElectionID,
+		LeaderElectionNamespace:       *namespace,
+		LeaderElectionReleaseOnCancel: true,
 		Cache: cache.Options{
-			DefaultNamespaces: map[string]cache.Config{
-				*namespace: {},
+			DefaultNamespaces: cacheNamespaces,
+			// the other ConfigMaps are read without cache
+			ByObject: map[client.Object]cache.ByObject{
+				&corev1.ConfigMap{}: {Label: controller.SnykPolicyCacheSelector()},
 			},
 		},
 	})
@@ -49,19 +194,183 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := (&controller.Reconciler{
-		Namespace:        *namespace,
-		InsecureRegistry: *insecureRegistry,
-	}).AddToManager(mgr, eventChan); err != nil {
+	// registry profiles and all other settings that can be reloaded are set by applyConfig below
+	// secrets are read without cache, so that the manager doesn't watch all secrets of the namespaces
+	registryClient := registry.NewClient(nil, mgr.GetAPIReader(), *namespace, cfg.Registries.CacheSize)
+	reconciler := &controller.Reconciler{
+		Namespace:       *namespace,
+		NamespaceRoutes: cfg.Namespaces,
+		Tenants:         cfg.ControllerTenants(),
+		Registry:        registryClient,
+		Results:         resultStore,
+		DeadLetters:     deadLetters,
+	}
+	if cfg.Referrers.Enabled {
+		reconciler.Attachments = registryClient
+	}
+	var graph *lineage.Graph
+	if cfg.Lineage.Enabled {
+		var saver *lineage.Saver
+		if graph, saver, err = newLineageGraph(logger); err != nil {
+			logger.Error(err, "loading lineage")
+			os.Exit(1)
+		}
+		if saver != nil {
+			// only the leader records pushes
+			if err := mgr.Add(saver); err != nil {
+				logger.Error(err, "adding lineage saver to manager")
+				os.Exit(1)
+			}
+		}
+		reconciler.Lineage = &controller.Lineage{Registry: registryClient, Graph: graph, Events: eventChan}
+	}
+	if *scanPolicies {
+		reconciler.Policies = &controller.ScanPolicies{Reader: mgr.GetClient()}
+	}
+	if err := reconciler.AddToManager(mgr, eventChan); err != nil {
 		logger.Error(err, "adding reconciler to manager")
 		os.Exit(1)
 	}
+	snykPolicyReconciler := &controller.SnykPolicyReconciler{
+		Reconciler: reconciler,
+		Results:    resultStore,
+		Events:     eventChan,
+	}
+	if err := snykPolicyReconciler.AddToManager(mgr); err != nil {
+		logger.Error(err, "adding snyk policy reconciler to manager")
+		os.Exit(1)
+	}
 
-	s, err := webhook.NewServer(*port, eventChan, logger.WithName("webhook"))
+	// with leader election only the leader rescans
+	if advisories := newAdvisoryWatcher(cfg, packages, resultStore, eventChan, logger); advisories != nil {
+		if err := mgr.Add(advisories); err != nil {
+			logger.Error(err, "adding advisory watcher to manager")
+			os.Exit(1)
+		}
+	}
+
+	var shards *ha.Shards
+	if *shard {
+		shards, err = newShards(mgr, cfg, secret, logger.WithName("shards"))
+		if err != nil {
+			logger.Error(err, "configuring shards")
+			os.Exit(1)
+		}
+		if err := mgr.Add(shards); err != nil {
+			logger.Error(err, "adding shards to manager")
+			os.Exit(1)
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		logger.Error(err, "creating clientset")
+		os.Exit(1)
+	}
+	scanJobReconciler := &controller.ScanJobReconciler{
+		Results:   resultStore,
+		Logs:      &controller.PodLogs{Clientset: clientset, LimitBytes: int64(*scanLogLimit)},
+		SBOMs:     sboms,
+		Inventory: packages,
+	}
+	if shards != nil {
+		scanJobReconciler.Shards = shards
+	}
+	if cfg.Referrers.Enabled {
+		scanJobReconciler.Referrers = registryClient
+	}
+	if err := scanJobReconciler.AddToManager(mgr); err != nil {
+		logger.Error(err, "adding scan job reconciler to manager")
+		os.Exit(1)
+	}
+
+	serverOptions := []webhook.Option{
+		webhook.WithResults(resultStore),
+		webhook.WithDeadLetters(deadLetters),
+		webhook.WithTenants(cfg.WebhookTenants()),
+		webhook.WithSBOMs(sboms),
+	}
+	if !*shard {
+		serverOptions = append(serverOptions, webhook.WithInventory(packages))
+	}
+	if graph != nil {
+		serverOptions = append(serverOptions, webhook.WithLineage(graph))
+	}
+	if cfg.Webhook.TLS != nil {
+		serverOptions = append(serverOptions, webhook.WithTLS(*cfg.Webhook.TLS))
+	}
+	if cfg.Webhook.TokenFile != "" {
+		serverOptions = append(serverOptions, webhook.WithToken(cfg.Webhook.TokenFile))
+	}
+
+	if *leaderElect {
+		forwardClient, err := newForwardClient(cfg.Webhook.TLS)
+		if err != nil {
+			logger.Error(err, "configuring forwarding to the leader")
+			os.Exit(1)
+		}
+		serverOptions = append(serverOptions, webhook.WithForwarder(&ha.Forwarder{
+			Reader:    mgr.GetAPIReader(),
+			Namespace: *namespace,
+			LeaseName: *leaderElectionID,
+			Port:      cfg.Webhook.Port,
+			Scheme:    webhookScheme(cfg.Webhook.TLS),
+			Client:    forwardClient,
+			Secret:    secret,
+			Elected:   mgr.Elected(),
+		}))
+	}
+	if secret != "" {
+		serverOptions = append(serverOptions, webhook.WithForwardSecret(secret))
+	}
+
+	if shards != nil {
+		serverOptions = append(serverOptions, webhook.WithRouter(shards))
+	}
+
+	s, err := webhook.NewServer(cfg.Webhook.Port, eventChan, logger.WithName("webhook"), serverOptions...)
 	if err != nil {
 		log.Fatalf("error creating webhook server: %s", err)
 	}
-	slog.Info("serving", "port", *port)
+	slog.Info("serving", "port", cfg.Webhook.Port)
+
+	targets := &configTargets{
+		registry:    registryClient,
+		reconciler:  reconciler,
+		server:      s,
+		results:     resultStore,
+		deadLetters: deadLetters,
+		logger:      logger,
+	}
+	targets.apply(cfg)
+	if watcher != nil {
+		watcher.OnChange(targets.apply)
+		if err := mgr.Add(watcher); err != nil {
+			logger.Error(err, "adding configuration watcher to manager")
+			os.Exit(1)
+		}
+	}
+
+	checks := []struct {
+		name    string
+		checker healthz.Checker
+		ready   bool
+	}{
+		{"webhook", s.Healthz, false},
+		{"webhook", s.Readyz, true},
+		{"cache-sync", controller.CacheSyncCheck(mgr.GetCache()), true},
+		{"snyk-secret", controller.SnykSecretCheck(mgr.GetAPIReader(), reconciler), true},
+	}
+	for _, c := range checks {
+		add := mgr.AddHealthzCheck
+		if c.ready {
+			add = mgr.AddReadyzCheck
+		}
+		if err := add(c.name, c.checker); err != nil {
+			logger.Error(err, "adding health check", "check", c.name)
+			os.Exit(1)
+		}
+	}
 
 	var errg errgroup.Group
 
@@ -80,3 +389,172 @@ func main() {
 		logger.Info("http server closed")
 	}
 }
+
+// resultStore keeps the results in memory or in -results-file.
+type resultStore interface {
+	results.Store
+	SetRetention(results.Retention)
+}
+
+func newResultStore() (resultStore, error) {
+	if *resultsFile == "" {
+		return results.NewMemoryStore(), nil
+	}
+	return results.OpenFileStore(*resultsFile)
+}
+
+func newSBOMStore() (sbom.Store, error) {
+	if *sbomDir == "" {
+		return sbom.NewMemoryStore(sbom.DefaultMemoryDigests), nil
+	}
+	return sbom.OpenDirStore(*sbomDir)
+}
+
+// newLineageGraph returns the lineage graph saved in -lineage-file and the Saver keeping the file up to date,
+// or an empty graph without Saver if -lineage-file is not set.
+func newLineageGraph(logger logr.Logger) (*lineage.Graph, *lineage.Saver, error) {
+	if *lineageFile == "" {
+		logger.Error(nil, "-lineage-file is not set, base images pushed before a restart aren't recognized when they "+
+			"are pushed again")
+		return lineage.NewGraph(lineage.DefaultMaxNodes), nil, nil
+	}
+	graph, err := lineage.LoadGraph(*lineageFile, lineage.DefaultMaxNodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return graph, &lineage.Saver{Graph: graph, Path: *lineageFile, Logger: logger.WithName("lineage")}, nil
+}
+
+// newAdvisoryWatcher returns the watcher of the advisory feeds of cfg, nil if there are none.
+func newAdvisoryWatcher(cfg *config.Config, packages *inventory.Index, store results.Store,
+	eventChan chan<- event.TypedGenericEvent[types.RegistryEvent], logger logr.Logger) *advisory.Watcher {
+	sources := cfg.AdvisorySources()
+	if len(sources) == 0 {
+		return nil
+	}
+	return &advisory.Watcher{
+		Sources:   sources,
+		Inventory: packages,
+		Results:   store,
+		Events:    eventChan,
+		Interval:  cfg.Advisories.Interval.Duration,
+		Logger:    logger.WithName("advisories"),
+	}
+}
+
+// configTargets are the running components that take the settings that can change at runtime.
+type configTargets struct {
+	registry    *registry.Client
+	reconciler  *controller.Reconciler
+	server      *webhook.Server
+	results     resultStore
+	deadLetters *results.DeadLetters
+	logger      logr.Logger
+}
+
+// apply passes the settings of c on to the components.
+func (t *configTargets) apply(c *config.Config) {
+	settings, err := c.ReconcilerSettings()
+	if err != nil {
+		t.logger.Error(err, "applying configuration")
+		return
+	}
+	rewriter, err := c.Rewriter()
+	if err != nil {
+		t.logger.Error(err, "applying configuration")
+		return
+	}
+	t.registry.SetProfiles(settings.Registries)
+	t.reconciler.Reconfigure(settings)
+	t.server.SetHostRewriter(rewriter)
+	t.server.SetFilters(c.Filters.Filters)
+	t.results.SetRetention(c.ResultsRetention())
+	t.deadLetters.SetRetention(c.DeadLettersRetention())
+}
+
+// newShards returns the shard membership of this replica.
+func newShards(mgr manager.Manager, cfg *config.Config, secret string, logger logr.Logger) (*ha.Shards, error) {
+	// membership leases are read without cache to not watch all leases of the namespace
+	c, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+	if err != nil {
+		return nil, err
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	address := *shardAddress
+	if address == "" {
+		podIP := os.Getenv("POD_IP")
+		if podIP == "" {
+			return nil, errors.New("-shard-address or $POD_IP must be set")
+		}
+		address = net.JoinHostPort(podIP, strconv.Itoa(cfg.Webhook.Port))
+	}
+	forwardClient, err := newForwardClient(cfg.Webhook.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return &ha.Shards{
+		Client:     c,
+		Namespace:  *namespace,
+		Group:      *shardGroup,
+		Identity:   identity,
+		Address:    address,
+		Scheme:     webhookScheme(cfg.Webhook.TLS),
+		HTTPClient: forwardClient,
+		Secret:     secret,
+		Logger:     logger,
+	}, nil
+}
+
+// readForwardSecret returns the secret of -forward-secret-file, which authenticates requests between replicas.
+func readForwardSecret() (string, error) {
+	if *forwardSecret == "" {
+		return "", errors.New("-forward-secret-file must be set")
+	}
+	data, err := os.ReadFile(*forwardSecret)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", *forwardSecret)
+	}
+	return secret, nil
+}
+
+func webhookScheme(tlsOptions *webhook.TLSOptions) string {
+	if tlsOptions != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// newForwardClient returns the HTTP client used to forward notifications to the leader.
+// With TLS, the serving certificate is presented as client certificate in case the leader requires one.
+func newForwardClient(tlsOptions *webhook.TLSOptions) (*http.Client, error) {
+	if tlsOptions == nil {
+		return &http.Client{Timeout: 10 * time.Second}, nil
+	}
+	tlsConfig := &tls.Config{
+		ServerName: *forwardSrvName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(tlsOptions.CertFile, tlsOptions.KeyFile)
+			return &cert, err
+		},
+	}
+	if *forwardCAFile != "" {
+		data, err := os.ReadFile(*forwardCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s contains no certificates", *forwardCAFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}, nil
+}
@@ -0,0 +1,387 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "registry_snyk_scan"
+
+// OverflowLabelValue replaces registry and repository label values beyond the cardinality limits.
+const OverflowLabelValue = "other"
+
+// Reasons for filtering events in the webhook.
+const (
+	FilterReasonAction     = "action"
+	FilterReasonMediaType  = "media_type"
+	FilterReasonRepository = "repository"
+	FilterReasonInvalid    = "invalid"
+)
+
+// Outcomes of reconciling an event.
+const (
+	OutcomeJobCreated          = "job_created"
+	OutcomeJobExists           = "job_exists"
+	OutcomeUnsupportedPlatform = "unsupported_platform"
+	OutcomeInvalid             = "invalid"
+	OutcomeDropped             = "dropped"
+	OutcomeRetried             = "retried"
+	OutcomeFailed              = "failed"
+	OutcomeError               = "error"
+	OutcomeAttachment          = "attachment"
+)
+
+// Outcomes of scan jobs.
+const (
+	ScanSucceeded = "succeeded"
+	ScanFailed    = "failed"
+)
+
+var (
+	envelopesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "envelopes_received_total",
+		Help:      "Number of notification envelopes received by the webhook by decoding result.",
+	}, []string{"result"})
+
+	eventsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_received_total",
+		Help:      "Number of notification events in decoded envelopes.",
+	})
+
+	eventsFiltered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_filtered_total",
+		Help:      "Number of notification events that were not passed to the controller by reason.",
+	}, []string{"reason"})
+
+	eventsEnqueued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_enqueued_total",
+		Help:      "Number of registry events passed to the controller.",
+	}, []string{"registry", "repository"})
+
+	reconcileOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_outcomes_total",
+		Help:      "Number of reconciled registry events by outcome.",
+	}, []string{"registry", "repository", "outcome"})
+
+	registryLookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "registry_lookup_duration_seconds",
+		Help:      "Latency of looking up the platform of an image, including cached lookups.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"registry"})
+
+	registryRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registry_requests_total",
+		Help:      "Number of HTTP requests sent to registries by status code.",
+	}, []string{"registry", "method", "code"})
+
+	registryRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "registry_request_duration_seconds",
+		Help:      "Latency of HTTP requests sent to registries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"registry", "method"})
+
+	registryCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registry_cache_lookups_total",
+		Help:      "Number of lookups in the manifest and config caches by result.",
+	}, []string{"cache", "result"})
+
+	scans = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scans_total",
+		Help:      "Number of finished scan jobs by outcome.",
+	}, []string{"registry", "repository", "outcome"})
+
+	scanDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scan_duration_seconds",
+		Help:      "Duration of finished scan jobs.",
+		Buckets:   prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{"registry", "outcome"})
+
+	scanVerdicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scan_verdicts_total",
+		Help:      "Number of scans gating images by verdict.",
+	}, []string{"registry", "repository", "verdict"})
+
+	referrersPushed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "referrers_pushed_total",
+		Help:      "Number of artifacts attached to scanned images by artifact and result.",
+	}, []string{"registry", "repository", "artifact", "result"})
+
+	sbomsStored = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sboms_stored_total",
+		Help:      "Number of SBOMs of scanned images stored by format and result.",
+	}, []string{"registry", "repository", "format", "result"})
+
+	inventoryDigests = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inventory_digests",
+		Help:      "Number of image digests in the package inventory.",
+	})
+
+	inventoryPackages = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inventory_packages",
+		Help:      "Number of distinct package versions in the package inventory.",
+	})
+
+	advisoryFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "advisory_fetches_total",
+		Help:      "Number of attempts to read a vulnerability advisory feed by result.",
+	}, []string{"result"})
+
+	advisoryRescans = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "advisory_rescans_total",
+		Help:      "Number of digests rescanned because a new vulnerability advisory affects them.",
+	}, []string{"registry", "repository"})
+
+	lineageImages = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "lineage_images",
+		Help:      "Number of image digests with a known base image.",
+	})
+
+	lineageOutdated = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "lineage_outdated_images",
+		Help:      "Number of image digests built on a base image that was pushed again.",
+	})
+
+	baseImageUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "base_image_updates_total",
+		Help:      "Number of pushes of base images that made the images built on them outdated.",
+	}, []string{"registry", "repository"})
+
+	baseImageRescans = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "base_image_rescans_total",
+		Help:      "Number of digests rescanned because their base image was pushed again.",
+	}, []string{"registry", "repository"})
+
+	configReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Number of attempts to reload the changed configuration file by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		envelopesReceived,
+		eventsReceived,
+		eventsFiltered,
+		eventsEnqueued,
+		reconcileOutcomes,
+		registryLookupDuration,
+		registryRequests,
+		registryRequestDuration,
+		registryCacheLookups,
+		scans,
+		scanDuration,
+		scanVerdicts,
+		referrersPushed,
+		sbomsStored,
+		inventoryDigests,
+		inventoryPackages,
+		advisoryFetches,
+		advisoryRescans,
+		lineageImages,
+		lineageOutdated,
+		baseImageUpdates,
+		baseImageRescans,
+		configReloads,
+	)
+}
+
+// cardinalityLimit passes through the first max distinct values and replaces all others with OverflowLabelValue.
+type cardinalityLimit struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+func (l *cardinalityLimit) value(v string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max < 0 {
+		return v
+	}
+	if _, ok := l.seen[v]; ok {
+		return v
+	}
+	if len(l.seen) >= l.max {
+		return OverflowLabelValue
+	}
+	if l.seen == nil {
+		l.seen = map[string]struct{}{}
+	}
+	l.seen[v] = struct{}{}
+	return v
+}
+
+// set replaces the limit and forgets the values seen so far.
+func (l *cardinalityLimit) set(max int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = max
+	l.seen = nil
+}
+
+var (
+	registries   = &cardinalityLimit{max: 50}
+	repositories = &cardinalityLimit{max: 500}
+)
+
+// SetCardinalityLimits sets the number of distinct registry and repository label values.
+// Further values are reported as OverflowLabelValue. Zero reports all values as OverflowLabelValue,
+// a negative limit disables the limit. It is safe to call while metrics are recorded.
+func SetCardinalityLimits(maxRegistries, maxRepositories int) {
+	registries.set(maxRegistries)
+	repositories.set(maxRepositories)
+}
+
+// ReceivedEnvelope records a received envelope with its number of events, or a decoding error.
+func ReceivedEnvelope(events int, decodeErr error) {
+	if decodeErr != nil {
+		envelopesReceived.WithLabelValues("invalid").Inc()
+		return
+	}
+	envelopesReceived.WithLabelValues("decoded").Inc()
+	eventsReceived.Add(float64(events))
+}
+
+// FilteredEvents records events that were filtered out of an envelope.
+func FilteredEvents(reason string, count int) {
+	if count > 0 {
+		eventsFiltered.WithLabelValues(reason).Add(float64(count))
+	}
+}
+
+// EnqueuedEvent records an event passed to the controller.
+func EnqueuedEvent(registry, repository string) {
+	eventsEnqueued.WithLabelValues(registries.value(registry), repositories.value(repository)).Inc()
+}
+
+// ReconcileOutcome records the outcome of reconciling an event.
+func ReconcileOutcome(registry, repository, outcome string) {
+	reconcileOutcomes.WithLabelValues(registries.value(registry), repositories.value(repository), outcome).Inc()
+}
+
+// RegistryLookup records the latency of a platform lookup.
+func RegistryLookup(registry string, d time.Duration) {
+	registryLookupDuration.WithLabelValues(registries.value(registry)).Observe(d.Seconds())
+}
+
+// RegistryRequest records a single HTTP request to a registry. A zero code means the request failed without response.
+func RegistryRequest(registry, method string, code int, d time.Duration) {
+	registry = registries.value(registry)
+	registryRequestDuration.WithLabelValues(registry, method).Observe(d.Seconds())
+	c := "error"
+	if code != 0 {
+		c = strconv.Itoa(code)
+	}
+	registryRequests.WithLabelValues(registry, method, c).Inc()
+}
+
+// RegistryCacheLookup records a lookup in the manifest or config cache of the registry client.
+func RegistryCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	registryCacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// ScanFinished records a finished scan job.
+func ScanFinished(registry, repository, outcome string, d time.Duration) {
+	registry = registries.value(registry)
+	scans.WithLabelValues(registry, repositories.value(repository), outcome).Inc()
+	scanDuration.WithLabelValues(registry, outcome).Observe(d.Seconds())
+}
+
+// ScanVerdict records the verdict of a scan gating an image.
+func ScanVerdict(registry, repository, verdict string) {
+	scanVerdicts.WithLabelValues(registries.value(registry), repositories.value(repository), verdict).Inc()
+}
+
+// ReferrerPushed records an attempt to attach an artifact to a scanned image.
+func ReferrerPushed(registry, repository, artifact string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	referrersPushed.WithLabelValues(registries.value(registry), repositories.value(repository), artifact, result).Inc()
+}
+
+// SBOMStored records an attempt to store the SBOM of a scanned image.
+func SBOMStored(registry, repository, format string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	sbomsStored.WithLabelValues(registries.value(registry), repositories.value(repository), format, result).Inc()
+}
+
+// InventorySize sets the number of digests and package versions in the package inventory.
+func InventorySize(digests, versions int) {
+	inventoryDigests.Set(float64(digests))
+	inventoryPackages.Set(float64(versions))
+}
+
+// AdvisoryFetch records an attempt to read an advisory feed.
+func AdvisoryFetch(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	advisoryFetches.WithLabelValues(result).Inc()
+}
+
+// AdvisoryRescan records a rescan of a digest affected by an advisory.
+func AdvisoryRescan(registry, repository string) {
+	advisoryRescans.WithLabelValues(registries.value(registry), repositories.value(repository)).Inc()
+}
+
+// LineageSize sets the number of digests with a known base image and the outdated ones.
+func LineageSize(images, outdated int) {
+	lineageImages.Set(float64(images))
+	lineageOutdated.Set(float64(outdated))
+}
+
+// BaseImageUpdated records a push of a base image that made the images built on it outdated.
+func BaseImageUpdated(registry, repository string) {
+	baseImageUpdates.WithLabelValues(registries.value(registry), repositories.value(repository)).Inc()
+}
+
+// BaseImageRescan records a rescan of a digest whose base image was pushed again.
+func BaseImageRescan(registry, repository string) {
+	baseImageRescans.WithLabelValues(registries.value(registry), repositories.value(repository)).Inc()
+}
+
+// ConfigReload records an attempt to reload the configuration file.
+func ConfigReload(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	configReloads.WithLabelValues(result).Inc()
+}
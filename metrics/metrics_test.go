@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ = Describe("cardinalityLimit", func() {
+	It("replaces values beyond the limit", func() {
+		l := &cardinalityLimit{max: 2}
+		Expect(l.value("a")).To(Equal("a"))
+		Expect(l.value("b")).To(Equal("b"))
+		Expect(l.value("c")).To(Equal(OverflowLabelValue))
+		Expect(l.value("a")).To(Equal("a"))
+	})
+
+	It("reports everything as overflow with a zero limit", func() {
+		l := &cardinalityLimit{max: 0}
+		Expect(l.value("a")).To(Equal(OverflowLabelValue))
+	})
+
+	It("passes all values without a limit", func() {
+		l := &cardinalityLimit{max: -1}
+		for _, v := range []string{"a", "b", "c"} {
+			Expect(l.value(v)).To(Equal(v))
+		}
+	})
+})
+
+var _ = Describe("ReconcileOutcome", func() {
+	It("applies the cardinality limits", func() {
+		SetCardinalityLimits(1, 1)
+		DeferCleanup(SetCardinalityLimits, 50, 500)
+
+		ReconcileOutcome("registry-a", "app", OutcomeJobCreated)
+		ReconcileOutcome("registry-b", "other", OutcomeJobCreated)
+
+		Expect(testutil.ToFloat64(reconcileOutcomes.WithLabelValues("registry-a", "app", OutcomeJobCreated))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(reconcileOutcomes.WithLabelValues(OverflowLabelValue, OverflowLabelValue, OutcomeJobCreated))).To(Equal(1.0))
+	})
+
+	It("can change the cardinality limits while recording", func() {
+		DeferCleanup(SetCardinalityLimits, 50, 500)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := range 100 {
+				SetCardinalityLimits(i, i)
+			}
+		}()
+		for range 100 {
+			ReconcileOutcome("registry-c", "app", OutcomeJobExists)
+		}
+		Eventually(done).Should(BeClosed())
+	})
+})
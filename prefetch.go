@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+)
+
+// prefetch runs in the prefetch init container of scan jobs, see scanner.Prefetch.
+// It copies an image into an OCI layout or archive with the settings of the registry profile passed as flags.
+// Credentials are read from $REGISTRY_USERNAME and $REGISTRY_PASSWORD, without them the default keychain is used.
+func prefetch(args []string) int {
+	fs := flag.NewFlagSet("prefetch", flag.ContinueOnError)
+	image := fs.String("image", "", "reference of the image with digest")
+	platform := fs.String("platform", "", "os/arch[/variant] of the image to copy if the reference is an index")
+	output := fs.String("output", "", "path of the OCI layout directory or archive")
+	format := fs.String("format", string(registry.FetchLayout), "layout or archive")
+	tlsMode := fs.String("tls-mode", string(registry.TLSModeVerify), "verify, skip-verify or plain-http")
+	caFile := fs.String("ca-file", "", "PEM encoded CA certificates trusted in addition to the system roots")
+	proxy := fs.String("proxy", "", "URL of an HTTP proxy used to reach the registry")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *image == "" || *output == "" || !slices.Contains(registry.FetchFormats, registry.FetchFormat(*format)) {
+		fmt.Fprintln(os.Stderr, "usage: registry-snyk-scan prefetch -image <reference> -output <path> [-format layout|archive] [flags]")
+		return 2
+	}
+	if err := runPrefetch(*image, *platform, *output, registry.FetchFormat(*format), registry.Profile{
+		TLSMode: registry.TLSMode(*tlsMode),
+		Proxy:   *proxy,
+	}, *caFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runPrefetch(image, platform, output string, format registry.FetchFormat, profile registry.Profile, caFile string) error {
+	var nameOptions []name.Option
+	if profile.TLSMode == registry.TLSModePlainHTTP {
+		nameOptions = append(nameOptions, name.Insecure)
+	}
+	// the copy is pinned to the digest of the event
+	ref, err := name.NewDigest(image, nameOptions...)
+	if err != nil {
+		return err
+	}
+	var p v1.Platform
+	if platform != "" {
+		parsed, err := v1.ParsePlatform(platform)
+		if err != nil {
+			return err
+		}
+		p = *parsed
+	}
+
+	var rootCAs *x509.CertPool
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if rootCAs, ok = registry.CertPool(pem); !ok {
+			return fmt.Errorf("%s contains no certificates", caFile)
+		}
+	}
+	tr, err := profile.Transport(rootCAs)
+	if err != nil {
+		return err
+	}
+	options := []remote.Option{remote.WithTransport(tr)}
+	if username := os.Getenv("REGISTRY_USERNAME"); username != "" {
+		options = append(options, remote.WithAuth(authn.FromConfig(authn.AuthConfig{
+			Username: username,
+			Password: os.Getenv("REGISTRY_PASSWORD"),
+		})))
+	} else {
+		options = append(options, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	}
+	return registry.Fetch(ref, p, format, output, options...)
+}
@@ -0,0 +1,220 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/opencontainers/go-digest"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"k8s.io/utils/lru"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultCacheSize is the number of manifests and config blobs cached by a Client.
+const DefaultCacheSize = 1024
+
+var imageManifestMediaTypes = []string{
+	schema2.MediaTypeManifest,
+	imagev1.MediaTypeImageManifest,
+}
+
+// Client looks up image metadata in registries.
+// Manifests and config blobs are immutable for a given digest, so they are cached by digest.
+type Client struct {
+	profiles  atomic.Pointer[Profiles]
+	reader    client.Reader
+	namespace string
+
+	// all caches are keyed by digest.Digest
+	manifests *lru.Cache
+	configs   *lru.Cache
+	// hints holds the descriptors of notifications passed to Hint
+	hints *lru.Cache
+}
+
+// hint is what the notification of a push tells about the manifest.
+type hint struct {
+	mediaType    string
+	configDigest digest.Digest
+}
+
+// NewClient returns a Client that connects to registries with the given profiles.
+// Credentials and CA bundles referenced by the profiles are read from namespace.
+func NewClient(profiles *Profiles, reader client.Reader, namespace string, cacheSize int) *Client {
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	c := &Client{
+		reader:    reader,
+		namespace: namespace,
+		manifests: lru.New(cacheSize),
+		configs:   lru.New(cacheSize),
+		hints:     lru.New(cacheSize),
+	}
+	c.profiles.Store(profiles)
+	return c
+}
+
+// SetProfiles replaces the profiles used for lookups started from now on.
+// Cached manifests and configs are kept, as they don't depend on how the registry is accessed.
+func (c *Client) SetProfiles(profiles *Profiles) {
+	c.profiles.Store(profiles)
+}
+
+// Hint remembers the media type and config digest of the notification of e for the lookups of its digest,
+// so that they are used even if the event is passed on without them.
+func (c *Client) Hint(e types.RegistryEvent) {
+	if e.MediaType == "" && e.ConfigDigest == "" {
+		return
+	}
+	c.hints.Add(e.Digest, hint{mediaType: e.MediaType, configDigest: e.ConfigDigest})
+}
+
+// Platform returns the platform of the image the event refers to.
+// If the event or a Hint carries the config digest, the manifest is not fetched at all.
+func (c *Client) Platform(ctx context.Context, e types.RegistryEvent) (imagev1.Platform, error) {
+	if cached, ok := c.hints.Get(e.Digest); ok && e.MediaType == "" && e.ConfigDigest == "" {
+		h := cached.(hint)
+		e.MediaType, e.ConfigDigest = h.mediaType, h.configDigest
+	}
+	if e.MediaType != "" && !slices.Contains(imageManifestMediaTypes, e.MediaType) {
+		return imagev1.Platform{}, &PermanentError{fmt.Errorf("unsupported manifest media type %q", e.MediaType)}
+	}
+
+	repo, remoteOptions, err := c.lookup(ctx, e)
+	if err != nil {
+		return imagev1.Platform{}, err
+	}
+
+	configDigest := e.ConfigDigest
+	if configDigest == "" {
+		manifest, err := c.manifest(repo, e, remoteOptions)
+		if err != nil {
+			return imagev1.Platform{}, err
+		}
+		configDigest = digest.Digest(manifest.Config.Digest.String())
+	}
+
+	config, err := c.config(repo, configDigest, remoteOptions)
+	if err != nil {
+		return imagev1.Platform{}, err
+	}
+
+	return imagev1.Platform{
+		Architecture: config.Architecture,
+		OS:           config.OS,
+		Variant:      config.Variant,
+	}, nil
+}
+
+// Ancestry is what the base image of an image can be derived from.
+type Ancestry struct {
+	// Annotations of the manifest, like imagev1.AnnotationBaseImageDigest.
+	Annotations map[string]string
+	// Layers are the digests of the uncompressed layers of the image config, the diff IDs.
+	Layers []digest.Digest
+}
+
+// Ancestry returns the annotations and layers of the image the event refers to.
+func (c *Client) Ancestry(ctx context.Context, e types.RegistryEvent) (Ancestry, error) {
+	repo, remoteOptions, err := c.lookup(ctx, e)
+	if err != nil {
+		return Ancestry{}, err
+	}
+	manifest, err := c.manifest(repo, e, remoteOptions)
+	if err != nil {
+		return Ancestry{}, err
+	}
+	config, err := c.config(repo, digest.Digest(manifest.Config.Digest.String()), remoteOptions)
+	if err != nil {
+		return Ancestry{}, err
+	}
+	a := Ancestry{Annotations: manifest.Annotations}
+	for _, h := range config.RootFS.DiffIDs {
+		a.Layers = append(a.Layers, digest.Digest(h.String()))
+	}
+	return a, nil
+}
+
+// lookup returns the repository of e and a function returning the options to access its registry.
+// The registry access is configured lazily, everything might be cached already.
+func (c *Client) lookup(ctx context.Context, e types.RegistryEvent) (name.Repository, func() ([]remote.Option, error), error) {
+	profiles := c.profiles.Load()
+	repo, err := name.NewRepository(e.Registry+"/"+e.Repository, profiles.NameOptions(e.Registry)...)
+	if err != nil {
+		return name.Repository{}, nil, &PermanentError{err}
+	}
+	var options []remote.Option
+	remoteOptions := func() ([]remote.Option, error) {
+		if options != nil {
+			return options, nil
+		}
+		var err error
+		options, err = profiles.RemoteOptions(ctx, c.reader, c.namespace, e.Registry)
+		return options, err
+	}
+	return repo, remoteOptions, nil
+}
+
+func (c *Client) manifest(repo name.Repository, e types.RegistryEvent, remoteOptions func() ([]remote.Option, error)) (*v1.Manifest, error) {
+	if cached, ok := c.manifests.Get(e.Digest); ok {
+		metrics.RegistryCacheLookup("manifest", true)
+		return cached.(*v1.Manifest), nil
+	}
+	metrics.RegistryCacheLookup("manifest", false)
+
+	options, err := remoteOptions()
+	if err != nil {
+		return nil, err
+	}
+	desc, err := remote.Get(repo.Digest(e.Digest.String()), options...)
+	if err != nil {
+		return nil, err
+	}
+	if !desc.MediaType.IsImage() {
+		return nil, &PermanentError{fmt.Errorf("unsupported manifest media type %q", desc.MediaType)}
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(desc.Manifest))
+	if err != nil {
+		return nil, &PermanentError{err}
+	}
+	c.manifests.Add(e.Digest, manifest)
+	return manifest, nil
+}
+
+func (c *Client) config(repo name.Repository, d digest.Digest, remoteOptions func() ([]remote.Option, error)) (*v1.ConfigFile, error) {
+	if cached, ok := c.configs.Get(d); ok {
+		metrics.RegistryCacheLookup("config", true)
+		return cached.(*v1.ConfigFile), nil
+	}
+	metrics.RegistryCacheLookup("config", false)
+
+	options, err := remoteOptions()
+	if err != nil {
+		return nil, err
+	}
+	blob, err := remote.Layer(repo.Digest(d.String()), options...)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := blob.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	config, err := v1.ParseConfigFile(rc)
+	if err != nil {
+		return nil, &PermanentError{err}
+	}
+	c.configs.Add(d, config)
+	return config, nil
+}
@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		host          string
+		manifestCalls atomic.Int32
+		blobCalls     atomic.Int32
+		event         types.RegistryEvent
+		configDigest  digest.Digest
+		profiles      *Profiles
+	)
+
+	BeforeEach(func() {
+		manifestCalls.Store(0)
+		blobCalls.Store(0)
+		handler := ggcrregistry.New()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.Contains(r.URL.Path, "/manifests/"):
+				manifestCalls.Add(1)
+			case strings.Contains(r.URL.Path, "/blobs/"):
+				blobCalls.Add(1)
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(server.Close)
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		host = u.Host
+		profiles = &Profiles{Default: Profile{TLSMode: TLSModePlainHTTP}}
+
+		img, err := random.Image(128, 1)
+		Expect(err).NotTo(HaveOccurred())
+		img, err = mutate.ConfigFile(img, &v1.ConfigFile{OS: "linux", Architecture: "arm", Variant: "v7"})
+		Expect(err).NotTo(HaveOccurred())
+		ref, err := name.ParseReference(host+"/team/app:v1", name.Insecure)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, img)).To(Succeed())
+
+		imgDigest, err := img.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		cfgDigest, err := img.ConfigName()
+		Expect(err).NotTo(HaveOccurred())
+		configDigest = digest.Digest(cfgDigest.String())
+		event = types.RegistryEvent{
+			Registry:   host,
+			Repository: "team/app",
+			Tag:        "v1",
+			Digest:     digest.Digest(imgDigest.String()),
+			MediaType:  imagev1.MediaTypeImageManifest,
+		}
+		manifestCalls.Store(0)
+		blobCalls.Store(0)
+	})
+
+	It("fetches manifest and config once and caches them", func(ctx SpecContext) {
+		c := NewClient(profiles, fake.NewClientBuilder().Build(), "default", 0)
+
+		platform, err := c.Platform(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platform).To(Equal(imagev1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}))
+		Expect(manifestCalls.Load()).To(BeEquivalentTo(1))
+		Expect(blobCalls.Load()).To(BeEquivalentTo(1))
+
+		_, err = c.Platform(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifestCalls.Load()).To(BeEquivalentTo(1))
+		Expect(blobCalls.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("uses the config digest of the notification", func(ctx SpecContext) {
+		c := NewClient(profiles, fake.NewClientBuilder().Build(), "default", 0)
+		event.ConfigDigest = configDigest
+
+		platform, err := c.Platform(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platform.Variant).To(Equal("v7"))
+		Expect(manifestCalls.Load()).To(BeEquivalentTo(0))
+		Expect(blobCalls.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("uses the config digest of a hint for events without it", func(ctx SpecContext) {
+		c := NewClient(profiles, fake.NewClientBuilder().Build(), "default", 0)
+		event.ConfigDigest = configDigest
+		c.Hint(event)
+		event.MediaType, event.ConfigDigest = "", ""
+
+		platform, err := c.Platform(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(platform.Variant).To(Equal("v7"))
+		Expect(manifestCalls.Load()).To(BeEquivalentTo(0))
+	})
+
+	It("rejects non image manifests from the notification", func(ctx SpecContext) {
+		c := NewClient(profiles, fake.NewClientBuilder().Build(), "default", 0)
+		event.MediaType = imagev1.MediaTypeImageIndex
+
+		_, err := c.Platform(ctx, event)
+		Expect(err).To(MatchError(ContainSubstring("unsupported manifest media type")))
+		Expect(manifestCalls.Load()).To(BeEquivalentTo(0))
+	})
+
+	It("returns the annotations and layers of an image", func(ctx SpecContext) {
+		img, err := random.Image(128, 2)
+		Expect(err).NotTo(HaveOccurred())
+		img = mutate.Annotations(img, map[string]string{
+			imagev1.AnnotationBaseImageName:   "registry.example.com/base/debian:12",
+			imagev1.AnnotationBaseImageDigest: string(digest.FromString("base")),
+		}).(v1.Image)
+		ref, err := name.ParseReference(host+"/team/app:v2", name.Insecure)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(ref, img)).To(Succeed())
+		imgDigest, err := img.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		config, err := img.ConfigFile()
+		Expect(err).NotTo(HaveOccurred())
+
+		manifestCalls.Store(0)
+		blobCalls.Store(0)
+
+		c := NewClient(profiles, fake.NewClientBuilder().Build(), "default", 0)
+		event.Tag, event.Digest = "v2", digest.Digest(imgDigest.String())
+		ancestry, err := c.Ancestry(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ancestry.Annotations).To(HaveKeyWithValue(imagev1.AnnotationBaseImageDigest, string(digest.FromString("base"))))
+		Expect(ancestry.Layers).To(Equal([]digest.Digest{
+			digest.Digest(config.RootFS.DiffIDs[0].String()),
+			digest.Digest(config.RootFS.DiffIDs[1].String()),
+		}))
+
+		// the platform lookup hits the cache
+		_, err = c.Platform(ctx, event)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifestCalls.Load()).To(BeEquivalentTo(1))
+		Expect(blobCalls.Load()).To(BeEquivalentTo(1))
+	})
+})
@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// PermanentError wraps errors that won't go away by retrying, like an unsupported media type.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient reports whether err is worth retrying.
+// Registry responses like 404 for a deleted manifest or 401 for missing permissions are permanent,
+// as are errors marked with PermanentError and canceled lookups. Network errors, rate limiting, server errors
+// and unknown errors are transient.
+func IsTransient(err error) bool {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		switch {
+		case transportErr.StatusCode == http.StatusTooManyRequests,
+			transportErr.StatusCode == http.StatusRequestTimeout,
+			transportErr.StatusCode >= http.StatusInternalServerError:
+			return true
+		case transportErr.StatusCode >= http.StatusBadRequest:
+			return false
+		}
+		return transportErr.Temporary()
+	}
+
+	return true
+}
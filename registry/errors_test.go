@@ -0,0 +1,27 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = DescribeTable("IsTransient", func(err error, expected bool) {
+	Expect(IsTransient(err)).To(Equal(expected))
+},
+	Entry("manifest not found", &transport.Error{StatusCode: http.StatusNotFound}, false),
+	Entry("unauthorized", fmt.Errorf("wrapped: %w", &transport.Error{StatusCode: http.StatusUnauthorized}), false),
+	Entry("rate limited", &transport.Error{StatusCode: http.StatusTooManyRequests}, true),
+	Entry("server error", &transport.Error{StatusCode: http.StatusBadGateway}, true),
+	Entry("network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true),
+	Entry("permanent error", &PermanentError{errors.New("unsupported media type")}, false),
+	Entry("canceled", fmt.Errorf("wrapped: %w", context.Canceled), false),
+	Entry("timeout", context.DeadlineExceeded, true),
+	Entry("unknown error", errors.New("something"), true),
+)
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// FetchFormat is how Fetch stores an image.
+type FetchFormat string
+
+const (
+	// FetchLayout stores the image as OCI image layout directory. This is the default.
+	FetchLayout FetchFormat = "layout"
+	// FetchArchive stores the image as tar archive of an OCI image layout.
+	FetchArchive FetchFormat = "archive"
+)
+
+// FetchFormats lists all formats.
+var FetchFormats = []FetchFormat{FetchLayout, FetchArchive}
+
+// Fetch copies the image ref refers to into dest. If ref is an index, only the image of platform is copied.
+func Fetch(ref name.Reference, platform v1.Platform, format FetchFormat, dest string, options ...remote.Option) error {
+	img, err := remote.Image(ref, append(options, remote.WithPlatform(platform))...)
+	if err != nil {
+		return fmt.Errorf("getting image %s: %w", ref, err)
+	}
+	if format != FetchArchive {
+		return writeLayout(dest, img)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(dest), ".layout-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := writeLayout(dir, img); err != nil {
+		return err
+	}
+	return writeTar(dir, dest)
+}
+
+func writeLayout(dir string, img v1.Image) error {
+	p, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		return err
+	}
+	if err := p.AppendImage(img); err != nil {
+		return fmt.Errorf("writing OCI layout: %w", err)
+	}
+	return nil
+}
+
+// writeTar archives the files of dir into the tar file dest, with paths relative to dir.
+func writeTar(dir, dest string) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(f)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		if hdr.Name, err = filepath.Rel(dir, path); err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(hdr.Name)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("writing OCI archive: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
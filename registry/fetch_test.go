@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"archive/tar"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fetch", func() {
+	var (
+		ref      name.Digest
+		armImage v1.Hash
+	)
+
+	BeforeEach(func() {
+		server := httptest.NewServer(ggcrregistry.New())
+		DeferCleanup(server.Close)
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		// an index with an image per platform
+		repo, err := name.NewRepository(u.Host+"/team/app", name.Insecure)
+		Expect(err).NotTo(HaveOccurred())
+		index := v1.ImageIndex(empty.Index)
+		for _, platform := range []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}} {
+			img, err := random.Image(128, 1)
+			Expect(err).NotTo(HaveOccurred())
+			cfg, err := img.ConfigFile()
+			Expect(err).NotTo(HaveOccurred())
+			cfg = cfg.DeepCopy()
+			cfg.OS, cfg.Architecture = platform.OS, platform.Architecture
+			img, err = mutate.ConfigFile(img, cfg)
+			Expect(err).NotTo(HaveOccurred())
+			imgDigest, err := img.Digest()
+			Expect(err).NotTo(HaveOccurred())
+			index = mutate.AppendManifests(index, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &platform}})
+			if platform.Architecture == "arm64" {
+				armImage = imgDigest
+			}
+		}
+		indexDigest, err := index.Digest()
+		Expect(err).NotTo(HaveOccurred())
+		ref = repo.Digest(indexDigest.String())
+		Expect(remote.WriteIndex(ref, index)).To(Succeed())
+	})
+
+	It("copies the image of the platform into an OCI layout", func() {
+		dir := filepath.Join(GinkgoT().TempDir(), "image")
+		Expect(Fetch(ref, v1.Platform{OS: "linux", Architecture: "arm64"}, FetchLayout, dir)).To(Succeed())
+
+		index, err := layout.ImageIndexFromPath(dir)
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := index.IndexManifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Manifests).To(HaveLen(1))
+		Expect(manifest.Manifests[0].Digest).To(Equal(armImage))
+	})
+
+	It("archives the OCI layout", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "image.tar")
+		Expect(Fetch(ref, v1.Platform{OS: "linux", Architecture: "arm64"}, FetchArchive, file)).To(Succeed())
+
+		f, err := os.Open(file)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		var names []string
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, hdr.Name)
+		}
+		Expect(names).To(ContainElements("oci-layout", "index.json", "blobs/sha256/"+armImage.Hex))
+		// the layout is only kept in the archive
+		Expect(os.ReadDir(filepath.Dir(file))).To(HaveLen(1))
+	})
+
+	It("fails for missing platforms", func() {
+		err := Fetch(ref, v1.Platform{OS: "linux", Architecture: "s390x"}, FetchLayout, GinkgoT().TempDir())
+		Expect(err).To(HaveOccurred())
+	})
+})
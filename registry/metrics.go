@@ -0,0 +1,25 @@
+package registry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+)
+
+// instrumentedTransport records the count and latency of requests to a registry.
+type instrumentedTransport struct {
+	registry string
+	next     http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := 0
+	if err == nil {
+		code = resp.StatusCode
+	}
+	metrics.RegistryRequest(t.registry, req.Method, code, time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,314 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// TLSMode controls how connections to a registry are secured.
+type TLSMode string
+
+const (
+	// TLSModeVerify uses TLS and verifies the registry certificate. This is the default.
+	TLSModeVerify TLSMode = "verify"
+	// TLSModeSkipVerify uses TLS without verifying the registry certificate.
+	TLSModeSkipVerify TLSMode = "skip-verify"
+	// TLSModePlainHTTP talks to the registry over plain HTTP.
+	TLSModePlainHTTP TLSMode = "plain-http"
+)
+
+const (
+	// CredentialsUsernameKey is the key of the username in a credentials secret.
+	CredentialsUsernameKey = "username"
+	// CredentialsPasswordKey is the key of the password in a credentials secret.
+	CredentialsPasswordKey = "password"
+)
+
+// Profile describes how to connect to a single registry.
+type Profile struct {
+	// TLSMode defaults to TLSModeVerify.
+	TLSMode TLSMode `json:"tlsMode,omitempty"`
+	// CABundle references a ConfigMap key holding PEM encoded CA certificates
+	// that are trusted in addition to the system roots.
+	CABundle *corev1.ConfigMapKeySelector `json:"caBundle,omitempty"`
+	// CredentialsSecret is the name of a secret with the keys "username" and "password".
+	// Without it, the default keychain is used for lookups and the scan runs anonymously.
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// Proxy is the URL of an HTTP proxy used to reach the registry.
+	Proxy string `json:"proxy,omitempty"`
+	// RateLimit is the maximum number of requests per second sent to the registry.
+	// Zero disables rate limiting.
+	RateLimit float64 `json:"rateLimit,omitempty"`
+	// Burst is the number of requests allowed to exceed RateLimit. Defaults to 1.
+	Burst int `json:"burst,omitempty"`
+}
+
+// Insecure reports whether the registry certificate is not verified or TLS is not used at all.
+func (p Profile) Insecure() bool {
+	return p.TLSMode == TLSModeSkipVerify || p.TLSMode == TLSModePlainHTTP
+}
+
+func (p Profile) validate() error {
+	switch p.TLSMode {
+	case "", TLSModeVerify, TLSModeSkipVerify, TLSModePlainHTTP:
+	default:
+		return fmt.Errorf("unknown tlsMode %q", p.TLSMode)
+	}
+	if p.CABundle != nil && (p.CABundle.Name == "" || p.CABundle.Key == "") {
+		return fmt.Errorf("caBundle needs name and key")
+	}
+	if p.Proxy != "" {
+		if _, err := url.Parse(p.Proxy); err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+	}
+	if p.RateLimit < 0 {
+		return fmt.Errorf("rateLimit must not be negative")
+	}
+	return nil
+}
+
+// Profiles holds the connection profiles of all known registries.
+type Profiles struct {
+	// Default is used for registries without an explicit profile.
+	Default Profile `json:"default,omitempty"`
+	// Registries maps a registry host, including the port if any, to its profile.
+	Registries map[string]Profile `json:"registries,omitempty"`
+
+	mu         sync.Mutex
+	limiters   map[string]*rate.Limiter
+	transports map[string]cachedTransport
+}
+
+// maxTransports bounds the transports kept by Profiles. Registries without a profile of their own share the default
+// profile, but each get their own transport.
+const maxTransports = 100
+
+// cachedTransport is the transport of a registry with the CA bundle it was built with.
+type cachedTransport struct {
+	caBundle string
+	tr       *http.Transport
+	rt       http.RoundTripper
+}
+
+// LoadProfiles reads profiles from a YAML file.
+func LoadProfiles(path string) (*Profiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profiles{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("parsing registry profiles %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("validating registry profiles %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Validate checks all profiles for invalid settings.
+func (p *Profiles) Validate() error {
+	if err := p.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for host, profile := range p.Registries {
+		if err := profile.validate(); err != nil {
+			return fmt.Errorf("registry %s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// Get returns the profile for the given registry host. It is safe to call on a nil Profiles.
+func (p *Profiles) Get(registry string) Profile {
+	if p == nil {
+		return Profile{}
+	}
+	if profile, ok := p.Registries[registry]; ok {
+		return profile
+	}
+	return p.Default
+}
+
+// limiter returns the shared rate limiter of a registry, or nil if the profile is not rate limited.
+func (p *Profiles) limiter(registry string, profile Profile) *rate.Limiter {
+	if p == nil || profile.RateLimit == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.limiters == nil {
+		p.limiters = map[string]*rate.Limiter{}
+	}
+	l, ok := p.limiters[registry]
+	if !ok {
+		burst := profile.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		l = rate.NewLimiter(rate.Limit(profile.RateLimit), burst)
+		p.limiters[registry] = l
+	}
+	return l
+}
+
+// NameOptions returns the options to parse references of the given registry.
+func (p *Profiles) NameOptions(registry string) []name.Option {
+	if p.Get(registry).TLSMode == TLSModePlainHTTP {
+		return []name.Option{name.Insecure}
+	}
+	return nil
+}
+
+// CertPool returns the system roots with the PEM encoded certificates added.
+// It reports false if pem contains no certificates.
+func CertPool(pem []byte) (*x509.CertPool, bool) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	return pool, pool.AppendCertsFromPEM(pem)
+}
+
+// Transport returns the HTTP transport to reach a registry with p. rootCAs replaces the system roots, if set.
+func (p Profile) Transport(rootCAs *x509.CertPool) (*http.Transport, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: p.Insecure(),
+		RootCAs:            rootCAs,
+	}
+	if p.Proxy != "" {
+		proxyURL, err := url.Parse(p.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy: %w", err)
+		}
+		tr.Proxy = http.ProxyURL(proxyURL)
+	}
+	return tr, nil
+}
+
+// transport returns the transport of a registry, which is shared by all lookups so that connections are reused.
+// It is replaced when the CA bundle changes.
+func (p *Profiles) transport(registry string, profile Profile, caBundle string) (http.RoundTripper, error) {
+	if p == nil {
+		tr, err := profile.transportWithCABundle(registry, caBundle)
+		if err != nil {
+			return nil, err
+		}
+		return &instrumentedTransport{registry: registry, next: tr}, nil
+	}
+	limiter := p.limiter(registry, profile)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cached, ok := p.transports[registry]; ok {
+		if cached.caBundle == caBundle {
+			return cached.rt, nil
+		}
+		cached.tr.CloseIdleConnections()
+		delete(p.transports, registry)
+	}
+	if p.transports == nil {
+		p.transports = map[string]cachedTransport{}
+	}
+	for other, cached := range p.transports {
+		if len(p.transports) < maxTransports {
+			break
+		}
+		cached.tr.CloseIdleConnections()
+		delete(p.transports, other)
+	}
+
+	tr, err := profile.transportWithCABundle(registry, caBundle)
+	if err != nil {
+		return nil, err
+	}
+	var rt http.RoundTripper = &instrumentedTransport{registry: registry, next: tr}
+	if limiter != nil {
+		rt = &rateLimitedTransport{limiter: limiter, next: rt}
+	}
+	p.transports[registry] = cachedTransport{caBundle: caBundle, tr: tr, rt: rt}
+	return rt, nil
+}
+
+// transportWithCABundle returns the transport of p trusting the PEM encoded caBundle if p has one.
+func (p Profile) transportWithCABundle(registry, caBundle string) (*http.Transport, error) {
+	var rootCAs *x509.CertPool
+	if p.CABundle != nil {
+		var ok bool
+		if rootCAs, ok = CertPool([]byte(caBundle)); !ok {
+			return nil, fmt.Errorf("CA bundle %s/%s for registry %s contains no certificates", p.CABundle.Name, p.CABundle.Key, registry)
+		}
+	}
+	tr, err := p.Transport(rootCAs)
+	if err != nil {
+		return nil, fmt.Errorf("registry %s: %w", registry, err)
+	}
+	return tr, nil
+}
+
+// RemoteOptions returns the options to access the given registry.
+// Credentials and CA bundles are read from the given namespace.
+func (p *Profiles) RemoteOptions(ctx context.Context, c client.Reader, namespace, registry string) ([]remote.Option, error) {
+	profile := p.Get(registry)
+
+	var caBundle string
+	if profile.CABundle != nil {
+		var cm corev1.ConfigMap
+		if err := c.Get(ctx, k8stypes.NamespacedName{Namespace: namespace, Name: profile.CABundle.Name}, &cm); err != nil {
+			return nil, fmt.Errorf("getting CA bundle for registry %s: %w", registry, err)
+		}
+		caBundle = cm.Data[profile.CABundle.Key]
+	}
+	rt, err := p.transport(registry, profile, caBundle)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithTransport(rt),
+	}
+
+	if profile.CredentialsSecret == "" {
+		options = append(options, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		return options, nil
+	}
+
+	var secret corev1.Secret
+	if err := c.Get(ctx, k8stypes.NamespacedName{Namespace: namespace, Name: profile.CredentialsSecret}, &secret); err != nil {
+		return nil, fmt.Errorf("getting credentials for registry %s: %w", registry, err)
+	}
+	options = append(options, remote.WithAuth(authn.FromConfig(authn.AuthConfig{
+		Username: string(secret.Data[CredentialsUsernameKey]),
+		Password: string(secret.Data[CredentialsPasswordKey]),
+	})))
+	return options, nil
+}
+
+type rateLimitedTransport struct {
+	limiter *rate.Limiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
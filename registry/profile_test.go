@@ -0,0 +1,139 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Profiles", func() {
+	profiles := &Profiles{
+		Default: Profile{TLSMode: TLSModeSkipVerify},
+		Registries: map[string]Profile{
+			"legacy:5000": {TLSMode: TLSModePlainHTTP},
+			"internal":    {CredentialsSecret: "internal-creds"},
+		},
+	}
+
+	Describe("Get", func() {
+		It("returns the profile of a known registry", func() {
+			Expect(profiles.Get("legacy:5000").TLSMode).To(Equal(TLSModePlainHTTP))
+		})
+
+		It("falls back to the default profile", func() {
+			Expect(profiles.Get("unknown").TLSMode).To(Equal(TLSModeSkipVerify))
+		})
+
+		It("returns an empty profile for nil profiles", func() {
+			var p *Profiles
+			Expect(p.Get("unknown")).To(Equal(Profile{}))
+		})
+	})
+
+	Describe("NameOptions", func() {
+		It("marks plain http registries as insecure", func() {
+			Expect(profiles.NameOptions("legacy:5000")).To(HaveLen(1))
+			Expect(profiles.NameOptions("internal")).To(BeEmpty())
+		})
+	})
+
+	Describe("RemoteOptions", func() {
+		It("fails if the credentials secret is missing", func(ctx SpecContext) {
+			c := fake.NewClientBuilder().Build()
+			_, err := profiles.RemoteOptions(ctx, c, "default", "internal")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("reads the credentials secret", func(ctx SpecContext) {
+			c := fake.NewClientBuilder().WithObjects(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "internal-creds", Namespace: "default"},
+				Data: map[string][]byte{
+					CredentialsUsernameKey: []byte("user"),
+					CredentialsPasswordKey: []byte("pass"),
+				},
+			}).Build()
+			_, err := profiles.RemoteOptions(ctx, c, "default", "internal")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("fails for a CA bundle without certificates", func(ctx SpecContext) {
+			p := &Profiles{Default: Profile{CABundle: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "ca"},
+				Key:                  "ca.crt",
+			}}}
+			c := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "default"},
+				Data:       map[string]string{"ca.crt": "not a certificate"},
+			}).Build()
+			_, err := p.RemoteOptions(ctx, c, "default", "internal")
+			Expect(err).To(MatchError(ContainSubstring("contains no certificates")))
+		})
+	})
+
+	Describe("transport", func() {
+		It("is shared by the lookups of a registry", func() {
+			p := &Profiles{}
+			first, err := p.transport("internal", p.Get("internal"), "")
+			Expect(err).NotTo(HaveOccurred())
+			second, err := p.transport("internal", p.Get("internal"), "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second).To(BeIdenticalTo(first))
+
+			other, err := p.transport("legacy:5000", p.Get("legacy:5000"), "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(other).NotTo(BeIdenticalTo(first))
+		})
+
+		It("is replaced when the CA bundle changes", func() {
+			p := &Profiles{}
+			first, err := p.transport("internal", Profile{}, "old")
+			Expect(err).NotTo(HaveOccurred())
+			second, err := p.transport("internal", Profile{}, "new")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(second).NotTo(BeIdenticalTo(first))
+		})
+	})
+
+	Describe("LoadProfiles", func() {
+		write := func(content string) string {
+			path := filepath.Join(GinkgoT().TempDir(), "profiles.yaml")
+			Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+			return path
+		}
+
+		It("loads a valid file", func() {
+			p, err := LoadProfiles(write(`
+default:
+  tlsMode: verify
+registries:
+  mirror.example.com:
+    proxy: http://proxy:3128
+    rateLimit: 5
+`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.Get("mirror.example.com").RateLimit).To(Equal(5.0))
+		})
+
+		It("rejects an unknown tls mode", func() {
+			_, err := LoadProfiles(write(`
+registries:
+  mirror.example.com:
+    tlsMode: maybe
+`))
+			Expect(err).To(MatchError(ContainSubstring("unknown tlsMode")))
+		})
+
+		It("rejects unknown fields", func() {
+			_, err := LoadProfiles(write(`
+default:
+  insecure: true
+`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+// ReportArtifactType is the artifact type of the scan reports attached to images.
+const ReportArtifactType = "application/vnd.stackit.registry-snyk-scan.report.v1+json"
+
+// referrersTag matches the tags of the referrers tag schema, which registries without the referrers API
+// use to list the referrers of a digest.
+var referrersTag = regexp.MustCompile(`^sha256-[a-f0-9]{64}$`)
+
+// Artifact is attached to an image as OCI referrer.
+type Artifact struct {
+	// ArtifactType is the media type of the config of the artifact manifest.
+	ArtifactType string
+	// MediaType of Data.
+	MediaType   string
+	Data        []byte
+	Annotations map[string]string
+}
+
+// Attach pushes a as artifact manifest whose subject is the image of e, and returns its digest.
+// Registries without the referrers API get the artifact added to the index tagged with the referrers tag
+// schema instead.
+func (c *Client) Attach(ctx context.Context, e types.RegistryEvent, a Artifact) (v1.Hash, error) {
+	profiles := c.profiles.Load()
+	repo, err := name.NewRepository(e.Registry+"/"+e.Repository, profiles.NameOptions(e.Registry)...)
+	if err != nil {
+		return v1.Hash{}, &PermanentError{err}
+	}
+	options, err := profiles.RemoteOptions(ctx, c.reader, c.namespace, e.Registry)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	subject, err := remote.Head(repo.Digest(e.Digest.String()), options...)
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("getting subject %s: %w", e.Digest, err)
+	}
+
+	img, err := artifactImage(a, *subject)
+	if err != nil {
+		return v1.Hash{}, &PermanentError{err}
+	}
+	h, err := img.Digest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	if err := remote.Write(repo.Digest(h.String()), img, options...); err != nil {
+		return v1.Hash{}, fmt.Errorf("pushing artifact: %w", err)
+	}
+	return h, nil
+}
+
+// Attached reports whether e is the push of an artifact or of a referrers tag index. Their events must not be
+// scanned. Artifacts are recognized by the subject of their manifest or a config that is no image config, so the
+// artifacts of other clients are skipped as well.
+func (c *Client) Attached(ctx context.Context, e types.RegistryEvent) (bool, error) {
+	if referrersTag.MatchString(e.Tag) {
+		return true, nil
+	}
+	if e.MediaType != "" && !slices.Contains(imageManifestMediaTypes, e.MediaType) {
+		return false, nil
+	}
+	repo, remoteOptions, err := c.lookup(ctx, e)
+	if err != nil {
+		return false, err
+	}
+	manifest, err := c.manifest(repo, e, remoteOptions)
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		// no image manifest, the platform lookup reports it
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return manifest.Subject != nil || !manifest.Config.MediaType.IsConfig(), nil
+}
+
+// artifactImage returns an artifact manifest with a single layer holding the data of a.
+func artifactImage(a Artifact, subject v1.Descriptor) (v1.Image, error) {
+	img := mutate.MediaType(empty.Image, ggcrtypes.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, ggcrtypes.MediaType(a.ArtifactType))
+	img, err := mutate.Append(img, mutate.Addendum{
+		Layer: static.NewLayer(a.Data, ggcrtypes.MediaType(a.MediaType)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the subject must not carry the annotations and platform of the index the image might be listed in
+	subject = v1.Descriptor{MediaType: subject.MediaType, Size: subject.Size, Digest: subject.Digest}
+	// setting annotations drops the subject, so it is set last
+	img = mutate.Annotations(img, maps.Clone(a.Annotations)).(v1.Image)
+	return mutate.Subject(img, subject).(v1.Image), nil
+}
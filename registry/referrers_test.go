@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Attach", func() {
+	var (
+		repo  name.Repository
+		event types.RegistryEvent
+		c     *Client
+	)
+
+	setup := func(referrersAPI bool) {
+		server := httptest.NewServer(ggcrregistry.New(ggcrregistry.WithReferrersSupport(referrersAPI)))
+		DeferCleanup(server.Close)
+		u, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		repo, err = name.NewRepository(u.Host+"/team/app", name.Insecure)
+		Expect(err).NotTo(HaveOccurred())
+		img, err := random.Image(128, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Write(repo.Tag("v1"), img)).To(Succeed())
+		imgDigest, err := img.Digest()
+		Expect(err).NotTo(HaveOccurred())
+
+		event = types.RegistryEvent{Registry: u.Host, Repository: "team/app", Tag: "v1", Digest: digest.Digest(imgDigest.String())}
+		c = NewClient(&Profiles{Default: Profile{TLSMode: TLSModePlainHTTP}}, fake.NewClientBuilder().Build(), "default", 0)
+	}
+
+	report := Artifact{
+		ArtifactType: ReportArtifactType,
+		MediaType:    "application/json",
+		Data:         []byte(`{"ok":true}`),
+		Annotations:  map[string]string{"scanner": "snyk"},
+	}
+
+	DescribeTable("should push the artifact as referrer of the image", func(ctx SpecContext, referrersAPI bool) {
+		setup(referrersAPI)
+		attached, err := c.Attach(ctx, event, report)
+		Expect(err).NotTo(HaveOccurred())
+
+		subject := repo.Digest(event.Digest.String())
+		index, err := remote.Referrers(subject, remote.WithFilter("artifactType", ReportArtifactType))
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := index.IndexManifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Manifests).To(ConsistOf(HaveField("Digest", attached)))
+
+		img, err := remote.Image(repo.Digest(attached.String()))
+		Expect(err).NotTo(HaveOccurred())
+		m, err := img.Manifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m.Subject.Digest.String()).To(Equal(event.Digest.String()))
+		Expect(m.Annotations).To(HaveKeyWithValue("scanner", "snyk"))
+		layers, err := img.Layers()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(layers).To(HaveLen(1))
+
+		// registries without the referrers API list the referrers in a tagged index
+		h, _ := v1.NewHash(event.Digest.String())
+		_, err = remote.Head(repo.Tag("sha256-" + h.Hex))
+		if referrersAPI {
+			Expect(err).To(HaveOccurred())
+		} else {
+			Expect(err).NotTo(HaveOccurred())
+		}
+	},
+		Entry("with the referrers API", true),
+		Entry("with the referrers tag schema", false),
+	)
+
+	It("should push the same artifact only once", func(ctx SpecContext) {
+		setup(true)
+		first, err := c.Attach(ctx, event, report)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := c.Attach(ctx, event, report)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(Equal(first))
+
+		index, err := remote.Referrers(repo.Digest(event.Digest.String()))
+		Expect(err).NotTo(HaveOccurred())
+		manifest, err := index.IndexManifest()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Manifests).To(HaveLen(1))
+	})
+
+	It("should recognize the pushes of artifacts", func(ctx SpecContext) {
+		setup(false)
+		attached, err := c.Attach(ctx, event, report)
+		Expect(err).NotTo(HaveOccurred())
+
+		// a restarted controller recognizes the artifact from its manifest
+		other := NewClient(&Profiles{Default: Profile{TLSMode: TLSModePlainHTTP}}, fake.NewClientBuilder().Build(), "default", 0)
+		artifact := types.RegistryEvent{Registry: event.Registry, Repository: "team/app", Digest: digest.Digest(attached.String())}
+		Expect(other.Attached(ctx, artifact)).To(BeTrue())
+		h, _ := v1.NewHash(event.Digest.String())
+		Expect(other.Attached(ctx, types.RegistryEvent{Repository: "team/app", Tag: "sha256-" + h.Hex, Digest: "sha256:" + digest.Digest(h.Hex)})).To(BeTrue())
+		Expect(other.Attached(ctx, event)).To(BeFalse())
+	})
+})
@@ -0,0 +1,151 @@
+package registry
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// PortKeep keeps the port of the original host unless the replacement sets one. This is the default.
+	PortKeep = "keep"
+	// PortStrip removes the port from the rewritten host.
+	PortStrip = "strip"
+)
+
+// RewriteRule turns the host a registry reports in its notifications into the host used to pull images.
+type RewriteRule struct {
+	// Host matches the notification host exactly. Without a port, it matches the hostname on any port.
+	Host string `json:"host,omitempty"`
+	// Regex matches the whole notification host including the port. It is mutually exclusive with Host.
+	Regex string `json:"regex,omitempty"`
+	// Replacement is the canonical host. With Regex, it may reference capture groups like $1.
+	Replacement string `json:"replacement"`
+	// Port is "keep", "strip" or a port number that is set on the rewritten host.
+	Port string `json:"port,omitempty"`
+}
+
+type compiledRule struct {
+	RewriteRule
+	regex *regexp.Regexp
+}
+
+// Rewriter applies the first matching RewriteRule to a host.
+type Rewriter struct {
+	rules []compiledRule
+}
+
+// NewRewriter validates and compiles rules.
+func NewRewriter(rules []RewriteRule) (*Rewriter, error) {
+	r := &Rewriter{}
+	for i, rule := range rules {
+		if (rule.Host == "") == (rule.Regex == "") {
+			return nil, fmt.Errorf("rule %d: exactly one of host and regex must be set", i)
+		}
+		if rule.Replacement == "" {
+			return nil, fmt.Errorf("rule %d: replacement must be set", i)
+		}
+		switch rule.Port {
+		case "", PortKeep, PortStrip:
+		default:
+			if port, err := strconv.Atoi(rule.Port); err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("rule %d: port must be %q, %q or a port number", i, PortKeep, PortStrip)
+			}
+		}
+		c := compiledRule{RewriteRule: rule}
+		if rule.Regex != "" {
+			re, err := regexp.Compile("^(?:" + rule.Regex + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			c.regex = re
+		}
+		r.rules = append(r.rules, c)
+	}
+	return r, nil
+}
+
+// LoadRewriteRules reads a YAML list of rewrite rules without validating them.
+func LoadRewriteRules(path string) ([]RewriteRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RewriteRule
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing rewrite rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// LoadRewriter reads a YAML list of rewrite rules.
+func LoadRewriter(path string) (*Rewriter, error) {
+	rules, err := LoadRewriteRules(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewRewriter(rules)
+	if err != nil {
+		return nil, fmt.Errorf("validating rewrite rules %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Rewrite returns the canonical host for host. Hosts without a matching rule are returned unchanged.
+// It is safe to call on a nil Rewriter.
+func (r *Rewriter) Rewrite(host string) string {
+	if r == nil {
+		return host
+	}
+	hostname, port := splitHostPort(host)
+	for _, rule := range r.rules {
+		var rewritten string
+		switch {
+		case rule.regex != nil:
+			m := rule.regex.FindStringSubmatchIndex(host)
+			if m == nil {
+				continue
+			}
+			rewritten = string(rule.regex.ExpandString(nil, rule.Replacement, host, m))
+		case rule.Host == host:
+			rewritten = rule.Replacement
+		case !strings.Contains(rule.Host, ":") && rule.Host == hostname:
+			rewritten = rule.Replacement
+		default:
+			continue
+		}
+		return applyPort(rewritten, port, rule.Port)
+	}
+	return host
+}
+
+func applyPort(host, originalPort, mode string) string {
+	hostname, port := splitHostPort(host)
+	switch mode {
+	case PortStrip:
+		return hostname
+	case "", PortKeep:
+		if port == "" {
+			port = originalPort
+		}
+	default:
+		port = mode
+	}
+	if port == "" {
+		return hostname
+	}
+	return net.JoinHostPort(hostname, port)
+}
+
+func splitHostPort(host string) (string, string) {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host, ""
+	}
+	return hostname, port
+}
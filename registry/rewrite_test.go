@@ -0,0 +1,49 @@
+package registry
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rewriter", func() {
+	DescribeTable("Rewrite", func(rule RewriteRule, host, expected string) {
+		r, err := NewRewriter([]RewriteRule{rule})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Rewrite(host)).To(Equal(expected))
+	},
+		Entry("exact host", RewriteRule{Host: "registry.svc:5000", Replacement: "registry.example.com"}, "registry.svc:5000", "registry.example.com:5000"),
+		Entry("hostname on any port", RewriteRule{Host: "registry.svc", Replacement: "registry.example.com"}, "registry.svc:5000", "registry.example.com:5000"),
+		Entry("strip port", RewriteRule{Host: "registry.svc", Replacement: "registry.example.com", Port: PortStrip}, "registry.svc:5000", "registry.example.com"),
+		Entry("set port", RewriteRule{Host: "registry.svc", Replacement: "registry.example.com", Port: "443"}, "registry.svc:5000", "registry.example.com:443"),
+		Entry("replacement port wins over kept port", RewriteRule{Host: "registry.svc", Replacement: "registry.example.com:8443"}, "registry.svc:5000", "registry.example.com:8443"),
+		Entry("regex with capture group", RewriteRule{Regex: `registry-(\w+)\.svc(:\d+)?`, Replacement: "$1.registry.example.com", Port: PortStrip}, "registry-eu.svc:5000", "eu.registry.example.com"),
+		Entry("regex must match the whole host", RewriteRule{Regex: `registry`, Replacement: "other"}, "registry.svc", "registry.svc"),
+		Entry("no match", RewriteRule{Host: "other", Replacement: "registry.example.com"}, "registry.svc:5000", "registry.svc:5000"),
+	)
+
+	It("applies the first matching rule", func() {
+		r, err := NewRewriter([]RewriteRule{
+			{Host: "registry.svc", Replacement: "first"},
+			{Regex: ".*", Replacement: "second"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Rewrite("registry.svc")).To(Equal("first"))
+		Expect(r.Rewrite("other")).To(Equal("second"))
+	})
+
+	It("returns the host unchanged for a nil Rewriter", func() {
+		var r *Rewriter
+		Expect(r.Rewrite("registry.svc")).To(Equal("registry.svc"))
+	})
+
+	DescribeTable("NewRewriter rejects invalid rules", func(rule RewriteRule) {
+		_, err := NewRewriter([]RewriteRule{rule})
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("host and regex", RewriteRule{Host: "a", Regex: "a", Replacement: "b"}),
+		Entry("neither host nor regex", RewriteRule{Replacement: "b"}),
+		Entry("missing replacement", RewriteRule{Host: "a"}),
+		Entry("invalid regex", RewriteRule{Regex: "(", Replacement: "b"}),
+		Entry("invalid port", RewriteRule{Host: "a", Replacement: "b", Port: "http"}),
+	)
+})
@@ -0,0 +1,86 @@
+package results
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+// DeadLetter is an event that exhausted its retries.
+type DeadLetter struct {
+	Event    types.RegistryEvent `json:"event"`
+	Reason   string              `json:"reason"`
+	Attempts int                 `json:"attempts"`
+	Time     time.Time           `json:"time"`
+}
+
+// DeadLetters keeps failed events in memory until they are replayed.
+type DeadLetters struct {
+	mu        sync.Mutex
+	entries   map[types.RegistryEvent]DeadLetter
+	retention Retention
+}
+
+// NewDeadLetters returns an empty dead-letter list.
+func NewDeadLetters() *DeadLetters {
+	return &DeadLetters{
+		entries: map[types.RegistryEvent]DeadLetter{},
+	}
+}
+
+// SetRetention limits the dead letters kept from now on. It can be changed at any time.
+func (d *DeadLetters) SetRetention(r Retention) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.retention = r
+	d.prune(time.Now())
+}
+
+func (d *DeadLetters) prune(now time.Time) {
+	prune(d.entries, d.retention, now, func(l DeadLetter) time.Time { return l.Time })
+}
+
+// Add stores l, replacing an earlier dead letter of the same event.
+func (d *DeadLetters) Add(l DeadLetter) {
+	if l.Time.IsZero() {
+		l.Time = time.Now()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries[l.Event] = l
+	d.prune(time.Now())
+}
+
+// List returns all matching dead letters, the oldest first.
+func (d *DeadLetters) List(f Filter) []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.list(f)
+}
+
+// Take removes and returns all matching dead letters, the oldest first.
+func (d *DeadLetters) Take(f Filter) []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := d.list(f)
+	for _, l := range list {
+		delete(d.entries, l.Event)
+	}
+	return list
+}
+
+func (d *DeadLetters) list(f Filter) []DeadLetter {
+	d.prune(time.Now())
+	var list []DeadLetter
+	for _, l := range d.entries {
+		if f.matches(Result{Event: l.Event}) {
+			list = append(list, l)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Time.Before(list[j].Time)
+	})
+	return list
+}
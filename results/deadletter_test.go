@@ -0,0 +1,35 @@
+package results
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+var _ = Describe("DeadLetters", func() {
+	app := types.RegistryEvent{Registry: "registry", Repository: "app", Tag: "v1", Digest: "sha256:aaaa"}
+	other := types.RegistryEvent{Registry: "registry", Repository: "other", Tag: "v1", Digest: "sha256:bbbb"}
+
+	It("lists and takes matching dead letters", func() {
+		d := NewDeadLetters()
+		d.Add(DeadLetter{Event: app, Reason: "timeout", Attempts: 5})
+		d.Add(DeadLetter{Event: other, Reason: "timeout", Attempts: 5})
+
+		Expect(d.List(Filter{})).To(HaveLen(2))
+
+		taken := d.Take(Filter{Repository: "app"})
+		Expect(taken).To(HaveLen(1))
+		Expect(taken[0].Event).To(Equal(app))
+		Expect(d.List(Filter{})).To(ConsistOf(HaveField("Event", other)))
+	})
+
+	It("keeps the newest dead letters", func() {
+		d := NewDeadLetters()
+		d.SetRetention(Retention{MaxEntries: 1})
+		d.Add(DeadLetter{Event: app, Time: time.Now().Add(-time.Minute)})
+		d.Add(DeadLetter{Event: other, Time: time.Now()})
+		Expect(d.List(Filter{})).To(ConsistOf(HaveField("Event", other)))
+	})
+})
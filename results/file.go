@@ -0,0 +1,156 @@
+package results
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+)
+
+// compactThreshold is the number of lines the results file may grow beyond twice the number of results before it is compacted.
+const compactThreshold = 1000
+
+// FileStore is a MemoryStore that persists the results in a file, so they survive restarts.
+// The file holds one JSON encoded result per line. Results are appended as they are recorded,
+// and the file is rewritten with only the latest results when it is opened or grows too large.
+type FileStore struct {
+	*MemoryStore
+
+	path string
+	// mu guards file and lines, and keeps the order of the file in line with the memory store
+	mu    sync.Mutex
+	file  *os.File
+	lines int
+}
+
+// OpenFileStore loads the results of the file at path, which is created if it doesn't exist.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Result
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// the last line may be cut off by a crash, everything before it is intact
+			if !scanner.Scan() {
+				break
+			}
+			return fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		s.results[r.Event] = r
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the file with the results currently kept.
+func (s *FileStore) compact() error {
+	list, err := s.MemoryStore.List(context.Background(), Filter{})
+	if err != nil {
+		return err
+	}
+	// oldest first, like they were recorded
+	slices.Reverse(list)
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range list {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	s.lines = len(list)
+	return err
+}
+
+// SetRetention limits the results kept from now on and removes the dropped results from the file.
+func (s *FileStore) SetRetention(r Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.MemoryStore.SetRetention(r)
+	// the file keeps growing until the next compaction if this fails
+	_ = s.compact()
+}
+
+func (s *FileStore) Record(ctx context.Context, r Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.MemoryStore.Record(ctx, r); err != nil {
+		return err
+	}
+	// the memory store sets the time of the result, or drops it right away if it is beyond the retention
+	s.MemoryStore.mu.RLock()
+	r, ok := s.results[r.Event]
+	kept := len(s.results)
+	s.MemoryStore.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing results file: %w", err)
+	}
+	s.lines++
+	if s.lines > 2*kept+compactThreshold {
+		return s.compact()
+	}
+	return nil
+}
+
+// Close closes the results file. The store must not be used afterwards.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,75 @@
+package results
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+var _ = Describe("FileStore", func() {
+	app := types.RegistryEvent{Registry: "registry", Repository: "app", Tag: "v1", Digest: "sha256:aaaa"}
+	other := types.RegistryEvent{Registry: "registry", Repository: "other", Tag: "v1", Digest: "sha256:bbbb"}
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "results.jsonl")
+	})
+
+	It("keeps the results across restarts", func(ctx SpecContext) {
+		s, err := OpenFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Record(ctx, Result{Event: app, Status: StatusScheduled})).To(Succeed())
+		Expect(s.Record(ctx, Result{Event: app, Status: StatusScanned})).To(Succeed())
+		Expect(s.Record(ctx, Result{Event: other, Status: StatusSkipped})).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		s, err = OpenFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+		list, err := s.List(ctx, Filter{Repository: "app"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Status).To(Equal(StatusScanned))
+
+		// compacted to the latest result of each event
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(string(data), "\n")).To(Equal(2))
+	})
+
+	It("ignores a cut off last line", func(ctx SpecContext) {
+		Expect(os.WriteFile(path, []byte(`{"event":{"registry":"registry","repository":"app"},"status":"scheduled","time":"2024-01-01T00:00:00Z"}
+{"event":{"regis`), 0o600)).To(Succeed())
+		s, err := OpenFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+		list, err := s.List(ctx, Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+	})
+
+	It("fails on corrupted files", func() {
+		Expect(os.WriteFile(path, []byte("{\n{}\n"), 0o600)).To(Succeed())
+		_, err := OpenFileStore(path)
+		Expect(err).To(MatchError(ContainSubstring(":1:")))
+	})
+
+	It("removes results beyond the retention from the file", func(ctx SpecContext) {
+		s, err := OpenFileStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer s.Close()
+		Expect(s.Record(ctx, Result{Event: app, Status: StatusScheduled, Time: time.Now().Add(-2 * time.Hour)})).To(Succeed())
+		Expect(s.Record(ctx, Result{Event: other, Status: StatusScheduled})).To(Succeed())
+		s.SetRetention(Retention{MaxAge: time.Hour})
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring(`"app"`))
+		Expect(string(data)).To(ContainSubstring(`"other"`))
+	})
+})
@@ -0,0 +1,190 @@
+package results
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+// Status is the outcome of processing a registry event.
+type Status string
+
+const (
+	// StatusScheduled means a scan job was created for the event.
+	StatusScheduled Status = "scheduled"
+	// StatusSkipped means the event was intentionally not scanned.
+	StatusSkipped Status = "skipped"
+	// StatusDropped means the event failed with an error that retrying won't fix.
+	StatusDropped Status = "dropped"
+	// StatusFailed means the event failed and exhausted its retries. It is kept as a dead letter.
+	StatusFailed Status = "failed"
+	// StatusScanned means the scan job of the event completed.
+	StatusScanned Status = "scanned"
+	// StatusScanFailed means the scan job of the event failed.
+	StatusScanFailed Status = "scan_failed"
+)
+
+// Verdict of a scan gating images.
+type Verdict string
+
+const (
+	VerdictPass Verdict = "pass"
+	VerdictFail Verdict = "fail"
+)
+
+// Result records what happened to a registry event.
+type Result struct {
+	Event  types.RegistryEvent `json:"event"`
+	Status Status              `json:"status"`
+	Reason string              `json:"reason,omitempty"`
+	// Policy names the ScanPolicy or ClusterScanPolicy applied to the event, if any.
+	Policy string `json:"policy,omitempty"`
+	// Scanner is the backend that scanned the image.
+	Scanner string `json:"scanner,omitempty"`
+	// Vulnerabilities counts the findings of the scan by severity, if the scanner reported any.
+	Vulnerabilities scanner.Summary `json:"vulnerabilities,omitempty"`
+	// Verdict is set if the scanner tested the image against a severity threshold, like snyk container test.
+	Verdict Verdict `json:"verdict,omitempty"`
+	// Period is the start of the rescan period of the scan, if the image is rescanned periodically.
+	Period *time.Time `json:"period,omitempty"`
+	// SnykPolicy is the ConfigMap and digest of the snyk policy of the scan, like name@sha256:..., if it used one.
+	SnykPolicy string    `json:"snykPolicy,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Filter selects results. Empty fields match everything.
+type Filter struct {
+	Registry   string
+	Repository string
+	Digest     string
+	Tenant     string
+	Verdict    Verdict
+	// Advisory selects the rescans triggered by a vulnerability advisory.
+	Advisory string
+}
+
+func (f Filter) matches(r Result) bool {
+	return (f.Tenant == "" || f.Tenant == r.Event.Tenant) &&
+		(f.Registry == "" || f.Registry == r.Event.Registry) &&
+		(f.Repository == "" || f.Repository == r.Event.Repository) &&
+		(f.Digest == "" || f.Digest == string(r.Event.Digest)) &&
+		(f.Verdict == "" || f.Verdict == r.Verdict) &&
+		(f.Advisory == "" || f.Advisory == r.Event.Advisory)
+}
+
+// Store keeps the latest result of each registry event.
+type Store interface {
+	Record(ctx context.Context, r Result) error
+	List(ctx context.Context, f Filter) ([]Result, error)
+}
+
+// DefaultMaxEntries is the number of entries kept in memory if the Retention sets no limit.
+const DefaultMaxEntries = 10000
+
+// Retention limits how many entries are kept in memory.
+type Retention struct {
+	// MaxAge removes entries older than this. Zero means no limit.
+	MaxAge time.Duration
+	// MaxEntries removes the oldest entries beyond this number. Defaults to DefaultMaxEntries.
+	MaxEntries int
+}
+
+// MemoryStore is a Store that keeps results in memory.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	results   map[types.RegistryEvent]Result
+	retention Retention
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		results: map[types.RegistryEvent]Result{},
+	}
+}
+
+// SetRetention limits the results kept from now on. It can be changed at any time.
+func (s *MemoryStore) SetRetention(r Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = r
+	s.prune(time.Now())
+}
+
+func (s *MemoryStore) Record(_ context.Context, r Result) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[r.Event] = r
+	s.prune(time.Now())
+	return nil
+}
+
+func (s *MemoryStore) prune(now time.Time) {
+	prune(s.results, s.retention, now, func(r Result) time.Time { return r.Time })
+}
+
+// prune removes the entries of m exceeding the retention.
+func prune[V any](m map[types.RegistryEvent]V, retention Retention, now time.Time, timeOf func(V) time.Time) {
+	if retention.MaxAge > 0 {
+		for k, v := range m {
+			if now.Sub(timeOf(v)) > retention.MaxAge {
+				delete(m, k)
+			}
+		}
+	}
+	maxEntries := retention.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	if len(m) <= maxEntries {
+		return
+	}
+	if len(m) == maxEntries+1 {
+		// the usual case of adding to a full store only needs the oldest entry
+		var oldest types.RegistryEvent
+		first := true
+		for k, v := range m {
+			if first || timeOf(v).Before(timeOf(m[oldest])) {
+				oldest, first = k, false
+			}
+		}
+		delete(m, oldest)
+		return
+	}
+	keys := make([]types.RegistryEvent, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return timeOf(m[keys[i]]).Before(timeOf(m[keys[j]]))
+	})
+	for _, k := range keys[:len(keys)-maxEntries] {
+		delete(m, k)
+	}
+}
+
+// List returns all matching results, the most recent first.
+func (s *MemoryStore) List(_ context.Context, f Filter) ([]Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []Result
+	for _, r := range s.results {
+		if s.retention.MaxAge > 0 && time.Since(r.Time) > s.retention.MaxAge {
+			continue
+		}
+		if f.matches(r) {
+			list = append(list, r)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Time.After(list[j].Time)
+	})
+	return list, nil
+}
@@ -0,0 +1,74 @@
+package results
+
+import (
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+var _ = Describe("MemoryStore", func() {
+	app := types.RegistryEvent{Registry: "registry", Repository: "app", Tag: "v1", Digest: "sha256:aaaa"}
+	other := types.RegistryEvent{Registry: "registry", Repository: "other", Tag: "v1", Digest: "sha256:bbbb"}
+
+	It("keeps the latest result per event", func(ctx SpecContext) {
+		s := NewMemoryStore()
+		Expect(s.Record(ctx, Result{Event: app, Status: StatusScheduled})).To(Succeed())
+		Expect(s.Record(ctx, Result{Event: app, Status: StatusSkipped, Reason: "unsupported platform"})).To(Succeed())
+
+		list, err := s.List(ctx, Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Status).To(Equal(StatusSkipped))
+		Expect(list[0].Time).NotTo(BeZero())
+	})
+
+	It("filters and sorts results", func(ctx SpecContext) {
+		s := NewMemoryStore()
+		now := time.Now()
+		Expect(s.Record(ctx, Result{Event: app, Status: StatusScheduled, Time: now.Add(-time.Minute)})).To(Succeed())
+		Expect(s.Record(ctx, Result{Event: other, Status: StatusScheduled, Time: now})).To(Succeed())
+
+		list, err := s.List(ctx, Filter{Registry: "registry"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(2))
+		Expect(list[0].Event).To(Equal(other))
+
+		list, err = s.List(ctx, Filter{Repository: "app"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Event).To(Equal(app))
+	})
+
+	It("drops results beyond the retention", func(ctx SpecContext) {
+		s := NewMemoryStore()
+		s.SetRetention(Retention{MaxAge: time.Hour, MaxEntries: 1})
+		now := time.Now()
+		Expect(s.Record(ctx, Result{Event: app, Status: StatusScheduled, Time: now.Add(-2 * time.Hour)})).To(Succeed())
+		list, err := s.List(ctx, Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(BeEmpty())
+
+		Expect(s.Record(ctx, Result{Event: app, Status: StatusScheduled, Time: now.Add(-time.Minute)})).To(Succeed())
+		Expect(s.Record(ctx, Result{Event: other, Status: StatusScheduled, Time: now})).To(Succeed())
+		list, err = s.List(ctx, Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Event).To(Equal(other))
+	})
+
+	It("keeps DefaultMaxEntries results without a retention", func(ctx SpecContext) {
+		s := NewMemoryStore()
+		start := time.Now().Add(-time.Hour)
+		for i := range DefaultMaxEntries + 2 {
+			e := types.RegistryEvent{Registry: "my-registry", Repository: "app", Tag: strconv.Itoa(i)}
+			Expect(s.Record(ctx, Result{Event: e, Status: StatusScheduled, Time: start.Add(time.Duration(i) * time.Millisecond)})).To(Succeed())
+		}
+		list, err := s.List(ctx, Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(DefaultMaxEntries))
+		Expect(list[len(list)-1].Event.Tag).To(Equal("2"))
+	})
+})
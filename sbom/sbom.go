@@ -0,0 +1,165 @@
+// Package sbom keeps the software bills of materials of scanned images by digest.
+package sbom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"k8s.io/utils/lru"
+)
+
+// DefaultMemoryDigests is the number of digests whose SBOMs are kept by a MemoryStore by default.
+const DefaultMemoryDigests = 1000
+
+// ErrNotFound is returned for SBOMs that are not stored.
+var ErrNotFound = errors.New("sbom not found")
+
+// Store keeps the SBOMs of images by digest and format.
+type Store interface {
+	Put(ctx context.Context, d digest.Digest, format scanner.SBOMFormat, doc []byte) error
+	// Get returns ErrNotFound if there is no SBOM of d in format.
+	Get(ctx context.Context, d digest.Digest, format scanner.SBOMFormat) ([]byte, error)
+	// Formats lists the formats stored for d in the order of scanner.SBOMFormats.
+	Formats(ctx context.Context, d digest.Digest) ([]scanner.SBOMFormat, error)
+}
+
+// MemoryStore keeps the SBOMs of the most recently stored digests in memory.
+type MemoryStore struct {
+	// mu makes adding a format to the SBOMs of a digest atomic
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+// NewMemoryStore returns a MemoryStore for the SBOMs of up to maxDigests digests, DefaultMemoryDigests if not positive.
+func NewMemoryStore(maxDigests int) *MemoryStore {
+	if maxDigests <= 0 {
+		maxDigests = DefaultMemoryDigests
+	}
+	return &MemoryStore{cache: lru.New(maxDigests)}
+}
+
+func (s *MemoryStore) Put(_ context.Context, d digest.Digest, format scanner.SBOMFormat, doc []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	docs := map[scanner.SBOMFormat][]byte{}
+	if cached, ok := s.cache.Get(d); ok {
+		docs = cached.(map[scanner.SBOMFormat][]byte)
+	}
+	docs[format] = slices.Clone(doc)
+	s.cache.Add(d, docs)
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, d digest.Digest, format scanner.SBOMFormat) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cached, ok := s.cache.Get(d); ok {
+		if doc, ok := cached.(map[scanner.SBOMFormat][]byte)[format]; ok {
+			return doc, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) Formats(_ context.Context, d digest.Digest) ([]scanner.SBOMFormat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var formats []scanner.SBOMFormat
+	if cached, ok := s.cache.Get(d); ok {
+		docs := cached.(map[scanner.SBOMFormat][]byte)
+		for _, format := range scanner.SBOMFormats {
+			if _, ok := docs[format]; ok {
+				formats = append(formats, format)
+			}
+		}
+	}
+	return formats, nil
+}
+
+// DirStore keeps SBOMs as files <dir>/<algorithm>/<hex>/<format>.json, so they survive restarts.
+// SBOMs of a digest never change, so files are never removed.
+type DirStore struct {
+	dir string
+}
+
+// OpenDirStore returns a DirStore in dir, which is created if it doesn't exist.
+func OpenDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+func (s *DirStore) path(d digest.Digest, format scanner.SBOMFormat) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, d.Algorithm().String(), d.Encoded(), string(format)+".json"), nil
+}
+
+// Put writes the file atomically, readers never see a partial SBOM.
+func (s *DirStore) Put(_ context.Context, d digest.Digest, format scanner.SBOMFormat, doc []byte) error {
+	path, err := s.path(d, format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sbom-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(doc); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing sbom: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *DirStore) Get(_ context.Context, d digest.Digest, format scanner.SBOMFormat) ([]byte, error) {
+	path, err := s.path(d, format)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	doc, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return doc, err
+}
+
+func (s *DirStore) Formats(_ context.Context, d digest.Digest) ([]scanner.SBOMFormat, error) {
+	path, err := s.path(d, scanner.SBOMCycloneDX)
+	if err != nil {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var formats []scanner.SBOMFormat
+	for _, format := range scanner.SBOMFormats {
+		if slices.ContainsFunc(entries, func(e os.DirEntry) bool {
+			return strings.TrimSuffix(e.Name(), ".json") == string(format)
+		}) {
+			formats = append(formats, format)
+		}
+	}
+	return formats, nil
+}
@@ -0,0 +1,60 @@
+package sbom
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+)
+
+var _ = Describe("Store", func() {
+	const imageDigest digest.Digest = "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"
+
+	DescribeTable("should keep SBOMs by digest and format", func(ctx SpecContext, newStore func() Store) {
+		s := newStore()
+		Expect(s.Formats(ctx, imageDigest)).To(BeEmpty())
+		_, err := s.Get(ctx, imageDigest, scanner.SBOMCycloneDX)
+		Expect(err).To(MatchError(ErrNotFound))
+
+		Expect(s.Put(ctx, imageDigest, scanner.SBOMSPDX, []byte(`{"spdxVersion":"SPDX-2.3"}`))).To(Succeed())
+		Expect(s.Put(ctx, imageDigest, scanner.SBOMCycloneDX, []byte(`{"bomFormat":"CycloneDX"}`))).To(Succeed())
+		Expect(s.Formats(ctx, imageDigest)).To(Equal([]scanner.SBOMFormat{scanner.SBOMCycloneDX, scanner.SBOMSPDX}))
+		Expect(s.Get(ctx, imageDigest, scanner.SBOMSPDX)).To(MatchJSON(`{"spdxVersion":"SPDX-2.3"}`))
+	},
+		Entry("in memory", func() Store { return NewMemoryStore(0) }),
+		Entry("in a directory", func() Store {
+			s, err := OpenDirStore(filepath.Join(GinkgoT().TempDir(), "sboms"))
+			Expect(err).NotTo(HaveOccurred())
+			return s
+		}),
+	)
+
+	It("should keep the SBOMs of the most recent digests in memory", func(ctx SpecContext) {
+		s := NewMemoryStore(1)
+		other := digest.FromString("other")
+		Expect(s.Put(ctx, imageDigest, scanner.SBOMCycloneDX, []byte(`{}`))).To(Succeed())
+		Expect(s.Put(ctx, other, scanner.SBOMCycloneDX, []byte(`{}`))).To(Succeed())
+		Expect(s.Formats(ctx, imageDigest)).To(BeEmpty())
+		Expect(s.Formats(ctx, other)).To(HaveLen(1))
+	})
+
+	It("should store files by digest and survive reopening", func(ctx SpecContext) {
+		dir := GinkgoT().TempDir()
+		s, err := OpenDirStore(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Put(ctx, imageDigest, scanner.SBOMCycloneDX, []byte(`{"bomFormat":"CycloneDX"}`))).To(Succeed())
+		Expect(filepath.Join(dir, "sha256", imageDigest.Encoded(), "cyclonedx.json")).To(BeARegularFile())
+
+		entries, err := os.ReadDir(filepath.Join(dir, "sha256", imageDigest.Encoded()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+
+		reopened, err := OpenDirStore(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.Get(ctx, imageDigest, scanner.SBOMCycloneDX)).To(MatchJSON(`{"bomFormat":"CycloneDX"}`))
+		Expect(s.Put(ctx, "sha256:../../etc", scanner.SBOMCycloneDX, nil)).NotTo(Succeed())
+	})
+})
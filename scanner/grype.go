@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultGrypeImage is the image of grype.
+const DefaultGrypeImage = "anchore/grype:v0.84.0"
+
+// Grype scans images with grype. It needs no license.
+type Grype struct {
+	Options
+}
+
+func (s *Grype) Name() string {
+	return BackendGrype
+}
+
+func (s *Grype) Workload(t Target) Workload {
+	args := []string{"registry:" + t.Event.Reference(), "--output=json", "--platform=" + platformString(t)}
+	args = append(args, s.Args...)
+
+	var env []corev1.EnvVar
+	if t.Profile.CredentialsSecret != "" {
+		env = append(env, corev1.EnvVar{Name: "GRYPE_REGISTRY_AUTH_AUTHORITY", Value: t.Event.Registry})
+		env = append(env, credentialsEnv(t.Profile, "GRYPE_REGISTRY_AUTH_USERNAME", "GRYPE_REGISTRY_AUTH_PASSWORD")...)
+	}
+	switch t.Profile.TLSMode {
+	case registry.TLSModeSkipVerify:
+		env = append(env, corev1.EnvVar{Name: "GRYPE_REGISTRY_INSECURE_SKIP_TLS_VERIFY", Value: "true"})
+	case registry.TLSModePlainHTTP:
+		env = append(env, corev1.EnvVar{Name: "GRYPE_REGISTRY_INSECURE_USE_HTTP", Value: "true"})
+	}
+	env = append(env, proxyEnv(t.Profile)...)
+	if file := caBundleFile(t.Profile); file != "" {
+		env = append(env, corev1.EnvVar{Name: "GRYPE_REGISTRY_CA_CERT", Value: file})
+	}
+
+	image := s.Image
+	if image == "" {
+		image = DefaultGrypeImage
+	}
+	return Workload{
+		Container: corev1.Container{
+			Name: ContainerName,
+			// the entrypoint of the image is grype
+			Image:        image,
+			Args:         args,
+			Env:          env,
+			VolumeMounts: caBundleVolumeMounts(t.Profile),
+		},
+		Volumes: caBundleVolumes(t.Profile),
+	}
+}
+
+type grypeReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID       string `json:"id"`
+			Severity string `json:"severity"`
+			Fix      struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+// ParseFindings parses the JSON output of grype.
+func (s *Grype) ParseFindings(output []byte) (*Findings, error) {
+	var raw grypeReport
+	if found, err := decodeJSON(output, &raw); !found || err != nil {
+		return nil, err
+	}
+	r := &Findings{Scanner: BackendGrype}
+	for _, m := range raw.Matches {
+		r.Vulnerabilities = append(r.Vulnerabilities, Vulnerability{
+			ID:       m.Vulnerability.ID,
+			Package:  m.Artifact.Name,
+			Version:  m.Artifact.Version,
+			Severity: ParseSeverity(m.Vulnerability.Severity),
+			FixedIn:  m.Vulnerability.Fix.Versions,
+		})
+	}
+	return r, nil
+}
@@ -0,0 +1,28 @@
+package scanner
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Grype", func() {
+	It("should scan the image from the registry with the settings of the profile", func() {
+		w := (&Grype{}).Workload(targetWithProfile(registry.Profile{
+			TLSMode:           registry.TLSModePlainHTTP,
+			CredentialsSecret: "creds",
+		}))
+		Expect(w.Container.Args[0]).To(Equal("registry:" + testTarget.Event.Reference()))
+		Expect(w.Container.Env).To(ContainElements(
+			corev1.EnvVar{Name: "GRYPE_REGISTRY_AUTH_AUTHORITY", Value: "internal"},
+			corev1.EnvVar{Name: "GRYPE_REGISTRY_INSECURE_USE_HTTP", Value: "true"},
+		))
+	})
+
+	It("should parse the JSON report", func() {
+		r, err := (&Grype{}).ParseFindings([]byte(`{"matches":[{"vulnerability":{"id":"CVE-2023-45853","severity":"Negligible","fix":{"versions":[]}},"artifact":{"name":"zlib1g","version":"1:1.2.13"}}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Vulnerabilities).To(ConsistOf(HaveField("Severity", SeverityLow)))
+	})
+})
@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"cmp"
+
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// PrefetchContainerName is the name of the init container copying the image.
+	PrefetchContainerName = "prefetch"
+	// PrefetchCommand is the subcommand of registry-snyk-scan run by the prefetch container.
+	PrefetchCommand = "prefetch"
+	// DefaultPrefetchBinary is the path of registry-snyk-scan in the image of the controller, which is built with ko.
+	DefaultPrefetchBinary = "/ko-app/registry-snyk-scan"
+
+	prefetchVolumeName = "image"
+	prefetchMountPath  = "/prefetch"
+)
+
+// Prefetch copies the image by digest into a volume shared with the scan containers before the scan.
+// The copy is made by `registry-snyk-scan prefetch` with the credentials, TLS settings and proxy of the
+// registry profile, so the scanner reads the copy and needs no registry access. Only snyk supports it.
+type Prefetch struct {
+	// Image contains the registry-snyk-scan binary, usually the image of the controller.
+	Image string `json:"image"`
+	// Binary is the path of registry-snyk-scan in Image. Defaults to DefaultPrefetchBinary.
+	Binary string `json:"binary,omitempty"`
+	// Format defaults to registry.FetchLayout.
+	Format registry.FetchFormat `json:"format,omitempty"`
+	// SizeLimit of the volume holding the copy. Defaults to DefaultPrefetchSizeLimit.
+	SizeLimit *resource.Quantity `json:"sizeLimit,omitempty"`
+}
+
+// DefaultPrefetchSizeLimit is the size limit of the volume holding the copy by default.
+var DefaultPrefetchSizeLimit = resource.MustParse("10Gi")
+
+func (p *Prefetch) path() string {
+	if p.Format == registry.FetchArchive {
+		return prefetchMountPath + "/image.tar"
+	}
+	return prefetchMountPath + "/image"
+}
+
+// source is the image argument of scanners reading the copy.
+func (p *Prefetch) source() string {
+	if p.Format == registry.FetchArchive {
+		return "oci-archive:" + p.path()
+	}
+	return "oci-dir:" + p.path()
+}
+
+func (p *Prefetch) volumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{Name: prefetchVolumeName, MountPath: prefetchMountPath}
+}
+
+// volume is an emptyDir with a size limit, so that large images can't fill the ephemeral storage of the node.
+func (p *Prefetch) volume() corev1.Volume {
+	sizeLimit := DefaultPrefetchSizeLimit.DeepCopy()
+	if p.SizeLimit != nil {
+		sizeLimit = p.SizeLimit.DeepCopy()
+	}
+	return corev1.Volume{
+		Name:         prefetchVolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: &sizeLimit}},
+	}
+}
+
+// container copies the image of t into the volume. The credentials are passed in the environment.
+func (p *Prefetch) container(t Target) corev1.Container {
+	format := p.Format
+	if format == "" {
+		format = registry.FetchLayout
+	}
+	args := []string{
+		PrefetchCommand,
+		"--image=" + t.Event.Reference(),
+		"--platform=" + platformString(t),
+		"--output=" + p.path(),
+		"--format=" + string(format),
+	}
+	if t.Profile.TLSMode != "" {
+		args = append(args, "--tls-mode="+string(t.Profile.TLSMode))
+	}
+	if file := caBundleFile(t.Profile); file != "" {
+		args = append(args, "--ca-file="+file)
+	}
+	if t.Profile.Proxy != "" {
+		args = append(args, "--proxy="+t.Profile.Proxy)
+	}
+	return corev1.Container{
+		Name:         PrefetchContainerName,
+		Image:        p.Image,
+		Command:      []string{cmp.Or(p.Binary, DefaultPrefetchBinary)},
+		Args:         args,
+		Env:          credentialsEnv(t.Profile, "REGISTRY_USERNAME", "REGISTRY_PASSWORD"),
+		VolumeMounts: append(caBundleVolumeMounts(t.Profile), p.volumeMount()),
+	}
+}
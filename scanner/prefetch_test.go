@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("Prefetch", func() {
+	profile := registry.Profile{
+		TLSMode:           registry.TLSModeSkipVerify,
+		CredentialsSecret: "creds",
+		Proxy:             "http://proxy:3128",
+		CABundle: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "registry-ca"},
+			Key:                  "ca.crt",
+		},
+	}
+
+	It("should copy the image with the registry profile before the scan", func() {
+		w := (&Snyk{Options: Options{
+			Snyk:     SnykOptions{Mode: SnykMonitorAndTest},
+			Prefetch: &Prefetch{Image: "registry-snyk-scan:v1"},
+		}}).Workload(targetWithProfile(profile))
+
+		Expect(w.InitContainers).To(HaveLen(2))
+		prefetch := w.InitContainers[0]
+		Expect(prefetch.Name).To(Equal(PrefetchContainerName))
+		Expect(prefetch.Command).To(Equal([]string{DefaultPrefetchBinary}))
+		Expect(prefetch.Args).To(Equal([]string{
+			"prefetch",
+			"--image=" + testTarget.Event.Reference(),
+			"--platform=linux/amd64",
+			"--output=/prefetch/image",
+			"--format=layout",
+			"--tls-mode=skip-verify",
+			"--ca-file=/etc/registry-ca/ca.crt",
+			"--proxy=http://proxy:3128",
+		}))
+		Expect(prefetch.Env).To(ConsistOf(HaveField("Name", "REGISTRY_USERNAME"), HaveField("Name", "REGISTRY_PASSWORD")))
+
+		for _, c := range []corev1.Container{w.InitContainers[1], w.Container} {
+			Expect(c.Args[len(c.Args)-1]).To(Equal("oci-dir:/prefetch/image"))
+			Expect(c.Args).NotTo(ContainElement("--insecure"))
+			Expect(c.Env).NotTo(ContainElement(HaveField("Name", HaveSuffix("REGISTRY_PASSWORD"))))
+			Expect(c.VolumeMounts).To(ConsistOf(HaveField("MountPath", "/prefetch")))
+		}
+		Expect(w.InitContainers[1].Args).To(ContainElement("--project-name=internal/app"))
+		Expect(w.Volumes).To(ContainElement(HaveField("EmptyDir.SizeLimit", HaveValue(Equal(DefaultPrefetchSizeLimit)))))
+	})
+
+	It("should use the configured binary and size limit", func() {
+		sizeLimit := resource.MustParse("2Gi")
+		w := (&Snyk{Options: Options{
+			Prefetch: &Prefetch{Image: "registry-snyk-scan:v1", Binary: "/usr/local/bin/registry-snyk-scan", SizeLimit: &sizeLimit},
+		}}).Workload(testTarget)
+		Expect(w.InitContainers[0].Command).To(Equal([]string{"/usr/local/bin/registry-snyk-scan"}))
+		Expect(w.Volumes).To(ContainElement(HaveField("EmptyDir.SizeLimit", HaveValue(Equal(sizeLimit)))))
+	})
+
+	It("should scan an archive", func() {
+		w := (&Snyk{Options: Options{
+			Snyk:     SnykOptions{Mode: SnykTest},
+			Prefetch: &Prefetch{Image: "registry-snyk-scan:v1", Format: registry.FetchArchive},
+		}}).Workload(testTarget)
+		Expect(w.InitContainers[0].Args).To(ContainElements("--output=/prefetch/image.tar", "--format=archive"))
+		Expect(w.Container.Args[len(w.Container.Args)-1]).To(Equal("oci-archive:/prefetch/image.tar"))
+	})
+})
@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"path"
+	"strings"
+
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	caBundleVolumeName = "registry-ca"
+	caBundleMountPath  = "/etc/registry-ca"
+)
+
+// caBundleFile is the path of the CA bundle of profile in the scan container, empty if there is none.
+func caBundleFile(profile registry.Profile) string {
+	if profile.CABundle == nil {
+		return ""
+	}
+	return path.Join(caBundleMountPath, profile.CABundle.Key)
+}
+
+// credentialsEnv passes the credentials secret of profile as the given variables.
+func credentialsEnv(profile registry.Profile, usernameVar, passwordVar string) []corev1.EnvVar {
+	if profile.CredentialsSecret == "" {
+		return nil
+	}
+	return []corev1.EnvVar{
+		secretEnvVar(usernameVar, profile.CredentialsSecret, registry.CredentialsUsernameKey),
+		secretEnvVar(passwordVar, profile.CredentialsSecret, registry.CredentialsPasswordKey),
+	}
+}
+
+// proxyEnv passes the proxy of profile. The hosts in noProxy, like the API of the scanner, are reached directly.
+func proxyEnv(profile registry.Profile, noProxy ...string) []corev1.EnvVar {
+	if profile.Proxy == "" {
+		return nil
+	}
+	env := []corev1.EnvVar{
+		{Name: "HTTP_PROXY", Value: profile.Proxy},
+		{Name: "HTTPS_PROXY", Value: profile.Proxy},
+	}
+	if len(noProxy) > 0 {
+		env = append(env, corev1.EnvVar{Name: "NO_PROXY", Value: strings.Join(noProxy, ",")})
+	}
+	return env
+}
+
+func caBundleVolumes(profile registry.Profile) []corev1.Volume {
+	if profile.CABundle == nil {
+		return nil
+	}
+	return []corev1.Volume{
+		{
+			Name: caBundleVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: profile.CABundle.LocalObjectReference,
+				},
+			},
+		},
+	}
+}
+
+func caBundleVolumeMounts(profile registry.Profile) []corev1.VolumeMount {
+	if profile.CABundle == nil {
+		return nil
+	}
+	return []corev1.VolumeMount{
+		{
+			Name:      caBundleVolumeName,
+			MountPath: caBundleMountPath,
+			ReadOnly:  true,
+		},
+	}
+}
+
+func secretEnvVar(name, secretName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				Key: key,
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: secretName,
+				},
+			},
+		},
+	}
+}
+
+func platformString(t Target) string {
+	s := t.Platform.OS + "/" + t.Platform.Architecture
+	if t.Platform.Variant != "" {
+		s += "/" + t.Platform.Variant
+	}
+	return s
+}
@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SBOMFormat is the format of a software bill of materials.
+type SBOMFormat string
+
+const (
+	// SBOMCycloneDX is CycloneDX JSON.
+	SBOMCycloneDX SBOMFormat = "cyclonedx"
+	// SBOMSPDX is SPDX JSON.
+	SBOMSPDX SBOMFormat = "spdx"
+)
+
+// SBOMFormats lists all formats.
+var SBOMFormats = []SBOMFormat{SBOMCycloneDX, SBOMSPDX}
+
+// sbomContainerPrefix is followed by the format in the names of the SBOM init containers.
+const sbomContainerPrefix = "sbom-"
+
+// SBOMContainerName returns the name of the init container printing the SBOM in format.
+func SBOMContainerName(format SBOMFormat) string {
+	return sbomContainerPrefix + string(format)
+}
+
+// MediaType is the media type of SBOMs in format.
+func (f SBOMFormat) MediaType() string {
+	switch f {
+	case SBOMCycloneDX:
+		return "application/vnd.cyclonedx+json"
+	case SBOMSPDX:
+		return "application/spdx+json"
+	default:
+		return "application/json"
+	}
+}
+
+// snykFormat is the --format of snyk container sbom.
+func (f SBOMFormat) snykFormat() string {
+	switch f {
+	case SBOMCycloneDX:
+		return "cyclonedx1.4+json"
+	case SBOMSPDX:
+		return "spdx2.3+json"
+	default:
+		return string(f)
+	}
+}
+
+// SBOM generates software bills of materials of the scanned images with init containers, one per format,
+// which print them to their output. Only snyk supports it.
+type SBOM struct {
+	// Formats defaults to SBOMCycloneDX.
+	Formats []SBOMFormat `json:"formats,omitempty"`
+}
+
+func (s *SBOM) formats() []SBOMFormat {
+	if len(s.Formats) == 0 {
+		return []SBOMFormat{SBOMCycloneDX}
+	}
+	return s.Formats
+}
+
+// sbomContainers print the SBOMs of the image with snyk container sbom, based on the scan container c.
+func (s *Snyk) sbomContainers(t Target, c corev1.Container) []corev1.Container {
+	if s.SBOM == nil {
+		return nil
+	}
+	var containers []corev1.Container
+	for _, format := range s.SBOM.formats() {
+		args := []string{
+			"container",
+			"sbom",
+			"--format=" + format.snykFormat(),
+			"--org=$(SNYK_ORG)",
+		}
+		args = append(args, s.registryArgs(t)...)
+		args = append(args, "--platform="+platformString(t))
+		if s.Snyk.ExcludeAppVulns {
+			args = append(args, "--exclude-app-vulns")
+		}
+		args = append(args, s.source(t))
+
+		sbom := *c.DeepCopy()
+		sbom.Name = SBOMContainerName(format)
+		sbom.Command = []string{"snyk"}
+		sbom.Args = args
+		containers = append(containers, sbom)
+	}
+	return containers
+}
+
+// ExtractJSON returns the first JSON document of output, like the report of a scan or an SBOM
+// printed between log lines. It returns false if output contains none.
+func ExtractJSON(output []byte) ([]byte, bool) {
+	var raw json.RawMessage
+	if found, err := decodeJSON(output, &raw); !found || err != nil {
+		return nil, false
+	}
+	return raw, true
+}
+
+// ParseSBOMContainerName returns the format of an SBOM init container, false for other containers.
+func ParseSBOMContainerName(name string) (SBOMFormat, bool) {
+	format, ok := strings.CutPrefix(name, sbomContainerPrefix)
+	if !ok || !slices.Contains(SBOMFormats, SBOMFormat(format)) {
+		return "", false
+	}
+	return SBOMFormat(format), true
+}
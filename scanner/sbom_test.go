@@ -0,0 +1,68 @@
+package scanner
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+)
+
+var _ = Describe("SBOM", func() {
+	It("should print the SBOM before the scan", func() {
+		w := (&Snyk{Options: Options{
+			Snyk: SnykOptions{Mode: SnykTest},
+			SBOM: &SBOM{},
+		}}).Workload(targetWithProfile(registry.Profile{CredentialsSecret: "creds"}))
+
+		Expect(w.InitContainers).To(HaveLen(1))
+		sbom := w.InitContainers[0]
+		Expect(sbom.Name).To(Equal("sbom-cyclonedx"))
+		Expect(sbom.Command).To(Equal([]string{"snyk"}))
+		Expect(sbom.Args).To(Equal([]string{
+			"container",
+			"sbom",
+			"--format=cyclonedx1.4+json",
+			"--org=$(SNYK_ORG)",
+			"--platform=linux/amd64",
+			testTarget.Event.Reference(),
+		}))
+		Expect(sbom.Env).To(Equal(w.Container.Env))
+	})
+
+	It("should read the prefetched copy", func() {
+		w := (&Snyk{Options: Options{
+			Prefetch: &Prefetch{Image: "registry-snyk-scan:v1"},
+			SBOM:     &SBOM{Formats: []SBOMFormat{SBOMCycloneDX}},
+		}}).Workload(testTarget)
+		Expect(w.InitContainers).To(HaveLen(2))
+		Expect(w.InitContainers[0].Name).To(Equal(PrefetchContainerName))
+		Expect(w.InitContainers[1].Args[len(w.InitContainers[1].Args)-1]).To(Equal("oci-dir:/prefetch/image"))
+	})
+
+	It("should print a container per format", func() {
+		w := (&Snyk{Options: Options{SBOM: &SBOM{Formats: []SBOMFormat{SBOMCycloneDX, SBOMSPDX}}}}).Workload(testTarget)
+		Expect(w.InitContainers).To(HaveLen(2))
+		Expect(w.InitContainers[1].Name).To(Equal("sbom-spdx"))
+		Expect(w.InitContainers[1].Args).To(ContainElement("--format=spdx2.3+json"))
+	})
+
+	It("should only be generated by snyk", func() {
+		w := (&Trivy{Options: Options{SBOM: &SBOM{}}}).Workload(testTarget)
+		Expect(w.InitContainers).To(BeEmpty())
+	})
+
+	It("should parse the names of SBOM containers", func() {
+		format, ok := ParseSBOMContainerName(SBOMContainerName(SBOMCycloneDX))
+		Expect(ok).To(BeTrue())
+		Expect(format).To(Equal(SBOMCycloneDX))
+		_, ok = ParseSBOMContainerName(PrefetchContainerName)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should extract the JSON document between log lines", func() {
+		doc, ok := ExtractJSON([]byte("Fetching image\n{\"bomFormat\": \"CycloneDX\"}\n"))
+		Expect(ok).To(BeTrue())
+		Expect(doc).To(MatchJSON(`{"bomFormat":"CycloneDX"}`))
+		_, ok = ExtractJSON([]byte("Monitoring image\n"))
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,163 @@
+// Package scanner builds the workloads that scan images and parses their reports.
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Backends that can be selected with New.
+const (
+	BackendSnyk  = "snyk"
+	BackendTrivy = "trivy"
+	BackendGrype = "grype"
+)
+
+// Backends lists all supported backends.
+var Backends = []string{BackendSnyk, BackendTrivy, BackendGrype}
+
+// ContainerName is the name of the scan container in the workload.
+const ContainerName = "scan"
+
+// Scanner builds the workload that scans an image and parses the report it prints.
+type Scanner interface {
+	// Name of the backend.
+	Name() string
+	// Workload returns the scan container and the volumes it needs for t.
+	Workload(t Target) Workload
+	// ParseFindings parses the output of the scan container. It returns nil if the output contains no findings.
+	ParseFindings(output []byte) (*Findings, error)
+}
+
+// Options configure a backend. Unset fields use the defaults of the backend.
+type Options struct {
+	// Image of the scanner.
+	Image string
+	// Args are added to the arguments set by the backend, before the image reference.
+	Args []string
+	// Org is the Snyk organization, instead of SNYK_ORG of the token secret. Only used by snyk.
+	Org string
+	// TokenSecret is the name of the secret with the keys SNYK_TOKEN and SNYK_ORG. Only used by snyk.
+	TokenSecret string
+	// Snyk selects the snyk commands and their gating options. Only used by snyk.
+	Snyk SnykOptions
+	// Prefetch copies the image before the scan, if set. Only used by snyk.
+	Prefetch *Prefetch
+	// SBOM generates bills of materials of the images before the scan, if set. Only used by snyk.
+	SBOM *SBOM
+}
+
+// New returns the backend with the given name, an empty name selects snyk.
+func New(backend string, o Options) (Scanner, error) {
+	switch backend {
+	case "", BackendSnyk:
+		return &Snyk{Options: o}, nil
+	case BackendTrivy:
+		return &Trivy{Options: o}, nil
+	case BackendGrype:
+		return &Grype{Options: o}, nil
+	default:
+		return nil, fmt.Errorf("unknown scanner backend %q, expected one of %s", backend, strings.Join(Backends, ", "))
+	}
+}
+
+// Target is the image to scan.
+type Target struct {
+	Event    types.RegistryEvent
+	Platform imagev1.Platform
+	// Profile is the connection profile of the registry of the image.
+	Profile registry.Profile
+}
+
+// Workload is the scan container and the volumes it mounts.
+type Workload struct {
+	Container corev1.Container
+	// InitContainers run before the scan container, their output is not parsed.
+	InitContainers []corev1.Container
+	Volumes        []corev1.Volume
+}
+
+// Severity of a vulnerability.
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical"
+	SeverityHigh     Severity = "high"
+	SeverityMedium   Severity = "medium"
+	SeverityLow      Severity = "low"
+	SeverityUnknown  Severity = "unknown"
+)
+
+// Severities are ordered from the most to the least severe.
+var Severities = []Severity{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityUnknown}
+
+// ParseSeverity normalizes the severity names of the backends.
+func ParseSeverity(s string) Severity {
+	switch sev := Severity(strings.ToLower(s)); sev {
+	case SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow:
+		return sev
+	case "negligible":
+		return SeverityLow
+	default:
+		return SeverityUnknown
+	}
+}
+
+// AtLeast reports whether s is as severe as threshold or more.
+func (s Severity) AtLeast(threshold Severity) bool {
+	return slices.Index(Severities, s) <= slices.Index(Severities, threshold)
+}
+
+// Vulnerability found in a package of an image.
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Package  string   `json:"package"`
+	Version  string   `json:"version"`
+	Severity Severity `json:"severity"`
+	// FixedIn lists the versions of the package fixing the vulnerability, if any.
+	FixedIn []string `json:"fixedIn,omitempty"`
+}
+
+// Findings are the parsed output of a scan.
+type Findings struct {
+	Scanner         string          `json:"scanner"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+	// Passed is the verdict of scanners gating images, nil if the scanner gave none.
+	Passed *bool `json:"passed,omitempty"`
+}
+
+// Summary counts the vulnerabilities by severity.
+type Summary map[Severity]int
+
+// Summary counts the vulnerabilities of r by severity.
+func (r *Findings) Summary() Summary {
+	s := Summary{}
+	for _, v := range r.Vulnerabilities {
+		s[v.Severity]++
+	}
+	return s
+}
+
+// decodeJSON decodes the first JSON object of output into v. Log lines before the object are skipped.
+// It returns false if output contains no JSON object.
+func decodeJSON(output []byte, v any) (bool, error) {
+	for len(output) > 0 {
+		line, rest, _ := bytes.Cut(output, []byte("\n"))
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) {
+			if err := json.NewDecoder(bytes.NewReader(output)).Decode(v); err != nil {
+				return true, fmt.Errorf("decoding report: %w", err)
+			}
+			return true, nil
+		}
+		output = rest
+	}
+	return false, nil
+}
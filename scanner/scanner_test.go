@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+)
+
+var testTarget = Target{
+	Event: types.RegistryEvent{
+		Registry:   "internal",
+		Repository: "app",
+		Tag:        "v1",
+		Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+	},
+	Platform: imagev1.Platform{OS: "linux", Architecture: "amd64"},
+}
+
+func targetWithProfile(p registry.Profile) Target {
+	t := testTarget
+	t.Profile = p
+	return t
+}
+
+var _ = Describe("New", func() {
+	It("should default to snyk", func() {
+		s, err := New("", Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Name()).To(Equal(BackendSnyk))
+	})
+
+	It("should reject unknown backends", func() {
+		_, err := New("clair", Options{})
+		Expect(err).To(MatchError(ContainSubstring(`unknown scanner backend "clair"`)))
+	})
+})
+
+var _ = Describe("Severity", func() {
+	DescribeTable("ParseSeverity", func(in string, expected Severity) {
+		Expect(ParseSeverity(in)).To(Equal(expected))
+	},
+		Entry("trivy", "CRITICAL", SeverityCritical),
+		Entry("grype", "Medium", SeverityMedium),
+		Entry("negligible is low", "Negligible", SeverityLow),
+		Entry("others are unknown", "", SeverityUnknown),
+	)
+
+	It("AtLeast should compare severities", func() {
+		Expect(SeverityCritical.AtLeast(SeverityHigh)).To(BeTrue())
+		Expect(SeverityHigh.AtLeast(SeverityHigh)).To(BeTrue())
+		Expect(SeverityLow.AtLeast(SeverityHigh)).To(BeFalse())
+	})
+})
+
+var _ = Describe("decodeJSON", func() {
+	It("should skip log lines before the report", func() {
+		var v struct{ OK bool }
+		found, err := decodeJSON([]byte("INFO downloading db\n{\n  \"OK\": true\n}\n"), &v)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(v.OK).To(BeTrue())
+	})
+
+	It("should report output without JSON", func() {
+		found, err := decodeJSON([]byte("Monitoring internal/app...\n"), &struct{}{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+	})
+})
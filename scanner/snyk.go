@@ -0,0 +1,300 @@
+package scanner
+
+import (
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultSnykImage is the image of the snyk CLI.
+	DefaultSnykImage = "snyk/snyk:linux"
+	// DefaultSnykTokenSecret is the name of the secret with the keys SNYK_TOKEN and SNYK_ORG.
+	DefaultSnykTokenSecret = "snyk-token"
+	// DefaultSnykPolicyKey is the key of a policy ConfigMap holding the .snyk file if the reference has none.
+	DefaultSnykPolicyKey = ".snyk"
+
+	// snykHosts are the domains of the Snyk API, which the snyk CLI reaches without the proxy of the registry profile
+	snykHosts = "snyk.io,.snyk.io"
+
+	snykPolicyVolumeName = "snyk-policy"
+	snykPolicyMountPath  = "/etc/snyk-policy"
+)
+
+// SnykMode selects the snyk commands a scan runs.
+type SnykMode string
+
+const (
+	// SnykMonitor snapshots the image into the Snyk organization with snyk container monitor. This is the default.
+	SnykMonitor SnykMode = "monitor"
+	// SnykTest tests the image with snyk container test, which reports the vulnerabilities and a verdict.
+	SnykTest SnykMode = "test"
+	// SnykMonitorAndTest monitors the image in an init container and tests it afterwards.
+	SnykMonitorAndTest SnykMode = "both"
+)
+
+// SnykModes lists all modes.
+var SnykModes = []SnykMode{SnykMonitor, SnykTest, SnykMonitorAndTest}
+
+// SnykFailOnValues lists the values of --fail-on.
+var SnykFailOnValues = []string{"all", "upgradable"}
+
+// SnykOptions configure the snyk commands. The gating options only apply to snyk container test.
+type SnykOptions struct {
+	// Mode defaults to SnykMonitor.
+	Mode SnykMode
+	// SeverityThreshold only reports vulnerabilities of this severity or higher.
+	SeverityThreshold Severity
+	// FailOn is "all" or "upgradable", it only fails the test for vulnerabilities that can be fixed.
+	FailOn string
+	// ExcludeBaseImageVulns only reports vulnerabilities introduced by the layers of the image itself.
+	ExcludeBaseImageVulns bool
+	// ExcludeAppVulns skips the vulnerabilities of application dependencies.
+	ExcludeAppVulns bool
+	// Policy references a ConfigMap key with a .snyk policy file, which is mounted into the scan containers
+	// and applies to both commands. The key defaults to DefaultSnykPolicyKey.
+	Policy *corev1.ConfigMapKeySelector
+}
+
+// snykTestScript runs snyk and exits with 0 if it found vulnerabilities, so the job doesn't retry a failing verdict.
+// The verdict is reported in the JSON output.
+const snykTestScript = `snyk "$@"; code=$?; [ "$code" -eq 1 ] && exit 0; exit "$code"`
+
+// Snyk monitors images with snyk container monitor, which snapshots them into the Snyk organization,
+// and/or tests them with snyk container test depending on the mode.
+type Snyk struct {
+	Options
+}
+
+func (s *Snyk) Name() string {
+	return BackendSnyk
+}
+
+func (s *Snyk) image() string {
+	if s.Image == "" {
+		return DefaultSnykImage
+	}
+	return s.Image
+}
+
+// TokenSecretName returns the name of the secret with the snyk token.
+func (s *Snyk) TokenSecretName() string {
+	if s.TokenSecret == "" {
+		return DefaultSnykTokenSecret
+	}
+	return s.TokenSecret
+}
+
+func (s *Snyk) orgEnvVar() corev1.EnvVar {
+	if s.Org != "" {
+		return corev1.EnvVar{Name: "SNYK_ORG", Value: s.Org}
+	}
+	return secretEnvVar("SNYK_ORG", s.TokenSecretName(), "SNYK_ORG")
+}
+
+func (s *Snyk) Workload(t Target) Workload {
+	env := []corev1.EnvVar{
+		secretEnvVar("SNYK_TOKEN", s.TokenSecretName(), "SNYK_TOKEN"),
+		s.orgEnvVar(),
+		{
+			Name:  "SNYK_DISABLE_ANALYTICS",
+			Value: "1",
+		},
+	}
+	// with a prefetched copy, only the prefetch container accesses the registry
+	var mounts []corev1.VolumeMount
+	volumes := caBundleVolumes(t.Profile)
+	if s.Prefetch == nil {
+		// passed as environment, so the password doesn't show in the arguments of the process
+		env = append(env, credentialsEnv(t.Profile, "SNYK_REGISTRY_USERNAME", "SNYK_REGISTRY_PASSWORD")...)
+		env = append(env, proxyEnv(t.Profile, snykHosts)...)
+		if file := caBundleFile(t.Profile); file != "" {
+			// the snyk CLI is a node application
+			env = append(env, corev1.EnvVar{Name: "NODE_EXTRA_CA_CERTS", Value: file})
+		}
+		mounts = caBundleVolumeMounts(t.Profile)
+	} else {
+		mounts = append(mounts, s.Prefetch.volumeMount())
+		volumes = append(volumes, s.Prefetch.volume())
+	}
+	if s.Snyk.Policy != nil {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      snykPolicyVolumeName,
+			MountPath: snykPolicyMountPath,
+			ReadOnly:  true,
+		})
+		volumes = append(volumes, s.policyVolume())
+	}
+	monitor := corev1.Container{
+		Name:         ContainerName,
+		Image:        s.image(),
+		Command:      []string{"snyk"},
+		Args:         s.monitorArgs(t),
+		Env:          env,
+		VolumeMounts: mounts,
+	}
+	test := corev1.Container{
+		Name:         ContainerName,
+		Image:        s.image(),
+		Command:      []string{"/bin/sh", "-c", snykTestScript, "snyk"},
+		Args:         s.testArgs(t),
+		Env:          env,
+		VolumeMounts: mounts,
+	}
+
+	w := Workload{Volumes: volumes}
+	if s.Prefetch != nil {
+		w.InitContainers = []corev1.Container{s.Prefetch.container(t)}
+	}
+	w.InitContainers = append(w.InitContainers, s.sbomContainers(t, monitor)...)
+	switch s.Snyk.Mode {
+	case SnykTest:
+		w.Container = test
+	case SnykMonitorAndTest:
+		monitor.Name = "monitor"
+		w.InitContainers = append(w.InitContainers, monitor)
+		w.Container = test
+	default:
+		w.Container = monitor
+	}
+	return w
+}
+
+// monitorArgs and testArgs don't enable debug output, as it would be mixed into the output parsed from the pod logs.
+func (s *Snyk) monitorArgs(t Target) []string {
+	e := t.Event
+	cmd := []string{
+		"container",
+		"monitor",
+		"--org=$(SNYK_ORG)",
+	}
+	cmd = append(cmd, s.registryArgs(t)...)
+	if s.Prefetch != nil {
+		// projects are named like the image, not like the copy
+		cmd = append(cmd, "--project-name="+e.Registry+"/"+e.Repository)
+	}
+	cmd = append(cmd, fmt.Sprintf("--target-reference=%s@%s", e.Tag, e.Digest))
+	cmd = append(cmd, "--platform="+platformString(t))
+	if s.Snyk.ExcludeAppVulns {
+		cmd = append(cmd, "--exclude-app-vulns")
+	}
+	cmd = append(cmd, s.policyArgs()...)
+	cmd = append(cmd, s.Args...)
+	cmd = append(cmd, s.source(t))
+	return cmd
+}
+
+func (s *Snyk) testArgs(t Target) []string {
+	cmd := []string{
+		"container",
+		"test",
+		"--json",
+		"--org=$(SNYK_ORG)",
+	}
+	cmd = append(cmd, s.registryArgs(t)...)
+	cmd = append(cmd, "--platform="+platformString(t))
+	if s.Snyk.SeverityThreshold != "" {
+		cmd = append(cmd, "--severity-threshold="+string(s.Snyk.SeverityThreshold))
+	}
+	if s.Snyk.FailOn != "" {
+		cmd = append(cmd, "--fail-on="+s.Snyk.FailOn)
+	}
+	if s.Snyk.ExcludeBaseImageVulns {
+		cmd = append(cmd, "--exclude-base-image-vulns")
+	}
+	if s.Snyk.ExcludeAppVulns {
+		cmd = append(cmd, "--exclude-app-vulns")
+	}
+	cmd = append(cmd, s.policyArgs()...)
+	cmd = append(cmd, s.Args...)
+	cmd = append(cmd, s.source(t))
+	return cmd
+}
+
+// source is the image argument of snyk, the prefetched copy if any.
+func (s *Snyk) source(t Target) string {
+	if s.Prefetch != nil {
+		return s.Prefetch.source()
+	}
+	return t.Event.Reference()
+}
+
+// registryArgs configure the registry access, which the prefetched copy doesn't need.
+func (s *Snyk) registryArgs(t Target) []string {
+	if s.Prefetch != nil {
+		return nil
+	}
+	return registryArgs(t)
+}
+
+// policyVolume mounts the policy key as .snyk, snyk treats policy paths not ending in .snyk as directories.
+func (s *Snyk) policyVolume() corev1.Volume {
+	key := s.Snyk.Policy.Key
+	if key == "" {
+		key = DefaultSnykPolicyKey
+	}
+	return corev1.Volume{
+		Name: snykPolicyVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: s.Snyk.Policy.LocalObjectReference,
+				Items:                []corev1.KeyToPath{{Key: key, Path: DefaultSnykPolicyKey}},
+			},
+		},
+	}
+}
+
+func (s *Snyk) policyArgs() []string {
+	if s.Snyk.Policy == nil {
+		return nil
+	}
+	return []string{"--policy-path=" + path.Join(snykPolicyMountPath, DefaultSnykPolicyKey)}
+}
+
+func registryArgs(t Target) []string {
+	if t.Profile.Insecure() {
+		return []string{"--insecure"}
+	}
+	return nil
+}
+
+type snykReport struct {
+	// OK is false if the test found vulnerabilities, considering the severity threshold and fail-on.
+	OK              *bool `json:"ok"`
+	Vulnerabilities []struct {
+		ID          string   `json:"id"`
+		PackageName string   `json:"packageName"`
+		Version     string   `json:"version"`
+		Severity    string   `json:"severity"`
+		FixedIn     []string `json:"fixedIn"`
+	} `json:"vulnerabilities"`
+	// Applications are the application dependencies found in the image, unless excluded.
+	Applications []snykReport `json:"applications"`
+}
+
+// ParseFindings parses the JSON output of snyk container test, including its verdict.
+// The output of snyk container monitor has no report.
+func (s *Snyk) ParseFindings(output []byte) (*Findings, error) {
+	var raw snykReport
+	if found, err := decodeJSON(output, &raw); !found || err != nil {
+		return nil, err
+	}
+	r := &Findings{Scanner: BackendSnyk}
+	for _, report := range append([]snykReport{raw}, raw.Applications...) {
+		for _, v := range report.Vulnerabilities {
+			r.Vulnerabilities = append(r.Vulnerabilities, Vulnerability{
+				ID:       v.ID,
+				Package:  v.PackageName,
+				Version:  v.Version,
+				Severity: ParseSeverity(v.Severity),
+				FixedIn:  v.FixedIn,
+			})
+		}
+		// the image passes if the tests of the image and all applications pass
+		if report.OK != nil && (r.Passed == nil || *r.Passed) {
+			r.Passed = report.OK
+		}
+	}
+	return r, nil
+}
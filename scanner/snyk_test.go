@@ -0,0 +1,121 @@
+package scanner
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = DescribeTable("Snyk arguments", func(profile registry.Profile, expected []string) {
+	w := (&Snyk{}).Workload(targetWithProfile(profile))
+	Expect(w.Container.Args).To(ContainElements(expected))
+},
+	Entry("skip-verify adds --insecure", registry.Profile{TLSMode: registry.TLSModeSkipVerify}, []string{"--insecure"}),
+)
+
+var _ = Describe("Snyk", func() {
+	It("should pass the credentials in the environment only", func() {
+		w := (&Snyk{}).Workload(targetWithProfile(registry.Profile{CredentialsSecret: "creds"}))
+		Expect(w.Container.Env).To(ContainElements(HaveField("Name", "SNYK_REGISTRY_USERNAME"), HaveField("Name", "SNYK_REGISTRY_PASSWORD")))
+		Expect(w.Container.Args).NotTo(ContainElement(ContainSubstring("password")))
+	})
+
+	It("should pass the platform variant", func() {
+		t := testTarget
+		t.Platform = imagev1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}
+		Expect((&Snyk{}).Workload(t).Container.Args).To(ContainElement("--platform=linux/arm/v6"))
+	})
+
+	It("should add extra args before the image reference", func() {
+		args := (&Snyk{Options: Options{Args: []string{"--exclude-app-vulns"}}}).Workload(testTarget).Container.Args
+		Expect(args[len(args)-2:]).To(Equal([]string{"--exclude-app-vulns", testTarget.Event.Reference()}))
+	})
+
+	It("should use the org instead of the token secret", func() {
+		w := (&Snyk{Options: Options{Org: "team-a"}}).Workload(testTarget)
+		Expect(w.Container.Env).To(ContainElement(corev1.EnvVar{Name: "SNYK_ORG", Value: "team-a"}))
+	})
+
+	It("should reach the Snyk API without the proxy of the registry", func() {
+		w := (&Snyk{}).Workload(targetWithProfile(registry.Profile{Proxy: "http://proxy:3128"}))
+		Expect(w.Container.Env).To(ContainElements(
+			corev1.EnvVar{Name: "HTTPS_PROXY", Value: "http://proxy:3128"},
+			corev1.EnvVar{Name: "NO_PROXY", Value: "snyk.io,.snyk.io"},
+		))
+	})
+
+	It("should parse snyk container test output", func() {
+		r, err := (&Snyk{}).ParseFindings([]byte(`{"vulnerabilities":[{"id":"SNYK-DEBIAN12-ZLIB-1","packageName":"zlib/zlib1g","version":"1.2.13","severity":"critical","fixedIn":["1.2.13.dfsg-1+deb12u1"]}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Vulnerabilities).To(ConsistOf(Vulnerability{
+			ID:       "SNYK-DEBIAN12-ZLIB-1",
+			Package:  "zlib/zlib1g",
+			Version:  "1.2.13",
+			Severity: SeverityCritical,
+			FixedIn:  []string{"1.2.13.dfsg-1+deb12u1"},
+		}))
+	})
+
+	It("should have no report for snyk container monitor", func() {
+		r, err := (&Snyk{}).ParseFindings([]byte("Monitoring internal/app@sha256:e692...\nExplore this snapshot at https://app.snyk.io/org/x/project/y\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r).To(BeNil())
+	})
+})
+
+var _ = Describe("Snyk modes", func() {
+	It("should only monitor by default", func() {
+		w := (&Snyk{}).Workload(testTarget)
+		Expect(w.InitContainers).To(BeEmpty())
+		Expect(w.Container.Args[:2]).To(Equal([]string{"container", "monitor"}))
+		Expect(w.Container.Args).NotTo(ContainElement("-d"))
+	})
+
+	It("should test with the gating options", func() {
+		w := (&Snyk{Options: Options{Snyk: SnykOptions{
+			Mode:                  SnykTest,
+			SeverityThreshold:     SeverityHigh,
+			FailOn:                "upgradable",
+			ExcludeBaseImageVulns: true,
+		}}}).Workload(testTarget)
+		Expect(w.InitContainers).To(BeEmpty())
+		Expect(w.Container.Command[:2]).To(Equal([]string{"/bin/sh", "-c"}))
+		Expect(w.Container.Args[:3]).To(Equal([]string{"container", "test", "--json"}))
+		Expect(w.Container.Args).To(ContainElements("--severity-threshold=high", "--fail-on=upgradable", "--exclude-base-image-vulns"))
+		Expect(w.Container.Args).NotTo(ContainElement("-d"))
+	})
+
+	It("should monitor before testing", func() {
+		w := (&Snyk{Options: Options{Snyk: SnykOptions{Mode: SnykMonitorAndTest, SeverityThreshold: SeverityHigh}}}).Workload(testTarget)
+		Expect(w.InitContainers).To(HaveLen(1))
+		Expect(w.InitContainers[0].Args[:2]).To(Equal([]string{"container", "monitor"}))
+		Expect(w.InitContainers[0].Args).NotTo(ContainElement("--severity-threshold=high"))
+		Expect(w.Container.Name).To(Equal(ContainerName))
+		Expect(w.Container.Args[:2]).To(Equal([]string{"container", "test"}))
+	})
+
+	It("should mount the policy into both containers", func() {
+		w := (&Snyk{Options: Options{Snyk: SnykOptions{
+			Mode:   SnykMonitorAndTest,
+			Policy: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ignores"}},
+		}}}).Workload(testTarget)
+		Expect(w.Volumes).To(ConsistOf(HaveField("ConfigMap.Items", []corev1.KeyToPath{{Key: ".snyk", Path: ".snyk"}})))
+		for _, c := range []corev1.Container{w.InitContainers[0], w.Container} {
+			Expect(c.VolumeMounts).To(ConsistOf(HaveField("MountPath", "/etc/snyk-policy")))
+			Expect(c.Args).To(ContainElement("--policy-path=/etc/snyk-policy/.snyk"))
+		}
+	})
+
+	It("should parse the verdict of the image and its applications", func() {
+		r, err := (&Snyk{}).ParseFindings([]byte(`{"ok":true,"vulnerabilities":[],"applications":[{"ok":false,"vulnerabilities":[{"id":"SNYK-JS-1","packageName":"lodash","version":"4.17.20","severity":"high"}]}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Passed).To(HaveValue(BeFalse()))
+		Expect(r.Summary()).To(Equal(Summary{SeverityHigh: 1}))
+
+		r, err = (&Snyk{}).ParseFindings([]byte(`{"ok":true,"vulnerabilities":[]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Passed).To(HaveValue(BeTrue()))
+	})
+})
@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultTrivyImage is the image of trivy.
+const DefaultTrivyImage = "aquasec/trivy:0.57.1"
+
+// Trivy scans images with trivy image. It needs no license, but downloads its vulnerability database on every scan.
+type Trivy struct {
+	Options
+}
+
+func (s *Trivy) Name() string {
+	return BackendTrivy
+}
+
+func (s *Trivy) Workload(t Target) Workload {
+	args := []string{"image", "--format=json", "--quiet", "--platform=" + platformString(t)}
+	if t.Profile.Insecure() {
+		args = append(args, "--insecure")
+	}
+	args = append(args, s.Args...)
+	args = append(args, t.Event.Reference())
+
+	env := credentialsEnv(t.Profile, "TRIVY_USERNAME", "TRIVY_PASSWORD")
+	env = append(env, proxyEnv(t.Profile)...)
+	if t.Profile.CABundle != nil {
+		// keep the system roots to download the vulnerability database
+		env = append(env, corev1.EnvVar{Name: "SSL_CERT_DIR", Value: "/etc/ssl/certs:" + caBundleMountPath})
+	}
+
+	image := s.Image
+	if image == "" {
+		image = DefaultTrivyImage
+	}
+	return Workload{
+		Container: corev1.Container{
+			Name:         ContainerName,
+			Image:        image,
+			Command:      []string{"trivy"},
+			Args:         args,
+			Env:          env,
+			VolumeMounts: caBundleVolumeMounts(t.Profile),
+		},
+		Volumes: caBundleVolumes(t.Profile),
+	}
+}
+
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// ParseFindings parses the JSON output of trivy image.
+func (s *Trivy) ParseFindings(output []byte) (*Findings, error) {
+	var raw trivyReport
+	if found, err := decodeJSON(output, &raw); !found || err != nil {
+		return nil, err
+	}
+	r := &Findings{Scanner: BackendTrivy}
+	for _, result := range raw.Results {
+		for _, v := range result.Vulnerabilities {
+			vuln := Vulnerability{
+				ID:       v.VulnerabilityID,
+				Package:  v.PkgName,
+				Version:  v.InstalledVersion,
+				Severity: ParseSeverity(v.Severity),
+			}
+			if v.FixedVersion != "" {
+				vuln.FixedIn = []string{v.FixedVersion}
+			}
+			r.Vulnerabilities = append(r.Vulnerabilities, vuln)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,39 @@
+package scanner
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Trivy", func() {
+	It("should scan the image with the credentials of the profile", func() {
+		w := (&Trivy{}).Workload(targetWithProfile(registry.Profile{
+			TLSMode:           registry.TLSModeSkipVerify,
+			CredentialsSecret: "creds",
+		}))
+		Expect(w.Container.Image).To(Equal(DefaultTrivyImage))
+		Expect(w.Container.Args).To(ContainElements("image", "--format=json", "--insecure", "--platform=linux/amd64"))
+		Expect(w.Container.Args[len(w.Container.Args)-1]).To(Equal(testTarget.Event.Reference()))
+		Expect(w.Container.Env).To(ContainElement(HaveField("Name", "TRIVY_USERNAME")))
+	})
+
+	It("should keep the system roots with a CA bundle", func() {
+		w := (&Trivy{}).Workload(targetWithProfile(registry.Profile{
+			CABundle: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}, Key: "ca.crt"},
+		}))
+		Expect(w.Container.Env).To(ContainElement(corev1.EnvVar{Name: "SSL_CERT_DIR", Value: "/etc/ssl/certs:/etc/registry-ca"}))
+		Expect(w.Volumes).To(HaveLen(1))
+	})
+
+	It("should parse the JSON report", func() {
+		r, err := (&Trivy{}).ParseFindings([]byte(`{"Results":[{"Target":"debian","Vulnerabilities":[
+			{"VulnerabilityID":"CVE-2023-45853","PkgName":"zlib1g","InstalledVersion":"1:1.2.13","Severity":"CRITICAL"},
+			{"VulnerabilityID":"CVE-2024-1","PkgName":"openssl","InstalledVersion":"3.0.1","FixedVersion":"3.0.2","Severity":"HIGH"}]}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Scanner).To(Equal(BackendTrivy))
+		Expect(r.Summary()).To(Equal(Summary{SeverityCritical: 1, SeverityHigh: 1}))
+		Expect(r.Vulnerabilities[1].FixedIn).To(Equal([]string{"3.0.2"}))
+	})
+})
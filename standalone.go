@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stackitcloud/registry-snyk-scan/config"
+	"github.com/stackitcloud/registry-snyk-scan/controller"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/lineage"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/standalone"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"github.com/stackitcloud/registry-snyk-scan/webhook"
+	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// runStandalone runs the webhook and the reconciler without Kubernetes until ctx is done.
+// Scans run as local processes, the secrets and CA bundles they need are read from -secrets-dir.
+func runStandalone(ctx context.Context, cfg *config.Config, watcher *config.Watcher, eventChan chan event.TypedGenericEvent[types.RegistryEvent],
+	resultStore resultStore, deadLetters *results.DeadLetters, sboms sbom.Store, packages *inventory.Index, logger logr.Logger) error {
+	if len(cfg.Namespaces) > 0 {
+		logger.Info("ignoring the namespace routes of the configuration in standalone mode")
+	}
+	tenants := cfg.ControllerTenants()
+	for name, t := range tenants {
+		// all scans run locally
+		t.Namespace = ""
+		tenants[name] = t
+	}
+
+	files := &standalone.Files{Dir: *secretsDir}
+	registryClient := registry.NewClient(nil, files, *namespace, cfg.Registries.CacheSize)
+	reconciler := &controller.Reconciler{
+		Namespace:   *namespace,
+		Tenants:     tenants,
+		Registry:    registryClient,
+		Results:     resultStore,
+		DeadLetters: deadLetters,
+		Reader:      files,
+	}
+	runner := &standalone.Runner{
+		Reconciler: reconciler,
+		Files:      files,
+		Results:    resultStore,
+		SBOMs:      sboms,
+		Inventory:  packages,
+		Workers:    *workers,
+		LogLimit:   *scanLogLimit,
+	}
+	reconciler.Jobs = runner
+	if cfg.Referrers.Enabled {
+		reconciler.Attachments = registryClient
+		runner.Referrers = registryClient
+	}
+
+	serverOptions := []webhook.Option{
+		webhook.WithResults(resultStore),
+		webhook.WithDeadLetters(deadLetters),
+		webhook.WithSBOMs(sboms),
+		webhook.WithInventory(packages),
+		webhook.WithTenants(cfg.WebhookTenants()),
+	}
+	var lineageSaver *lineage.Saver
+	if cfg.Lineage.Enabled {
+		graph, saver, err := newLineageGraph(logger)
+		if err != nil {
+			return err
+		}
+		lineageSaver = saver
+		reconciler.Lineage = &controller.Lineage{Registry: registryClient, Graph: graph, Events: eventChan}
+		serverOptions = append(serverOptions, webhook.WithLineage(graph))
+	}
+	if cfg.Webhook.TLS != nil {
+		serverOptions = append(serverOptions, webhook.WithTLS(*cfg.Webhook.TLS))
+	}
+	if cfg.Webhook.TokenFile != "" {
+		serverOptions = append(serverOptions, webhook.WithToken(cfg.Webhook.TokenFile))
+	}
+	s, err := webhook.NewServer(cfg.Webhook.Port, eventChan, logger.WithName("webhook"), serverOptions...)
+	if err != nil {
+		return err
+	}
+
+	targets := &configTargets{
+		registry:    registryClient,
+		reconciler:  reconciler,
+		server:      s,
+		results:     resultStore,
+		deadLetters: deadLetters,
+		logger:      logger,
+	}
+	targets.apply(cfg)
+
+	probes := http.NewServeMux()
+	for path, checks := range map[string]map[string]healthz.Checker{
+		"/healthz": {"webhook": s.Healthz},
+		"/readyz":  {"webhook": s.Readyz, "snyk-secret": controller.SnykSecretCheck(files, reconciler)},
+	} {
+		// like the manager, single checks are served at /readyz/<name>
+		handler := http.StripPrefix(path, &healthz.Handler{Checks: checks})
+		probes.Handle(path, handler)
+		probes.Handle(path+"/", handler)
+	}
+	servers := []*http.Server{{Addr: *probeAddr, Handler: probes}}
+	if *metricsAddr != "0" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.HandlerFor(ctrlmetrics.Registry, promhttp.HandlerOpts{}))
+		servers = append(servers, &http.Server{Addr: *metricsAddr, Handler: metricsMux})
+	}
+
+	errg, ctx := errgroup.WithContext(ctx)
+	errg.Go(func() error {
+		return s.ListenAndServe(ctx)
+	})
+	errg.Go(func() error {
+		return runner.Start(ctx, eventChan)
+	})
+	if advisories := newAdvisoryWatcher(cfg, packages, resultStore, eventChan, logger); advisories != nil {
+		errg.Go(func() error {
+			return advisories.Start(ctx)
+		})
+	}
+	if lineageSaver != nil {
+		errg.Go(func() error {
+			return lineageSaver.Start(ctx)
+		})
+	}
+	if watcher != nil {
+		watcher.OnChange(targets.apply)
+		errg.Go(func() error {
+			return watcher.Start(ctx)
+		})
+	}
+	for _, srv := range servers {
+		errg.Go(func() error {
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		})
+		errg.Go(func() error {
+			<-ctx.Done()
+			return srv.Close()
+		})
+	}
+	logger.Info("running standalone", "port", cfg.Webhook.Port, "workers", *workers)
+
+	if err := errg.Wait(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
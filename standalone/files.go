@@ -0,0 +1,102 @@
+// Package standalone runs scans as local processes instead of Kubernetes jobs.
+package standalone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Files reads the Secrets and ConfigMaps referenced by registry profiles and scanners from a directory,
+// laid out like they are mounted into pods: a subdirectory per object with a file per key.
+// Namespaces are ignored.
+type Files struct {
+	Dir string
+}
+
+var _ client.Reader = &Files{}
+
+// Path returns the directory of the object with the given name.
+func (f *Files) Path(name string) string {
+	return filepath.Join(f.Dir, name)
+}
+
+func (f *Files) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	var resource string
+	switch obj.(type) {
+	case *corev1.Secret:
+		resource = "secrets"
+	case *corev1.ConfigMap:
+		resource = "configmaps"
+	default:
+		return fmt.Errorf("%T can't be read from files", obj)
+	}
+
+	data, err := f.read(key.Name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: resource}, key.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch o := obj.(type) {
+	case *corev1.Secret:
+		o.Data = data
+	case *corev1.ConfigMap:
+		o.Data = map[string]string{}
+		for k, v := range data {
+			o.Data[k] = string(v)
+		}
+	}
+	obj.SetName(key.Name)
+	obj.SetNamespace(key.Namespace)
+	return nil
+}
+
+func (f *Files) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.New("listing objects from files is not supported")
+}
+
+func (f *Files) read(name string) (map[string][]byte, error) {
+	// names are DNS subdomains, this just keeps them inside Dir
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fs.ErrNotExist
+	}
+	entries, err := os.ReadDir(f.Path(name))
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{}
+	for _, e := range entries {
+		// skips the ..data links of mounted volumes, keys like .snyk may start with a single dot
+		if strings.HasPrefix(e.Name(), "..") {
+			continue
+		}
+		value, err := os.ReadFile(filepath.Join(f.Path(name), e.Name()))
+		if err != nil {
+			// subdirectories aren't keys
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) && isDir(pathErr.Path) {
+				continue
+			}
+			return nil, err
+		}
+		data[e.Name()] = value
+	}
+	return data, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,48 @@
+package standalone
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Files", func() {
+	var files *Files
+
+	BeforeEach(func() {
+		files = &Files{Dir: GinkgoT().TempDir()}
+		Expect(os.MkdirAll(filepath.Join(files.Dir, "snyk-token", "..data"), 0o700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(files.Dir, "snyk-token", "SNYK_TOKEN"), []byte("token"), 0o600)).To(Succeed())
+	})
+
+	It("should read secrets and ConfigMaps from directories", func(ctx SpecContext) {
+		var secret corev1.Secret
+		Expect(files.Get(ctx, k8stypes.NamespacedName{Namespace: "default", Name: "snyk-token"}, &secret)).To(Succeed())
+		Expect(secret.Data).To(Equal(map[string][]byte{"SNYK_TOKEN": []byte("token")}))
+
+		var cm corev1.ConfigMap
+		Expect(files.Get(ctx, k8stypes.NamespacedName{Name: "snyk-token"}, &cm)).To(Succeed())
+		Expect(cm.Data).To(Equal(map[string]string{"SNYK_TOKEN": "token"}))
+	})
+
+	It("should read keys starting with a dot", func(ctx SpecContext) {
+		Expect(os.Mkdir(filepath.Join(files.Dir, "ignores"), 0o700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(files.Dir, "ignores", ".snyk"), []byte("ignore: {}"), 0o600)).To(Succeed())
+		var cm corev1.ConfigMap
+		Expect(files.Get(ctx, k8stypes.NamespacedName{Name: "ignores"}, &cm)).To(Succeed())
+		Expect(cm.Data).To(Equal(map[string]string{".snyk": "ignore: {}"}))
+	})
+
+	It("should report missing objects as not found", func(ctx SpecContext) {
+		var secret corev1.Secret
+		err := files.Get(ctx, k8stypes.NamespacedName{Name: "missing"}, &secret)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		err = files.Get(ctx, k8stypes.NamespacedName{Name: "../snyk-token"}, &secret)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
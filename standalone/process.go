@@ -0,0 +1,233 @@
+package standalone
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+)
+
+// inheritedEnv are the variables of the environment of the runner passed on to the processes.
+var inheritedEnv = []string{
+	"PATH", "HOME", "TMPDIR", "LANG", "TZ",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+}
+
+// command builds the local process of a container of job.
+// The process gets the inheritedEnv and the environment of the container. Unlike in a pod, the arguments of the
+// process are visible to all local users, so the scanners get credentials from the environment.
+// Secret and ConfigMap volumes are replaced by their directories in files, emptyDir volumes by a directory
+// named like the volume in scratch. References to the mount paths in the arguments and environment are
+// rewritten accordingly.
+func command(ctx context.Context, files *Files, scratch string, job *batchv1.Job, container *corev1.Container) (*exec.Cmd, error) {
+	mounts, err := mountReplacer(files, scratch, job.Spec.Template.Spec.Volumes, container.VolumeMounts)
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	var environ []string
+	for _, name := range inheritedEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			environ = append(environ, name+"="+value)
+		}
+	}
+	for _, e := range container.Env {
+		value, err := envValue(ctx, files, job.Namespace, e, env)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", e.Name, err)
+		}
+		value = mounts.Replace(value)
+		env[e.Name] = value
+		environ = append(environ, e.Name+"="+value)
+	}
+
+	argv := slices.Concat(container.Command, container.Args)
+	switch {
+	case container.Name == scanner.PrefetchContainerName:
+		// the copy is made by this binary, not by the one in the image
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		argv[0] = executable
+	case len(container.Command) == 0:
+		// containers without command run the entrypoint of their image, like grype for anchore/grype
+		argv = append([]string{imageName(container.Image)}, argv...)
+	}
+	for i := range argv {
+		argv[i] = mounts.Replace(expand(argv[i], env))
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = environ
+	return cmd, nil
+}
+
+// scratchDir creates the directories of the emptyDir volumes of job in a temporary directory, and those of the
+// Secret and ConfigMap volumes that mount keys at other paths. It returns an empty path if job has none of them.
+func scratchDir(job *batchv1.Job) (string, error) {
+	var dir string
+	for _, v := range job.Spec.Template.Spec.Volumes {
+		if v.EmptyDir == nil && len(volumeItems(v)) == 0 {
+			continue
+		}
+		if dir == "" {
+			var err error
+			if dir, err = os.MkdirTemp("", "registry-snyk-scan-"); err != nil {
+				return "", err
+			}
+		}
+		if err := os.Mkdir(filepath.Join(dir, v.Name), 0o700); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func scanContainer(job *batchv1.Job) (*corev1.Container, error) {
+	containers := job.Spec.Template.Spec.Containers
+	for i := range containers {
+		if containers[i].Name == scanner.ContainerName {
+			return &containers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("job %s has no %s container", job.Name, scanner.ContainerName)
+}
+
+func mountReplacer(files *Files, scratch string, volumes []corev1.Volume, mounts []corev1.VolumeMount) (*strings.Replacer, error) {
+	var pairs []string
+	for _, m := range mounts {
+		var dir string
+		var items []corev1.KeyToPath
+		for _, v := range volumes {
+			if v.Name != m.Name {
+				continue
+			}
+			switch {
+			case v.ConfigMap != nil:
+				dir, items = files.Path(v.ConfigMap.Name), v.ConfigMap.Items
+			case v.Secret != nil:
+				dir, items = files.Path(v.Secret.SecretName), v.Secret.Items
+			case v.EmptyDir != nil && scratch != "":
+				dir = filepath.Join(scratch, v.Name)
+			default:
+				return nil, fmt.Errorf("volume %s is neither a ConfigMap, a Secret nor an emptyDir", v.Name)
+			}
+			if len(items) > 0 && scratch == "" {
+				return nil, fmt.Errorf("volume %s mounts keys at other paths without scratch directory", v.Name)
+			}
+			if len(items) > 0 {
+				// like the kubelet, only the items are mounted at their paths, which the scanner might depend on
+				// like snyk on the name of the policy file
+				projected := filepath.Join(scratch, v.Name)
+				for _, item := range items {
+					link := filepath.Join(projected, filepath.FromSlash(item.Path))
+					if err := os.MkdirAll(filepath.Dir(link), 0o700); err != nil {
+						return nil, err
+					}
+					if err := os.Symlink(filepath.Join(dir, item.Key), link); err != nil && !errors.Is(err, fs.ErrExist) {
+						return nil, err
+					}
+				}
+				dir = projected
+			}
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("volume %s doesn't exist", m.Name)
+		}
+		pairs = append(pairs, m.MountPath, dir)
+	}
+	return strings.NewReplacer(pairs...), nil
+}
+
+// volumeItems returns the keys of the Secret or ConfigMap of v mounted at other paths.
+func volumeItems(v corev1.Volume) []corev1.KeyToPath {
+	switch {
+	case v.ConfigMap != nil:
+		return v.ConfigMap.Items
+	case v.Secret != nil:
+		return v.Secret.Items
+	}
+	return nil
+}
+
+func envValue(ctx context.Context, files *Files, namespace string, e corev1.EnvVar, env map[string]string) (string, error) {
+	if e.ValueFrom == nil {
+		return expand(e.Value, env), nil
+	}
+	switch {
+	case e.ValueFrom.SecretKeyRef != nil:
+		ref := e.ValueFrom.SecretKeyRef
+		var secret corev1.Secret
+		if err := files.Get(ctx, k8stypes.NamespacedName{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+			return "", err
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			return "", fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+		}
+		return string(value), nil
+	case e.ValueFrom.ConfigMapKeyRef != nil:
+		ref := e.ValueFrom.ConfigMapKeyRef
+		var cm corev1.ConfigMap
+		if err := files.Get(ctx, k8stypes.NamespacedName{Namespace: namespace, Name: ref.Name}, &cm); err != nil {
+			return "", err
+		}
+		value, ok := cm.Data[ref.Key]
+		if !ok {
+			return "", fmt.Errorf("ConfigMap %s has no key %s", ref.Name, ref.Key)
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("only secret and ConfigMap keys are supported")
+	}
+}
+
+var variableReference = regexp.MustCompile(`\$\(([A-Za-z_][A-Za-z0-9_.-]*)\)`)
+
+// expand replaces references to variables like $(SNYK_ORG) in s like Kubernetes does.
+// References to undefined variables are kept.
+func expand(s string, env map[string]string) string {
+	return variableReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if value, ok := env[ref[2:len(ref)-1]]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// imageName returns the last path component of an image reference without tag and digest.
+func imageName(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	name := path.Base(image)
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(p) {
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,171 @@
+package standalone
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("command", func() {
+	var files *Files
+
+	BeforeEach(func() {
+		files = &Files{Dir: GinkgoT().TempDir()}
+		for name, data := range map[string]map[string]string{
+			"snyk-token":  {"SNYK_TOKEN": "token", "SNYK_ORG": "org"},
+			"registry-ca": {"ca.crt": "PEM"},
+			"registry-creds": {
+				registry.CredentialsUsernameKey: "user",
+				registry.CredentialsPasswordKey: "s3cret",
+			},
+		} {
+			Expect(os.Mkdir(filepath.Join(files.Dir, name), 0o700)).To(Succeed())
+			for key, value := range data {
+				Expect(os.WriteFile(filepath.Join(files.Dir, name, key), []byte(value), 0o600)).To(Succeed())
+			}
+		}
+	})
+
+	job := func(s scanner.Scanner) *batchv1.Job {
+		profile := registry.Profile{CABundle: &corev1.ConfigMapKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "registry-ca"},
+			Key:                  "ca.crt",
+		}}
+		w := s.Workload(scanner.Target{
+			Event:   types.RegistryEvent{Registry: "registry.example.com", Repository: "app", Digest: "sha256:abc"},
+			Profile: profile,
+		})
+		return &batchv1.Job{Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{w.Container},
+			Volumes:    w.Volumes,
+		}}}}
+	}
+
+	scanCommand := func(ctx context.Context, job *batchv1.Job) (*exec.Cmd, error) {
+		container, err := scanContainer(job)
+		Expect(err).NotTo(HaveOccurred())
+		return command(ctx, files, "", job, container)
+	}
+
+	It("should resolve secrets, variables and mounts", func(ctx SpecContext) {
+		cmd, err := scanCommand(ctx, job(&scanner.Snyk{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Args[0]).To(Equal("snyk"))
+		Expect(cmd.Args).To(ContainElement("--org=org"))
+		Expect(cmd.Env).To(ContainElements("SNYK_TOKEN=token", "NODE_EXTRA_CA_CERTS="+filepath.Join(files.Dir, "registry-ca", "ca.crt")))
+	})
+
+	It("should mount keys at other paths", func(ctx SpecContext) {
+		Expect(os.Mkdir(filepath.Join(files.Dir, "ignores"), 0o700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(files.Dir, "ignores", "policy.yaml"), []byte("ignore: {}"), 0o600)).To(Succeed())
+		j := job(&scanner.Snyk{Options: scanner.Options{Snyk: scanner.SnykOptions{
+			Policy: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ignores"}, Key: "policy.yaml"},
+		}}})
+		scratch, err := scratchDir(j)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, scratch)
+
+		container, err := scanContainer(j)
+		Expect(err).NotTo(HaveOccurred())
+		cmd, err := command(ctx, files, scratch, j, container)
+		Expect(err).NotTo(HaveOccurred())
+		// snyk only reads policy files named .snyk
+		var policyPath string
+		for _, arg := range cmd.Args {
+			if p, ok := strings.CutPrefix(arg, "--policy-path="); ok {
+				policyPath = p
+			}
+		}
+		Expect(policyPath).To(HaveSuffix("/.snyk"))
+		Expect(os.ReadFile(policyPath)).To(Equal([]byte("ignore: {}")))
+
+		// the volume is mounted again for every process
+		_, err = command(ctx, files, scratch, j, container)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should replace emptyDir volumes with scratch directories", func(ctx SpecContext) {
+		j := job(&scanner.Snyk{Options: scanner.Options{Prefetch: &scanner.Prefetch{Image: "registry-snyk-scan"}}})
+		scratch, err := scratchDir(j)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, scratch)
+		Expect(filepath.Join(scratch, "image")).To(BeADirectory())
+
+		container, err := scanContainer(j)
+		Expect(err).NotTo(HaveOccurred())
+		cmd, err := command(ctx, files, scratch, j, container)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Args[len(cmd.Args)-1]).To(Equal("oci-dir:" + filepath.Join(scratch, "image", "image")))
+	})
+
+	It("should prefetch with the running binary", func(ctx SpecContext) {
+		w := (&scanner.Snyk{Options: scanner.Options{Prefetch: &scanner.Prefetch{Image: "registry-snyk-scan"}}}).Workload(scanner.Target{
+			Event: types.RegistryEvent{Registry: "registry.example.com", Repository: "app", Digest: "sha256:abc"},
+		})
+		j := &batchv1.Job{Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			InitContainers: w.InitContainers,
+			Containers:     []corev1.Container{w.Container},
+			Volumes:        w.Volumes,
+		}}}}
+		scratch, err := scratchDir(j)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, scratch)
+
+		cmd, err := command(ctx, files, scratch, j, &j.Spec.Template.Spec.InitContainers[0])
+		Expect(err).NotTo(HaveOccurred())
+		executable, err := os.Executable()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Path).To(Equal(executable))
+		Expect(cmd.Args[1]).To(Equal(scanner.PrefetchCommand))
+	})
+
+	It("should run the entrypoint named like the image", func(ctx SpecContext) {
+		cmd, err := scanCommand(ctx, job(&scanner.Grype{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Args[0]).To(Equal("grype"))
+	})
+
+	It("should only inherit the generic environment", func(ctx SpecContext) {
+		GinkgoT().Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		cmd, err := scanCommand(ctx, job(&scanner.Snyk{}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Env).To(ContainElement(HavePrefix("PATH=")))
+		Expect(cmd.Env).NotTo(ContainElement(HavePrefix("AWS_SECRET_ACCESS_KEY=")))
+	})
+
+	It("should not pass registry credentials as arguments", func(ctx SpecContext) {
+		w := (&scanner.Snyk{}).Workload(scanner.Target{
+			Event:   types.RegistryEvent{Registry: "registry.example.com", Repository: "app", Digest: "sha256:abc"},
+			Profile: registry.Profile{CredentialsSecret: "registry-creds"},
+		})
+		cmd, err := scanCommand(ctx, &batchv1.Job{Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{w.Container},
+		}}}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Env).To(ContainElement("SNYK_REGISTRY_PASSWORD=s3cret"))
+		Expect(cmd.Args).NotTo(ContainElement(ContainSubstring("s3cret")))
+	})
+
+	It("should fail on missing secrets", func(ctx SpecContext) {
+		_, err := scanCommand(ctx, job(&scanner.Snyk{Options: scanner.Options{TokenSecret: "missing"}}))
+		Expect(err).To(MatchError(ContainSubstring("SNYK_TOKEN")))
+	})
+})
+
+var _ = DescribeTable("imageName", func(image, expected string) {
+	Expect(imageName(image)).To(Equal(expected))
+},
+	Entry("tag", "anchore/grype:latest", "grype"),
+	Entry("registry with port", "registry:5000/tools/trivy", "trivy"),
+	Entry("digest", "grype@sha256:abc", "grype"),
+)
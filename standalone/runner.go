@@ -0,0 +1,356 @@
+package standalone
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/stackitcloud/registry-snyk-scan/controller"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/lru"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DefaultWorkers is the number of scans run in parallel by default.
+	DefaultWorkers = 2
+	// jobHistorySize is the number of job names remembered to skip duplicate scans.
+	jobHistorySize = 10000
+	// DefaultRetryDelay is the delay before the first retry of a failed scan by default, like for the pods of a job.
+	DefaultRetryDelay = 10 * time.Second
+	// maxRetryDelay is the maximum delay between retries of a scan, like for the pods of a job.
+	maxRetryDelay = 6 * time.Minute
+	// defaultBackoffLimit is the number of retries of jobs without backoff limit, the default of Kubernetes.
+	defaultBackoffLimit = 6
+)
+
+// Runner passes registry events to a Reconciler like the Kubernetes controller does, and runs the scan jobs
+// it creates as local processes. The Reconciler must use the Runner as its JobCreator.
+//
+// Every worker processes one event at a time, including its scan, so Workers limits the number of parallel scans.
+// Events that fail are retried with backoff, and rescans are requeued after their interval. Scans that exit
+// with an error are retried up to the backoff limit of their job, like failed pods.
+type Runner struct {
+	Reconciler *controller.Reconciler
+	// Files holds the Secrets and ConfigMaps referenced by the scan jobs.
+	Files *Files
+	// Results records the outcome and findings of each scan, if set.
+	Results results.Store
+	// Referrers attaches the reports and SBOMs of successful scans to the scanned images, if set.
+	Referrers controller.ReferrerPusher
+	// SBOMs keeps the SBOMs printed by the scans, if set.
+	SBOMs sbom.Store
+	// Inventory indexes the packages of the SBOMs printed by the scans, if set.
+	Inventory *inventory.Index
+	// Workers defaults to DefaultWorkers.
+	Workers int
+	// LogLimit is the number of bytes of scan output parsed for findings. Defaults to controller.DefaultLogLimit.
+	LogLimit int
+	// RetryDelay is doubled with every retry of a failed scan. Defaults to DefaultRetryDelay.
+	RetryDelay time.Duration
+
+	initOnce sync.Once
+	queue    workqueue.TypedRateLimitingInterface[types.RegistryEvent]
+
+	// jobsMu makes checking and adding a job name atomic
+	jobsMu sync.Mutex
+	jobs   *lru.Cache
+}
+
+var _ controller.JobCreator = &Runner{}
+
+func (r *Runner) init() {
+	r.initOnce.Do(func() {
+		r.queue = workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[types.RegistryEvent]())
+		r.jobs = lru.New(jobHistorySize)
+	})
+}
+
+// Start processes the events until ctx is done.
+func (r *Runner) Start(ctx context.Context, events <-chan event.TypedGenericEvent[types.RegistryEvent]) error {
+	r.init()
+	workers := r.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r.processNext(ctx) {
+			}
+		}()
+	}
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// no more events, keep processing the queue until ctx is done
+				events = nil
+				continue
+			}
+			r.queue.Add(r.Reconciler.QueueKey(e.Object))
+		case <-ctx.Done():
+			r.queue.ShutDown()
+			wg.Wait()
+			return nil
+		}
+	}
+}
+
+func (r *Runner) processNext(ctx context.Context) bool {
+	e, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(e)
+
+	log := logf.FromContext(ctx).WithValues("registry", e.Registry, "repository", e.Repository, "digest", e.Digest)
+	ctx = logf.IntoContext(ctx, log)
+
+	// the scan runs in Create, its result is recorded after the reconciler recorded the scheduled job
+	var scan *finishedScan
+	result, err := r.Reconciler.Reconcile(context.WithValue(ctx, scanKey{}, &scan), e)
+	if scan != nil {
+		r.record(ctx, scan)
+	}
+
+	switch {
+	case err != nil:
+		log.Error(err, "processing registry event")
+		r.queue.AddRateLimited(e)
+	case result.RequeueAfter > 0:
+		r.queue.Forget(e)
+		r.queue.AddAfter(e, result.RequeueAfter)
+	case result.Requeue:
+		r.queue.AddRateLimited(e)
+	default:
+		r.queue.Forget(e)
+	}
+	return true
+}
+
+type scanKey struct{}
+
+type finishedScan struct {
+	job     *batchv1.Job
+	outcome string
+	output  []byte
+	// sboms holds the output of the SBOM init containers by format
+	sboms map[scanner.SBOMFormat][]byte
+	// reason is set if the scan didn't produce output to parse
+	reason     string
+	duration   time.Duration
+	finishedAt time.Time
+}
+
+// Create runs the scan job as a local process and waits for it to finish.
+// Jobs are created once per name, like in Kubernetes.
+func (r *Runner) Create(ctx context.Context, obj client.Object, _ ...client.CreateOption) error {
+	r.init()
+	job, ok := obj.(*batchv1.Job)
+	if !ok {
+		return fmt.Errorf("%T can't be run as local process", obj)
+	}
+	runCtx := ctx
+	if d := job.Spec.ActiveDeadlineSeconds; d != nil {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, time.Duration(*d)*time.Second)
+		defer cancel()
+	}
+	container, err := scanContainer(job)
+	if err != nil {
+		return err
+	}
+	scratch, err := scratchDir(job)
+	if err != nil {
+		return err
+	}
+	if scratch != "" {
+		defer os.RemoveAll(scratch)
+	}
+	limit := r.LogLimit
+	if limit <= 0 {
+		limit = controller.DefaultLogLimit
+	}
+	p, err := r.pod(runCtx, scratch, job, container, limit)
+	if err != nil {
+		return err
+	}
+	if !r.addJob(job.Name) {
+		return apierrors.NewAlreadyExists(batchv1.Resource("jobs"), job.Name)
+	}
+
+	log := logf.FromContext(ctx)
+	log.Info("Running scan", "job", job.Name, "command", p.cmd.Path)
+	start := time.Now()
+	scan := &finishedScan{job: job, outcome: metrics.ScanSucceeded}
+	backoffLimit := int32(defaultBackoffLimit)
+	if job.Spec.BackoffLimit != nil {
+		backoffLimit = *job.Spec.BackoffLimit
+	}
+	delay := cmp.Or(r.RetryDelay, DefaultRetryDelay)
+	for retries := int32(0); ; retries++ {
+		scan.reason, err = p.run()
+		var exitErr *exec.ExitError
+		if err == nil || !errors.As(err, &exitErr) || retries >= backoffLimit {
+			break
+		}
+		log.Info("Retrying failed scan", "job", job.Name, "error", err.Error(), "after", delay)
+		select {
+		case <-time.After(delay):
+		case <-runCtx.Done():
+		}
+		if runCtx.Err() != nil {
+			break
+		}
+		delay = min(2*delay, maxRetryDelay)
+		// processes can't be started twice
+		var next *localPod
+		if next, err = r.pod(runCtx, scratch, job, container, limit); err != nil {
+			scan.reason = err.Error()
+			break
+		}
+		p = next
+	}
+	if err != nil {
+		scan.outcome = metrics.ScanFailed
+		if runCtx.Err() != nil {
+			scan.reason = fmt.Sprintf("scan stopped: %s", runCtx.Err())
+		}
+	}
+	scan.finishedAt = time.Now()
+	scan.duration = scan.finishedAt.Sub(start)
+	scan.output = p.output.Bytes()
+	scan.sboms = map[scanner.SBOMFormat][]byte{}
+	for format, sbom := range p.sboms {
+		scan.sboms[format] = sbom.Bytes()
+	}
+
+	if slot, ok := ctx.Value(scanKey{}).(**finishedScan); ok {
+		*slot = scan
+	} else {
+		r.record(ctx, scan)
+	}
+	return nil
+}
+
+// localPod holds the processes of one run of the pod of a job.
+type localPod struct {
+	job      *batchv1.Job
+	initCmds []*exec.Cmd
+	cmd      *exec.Cmd
+	output   *limitedBuffer
+	// sboms holds the output of the SBOM init containers by format
+	sboms map[scanner.SBOMFormat]*limitedBuffer
+}
+
+func (r *Runner) pod(ctx context.Context, scratch string, job *batchv1.Job, container *corev1.Container, limit int) (*localPod, error) {
+	cmd, err := command(ctx, r.Files, scratch, job, container)
+	if err != nil {
+		return nil, err
+	}
+	p := &localPod{job: job, cmd: cmd, output: &limitedBuffer{limit: limit}, sboms: map[scanner.SBOMFormat]*limitedBuffer{}}
+	cmd.Stdout = p.output
+	cmd.Stderr = os.Stderr
+	for i, c := range job.Spec.Template.Spec.InitContainers {
+		initCmd, err := command(ctx, r.Files, scratch, job, &job.Spec.Template.Spec.InitContainers[i])
+		if err != nil {
+			return nil, err
+		}
+		initCmd.Stdout, initCmd.Stderr = os.Stderr, os.Stderr
+		if format, ok := scanner.ParseSBOMContainerName(c.Name); ok {
+			p.sboms[format] = &limitedBuffer{limit: limit}
+			initCmd.Stdout = p.sboms[format]
+		}
+		p.initCmds = append(p.initCmds, initCmd)
+	}
+	return p, nil
+}
+
+// run runs the init containers first, like in a pod, then the scan. It returns the reason if the scan didn't
+// produce output to parse.
+func (p *localPod) run() (string, error) {
+	for i, initCmd := range p.initCmds {
+		if err := initCmd.Run(); err != nil {
+			return fmt.Sprintf("init container %s: %s", p.job.Spec.Template.Spec.InitContainers[i].Name, err), err
+		}
+	}
+	err := p.cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		// the process didn't start
+		return err.Error(), err
+	}
+	return "", err
+}
+
+func (r *Runner) addJob(name string) bool {
+	r.jobsMu.Lock()
+	defer r.jobsMu.Unlock()
+	if _, ok := r.jobs.Get(name); ok {
+		return false
+	}
+	r.jobs.Add(name, struct{}{})
+	return true
+}
+
+func (r *Runner) record(ctx context.Context, scan *finishedScan) {
+	log := logf.FromContext(ctx)
+	res, ok := controller.ScanJobResult(scan.job, scan.outcome, scan.finishedAt)
+	if !ok {
+		return
+	}
+	metrics.ScanFinished(res.Event.Registry, res.Event.Repository, scan.outcome, scan.duration)
+	if r.Results == nil && r.Referrers == nil && r.SBOMs == nil && r.Inventory == nil {
+		return
+	}
+
+	if scan.reason != "" {
+		res.Reason = scan.reason
+	} else if err := controller.AddFindings(&res, scan.output); err != nil {
+		log.Error(err, "reading scan findings")
+		res.Reason = err.Error()
+	} else if res.Verdict != "" {
+		metrics.ScanVerdict(res.Event.Registry, res.Event.Repository, string(res.Verdict))
+	}
+	if r.Results != nil {
+		if err := r.Results.Record(ctx, res); err != nil {
+			log.Error(err, "recording scan result")
+		}
+	}
+	if r.SBOMs != nil {
+		if err := controller.StoreSBOMs(ctx, r.SBOMs, res.Event, scan.sboms); err != nil {
+			log.Error(err, "storing SBOMs")
+		}
+	}
+	if r.Inventory != nil {
+		if err := r.Inventory.AddSBOMs(res.Event, scan.sboms); err != nil {
+			log.Error(err, "indexing SBOM packages")
+		}
+	}
+	if r.Referrers != nil && res.Reason == "" {
+		if err := controller.AttachArtifacts(ctx, r.Referrers, res, scan.output, scan.sboms); err != nil {
+			log.Error(err, "attaching artifacts to image")
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package standalone
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/api/v1alpha1"
+	"github.com/stackitcloud/registry-snyk-scan/controller"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+type linuxAMD64 struct{}
+
+func (linuxAMD64) Platform(context.Context, types.RegistryEvent) (imagev1.Platform, error) {
+	return imagev1.Platform{OS: "linux", Architecture: "amd64"}, nil
+}
+
+var _ = Describe("Runner", func() {
+	e := types.RegistryEvent{Registry: "registry.example.com", Repository: "app", Tag: "v1", Digest: "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"}
+
+	It("should run every scan once and record its findings", func(ctx SpecContext) {
+		// a fake trivy printing a report and counting its runs
+		bin := GinkgoT().TempDir()
+		runs := filepath.Join(bin, "runs")
+		Expect(os.WriteFile(filepath.Join(bin, "trivy"), []byte(`#!/bin/sh
+echo run >> `+runs+`
+echo '{"Results":[{"Vulnerabilities":[{"VulnerabilityID":"CVE-2024-1","PkgName":"openssl","Severity":"HIGH"}]}]}'
+`), 0o700)).To(Succeed())
+		GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		store := results.NewMemoryStore()
+		reconciler := &controller.Reconciler{
+			Namespace: "default",
+			Registry:  linuxAMD64{},
+			Results:   store,
+			Scanner:   controller.Scanner{Backend: scanner.BackendTrivy},
+		}
+		runner := &Runner{Reconciler: reconciler, Files: &Files{Dir: bin}, Results: store}
+		reconciler.Jobs = runner
+
+		events := make(chan event.TypedGenericEvent[types.RegistryEvent], 2)
+		events <- event.TypedGenericEvent[types.RegistryEvent]{Object: e}
+		ctx2, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- runner.Start(ctx2, events) }()
+
+		Eventually(func(g Gomega) {
+			list, err := store.List(ctx, results.Filter{})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(list).To(HaveLen(1))
+			g.Expect(list[0].Status).To(Equal(results.StatusScanned))
+			g.Expect(list[0].Vulnerabilities).To(Equal(scanner.Summary{scanner.SeverityHigh: 1}))
+		}).Should(Succeed())
+
+		// a repeated notification doesn't scan the image again
+		events <- event.TypedGenericEvent[types.RegistryEvent]{Object: e}
+		Consistently(func(g Gomega) {
+			data, err := os.ReadFile(runs)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(strings.Count(string(data), "run")).To(Equal(1))
+			list, err := store.List(ctx, results.Filter{})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(list[0].Status).To(Equal(results.StatusScanned))
+		}).Should(Succeed())
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should run init containers first", func(ctx SpecContext) {
+		bin := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(bin, "snyk"), []byte(`#!/bin/sh
+[ "$2" = monitor ] && exit 3
+echo '{"ok":true,"vulnerabilities":[]}'
+`), 0o700)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(bin, "snyk-token"), 0o700)).To(Succeed())
+		for _, key := range []string{"SNYK_TOKEN", "SNYK_ORG"} {
+			Expect(os.WriteFile(filepath.Join(bin, "snyk-token", key), []byte("x"), 0o600)).To(Succeed())
+		}
+		GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		store := results.NewMemoryStore()
+		reconciler := &controller.Reconciler{
+			Namespace: "default",
+			Registry:  linuxAMD64{},
+			Results:   store,
+			Scanner:   controller.Scanner{Snyk: v1alpha1.SnykOptions{Mode: string(scanner.SnykMonitorAndTest)}},
+		}
+		runner := &Runner{Reconciler: reconciler, Files: &Files{Dir: bin}, Results: store, RetryDelay: time.Millisecond}
+		reconciler.Jobs = runner
+		runner.init()
+		runner.queue.Add(e)
+		Expect(runner.processNext(ctx)).To(BeTrue())
+
+		list, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Status).To(Equal(results.StatusScanFailed))
+		Expect(list[0].Reason).To(HavePrefix("init container monitor:"))
+		Expect(list[0].Verdict).To(BeEmpty())
+	})
+
+	It("should retry failed scans up to the backoff limit", func(ctx SpecContext) {
+		// a fake trivy failing on its first two runs
+		bin := GinkgoT().TempDir()
+		runs := filepath.Join(bin, "runs")
+		Expect(os.WriteFile(filepath.Join(bin, "trivy"), []byte(`#!/bin/sh
+echo run >> `+runs+`
+[ "$(wc -l < `+runs+`)" -le 2 ] && exit 2
+echo '{"Results":[]}'
+`), 0o700)).To(Succeed())
+		GinkgoT().Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		store := results.NewMemoryStore()
+		reconciler := &controller.Reconciler{
+			Namespace: "default",
+			Registry:  linuxAMD64{},
+			Results:   store,
+			Scanner:   controller.Scanner{Backend: scanner.BackendTrivy},
+		}
+		runner := &Runner{Reconciler: reconciler, Files: &Files{Dir: bin}, Results: store, RetryDelay: time.Millisecond}
+		reconciler.Jobs = runner
+		runner.init()
+
+		reconciler.JobTemplate.BackoffLimit = ptr.To[int32](1)
+		runner.queue.Add(e)
+		Expect(runner.processNext(ctx)).To(BeTrue())
+		list, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(ConsistOf(HaveField("Status", results.StatusScanFailed)))
+
+		// a rescan gets a new job name
+		reconciler.JobTemplate.BackoffLimit = ptr.To[int32](2)
+		runner.queue.Add(types.RegistryEvent{Registry: e.Registry, Repository: e.Repository, Tag: e.Tag, Digest: e.Digest, Advisory: "GHSA-1"})
+		Expect(runner.processNext(ctx)).To(BeTrue())
+		list, err = store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(ContainElement(And(HaveField("Event.Advisory", "GHSA-1"), HaveField("Status", results.StatusScanned))))
+		data, err := os.ReadFile(runs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(string(data), "run")).To(Equal(3))
+	})
+
+	It("should record scans that fail to start", func(ctx SpecContext) {
+		store := results.NewMemoryStore()
+		reconciler := &controller.Reconciler{
+			Namespace: "default",
+			Registry:  linuxAMD64{},
+			Results:   store,
+			Scanner:   controller.Scanner{Backend: scanner.BackendGrype, Image: "registry.example.com/does-not-exist"},
+		}
+		runner := &Runner{Reconciler: reconciler, Files: &Files{Dir: GinkgoT().TempDir()}, Results: store}
+		reconciler.Jobs = runner
+
+		runner.init()
+		runner.queue.Add(e)
+		Expect(runner.processNext(ctx)).To(BeTrue())
+
+		list, err := store.List(ctx, results.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Status).To(Equal(results.StatusScanFailed))
+		Expect(list[0].Reason).To(ContainSubstring("does-not-exist"))
+	})
+})
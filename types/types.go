@@ -1,19 +1,16 @@
 package types
 
 import (
-	"crypto/tls"
+	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
+	"slices"
 
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 
+	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/notifications"
 	"github.com/opencontainers/go-digest"
-
-	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/name"
-	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
 type RegistryEvent struct {
@@ -21,6 +18,21 @@ type RegistryEvent struct {
 	Repository string
 	Tag        string
 	Digest     digest.Digest
+	// MediaType is the media type of the manifest, if known.
+	MediaType string
+	// ConfigDigest is the digest of the image config, if the notification included references.
+	ConfigDigest digest.Digest
+	// Tenant that sent the notification to POST /event/{tenant}, empty for POST /event.
+	Tenant string
+	// Advisory is the ID of the vulnerability advisory that triggered a rescan of the image, empty for pushes.
+	Advisory string
+	// BaseUpdate is the new digest of the base image that triggered a rescan of the image, empty for pushes.
+	BaseUpdate digest.Digest
+}
+
+var configMediaTypes = []string{
+	schema2.MediaTypeImageConfig,
+	v1.MediaTypeImageConfig,
 }
 
 func (e RegistryEvent) Reference() string {
@@ -30,54 +42,50 @@ func (e RegistryEvent) Reference() string {
 	return fmt.Sprintf("%s/%s@%s", e.Registry, e.Repository, e.Digest)
 }
 
-func RegistryEventFromNotificationsEvent(e *notifications.Event) RegistryEvent {
+// RepositoryPath returns the registry and repository of the event, which repository patterns are matched against.
+func (e RegistryEvent) RepositoryPath() string {
+	return e.Registry + "/" + e.Repository
+}
+
+// ShardKey returns the key used to assign the event to a shard. All events of a repository belong to the same shard.
+func (e RegistryEvent) ShardKey() string {
+	return e.RepositoryPath()
+}
+
+// RegistryEventFromNotificationsEvent converts and validates a notification event.
+// rewriteHost, if set, turns the host of the target URL into the registry before the event is validated.
+// Malformed events are reported with an *InvalidEventError.
+func RegistryEventFromNotificationsEvent(e *notifications.Event, rewriteHost func(string) string) (RegistryEvent, error) {
 	u, err := url.Parse(e.Target.URL)
 	if err != nil {
-		panic(err)
+		return RegistryEvent{}, &InvalidEventError{EventID: e.ID, Field: "target.url", Reason: err.Error()}
+	}
+	if u.Host == "" {
+		return RegistryEvent{}, &InvalidEventError{EventID: e.ID, Field: "target.url", Reason: "missing host"}
 	}
 
-	return RegistryEvent{
+	registryEvent := RegistryEvent{
 		Repository: e.Target.Repository,
 		Tag:        e.Target.Tag,
 		Registry:   u.Host,
 		Digest:     e.Target.Digest,
+		MediaType:  e.Target.MediaType,
 	}
-}
-
-// exposed for overriding in tests
-var RemoteImage = remote.Image
-
-func (e RegistryEvent) Platform(insecureRegistry bool) (v1.Platform, error) {
-	ref, err := name.ParseReference(e.Reference())
-	if err != nil {
-		return v1.Platform{}, err
-	}
-
-	options := []remote.Option{
-		remote.WithAuthFromKeychain(authn.DefaultKeychain),
+	if rewriteHost != nil {
+		registryEvent.Registry = rewriteHost(registryEvent.Registry)
 	}
-
-	if insecureRegistry {
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
+	for _, ref := range e.Target.References {
+		if slices.Contains(configMediaTypes, ref.MediaType) {
+			registryEvent.ConfigDigest = ref.Digest
+			break
 		}
-		options = append(options, remote.WithTransport(tr))
 	}
-
-	img, err := RemoteImage(ref, options...)
-	if err != nil {
-		return v1.Platform{}, err
-	}
-
-	configFile, err := img.ConfigFile()
-	if err != nil {
-		return v1.Platform{}, err
+	if err := registryEvent.Validate(); err != nil {
+		var invalid *InvalidEventError
+		if errors.As(err, &invalid) {
+			invalid.EventID = e.ID
+		}
+		return RegistryEvent{}, err
 	}
-
-	return v1.Platform{
-		Architecture: configFile.Architecture,
-		OS:           configFile.OS,
-	}, nil
+	return registryEvent, nil
 }
@@ -1,11 +1,20 @@
 package types
 
 import (
+	"errors"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/notifications"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"testing"
+	"github.com/opencontainers/go-digest"
 )
 
+func digestOf(s string) digest.Digest {
+	return digest.Digest(s)
+}
+
 func TestRegistryEvent(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "RegistryEvent Suite")
@@ -39,4 +48,60 @@ var _ = Describe("RegistryEvent", func() {
 			})
 		})
 	})
+
+	Describe("RegistryEventFromNotificationsEvent", func() {
+		newEvent := func(url, repository, tag, digest string) *notifications.Event {
+			e := &notifications.Event{ID: "event-1"}
+			e.Target.URL = url
+			e.Target.Repository = repository
+			e.Target.Tag = tag
+			e.Target.Descriptor = distribution.Descriptor{Digest: digestOf(digest)}
+			return e
+		}
+		validDigest := "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"
+
+		It("converts a valid event", func() {
+			e, err := RegistryEventFromNotificationsEvent(newEvent("https://registry:5000/v2/team/app/manifests/"+validDigest, "team/app", "v1", validDigest), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(e).To(Equal(RegistryEvent{Registry: "registry:5000", Repository: "team/app", Tag: "v1", Digest: digestOf(validDigest)}))
+		})
+
+		It("takes the config digest from the references", func() {
+			e := newEvent("https://registry/v2/app/manifests/"+validDigest, "app", "v1", validDigest)
+			e.Target.References = []distribution.Descriptor{
+				{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: "sha256:1111111111111111111111111111111111111111111111111111111111111111"},
+				{MediaType: "application/vnd.oci.image.config.v1+json", Digest: "sha256:2222222222222222222222222222222222222222222222222222222222222222"},
+			}
+			registryEvent, err := RegistryEventFromNotificationsEvent(e, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(registryEvent.ConfigDigest).To(Equal(digestOf("sha256:2222222222222222222222222222222222222222222222222222222222222222")))
+		})
+
+		It("validates the rewritten registry", func() {
+			e := newEvent("https://registry.svc:5000/v2/app/manifests/"+validDigest, "app", "v1", validDigest)
+			registryEvent, err := RegistryEventFromNotificationsEvent(e, func(string) string { return "registry.example.com" })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(registryEvent.Registry).To(Equal("registry.example.com"))
+
+			_, err = RegistryEventFromNotificationsEvent(e, func(string) string { return "Not A Host" })
+			Expect(err).To(MatchError(ContainSubstring("invalid registry")))
+		})
+
+		DescribeTable("rejects malformed events", func(e *notifications.Event, field string) {
+			_, err := RegistryEventFromNotificationsEvent(e, nil)
+			var invalid *InvalidEventError
+			Expect(err).To(BeAssignableToTypeOf(invalid))
+			Expect(errors.As(err, &invalid)).To(BeTrue())
+			Expect(invalid.EventID).To(Equal("event-1"))
+			Expect(invalid.Field).To(Equal(field))
+		},
+			Entry("unparsable url", newEvent("://registry", "app", "v1", validDigest), "target.url"),
+			Entry("url without host", newEvent("/v2/app/manifests/latest", "app", "v1", validDigest), "target.url"),
+			Entry("empty repository", newEvent("https://registry", "", "v1", validDigest), "repository"),
+			Entry("invalid repository", newEvent("https://registry", "App/UPPER", "v1", validDigest), "repository"),
+			Entry("invalid tag", newEvent("https://registry", "app", "v1/x", validDigest), "tag"),
+			Entry("empty digest", newEvent("https://registry", "app", "v1", ""), "digest"),
+			Entry("short digest", newEvent("https://registry", "app", "v1", "sha256:1234"), "digest"),
+		)
+	})
 })
@@ -0,0 +1,56 @@
+package types
+
+import (
+	// register the hash functions for digest validation
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// InvalidEventError is returned for events that can't be turned into a scannable RegistryEvent.
+type InvalidEventError struct {
+	// EventID is the ID of the notification event, if known.
+	EventID string
+	// Field is the event field that failed validation.
+	Field  string
+	Reason string
+}
+
+func (e *InvalidEventError) Error() string {
+	if e.EventID == "" {
+		return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("event %s: invalid %s: %s", e.EventID, e.Field, e.Reason)
+}
+
+// Validate checks that all fields of the event form a valid image reference.
+func (e RegistryEvent) Validate() error {
+	if e.Registry == "" {
+		return &InvalidEventError{Field: "registry", Reason: "must not be empty"}
+	}
+	if _, err := name.NewRegistry(e.Registry, name.StrictValidation); err != nil {
+		return &InvalidEventError{Field: "registry", Reason: err.Error()}
+	}
+	if e.Repository == "" {
+		return &InvalidEventError{Field: "repository", Reason: "must not be empty"}
+	}
+	named, err := reference.WithName(e.Registry + "/" + e.Repository)
+	if err != nil {
+		return &InvalidEventError{Field: "repository", Reason: err.Error()}
+	}
+	if e.Tag != "" {
+		if _, err := reference.WithTag(named, e.Tag); err != nil {
+			return &InvalidEventError{Field: "tag", Reason: err.Error()}
+		}
+	}
+	if e.Digest == "" {
+		return &InvalidEventError{Field: "digest", Reason: "must not be empty"}
+	}
+	if err := e.Digest.Validate(); err != nil {
+		return &InvalidEventError{Field: "digest", Reason: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+)
+
+// Filters select the notification events that are passed on to the controller.
+type Filters struct {
+	// Actions defaults to push.
+	Actions []string `json:"actions,omitempty"`
+	// MediaTypes of the manifests, defaults to docker v2 and OCI image manifests.
+	MediaTypes []string `json:"mediaTypes,omitempty"`
+	// IncludeRepositories and ExcludeRepositories are glob patterns matched against "<registry>/<repository>"
+	// after rewriting the registry host, see path.Match. Without include patterns, all repositories are included.
+	// Exclude patterns take precedence.
+	IncludeRepositories []string `json:"includeRepositories,omitempty"`
+	ExcludeRepositories []string `json:"excludeRepositories,omitempty"`
+}
+
+// DefaultActions are the actions of events passed on if Filters has no Actions.
+var DefaultActions = []string{notifications.EventActionPush}
+
+// DefaultMediaTypes are the manifest media types of events passed on if Filters has no MediaTypes.
+var DefaultMediaTypes = []string{
+	schema2.MediaTypeManifest,
+	imagev1.MediaTypeImageManifest,
+}
+
+// Validate checks the repository patterns.
+func (f Filters) Validate() error {
+	for _, p := range slices.Concat(f.IncludeRepositories, f.ExcludeRepositories) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid repository pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+func (f Filters) actions() []string {
+	if len(f.Actions) == 0 {
+		return DefaultActions
+	}
+	return f.Actions
+}
+
+func (f Filters) mediaTypes() []string {
+	if len(f.MediaTypes) == 0 {
+		return DefaultMediaTypes
+	}
+	return f.MediaTypes
+}
+
+// includesRepository matches key, which is "<registry>/<repository>", against the repository patterns.
+func (f Filters) includesRepository(key string) bool {
+	matches := func(p string) bool {
+		ok, _ := path.Match(p, key)
+		return ok
+	}
+	if slices.ContainsFunc(f.ExcludeRepositories, matches) {
+		return false
+	}
+	return len(f.IncludeRepositories) == 0 || slices.ContainsFunc(f.IncludeRepositories, matches)
+}
+
+func filterEvents(f Filters, events []notifications.Event) []notifications.Event {
+	// filter out all events with other actions, usually pulls
+	n := len(events)
+	events = slices.DeleteFunc(events, func(e notifications.Event) bool {
+		return !slices.Contains(f.actions(), e.Action)
+	})
+	metrics.FilteredEvents(metrics.FilterReasonAction, n-len(events))
+
+	// filter out non manifest mediaTypes
+	n = len(events)
+	events = slices.DeleteFunc(events, func(e notifications.Event) bool {
+		return !slices.Contains(f.mediaTypes(), e.Target.MediaType)
+	})
+	metrics.FilteredEvents(metrics.FilterReasonMediaType, n-len(events))
+
+	return events
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"github.com/docker/distribution/notifications"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = DescribeTable("Filters.includesRepository", func(f Filters, key string, expected bool) {
+	Expect(f.includesRepository(key)).To(Equal(expected))
+},
+	Entry("everything without patterns", Filters{}, "registry.example.com/team/app", true),
+	Entry("matching include", Filters{IncludeRepositories: []string{"registry.example.com/team/*"}}, "registry.example.com/team/app", true),
+	Entry("no matching include", Filters{IncludeRepositories: []string{"registry.example.com/team/*"}}, "registry.example.com/other/app", false),
+	Entry("exclude takes precedence", Filters{
+		IncludeRepositories: []string{"registry.example.com/team/*"},
+		ExcludeRepositories: []string{"*/team/cache"},
+	}, "registry.example.com/team/cache", false),
+)
+
+var _ = Describe("Filters", func() {
+	It("should reject invalid patterns", func() {
+		Expect(Filters{ExcludeRepositories: []string{"[a"}}.Validate()).To(MatchError(ContainSubstring(`"[a"`)))
+	})
+
+	It("should pass on the configured actions", func() {
+		events := []notifications.Event{
+			{Action: notifications.EventActionPush},
+			{Action: notifications.EventActionMount},
+		}
+		for i := range events {
+			events[i].Target.MediaType = DefaultMediaTypes[0]
+		}
+		filtered := filterEvents(Filters{Actions: []string{notifications.EventActionMount}}, events)
+		Expect(filtered).To(HaveLen(1))
+		Expect(filtered[0].Action).To(Equal(notifications.EventActionMount))
+	})
+})
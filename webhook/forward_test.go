@@ -0,0 +1,270 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/ha"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	runtime_event "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+type fakeForwarder struct {
+	leader   bool
+	err      error
+	method   string
+	path     string
+	body     string
+	forwards int
+}
+
+func (f *fakeForwarder) IsLeader() bool {
+	return f.leader
+}
+
+func (f *fakeForwarder) Forward(_ context.Context, method, path string, _ http.Header, body []byte) (int, string, []byte, error) {
+	f.forwards++
+	f.method, f.path, f.body = method, path, string(body)
+	if f.err != nil {
+		return 0, "", nil, f.err
+	}
+	return http.StatusAccepted, "text/plain", []byte("forwarded"), nil
+}
+
+var _ = Describe("Forwarding", func() {
+	var forwarder *fakeForwarder
+
+	BeforeEach(func() {
+		forwarder = &fakeForwarder{}
+		s, err := NewServer(8081, eventChan, zap.New(), WithForwarder(forwarder), WithResults(results.NewMemoryStore()),
+			WithForwardSecret("s3cret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			_ = s.ListenAndServe(ctx)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			<-done
+		})
+		Eventually(func() error { return s.Healthz(nil) }, 5*time.Second).Should(Succeed())
+	})
+
+	post := func(forwarded string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:8081/event", strings.NewReader(`{"events":[]}`))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		if forwarded != "" {
+			req.Header.Set(ha.ForwardedHeader, forwarded)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, string(body)
+	}
+
+	It("should process notifications on the leader", func() {
+		forwarder.leader = true
+		status, _ := post("")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(forwarder.forwards).To(BeZero())
+	})
+
+	It("should relay the leader's response on other replicas", func() {
+		status, body := post("")
+		Expect(status).To(Equal(http.StatusAccepted))
+		Expect(body).To(Equal("forwarded"))
+		Expect(forwarder.path).To(Equal("/event"))
+		Expect(forwarder.body).To(Equal(`{"events":[]}`))
+	})
+
+	It("should not forward a notification twice", func() {
+		status, _ := post("s3cret")
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		Expect(forwarder.forwards).To(BeZero())
+	})
+
+	It("should forward notifications with a wrong forwarded header", func() {
+		status, _ := post("true")
+		Expect(status).To(Equal(http.StatusAccepted))
+		Expect(forwarder.forwards).To(Equal(1))
+	})
+
+	It("should serve results on the leader", func() {
+		forwarder.leader = true
+		resp, err := http.Get("http://localhost:8081/results?tenant=team-a")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(forwarder.forwards).To(BeZero())
+	})
+
+	It("should forward reads of results to the leader on other replicas", func() {
+		resp, err := http.Get("http://localhost:8081/results?tenant=team-a")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/plain"))
+		Expect(forwarder.method).To(Equal(http.MethodGet))
+		Expect(forwarder.path).To(Equal("/results?tenant=team-a"))
+	})
+
+	It("should ask the registry to retry if forwarding fails", func() {
+		forwarder.err = errors.New("no leader elected")
+		status, body := post("")
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+		Expect(body).To(ContainSubstring("no leader elected"))
+	})
+})
+
+type fakeRouter struct {
+	status int
+	body   string
+	err    error
+	shard  string
+	events []notifications.Event
+	// queued is the number of enqueued events when events were forwarded
+	queued int
+}
+
+func (f *fakeRouter) Route(e types.RegistryEvent) (string, bool) {
+	if e.Repository == "local" {
+		return "self", true
+	}
+	return "other", false
+}
+
+func (f *fakeRouter) ForwardTo(_ context.Context, shard, _ string, _ http.Header, body []byte) (int, []byte, error) {
+	f.shard, f.queued = shard, len(eventChan)
+	var envelope notifications.Envelope
+	Expect(json.Unmarshal(body, &envelope)).To(Succeed())
+	f.events = envelope.Events
+	if f.err != nil {
+		return 0, nil, f.err
+	}
+	return f.status, []byte(f.body), nil
+}
+
+var _ = Describe("Routing", func() {
+	var router *fakeRouter
+
+	BeforeEach(func() {
+		router = &fakeRouter{status: http.StatusOK}
+		s, err := NewServer(8083, eventChan, zap.New(), WithRouter(router), WithForwardSecret("s3cret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			_ = s.ListenAndServe(ctx)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			<-done
+		})
+		Eventually(func() error { return s.Healthz(nil) }, 5*time.Second).Should(Succeed())
+	})
+
+	pushEvent := func(id, repository string) notifications.Event {
+		return notifications.Event{
+			ID:     id,
+			Action: notifications.EventActionPush,
+			Target: target{
+				Descriptor: distribution.Descriptor{
+					MediaType: schema2.MediaTypeManifest,
+					Digest:    "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+				},
+				Repository: repository,
+				URL:        "https://registry.example.com/v2/" + repository + "/manifests/sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+			},
+		}
+	}
+
+	post := func(forwarded string, events ...notifications.Event) (int, string) {
+		body, err := json.Marshal(notifications.Envelope{Events: events})
+		Expect(err).NotTo(HaveOccurred())
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:8083/event", bytes.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		if forwarded != "" {
+			req.Header.Set(ha.ForwardedHeader, forwarded)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return resp.StatusCode, string(respBody)
+	}
+
+	receiveRepository := func() string {
+		var e runtime_event.TypedGenericEvent[types.RegistryEvent]
+		Eventually(eventChan, 5*time.Second).Should(Receive(&e))
+		return e.Object.Repository
+	}
+
+	It("should enqueue owned events and forward the others to their shard", func() {
+		status, _ := post("", pushEvent("1", "local"), pushEvent("2", "remote"))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(receiveRepository()).To(Equal("local"))
+		Expect(router.shard).To(Equal("other"))
+		Expect(router.events).To(HaveLen(1))
+		Expect(router.events[0].ID).To(Equal("2"))
+	})
+
+	It("should process forwarded events locally", func() {
+		status, _ := post("s3cret", pushEvent("2", "remote"))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(receiveRepository()).To(Equal("remote"))
+		Expect(router.events).To(BeEmpty())
+	})
+
+	It("should route events with a wrong forwarded header", func() {
+		status, _ := post("true", pushEvent("2", "remote"))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(router.events).To(HaveLen(1))
+		Consistently(eventChan).ShouldNot(Receive())
+	})
+
+	It("should pass on events rejected by the shard", func() {
+		router.body = `{"rejected":[{"id":"2","reason":"invalid"}]}`
+		status, body := post("", pushEvent("2", "remote"))
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(body).To(ContainSubstring(`"id":"2"`))
+	})
+
+	It("should forward events before enqueueing the owned ones", func() {
+		status, _ := post("", pushEvent("1", "local"), pushEvent("2", "remote"))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(router.queued).To(BeZero())
+		Expect(receiveRepository()).To(Equal("local"))
+	})
+
+	It("should process the events of an unavailable shard locally", func() {
+		router.err = errors.New("connection refused")
+		status, _ := post("", pushEvent("2", "remote"))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(router.events).To(HaveLen(1))
+		Expect(receiveRepository()).To(Equal("remote"))
+	})
+})
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+)
+
+// WithInventory answers which images contain a package version at GET /inventory.
+func WithInventory(i *inventory.Index) Option {
+	return func(s *Server) {
+		s.inventory = i
+	}
+}
+
+// handleInventory responds with the digests containing the package of the query parameter package, which is a name
+// optionally followed by @ and a version range like openssl@>=3.0.0,<3.0.12. The range can also be passed
+// as parameter version, and the ecosystem as parameter ecosystem. Tenants only get the images of their own events.
+func (s *Server) handleInventory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		name, versions := query.Get("package"), query.Get("version")
+		// npm scopes start with @
+		if i := strings.LastIndex(name, "@"); i > 0 {
+			name, versions = name[:i], name[i+1:]
+		}
+		if name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "query parameter package is required")
+			return
+		}
+		versionRange, err := inventory.ParseRange(versions)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "invalid version range: %s", err)
+			return
+		}
+		matches := s.inventory.Find(inventory.Query{
+			Name:      name,
+			Ecosystem: query.Get("ecosystem"),
+			Versions:  versionRange,
+		})
+		// tenants only see their own images
+		own := []inventory.Match{}
+		for _, m := range matches {
+			if m.Images = tenantImages(callerTenant(r), m.Images); len(m.Images) > 0 {
+				own = append(own, m)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(own)
+	}
+}
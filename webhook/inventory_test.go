@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Inventory", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		index := inventory.NewIndex(0)
+		index.Add(types.RegistryEvent{Registry: "registry.example.com", Repository: "team/app", Tag: "v1", Digest: digest.FromString("app")}, []inventory.Package{
+			{Name: "openssl", Version: "3.0.11-1~deb12u1", Ecosystem: "Debian"},
+			{Name: "@angular/core", Version: "16.0.0", Ecosystem: "npm"},
+		})
+		var err error
+		s, err = NewServer(0, eventChan, zap.New(), WithInventory(index))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	find := func(path string) []inventory.Match {
+		rec := get(path)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/json"))
+		var matches []inventory.Match
+		Expect(json.Unmarshal(rec.Body.Bytes(), &matches)).To(Succeed())
+		return matches
+	}
+
+	It("should list the images containing a package version", func() {
+		Expect(find("/inventory?package=openssl@%3E%3D3.0.0,%3C3.0.12&ecosystem=Debian")).To(ConsistOf(And(
+			HaveField("Package.Version", "3.0.11-1~deb12u1"),
+			HaveField("Images", ConsistOf(HaveField("Tag", "v1"))),
+		)))
+		Expect(find("/inventory?package=openssl&version=%3E%3D3.0.12")).To(BeEmpty())
+		Expect(find("/inventory?package=@angular/core@16.0.0")).To(HaveLen(1))
+		Expect(get("/inventory?package=nothing").Body.String()).To(MatchJSON(`[]`))
+	})
+
+	It("should reject queries without package or with invalid ranges", func() {
+		Expect(get("/inventory").Code).To(Equal(http.StatusBadRequest))
+		Expect(get("/inventory?package=openssl@%3E%3D").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should serve tenants only their own images", func() {
+		index := inventory.NewIndex(0)
+		packages := []inventory.Package{{Name: "openssl", Version: "3.0.11-1~deb12u1", Ecosystem: "Debian"}}
+		index.Add(types.RegistryEvent{Registry: "registry.example.com", Repository: "team-a/app", Tag: "v1", Digest: digest.FromString("app"), Tenant: "team-a"}, packages)
+		index.Add(types.RegistryEvent{Registry: "registry.example.com", Repository: "team-b/app", Tag: "v1", Digest: digest.FromString("app"), Tenant: "team-b"}, packages)
+		index.Add(types.RegistryEvent{Registry: "registry.example.com", Repository: "team-b/other", Tag: "v1", Digest: digest.FromString("other"), Tenant: "team-b"}, packages)
+		s, err := NewServer(0, eventChan, zap.New(), append(tenantOptions(), WithInventory(index))...)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getAs(s, "/inventory?package=openssl", "").Code).To(Equal(http.StatusUnauthorized))
+		var matches []inventory.Match
+		Expect(json.Unmarshal(getAs(s, "/inventory?package=openssl", "t0ken-a").Body.Bytes(), &matches)).To(Succeed())
+		Expect(matches).To(ConsistOf(HaveField("Images", ConsistOf(HaveField("Repository", "team-a/app")))))
+		Expect(json.Unmarshal(getAs(s, "/inventory?package=openssl", "adm1n").Body.Bytes(), &matches)).To(Succeed())
+		Expect(matches).To(HaveLen(2))
+	})
+})
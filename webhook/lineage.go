@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/lineage"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+)
+
+// WithLineage serves the base images of pushed images at GET /lineage/{digest} and the images built on a base that
+// was pushed again at GET /lineage/outdated. The results of GET /results are marked as outdated accordingly.
+func WithLineage(g *lineage.Graph) Option {
+	return func(s *Server) {
+		s.lineage = g
+	}
+}
+
+// lineageResult is a result re-evaluated against the lineage of its image.
+type lineageResult struct {
+	results.Result
+	Outdated *lineage.Outdated `json:"outdated,omitempty"`
+}
+
+// withLineage marks the results of outdated images. With the query parameter outdated set to true or false,
+// only the outdated or current ones are returned.
+func (s *Server) withLineage(r *http.Request, list []results.Result) ([]lineageResult, error) {
+	filter := r.URL.Query().Get("outdated")
+	if filter != "" && filter != "true" && filter != "false" {
+		return nil, fmt.Errorf("outdated must be true or false")
+	}
+	marked := []lineageResult{}
+	for _, res := range list {
+		outdated := s.tenantOutdated(callerTenant(r), s.lineage.Outdated(res.Event.Digest))
+		if (filter == "true" && outdated == nil) || (filter == "false" && outdated != nil) {
+			continue
+		}
+		marked = append(marked, lineageResult{Result: res, Outdated: outdated})
+	}
+	return marked, nil
+}
+
+// handleLineage responds with the base and children of a digest.
+func (s *Server) handleLineage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, err := digest.Parse(r.PathValue("digest"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "invalid digest: %s", err)
+			return
+		}
+		node, ok := s.lineage.Get(d)
+		if ok {
+			node, ok = s.tenantNode(callerTenant(r), node)
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "%s was not pushed", d)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(node)
+	}
+}
+
+// tenantNode returns n with only the images and children of tenant, and false if tenant didn't push n.
+// The base is reduced to its digest if tenant didn't push it. An empty tenant gets n unchanged.
+func (s *Server) tenantNode(tenant string, n lineage.Node) (lineage.Node, bool) {
+	if tenant == "" {
+		return n, true
+	}
+	if n.Images = tenantImages(tenant, n.Images); len(n.Images) == 0 {
+		return lineage.Node{}, false
+	}
+	var children []digest.Digest
+	for _, d := range n.Children {
+		if child, ok := s.lineage.Get(d); ok && len(tenantImages(tenant, child.Images)) > 0 {
+			children = append(children, d)
+		}
+	}
+	n.Children = children
+	if n.Base != nil && !s.pushedBy(tenant, n.Base.Digest) {
+		n.Base = &lineage.Base{Digest: n.Base.Digest, Source: n.Base.Source}
+	}
+	n.Outdated = s.tenantOutdated(tenant, n.Outdated)
+	return n, true
+}
+
+// tenantOutdated returns o without the tag and current digest of the base if tenant didn't push the base.
+func (s *Server) tenantOutdated(tenant string, o *lineage.Outdated) *lineage.Outdated {
+	if o == nil || s.pushedBy(tenant, o.Digest) {
+		return o
+	}
+	return &lineage.Outdated{Digest: o.Digest, Since: o.Since}
+}
+
+// pushedBy reports whether tenant pushed d, which is true for all digests if tenant is empty.
+func (s *Server) pushedBy(tenant string, d digest.Digest) bool {
+	if tenant == "" {
+		return true
+	}
+	n, ok := s.lineage.Get(d)
+	return ok && len(tenantImages(tenant, n.Images)) > 0
+}
+
+// handleOutdated responds with the outdated images, only those built on the digest of the query parameter base
+// if it is set.
+func (s *Server) handleOutdated() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var base digest.Digest
+		if b := r.URL.Query().Get("base"); b != "" {
+			var err error
+			if base, err = digest.Parse(b); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "invalid base digest: %s", err)
+				return
+			}
+		}
+		nodes := []lineage.Node{}
+		for _, n := range s.lineage.ListOutdated(base) {
+			if n, ok := s.tenantNode(callerTenant(r), n); ok {
+				nodes = append(nodes, n)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(nodes)
+	}
+}
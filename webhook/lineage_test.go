@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/lineage"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Lineage", func() {
+	var s *Server
+	base := types.RegistryEvent{Registry: "registry.example.com", Repository: "base/debian", Tag: "12", Digest: digest.FromString("debian 12")}
+	app := types.RegistryEvent{Registry: "registry.example.com", Repository: "team/app", Tag: "v1", Digest: digest.FromString("app")}
+	rebuilt := types.RegistryEvent{Registry: "registry.example.com", Repository: "base/debian", Tag: "12", Digest: digest.FromString("debian 12.1")}
+
+	BeforeEach(func() {
+		graph := lineage.NewGraph(0)
+		graph.Record(base, nil, []digest.Digest{digest.FromString("debian")})
+		graph.Record(app, nil, []digest.Digest{digest.FromString("debian"), digest.FromString("app")})
+		graph.Record(rebuilt, nil, []digest.Digest{digest.FromString("debian 12.1")})
+
+		store := results.NewMemoryStore()
+		Expect(store.Record(context.Background(), results.Result{Event: app, Status: results.StatusScanned})).To(Succeed())
+		Expect(store.Record(context.Background(), results.Result{Event: rebuilt, Status: results.StatusScanned})).To(Succeed())
+		var err error
+		s, err = NewServer(0, eventChan, zap.New(), WithLineage(graph), WithResults(store))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	It("should serve the lineage of a digest", func() {
+		rec := get("/lineage/" + base.Digest.String())
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var node lineage.Node
+		Expect(json.Unmarshal(rec.Body.Bytes(), &node)).To(Succeed())
+		Expect(node.Children).To(ConsistOf(app.Digest))
+
+		Expect(get("/lineage/latest").Code).To(Equal(http.StatusBadRequest))
+		Expect(get("/lineage/" + digest.FromString("unknown").String()).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should list the outdated images", func() {
+		rec := get("/lineage/outdated?base=" + base.Digest.String())
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var nodes []lineage.Node
+		Expect(json.Unmarshal(rec.Body.Bytes(), &nodes)).To(Succeed())
+		Expect(nodes).To(ConsistOf(And(HaveField("Digest", app.Digest), HaveField("Outdated.Current", rebuilt.Digest))))
+
+		Expect(get("/lineage/outdated?base=" + rebuilt.Digest.String()).Body.String()).To(MatchJSON(`[]`))
+	})
+
+	It("should mark the results of outdated images", func() {
+		var list []struct {
+			Event    types.RegistryEvent
+			Outdated *lineage.Outdated
+		}
+		Expect(json.Unmarshal(get("/results?outdated=true").Body.Bytes(), &list)).To(Succeed())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Event.Digest).To(Equal(app.Digest))
+		Expect(list[0].Outdated.Digest).To(Equal(base.Digest))
+
+		Expect(json.Unmarshal(get("/results?outdated=false").Body.Bytes(), &list)).To(Succeed())
+		Expect(list).To(ConsistOf(HaveField("Event.Digest", rebuilt.Digest)))
+
+		Expect(get("/results?outdated=yes").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should serve tenants only the lineage of their own images", func() {
+		graph := lineage.NewGraph(0)
+		teamA := types.RegistryEvent{Registry: "registry.example.com", Repository: "team-a/app", Tag: "v1", Digest: digest.FromString("a"), Tenant: "team-a"}
+		teamB := types.RegistryEvent{Registry: "registry.example.com", Repository: "team-b/app", Tag: "v1", Digest: digest.FromString("b"), Tenant: "team-b"}
+		graph.Record(base, nil, []digest.Digest{digest.FromString("debian")})
+		graph.Record(teamA, nil, []digest.Digest{digest.FromString("debian"), digest.FromString("a")})
+		graph.Record(teamB, nil, []digest.Digest{digest.FromString("debian"), digest.FromString("b")})
+		graph.Record(rebuilt, nil, []digest.Digest{digest.FromString("debian 12.1")})
+		s, err := NewServer(0, eventChan, zap.New(), append(tenantOptions(), WithLineage(graph))...)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getAs(s, "/lineage/outdated", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(getAs(s, "/lineage/"+base.Digest.String(), "t0ken-a").Code).To(Equal(http.StatusNotFound))
+		Expect(getAs(s, "/lineage/"+teamB.Digest.String(), "t0ken-a").Code).To(Equal(http.StatusNotFound))
+		Expect(getAs(s, "/lineage/"+teamA.Digest.String(), "t0ken-a").Code).To(Equal(http.StatusOK))
+
+		var nodes []lineage.Node
+		Expect(json.Unmarshal(getAs(s, "/lineage/outdated", "t0ken-a").Body.Bytes(), &nodes)).To(Succeed())
+		Expect(nodes).To(ConsistOf(HaveField("Digest", teamA.Digest)))
+		var node lineage.Node
+		Expect(json.Unmarshal(getAs(s, "/lineage/"+base.Digest.String(), "adm1n").Body.Bytes(), &node)).To(Succeed())
+		Expect(node.Children).To(ConsistOf(teamA.Digest, teamB.Digest))
+	})
+
+	It("should hide the base from tenants that didn't push it", func() {
+		graph := lineage.NewGraph(0)
+		baseB := types.RegistryEvent{Registry: "registry.example.com", Repository: "team-b/base", Tag: "1", Digest: digest.FromString("base 1"), Tenant: "team-b"}
+		rebuiltB := baseB
+		rebuiltB.Digest = digest.FromString("base 1.1")
+		teamA := types.RegistryEvent{Registry: "registry.example.com", Repository: "team-a/app", Tag: "v1", Digest: digest.FromString("a"), Tenant: "team-a"}
+		teamB := types.RegistryEvent{Registry: "registry.example.com", Repository: "team-b/app", Tag: "v1", Digest: digest.FromString("b"), Tenant: "team-b"}
+		graph.Record(baseB, nil, []digest.Digest{digest.FromString("base")})
+		graph.Record(teamA, map[string]string{
+			imagev1.AnnotationBaseImageName:   "registry.example.com/team-b/base:1",
+			imagev1.AnnotationBaseImageDigest: baseB.Digest.String(),
+		}, nil)
+		graph.Record(teamB, nil, []digest.Digest{digest.FromString("base"), digest.FromString("b")})
+		graph.Record(rebuiltB, nil, []digest.Digest{digest.FromString("base 1.1")})
+		s, err := NewServer(0, eventChan, zap.New(), append(tenantOptions(), WithLineage(graph))...)
+		Expect(err).NotTo(HaveOccurred())
+
+		var node lineage.Node
+		Expect(json.Unmarshal(getAs(s, "/lineage/"+teamA.Digest.String(), "t0ken-a").Body.Bytes(), &node)).To(Succeed())
+		Expect(node.Base).To(Equal(&lineage.Base{Digest: baseB.Digest, Source: lineage.SourceAnnotation}))
+		Expect(node.Outdated).To(And(HaveField("Base", ""), HaveField("Digest", baseB.Digest), HaveField("Current", digest.Digest(""))))
+
+		var nodes []lineage.Node
+		Expect(json.Unmarshal(getAs(s, "/lineage/outdated", "t0ken-a").Body.Bytes(), &nodes)).To(Succeed())
+		Expect(nodes).To(ConsistOf(And(HaveField("Digest", teamA.Digest), HaveField("Outdated.Base", ""), HaveField("Outdated.Current", digest.Digest("")))))
+
+		// the tenant that pushed the base sees it
+		Expect(json.Unmarshal(getAs(s, "/lineage/outdated", "t0ken-b").Body.Bytes(), &nodes)).To(Succeed())
+		Expect(nodes).To(ConsistOf(And(
+			HaveField("Digest", teamB.Digest),
+			HaveField("Outdated.Base", "registry.example.com/team-b/base:1"),
+			HaveField("Outdated.Current", rebuiltB.Digest),
+		)))
+	})
+})
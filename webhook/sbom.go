@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+)
+
+// WithSBOMs serves the SBOMs of scanned images at GET /sbom/{digest}.
+func WithSBOMs(store sbom.Store) Option {
+	return func(s *Server) {
+		s.sboms = store
+	}
+}
+
+// handleSBOM responds with the SBOM of a digest in the format of the query parameter format.
+// Without it, the first stored format of scanner.SBOMFormats is served.
+func (s *Server) handleSBOM() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d, err := digest.Parse(r.PathValue("digest"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "invalid digest: %s", err)
+			return
+		}
+		if ok, err := s.ownsDigest(r, d); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "error listing results: %s", err)
+			return
+		} else if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "no SBOM of %s", d)
+			return
+		}
+		format := scanner.SBOMFormat(r.URL.Query().Get("format"))
+		if format == "" {
+			formats, err := s.sboms.Formats(r.Context(), d)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "error listing SBOMs: %s", err)
+				return
+			}
+			if len(formats) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprintf(w, "no SBOM of %s", d)
+				return
+			}
+			format = formats[0]
+		} else if !slices.Contains(scanner.SBOMFormats, format) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "unknown format %q", format)
+			return
+		}
+
+		doc, err := s.sboms.Get(r.Context(), d, format)
+		if errors.Is(err, sbom.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "no %s SBOM of %s", format, d)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "error reading SBOM: %s", err)
+			return
+		}
+		w.Header().Set("Content-Type", format.MediaType())
+		_, _ = w.Write(doc)
+	}
+}
+
+// ownsDigest reports whether the caller of r may read about d. Tenants may only read about the digests of their
+// own events, which are looked up in the results.
+func (s *Server) ownsDigest(r *http.Request, d digest.Digest) (bool, error) {
+	tenant := callerTenant(r)
+	if tenant == "" {
+		return true, nil
+	}
+	if s.results == nil {
+		return false, nil
+	}
+	list, err := s.results.List(r.Context(), results.Filter{Digest: d.String(), Tenant: tenant})
+	return len(list) > 0, err
+}
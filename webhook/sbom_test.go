@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
+	"github.com/stackitcloud/registry-snyk-scan/scanner"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("SBOMs", func() {
+	const imageDigest = "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f"
+	var (
+		s     *Server
+		store *sbom.MemoryStore
+	)
+
+	BeforeEach(func() {
+		store = sbom.NewMemoryStore(0)
+		Expect(store.Put(context.Background(), imageDigest, scanner.SBOMSPDX, []byte(`{"spdxVersion":"SPDX-2.3"}`))).To(Succeed())
+		var err error
+		s, err = NewServer(0, eventChan, zap.New(), WithSBOMs(store))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	It("should serve the stored format", func() {
+		rec := get("/sbom/" + imageDigest)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(Equal("application/spdx+json"))
+		Expect(rec.Body.String()).To(MatchJSON(`{"spdxVersion":"SPDX-2.3"}`))
+	})
+
+	It("should respond with not found for missing SBOMs", func() {
+		Expect(get("/sbom/" + imageDigest + "?format=cyclonedx").Code).To(Equal(http.StatusNotFound))
+		Expect(get("/sbom/sha256:2a2a3c1a1e1b6e3e1a2b0b4e7a4a7e9d0c5f1b0e2d6a9c8b7f4e3d2c1b0a9f8e").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should reject invalid digests and formats", func() {
+		Expect(get("/sbom/latest").Code).To(Equal(http.StatusBadRequest))
+		Expect(get("/sbom/" + imageDigest + "?format=xml").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should serve tenants only the SBOMs of their own images", func(ctx SpecContext) {
+		resultStore := results.NewMemoryStore()
+		event := types.RegistryEvent{Registry: "my-registry", Repository: "team-a/app", Digest: imageDigest, Tenant: "team-a"}
+		Expect(resultStore.Record(ctx, results.Result{Event: event, Status: results.StatusScheduled})).To(Succeed())
+		s, err := NewServer(0, eventChan, zap.New(), append(tenantOptions(), WithSBOMs(store), WithResults(resultStore))...)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getAs(s, "/sbom/"+imageDigest, "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(getAs(s, "/sbom/"+imageDigest, "t0ken-b").Code).To(Equal(http.StatusNotFound))
+		Expect(getAs(s, "/sbom/"+imageDigest, "t0ken-a").Code).To(Equal(http.StatusOK))
+		Expect(getAs(s, "/sbom/"+imageDigest, "adm1n").Code).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+)
+
+// Tenant is a sender of notifications with its own endpoint POST /event/{tenant}.
+type Tenant struct {
+	// TokenFile contains the bearer token the registries of the tenant send in the Authorization header.
+	// It is read on every request, so it can be mounted from a Secret and rotated without a restart.
+	TokenFile string `json:"tokenFile,omitempty"`
+	// Filters replace the filters of the server for the events of the tenant, if set.
+	Filters *Filters `json:"filters,omitempty"`
+}
+
+// WithTenants serves POST /event/{tenant} for each tenant. Events received there carry the tenant name.
+func WithTenants(tenants map[string]Tenant) Option {
+	return func(s *Server) {
+		s.tenants = tenants
+	}
+}
+
+// WithToken requires the bearer token in tokenFile for POST /event. Like the token files of tenants,
+// it is read on every request.
+func WithToken(tokenFile string) Option {
+	return func(s *Server) {
+		s.tokenFile = tokenFile
+	}
+}
+
+// authenticate checks the bearer token of r against the token in tokenFile.
+func authenticate(r *http.Request, tokenFile string) error {
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return fmt.Errorf("reading token file: %w", err)
+	}
+	want := strings.TrimSpace(string(data))
+	if want == "" {
+		return fmt.Errorf("token file %s is empty", tokenFile)
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		return errUnauthorized
+	}
+	return nil
+}
+
+var errUnauthorized = errors.New("missing or invalid bearer token")
+
+// unauthorized responds with 401 after authentication failed with err.
+func (s *Server) unauthorized(w http.ResponseWriter, err error, keysAndValues ...any) {
+	if !errors.Is(err, errUnauthorized) {
+		s.logger.Error(err, "authenticating request", keysAndValues...)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprint(w, errUnauthorized)
+}
+
+// caller authenticates a request to the endpoints serving results and the like. The token of the server grants
+// access to everything and returns an empty tenant, the token of a tenant grants access to its own images only.
+// Without any token configured, the endpoints are open.
+func (s *Server) caller(r *http.Request) (string, error) {
+	if s.tokenFile == "" && len(s.tenants) == 0 {
+		return "", nil
+	}
+	var errs []error
+	if s.tokenFile != "" {
+		err := authenticate(r, s.tokenFile)
+		if err == nil {
+			return "", nil
+		}
+		errs = append(errs, err)
+	}
+	for name, t := range s.tenants {
+		err := authenticate(r, t.TokenFile)
+		if err == nil {
+			return name, nil
+		}
+		errs = append(errs, err)
+	}
+	// a token file that can't be read is worth logging even if the token was wrong anyway
+	for _, err := range errs {
+		if !errors.Is(err, errUnauthorized) {
+			return "", err
+		}
+	}
+	return "", errUnauthorized
+}
+
+type callerKey struct{}
+
+// authorize passes authenticated requests on to h, with the tenant of the caller in their context.
+func (s *Server) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := s.caller(r)
+		if err != nil {
+			s.unauthorized(w, err, "path", r.URL.Path)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, tenant)))
+	})
+}
+
+// callerTenant returns the tenant authorize found for r, empty for callers with access to all tenants.
+func callerTenant(r *http.Request) string {
+	tenant, _ := r.Context().Value(callerKey{}).(string)
+	return tenant
+}
+
+// tenantImages returns the images of tenant, all images if tenant is empty.
+func tenantImages(tenant string, images []inventory.Image) []inventory.Image {
+	if tenant == "" {
+		return images
+	}
+	var own []inventory.Image
+	for _, img := range images {
+		if img.Tenant == tenant {
+			own = append(own, img)
+		}
+	}
+	return own
+}
+
+// tenantFilters returns the filters for the events of tenant, which is empty for POST /event.
+func (s *Server) tenantFilters(tenant string) Filters {
+	if t, ok := s.tenants[tenant]; ok && t.Filters != nil {
+		return *t.Filters
+	}
+	return *s.filters.Load()
+}
+
+// handleTenantNotification authenticates the tenant before processing the notification.
+func (s *Server) handleTenantNotification() http.HandlerFunc {
+	process := s.handleRegistryNotification()
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("tenant")
+		t, ok := s.tenants[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "unknown tenant %q", name)
+			return
+		}
+		if err := authenticate(r, t.TokenFile); err != nil {
+			s.unauthorized(w, err, "tenant", name)
+			return
+		}
+		process(w, r)
+	}
+}
+
+// handleNotification authenticates the request with the token of the server, if any, before processing the
+// notification.
+func (s *Server) handleNotification() http.HandlerFunc {
+	process := s.handleRegistryNotification()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.tokenFile != "" {
+			if err := authenticate(r, s.tokenFile); err != nil {
+				s.unauthorized(w, err)
+				return
+			}
+		}
+		process(w, r)
+	}
+}
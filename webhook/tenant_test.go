@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/types"
+	runtime_event "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+// tokenFile writes token to a temporary file and returns its path.
+func tokenFile(token string) string {
+	path := filepath.Join(GinkgoT().TempDir(), "token")
+	Expect(os.WriteFile(path, []byte(token), 0o600)).To(Succeed())
+	return path
+}
+
+// tenantOptions configures the token adm1n for the server and t0ken-a and t0ken-b for the tenants team-a and team-b.
+func tenantOptions() []Option {
+	return []Option{WithToken(tokenFile("adm1n")), WithTenants(map[string]Tenant{
+		"team-a": {TokenFile: tokenFile("t0ken-a")},
+		"team-b": {TokenFile: tokenFile("t0ken-b")},
+	})}
+}
+
+// getAs serves a GET request to path with the bearer token.
+func getAs(s *Server, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+var _ = Describe("Tenants", func() {
+	BeforeEach(func() {
+		tokenFile := filepath.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600)).To(Succeed())
+		adminTokenFile := filepath.Join(GinkgoT().TempDir(), "admin-token")
+		Expect(os.WriteFile(adminTokenFile, []byte("adm1n"), 0o600)).To(Succeed())
+
+		s, err := NewServer(8084, eventChan, zap.New(), WithTenants(map[string]Tenant{
+			"team-a": {TokenFile: tokenFile},
+			"team-b": {
+				TokenFile: tokenFile,
+				Filters:   &Filters{IncludeRepositories: []string{"*/team-b/*"}},
+			},
+		}), WithToken(adminTokenFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			_ = s.ListenAndServe(ctx)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			<-done
+		})
+		Eventually(func() error { return s.Healthz(nil) }, 5*time.Second).Should(Succeed())
+	})
+
+	post := func(tenant, token string) int {
+		body, err := json.Marshal(notifications.Envelope{Events: []notifications.Event{{
+			Action: notifications.EventActionPush,
+			Target: target{
+				Descriptor: distribution.Descriptor{
+					MediaType: schema2.MediaTypeManifest,
+					Digest:    "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+				},
+				Repository: "team-a/app",
+				URL:        "https://registry.example.com/v2/team-a/app/manifests/latest",
+				Tag:        "latest",
+			},
+		}}})
+		Expect(err).NotTo(HaveOccurred())
+		url := "http://localhost:8084/event"
+		if tenant != "" {
+			url += "/" + tenant
+		}
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(string(body)))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	It("should pass on events with the tenant", func() {
+		Expect(post("team-a", "s3cret")).To(Equal(http.StatusOK))
+		Eventually(eventChan, 5*time.Second).Should(Receive(WithTransform(func(e runtime_event.TypedGenericEvent[types.RegistryEvent]) string {
+			return e.Object.Tenant
+		}, Equal("team-a"))))
+	})
+
+	It("should reject missing or wrong tokens", func() {
+		Expect(post("team-a", "")).To(Equal(http.StatusUnauthorized))
+		Expect(post("team-a", "guess")).To(Equal(http.StatusUnauthorized))
+		Consistently(eventChan).ShouldNot(Receive())
+	})
+
+	It("should require the token of the server without a tenant", func() {
+		Expect(post("", "")).To(Equal(http.StatusUnauthorized))
+		Expect(post("", "s3cret")).To(Equal(http.StatusUnauthorized))
+		Consistently(eventChan).ShouldNot(Receive())
+
+		Expect(post("", "adm1n")).To(Equal(http.StatusOK))
+		Eventually(eventChan, 5*time.Second).Should(Receive(WithTransform(func(e runtime_event.TypedGenericEvent[types.RegistryEvent]) string {
+			return e.Object.Tenant
+		}, BeEmpty())))
+	})
+
+	It("should reject unknown tenants", func() {
+		Expect(post("team-c", "s3cret")).To(Equal(http.StatusNotFound))
+	})
+
+	It("should apply the filters of the tenant", func() {
+		Expect(post("team-b", "s3cret")).To(Equal(http.StatusOK))
+		Consistently(eventChan).ShouldNot(Receive())
+	})
+})
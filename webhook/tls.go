@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+)
+
+// TLSOptions configures TLS serving of the webhook.
+type TLSOptions struct {
+	// CertFile and KeyFile are reloaded when they change on disk, e.g. when a mounted secret is rotated.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ClientCAFile enables mutual TLS: clients must present a certificate signed by one of its CAs.
+	// It is reloaded when it changes on disk.
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+// WithTLS serves the webhook over TLS.
+func WithTLS(opts TLSOptions) Option {
+	return func(s *Server) {
+		s.tlsOptions = &opts
+	}
+}
+
+// setupTLS creates the certificate watchers and the tls.Config of the server.
+func (s *Server) setupTLS() error {
+	watcher, err := certwatcher.New(s.tlsOptions.CertFile, s.tlsOptions.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading serving certificate: %w", err)
+	}
+	s.certWatcher = watcher
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: watcher.GetCertificate,
+	}
+
+	if s.tlsOptions.ClientCAFile != "" {
+		clientCAs := &clientCAReloader{path: s.tlsOptions.ClientCAFile}
+		if _, err := clientCAs.pool(); err != nil {
+			return err
+		}
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			pool, err := clientCAs.pool()
+			if err != nil {
+				s.logger.Error(err, "reloading client CAs, using previous ones")
+			}
+			c := cfg.Clone()
+			c.GetConfigForClient = nil
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+			c.ClientCAs = pool
+			return c, nil
+		}
+	}
+
+	s.tlsConfig = cfg
+	return nil
+}
+
+// clientCAReloader reads the client CA bundle again whenever the file was modified.
+type clientCAReloader struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	certs   *x509.CertPool
+}
+
+// pool returns the current CA pool. If reloading fails, the previous pool is returned with the error.
+func (r *clientCAReloader) pool() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return r.certs, fmt.Errorf("reading client CA file: %w", err)
+	}
+	if r.certs != nil && info.ModTime().Equal(r.modTime) {
+		return r.certs, nil
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return r.certs, fmt.Errorf("reading client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return r.certs, fmt.Errorf("client CA file %s contains no certificates", r.path)
+	}
+	r.certs = pool
+	r.modTime = info.ModTime()
+	return r.certs, nil
+}
@@ -1,20 +1,31 @@
 package webhook
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
-	"slices"
+	"sync/atomic"
 	"time"
 
-	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/notifications"
 	"github.com/go-logr/logr"
-	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stackitcloud/registry-snyk-scan/ha"
+	"github.com/stackitcloud/registry-snyk-scan/inventory"
+	"github.com/stackitcloud/registry-snyk-scan/lineage"
+	"github.com/stackitcloud/registry-snyk-scan/metrics"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
+	"github.com/stackitcloud/registry-snyk-scan/sbom"
 	"github.com/stackitcloud/registry-snyk-scan/types"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
@@ -22,9 +33,110 @@ type Server struct {
 	httpServer *http.Server
 	eventChan  chan<- event.TypedGenericEvent[types.RegistryEvent]
 	logger     logr.Logger
+	rewriter   atomic.Pointer[registry.Rewriter]
+	filters    atomic.Pointer[Filters]
+	results    results.Store
+	dead       *results.DeadLetters
+	sboms      sbom.Store
+	inventory  *inventory.Index
+	lineage    *lineage.Graph
+
+	forwarder     Forwarder
+	router        Router
+	forwardSecret string
+	tenants       map[string]Tenant
+	tokenFile     string
+
+	tlsOptions  *TLSOptions
+	tlsConfig   *tls.Config
+	certWatcher *certwatcher.CertWatcher
+
+	listening atomic.Bool
+}
+
+// Option configures optional behaviour of the Server.
+type Option func(*Server)
+
+// WithHostRewriter rewrites the registry host of received events before they are passed on.
+func WithHostRewriter(r *registry.Rewriter) Option {
+	return func(s *Server) {
+		s.rewriter.Store(r)
+	}
 }
 
-func NewServer(port int, eventChan chan<- event.TypedGenericEvent[types.RegistryEvent], logger logr.Logger) (*Server, error) {
+// SetHostRewriter replaces the host rewriter for notifications received from now on.
+func (s *Server) SetHostRewriter(r *registry.Rewriter) {
+	s.rewriter.Store(r)
+}
+
+// WithFilters passes on only the events matching f. Without it, pushes of image manifests are passed on.
+func WithFilters(f Filters) Option {
+	return func(s *Server) {
+		s.filters.Store(&f)
+	}
+}
+
+// SetFilters replaces the filters for notifications received from now on.
+func (s *Server) SetFilters(f Filters) {
+	s.filters.Store(&f)
+}
+
+// WithResults serves the results of processed events at GET /results.
+func WithResults(store results.Store) Option {
+	return func(s *Server) {
+		s.results = store
+	}
+}
+
+// Forwarder passes requests on to the replica that processes events.
+type Forwarder interface {
+	// IsLeader reports whether this replica processes events itself.
+	IsLeader() bool
+	// Forward sends a request to path on the leader and returns the status code, content type and body of its response.
+	Forward(ctx context.Context, method, path string, header http.Header, body []byte) (int, string, []byte, error)
+}
+
+// WithForwarder forwards notifications to the leader while this replica is not the leader.
+// The results, dead letters, SBOMs, inventory and lineage are kept by the leader, so their requests are
+// forwarded as well.
+func WithForwarder(f Forwarder) Option {
+	return func(s *Server) {
+		s.forwarder = f
+	}
+}
+
+// WithForwardSecret accepts requests forwarded by other replicas only if they carry secret,
+// which all replicas share. Without it, requests are never treated as forwarded.
+func WithForwardSecret(secret string) Option {
+	return func(s *Server) {
+		s.forwardSecret = secret
+	}
+}
+
+// Router assigns events to the shard that processes them.
+type Router interface {
+	// Route returns the shard responsible for e and whether that is this replica.
+	Route(e types.RegistryEvent) (shard string, local bool)
+	// ForwardTo posts body to path on the given shard and returns the status code and body of its response.
+	ForwardTo(ctx context.Context, shard, path string, header http.Header, body []byte) (int, []byte, error)
+}
+
+// WithRouter passes events on to the controller only if this replica is responsible for them,
+// all other events are forwarded to their shard.
+func WithRouter(r Router) Option {
+	return func(s *Server) {
+		s.router = r
+	}
+}
+
+// WithDeadLetters serves the dead letters at GET /deadletters and replays them with POST /deadletters/replay.
+func WithDeadLetters(d *results.DeadLetters) Option {
+	return func(s *Server) {
+		s.dead = d
+	}
+}
+
+func NewServer(port int, eventChan chan<- event.TypedGenericEvent[types.RegistryEvent], logger logr.Logger, opts ...Option) (*Server, error) {
 	mux := http.NewServeMux()
 	addr := fmt.Sprintf("0.0.0.0:%d", port)
 	httpServer := &http.Server{
@@ -36,14 +148,56 @@ func NewServer(port int, eventChan chan<- event.TypedGenericEvent[types.Registry
 		logger:     logger,
 		eventChan:  eventChan,
 	}
-	mux.Handle("POST /event", s.handleRegistryNotification())
+	s.filters.Store(&Filters{})
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.tlsOptions != nil {
+		if err := s.setupTLS(); err != nil {
+			return nil, err
+		}
+	}
+	mux.Handle("POST /event", s.handleNotification())
+	if len(s.tenants) > 0 {
+		mux.Handle("POST /event/{tenant}", s.handleTenantNotification())
+	}
+	if s.results != nil {
+		mux.Handle("GET /results", s.authorize(s.onLeader(s.handleResults())))
+	}
+	if s.sboms != nil {
+		mux.Handle("GET /sbom/{digest}", s.authorize(s.onLeader(s.handleSBOM())))
+	}
+	if s.inventory != nil {
+		mux.Handle("GET /inventory", s.authorize(s.onLeader(s.handleInventory())))
+	}
+	if s.lineage != nil {
+		mux.Handle("GET /lineage/outdated", s.authorize(s.onLeader(s.handleOutdated())))
+		mux.Handle("GET /lineage/{digest}", s.authorize(s.onLeader(s.handleLineage())))
+	}
+	if s.dead != nil {
+		mux.Handle("GET /deadletters", s.authorize(s.onLeader(s.handleDeadLetters())))
+		mux.Handle("POST /deadletters/replay", s.authorize(s.onLeader(s.handleReplayDeadLetters())))
+	}
 	return s, nil
 }
 
 func (s *Server) ListenAndServe(ctx context.Context) error {
+	l, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+
 	g, gCtx := errgroup.WithContext(ctx)
+	if s.tlsConfig != nil {
+		l = tls.NewListener(l, s.tlsConfig)
+		g.Go(func() error {
+			return s.certWatcher.Start(gCtx)
+		})
+	}
 	g.Go(func() error {
-		return s.httpServer.ListenAndServe()
+		return s.httpServer.Serve(l)
 	})
 	g.Go(func() error {
 		<-gCtx.Done()
@@ -54,45 +208,254 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 	return g.Wait()
 }
 
+// Healthz fails if the server is not accepting connections.
+func (s *Server) Healthz(_ *http.Request) error {
+	if !s.listening.Load() {
+		return errors.New("webhook server is not listening")
+	}
+	return nil
+}
+
+// Readyz fails if the server is not accepting connections or the event queue to the controller is full,
+// in which case received notifications would block until the controller catches up.
+func (s *Server) Readyz(req *http.Request) error {
+	if err := s.Healthz(req); err != nil {
+		return err
+	}
+	if c := cap(s.eventChan); c > 0 && len(s.eventChan) >= c {
+		return fmt.Errorf("event queue is saturated with %d events", len(s.eventChan))
+	}
+	return nil
+}
+
 func (s *Server) handleRegistryNotification() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "error reading request body: %s", err)
+			return
+		}
+
+		if s.forwarder != nil && !s.forwarder.IsLeader() {
+			s.forward(w, r, body)
+			return
+		}
+
 		var envelope notifications.Envelope
-		if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			metrics.ReceivedEnvelope(0, err)
 			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprintf(w, "error decoding request body: %s", err)
 			return
 		}
-		s.processEnvelope(envelope)
+		metrics.ReceivedEnvelope(len(envelope.Events), nil)
+		rejected := s.processEnvelope(r, envelope)
+		if len(rejected) > 0 {
+			// the registry would send the envelope again on errors, which would enqueue its valid events twice
+			status := http.StatusOK
+			if len(rejected) == len(envelope.Events) {
+				status = http.StatusBadRequest
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(rejectedEventsResponse{Rejected: rejected})
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-func (s *Server) processEnvelope(envelope notifications.Envelope) {
-	for _, e := range filterEvents(envelope.Events) {
-		registryEvent := types.RegistryEventFromNotificationsEvent(&e)
-		s.logger.V(int(zap.DebugLevel)).Info("recieved event from registry", "notifications.Event", e, "registryEvent", registryEvent)
-		s.eventChan <- event.TypedGenericEvent[types.RegistryEvent]{
-			Object: registryEvent,
+// filterFromQuery returns the filter of the query parameters. Tenants only get their own entries.
+func filterFromQuery(r *http.Request) results.Filter {
+	query := r.URL.Query()
+	return results.Filter{
+		Registry:   query.Get("registry"),
+		Repository: query.Get("repository"),
+		Digest:     query.Get("digest"),
+		Tenant:     cmp.Or(callerTenant(r), query.Get("tenant")),
+		Verdict:    results.Verdict(query.Get("verdict")),
+		Advisory:   query.Get("advisory"),
+	}
+}
+
+func (s *Server) handleResults() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := s.results.List(r.Context(), filterFromQuery(r))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "error listing results: %s", err)
+			return
+		}
+		if s.lineage != nil {
+			marked, err := s.withLineage(r, list)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(marked)
+			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
 	}
 }
 
-var knownManifestMediaTypes = []string{
-	schema2.MediaTypeManifest,
-	imagev1.MediaTypeImageManifest,
+func (s *Server) handleDeadLetters() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.dead.List(filterFromQuery(r)))
+	}
 }
 
-func filterEvents(events []notifications.Event) []notifications.Event {
-	// filter out all events that are not push actions
-	events = slices.DeleteFunc(events, func(e notifications.Event) bool {
-		return e.Action != notifications.EventActionPush
-	})
+// handleReplayDeadLetters enqueues the matching dead letters again and responds with the replayed ones.
+func (s *Server) handleReplayDeadLetters() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		replayed := s.dead.Take(filterFromQuery(r))
+		for _, l := range replayed {
+			s.logger.Info("replaying dead letter", "registryEvent", l.Event)
+			s.eventChan <- event.TypedGenericEvent[types.RegistryEvent]{
+				Object: l.Event,
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(replayed)
+	}
+}
 
-	// filter out non manifest mediaTypes
-	events = slices.DeleteFunc(events, func(e notifications.Event) bool {
-		return !slices.Contains(knownManifestMediaTypes, e.Target.MediaType)
+// onLeader serves requests with h on the leader and forwards them to the leader on other replicas.
+func (s *Server) onLeader(h http.Handler) http.Handler {
+	if s.forwarder == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.forwarder.IsLeader() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "error reading request body: %s", err)
+			return
+		}
+		s.forward(w, r, body)
 	})
+}
+
+// forward passes a request on to the leader. If that fails, the registry retries notifications later.
+func (s *Server) forward(w http.ResponseWriter, r *http.Request, body []byte) {
+	if ha.Forwarded(r, s.forwardSecret) {
+		// leadership changed while forwarding, let the registry retry
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "not the leader")
+		return
+	}
+	status, contentType, respBody, err := s.forwarder.Forward(r.Context(), r.Method, r.URL.RequestURI(), r.Header, body)
+	if err != nil {
+		s.logger.Error(err, "forwarding request to leader", "path", r.URL.Path)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "error forwarding to leader: %s", err)
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(respBody)
+}
+
+// rejectedEvent is an event of an envelope that failed validation.
+type rejectedEvent struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type rejectedEventsResponse struct {
+	Rejected []rejectedEvent `json:"rejected"`
+}
+
+// processEnvelope passes all valid events of envelope on to the controller or the responsible shard
+// and returns the rejected ones. Events are forwarded to their shards first and only the events of
+// shards that couldn't be reached are processed here, so no event is enqueued twice or dropped.
+func (s *Server) processEnvelope(r *http.Request, envelope notifications.Envelope) []rejectedEvent {
+	var rejected []rejectedEvent
+	var local []types.RegistryEvent
+	remote := map[string][]notifications.Event{}
+	remoteEvents := map[string][]types.RegistryEvent{}
+	tenant := r.PathValue("tenant")
+	filters, rewriter := s.tenantFilters(tenant), s.rewriter.Load()
+	for _, e := range filterEvents(filters, envelope.Events) {
+		registryEvent, err := types.RegistryEventFromNotificationsEvent(&e, rewriter.Rewrite)
+		if err != nil {
+			s.logger.Info("rejecting invalid event", "id", e.ID, "reason", err.Error())
+			rejected = append(rejected, rejectedEvent{ID: e.ID, Reason: err.Error()})
+			metrics.FilteredEvents(metrics.FilterReasonInvalid, 1)
+			continue
+		}
+		registryEvent.Tenant = tenant
+		if !filters.includesRepository(registryEvent.RepositoryPath()) {
+			metrics.FilteredEvents(metrics.FilterReasonRepository, 1)
+			continue
+		}
+		// events forwarded by another shard are processed here even if the shards disagree about the owner,
+		// so that events are never passed back and forth while the membership changes
+		if s.router != nil && !ha.Forwarded(r, s.forwardSecret) {
+			if shard, local := s.router.Route(registryEvent); !local {
+				remote[shard] = append(remote[shard], e)
+				remoteEvents[shard] = append(remoteEvents[shard], registryEvent)
+				continue
+			}
+		}
+		s.logger.V(int(zap.DebugLevel)).Info("recieved event from registry", "notifications.Event", e, "registryEvent", registryEvent)
+		local = append(local, registryEvent)
+	}
+
+	for shard, events := range remote {
+		shardRejected, err := s.forwardToShard(r, shard, events)
+		if err != nil {
+			// scan job names don't depend on the shard, so processing the events here doesn't scan them twice
+			s.logger.Error(err, "processing the events of an unavailable shard", "shard", shard, "events", len(events))
+			local = append(local, remoteEvents[shard]...)
+			continue
+		}
+		rejected = append(rejected, shardRejected...)
+	}
+	for _, registryEvent := range local {
+		s.eventChan <- event.TypedGenericEvent[types.RegistryEvent]{
+			Object: registryEvent,
+		}
+		metrics.EnqueuedEvent(registryEvent.Registry, registryEvent.Repository)
+	}
+	return rejected
+}
 
-	return events
+// forwardToShard sends events in a new envelope to shard and returns the events it rejected.
+func (s *Server) forwardToShard(r *http.Request, shard string, events []notifications.Event) ([]rejectedEvent, error) {
+	body, err := json.Marshal(notifications.Envelope{Events: events})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.V(int(zap.DebugLevel)).Info("forwarding events to shard", "shard", shard, "events", len(events))
+	status, respBody, err := s.router.ForwardTo(r.Context(), shard, r.URL.Path, r.Header, body)
+	if err != nil {
+		return nil, fmt.Errorf("forwarding to shard %s: %w", shard, err)
+	}
+	switch {
+	case status == http.StatusOK && len(respBody) == 0:
+		return nil, nil
+	case status == http.StatusOK, status == http.StatusBadRequest:
+		// the shard rejects the envelope with 400 if all of its events are invalid
+		var resp rejectedEventsResponse
+		if err := json.Unmarshal(respBody, &resp); err != nil {
+			return nil, fmt.Errorf("decoding response of shard %s: %w", shard, err)
+		}
+		return resp.Rejected, nil
+	default:
+		return nil, fmt.Errorf("shard %s responded with status %d", shard, status)
+	}
 }
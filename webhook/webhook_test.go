@@ -8,6 +8,7 @@ import (
 	imagev1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -15,6 +16,8 @@ import (
 	"github.com/docker/distribution/notifications"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/stackitcloud/registry-snyk-scan/registry"
+	"github.com/stackitcloud/registry-snyk-scan/results"
 	"github.com/stackitcloud/registry-snyk-scan/types"
 	runtime_event "sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -60,7 +63,14 @@ var _ = AfterSuite(func() {
 	cancelFunc()
 })
 
+// waitForServer waits until the server of the suite, which starts in the background, is listening.
+func waitForServer() {
+	Eventually(func() error { return server.Healthz(nil) }, 5*time.Second).Should(Succeed())
+}
+
 var _ = Describe("Webhook", func() {
+	BeforeEach(waitForServer)
+
 	It("should receive a RegistryEvent when sending a valid notifications.Envelope", func() {
 		event := notifications.Event{
 			ID:     "1234567890",
@@ -105,9 +115,110 @@ var _ = Describe("Webhook", func() {
 			Repository: "my-repo",
 			Tag:        "latest",
 			Digest:     "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+			MediaType:  schema2.MediaTypeManifest,
 		}))))
 	})
 
+	It("should rewrite the registry host of received events", func() {
+		rewriter, err := registry.NewRewriter([]registry.RewriteRule{
+			{Host: "registry.svc.cluster.local", Replacement: "registry.example.com", Port: registry.PortStrip},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		s, err := NewServer(0, eventChan, zap.New(), WithHostRewriter(rewriter))
+		Expect(err).NotTo(HaveOccurred())
+
+		rejected := s.processEnvelope(httptest.NewRequest(http.MethodPost, "/event", nil), notifications.Envelope{Events: []notifications.Event{
+			{
+				Action: notifications.EventActionPush,
+				Target: target{
+					Descriptor: distribution.Descriptor{
+						MediaType: schema2.MediaTypeManifest,
+						Digest:    "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+					},
+					Repository: "my-repo",
+					URL:        "http://registry.svc.cluster.local:5000/v2/my-repo/manifests/sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+					Tag:        "latest",
+				},
+			},
+		}})
+		Expect(rejected).To(BeEmpty())
+
+		Eventually(eventChan, 5*time.Second).Should(Receive(WithTransform(func(e runtime_event.TypedGenericEvent[types.RegistryEvent]) string {
+			return e.Object.Registry
+		}, Equal("registry.example.com"))))
+	})
+
+	It("should drop malformed events with a reason and enqueue the valid ones", func() {
+		malformed := notifications.Event{
+			ID:     "malformed",
+			Action: notifications.EventActionPush,
+			Target: target{
+				Descriptor: distribution.Descriptor{
+					MediaType: schema2.MediaTypeManifest,
+				},
+				Repository: "my-repo",
+				URL:        "https://my-registry/v2/my-repo/manifests/latest",
+				Tag:        "latest",
+			},
+		}
+		valid := notifications.Event{
+			ID:     "valid",
+			Action: notifications.EventActionPush,
+			Target: target{
+				Descriptor: distribution.Descriptor{
+					MediaType: schema2.MediaTypeManifest,
+					Digest:    "sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+				},
+				Repository: "my-repo",
+				URL:        "https://my-registry/v2/my-repo/manifests/sha256:e692418e4cbaf90ca69d05a66403747baa33ee08806650b51fab815ad7fc331f",
+				Tag:        "latest",
+			},
+		}
+		eventJSON, err := json.Marshal(notifications.Envelope{Events: []notifications.Event{malformed, valid}})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := http.Post("http://localhost:8080/event", "application/json", strings.NewReader(string(eventJSON)))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		// the registry would retry the envelope on errors, which doesn't fix malformed events
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var body rejectedEventsResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Rejected).To(HaveLen(1))
+		Expect(body.Rejected[0].ID).To(Equal("malformed"))
+		Expect(body.Rejected[0].Reason).To(ContainSubstring("digest"))
+		Eventually(eventChan, 5*time.Second).Should(Receive(HaveField("Object.Tag", "latest")))
+		Consistently(eventChan).ShouldNot(Receive())
+	})
+
+	It("should return HTTP status code 400 with a reason when all events are malformed", func() {
+		malformed := notifications.Event{
+			ID:     "malformed",
+			Action: notifications.EventActionPush,
+			Target: target{
+				Descriptor: distribution.Descriptor{
+					MediaType: schema2.MediaTypeManifest,
+				},
+				Repository: "my-repo",
+				URL:        "https://my-registry/v2/my-repo/manifests/latest",
+				Tag:        "latest",
+			},
+		}
+		eventJSON, err := json.Marshal(notifications.Envelope{Events: []notifications.Event{malformed}})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := http.Post("http://localhost:8080/event", "application/json", strings.NewReader(string(eventJSON)))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+
+		var body rejectedEventsResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body.Rejected).To(ConsistOf(HaveField("ID", "malformed")))
+		Consistently(eventChan).ShouldNot(Receive())
+	})
+
 	It("should return HTTP status code 400 when sending an invalid notifications.Envelope", func() {
 		invalidEventJSON := `invalid json`
 
@@ -124,6 +235,138 @@ var _ = Describe("Webhook", func() {
 	})
 })
 
+var _ = Describe("Results", func() {
+	var (
+		s           *Server
+		resultStore *results.MemoryStore
+	)
+
+	BeforeEach(func() {
+		resultStore = results.NewMemoryStore()
+		var err error
+		s, err = NewServer(0, eventChan, zap.New(), WithResults(resultStore))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should serve filtered results", func(ctx SpecContext) {
+		skipped := types.RegistryEvent{Registry: "my-registry", Repository: "windows-app", Tag: "latest", Digest: "sha256:aaaa"}
+		Expect(resultStore.Record(ctx, results.Result{Event: skipped, Status: results.StatusSkipped, Reason: "unsupported platform windows/amd64"})).To(Succeed())
+		Expect(resultStore.Record(ctx, results.Result{Event: types.RegistryEvent{Registry: "my-registry", Repository: "other"}, Status: results.StatusScheduled})).To(Succeed())
+
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results?repository=windows-app", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		var list []results.Result
+		Expect(json.NewDecoder(rec.Body).Decode(&list)).To(Succeed())
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Event).To(Equal(skipped))
+		Expect(list[0].Status).To(Equal(results.StatusSkipped))
+	})
+
+	It("should serve tenants only their own results", func(ctx SpecContext) {
+		s, err := NewServer(0, eventChan, zap.New(), append(tenantOptions(), WithResults(resultStore))...)
+		Expect(err).NotTo(HaveOccurred())
+		teamA := types.RegistryEvent{Registry: "my-registry", Repository: "team-a/app", Tenant: "team-a"}
+		Expect(resultStore.Record(ctx, results.Result{Event: teamA, Status: results.StatusScheduled})).To(Succeed())
+		Expect(resultStore.Record(ctx, results.Result{Event: types.RegistryEvent{Registry: "my-registry", Repository: "team-b/app", Tenant: "team-b"}, Status: results.StatusScheduled})).To(Succeed())
+
+		Expect(getAs(s, "/results", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(getAs(s, "/results", "guess").Code).To(Equal(http.StatusUnauthorized))
+
+		var list []results.Result
+		Expect(json.NewDecoder(getAs(s, "/results?tenant=team-b", "t0ken-a").Body).Decode(&list)).To(Succeed())
+		Expect(list).To(ConsistOf(HaveField("Event", teamA)))
+		Expect(json.NewDecoder(getAs(s, "/results", "adm1n").Body).Decode(&list)).To(Succeed())
+		Expect(list).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("DeadLetters", func() {
+	var (
+		s           *Server
+		deadLetters *results.DeadLetters
+	)
+
+	BeforeEach(func() {
+		deadLetters = results.NewDeadLetters()
+		var err error
+		s, err = NewServer(0, eventChan, zap.New(), WithDeadLetters(deadLetters))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should list and replay dead letters", func() {
+		failed := types.RegistryEvent{Registry: "my-registry", Repository: "flaky", Tag: "latest", Digest: "sha256:aaaa"}
+		deadLetters.Add(results.DeadLetter{Event: failed, Reason: "connection reset", Attempts: 10})
+
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/deadletters", nil))
+		var list []results.DeadLetter
+		Expect(json.NewDecoder(rec.Body).Decode(&list)).To(Succeed())
+		Expect(list).To(ConsistOf(HaveField("Event", failed)))
+
+		rec = httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/deadletters/replay?repository=flaky", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		Eventually(eventChan, 5*time.Second).Should(Receive(HaveField("Object", failed)))
+		Expect(deadLetters.List(results.Filter{})).To(BeEmpty())
+	})
+
+	It("should list and replay only the dead letters of a tenant", func() {
+		s, err := NewServer(0, eventChan, zap.New(), append(tenantOptions(), WithDeadLetters(deadLetters))...)
+		Expect(err).NotTo(HaveOccurred())
+		teamA := types.RegistryEvent{Registry: "my-registry", Repository: "team-a/app", Digest: "sha256:aaaa", Tenant: "team-a"}
+		teamB := types.RegistryEvent{Registry: "my-registry", Repository: "team-b/app", Digest: "sha256:bbbb", Tenant: "team-b"}
+		deadLetters.Add(results.DeadLetter{Event: teamA, Reason: "connection reset"})
+		deadLetters.Add(results.DeadLetter{Event: teamB, Reason: "connection reset"})
+
+		var list []results.DeadLetter
+		Expect(json.NewDecoder(getAs(s, "/deadletters", "t0ken-a").Body).Decode(&list)).To(Succeed())
+		Expect(list).To(ConsistOf(HaveField("Event", teamA)))
+
+		replay := func(token string) int {
+			req := httptest.NewRequest(http.MethodPost, "/deadletters/replay?tenant=team-b", nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			s.httpServer.Handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		Expect(replay("")).To(Equal(http.StatusUnauthorized))
+		Expect(replay("t0ken-a")).To(Equal(http.StatusOK))
+		Eventually(eventChan, 5*time.Second).Should(Receive(HaveField("Object", teamA)))
+		Expect(deadLetters.List(results.Filter{})).To(ConsistOf(HaveField("Event", teamB)))
+	})
+})
+
+var _ = Describe("Probes", func() {
+	It("should be healthy and ready while listening", func() {
+		waitForServer()
+		req, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.Healthz(req)).To(Succeed())
+		Expect(server.Readyz(req)).To(Succeed())
+	})
+
+	It("should not be healthy before listening", func() {
+		s, err := NewServer(0, eventChan, zap.New())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Healthz(nil)).NotTo(Succeed())
+	})
+
+	It("should not be ready while the event queue is saturated", func() {
+		full := make(chan runtime_event.TypedGenericEvent[types.RegistryEvent], 1)
+		full <- runtime_event.TypedGenericEvent[types.RegistryEvent]{}
+		s, err := NewServer(0, full, zap.New())
+		Expect(err).NotTo(HaveOccurred())
+		s.listening.Store(true)
+		Expect(s.Healthz(nil)).To(Succeed())
+		Expect(s.Readyz(nil)).To(MatchError(ContainSubstring("saturated")))
+	})
+})
+
 var _ = Describe("FilterEvents", func() {
 	It("should filter out non-push events and non-manifest media types", func() {
 		events := []notifications.Event{
@@ -153,7 +396,7 @@ var _ = Describe("FilterEvents", func() {
 			},
 		}
 
-		filteredEvents := filterEvents(events)
+		filteredEvents := filterEvents(Filters{}, events)
 
 		Expect(len(filteredEvents)).To(Equal(1))
 		Expect(filteredEvents[0].Action).To(Equal(notifications.EventActionPush))